@@ -2,16 +2,21 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	goflag "flag"
 	"github.com/pkg/errors"
 	flag "github.com/spf13/pflag"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
+	aaq_evaluator "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-evaluator"
+	built_in_usage_calculators "kubevirt.io/application-aware-quota/pkg/aaq-controller/built-in-usage-calculators"
 	"kubevirt.io/application-aware-quota/pkg/aaq-server"
 	"kubevirt.io/application-aware-quota/pkg/certificates/bootstrap"
 	"kubevirt.io/application-aware-quota/pkg/client"
 	"kubevirt.io/application-aware-quota/pkg/informers"
+	"kubevirt.io/application-aware-quota/pkg/tracing"
 	"kubevirt.io/application-aware-quota/pkg/util"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
 	"os"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
 )
@@ -19,6 +24,19 @@ import (
 func main() {
 	flag.CommandLine.AddGoFlag(goflag.CommandLine.Lookup("v"))
 	isOnOpenshift := flag.Bool(util.IsOnOpenshift, false, "flag that suggest that we are on Openshift cluster")
+	launcherConfig := flag.String(util.VMICalculatorConfiguration, "", "flag that to let us know how to allocate resource for virtual machines")
+	tracingEndpoint := flag.String(util.TracingEndpointFlag, "", "OTLP gRPC collector the traces are exported to, tracing is disabled when empty")
+	tracingInsecure := flag.Bool(util.TracingInsecureFlag, false, "flag that to let us know if TLS should be disabled towards the tracing collector")
+	celCalculators := flag.String(util.CELCalculatorsFlag, "", "JSON list of the usage calculators declared with CEL expressions")
+	wasmCalculators := flag.String(util.WasmCalculatorsFlag, "", "JSON list of the usage calculators compiled to WebAssembly")
+	calculatorPolicies := flag.String(util.CalculatorPoliciesFlag, "", "JSON list of the policies applied on the usage calculators, their defaults apply when empty")
+	calculatorComposition := flag.String(util.CalculatorCompositionFlag, string(v1alpha1.SumComposition), "how the usages of the calculators matching the same pod are combined: Sum, FirstMatch or Max")
+	usageCacheTTL := flag.Duration(util.UsageCacheTTLFlag, util.DefaultUsageCacheTTL, "how long the usage calculators computed for a pod is reused, zero disables the cache")
+	usageCacheMaxEntries := flag.Int(util.UsageCacheMaxEntriesFlag, util.DefaultUsageCacheMaxEntries, "maximum number of usages the usage cache holds")
+	stripPodFields := flag.Bool(util.StripPodFieldsFlag, false, "flag that to let us know if the pod fields no calculator requires should be dropped from the pods cached for dry runs")
+	calculatorPodFields := flag.StringSlice(util.CalculatorPodFieldsFlag, nil, "pod fields the CEL and wasm calculators require")
+	clusterQuotaEnabled := flag.Bool(util.EnableClusterQuota, false, "flag that to let us know if dry runs should check the cluster quotas")
+	controllerCalculators := flag.StringSlice(util.ControllerCalculatorsFlag, nil, "comma separated names of the calculators that only run alongside the controller, dry runs report them as unevaluated")
 	flag.Parse()
 	defer klog.Flush()
 	aaqNS := util.GetNamespace()
@@ -33,6 +51,13 @@ func main() {
 	defer cancel()
 	stop := ctx.Done()
 
+	shutdownTracing, err := tracing.Setup(ctx, util.AaqServerPodName, v1alpha1.TracingConfiguration{Endpoint: *tracingEndpoint, Insecure: *tracingInsecure})
+	if err != nil {
+		klog.Error(err.Error())
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+
 	secretInformer := informers.GetSecretInformer(aaqCli, aaqNS)
 	go secretInformer.Run(stop)
 	if !cache.WaitForCacheSync(stop, secretInformer.HasSynced) {
@@ -50,12 +75,84 @@ func main() {
 	secretCertManager.Start()
 	defer secretCertManager.Stop()
 
+	// sidecar and remote evaluators only run alongside the controller, dry runs use the in-process calculators
+	// and report the others as unevaluated
+	evaluatorsRegistry := aaq_evaluator.GetAaqEvaluatorsRegistry()
+	if *calculatorPolicies != "" {
+		var policies []v1alpha1.CalculatorPolicy
+		if err := json.Unmarshal([]byte(*calculatorPolicies), &policies); err != nil {
+			klog.Fatalf("unable to parse the calculator policies: %v", err)
+		}
+		if err := evaluatorsRegistry.SetCalculatorPolicies(policies); err != nil {
+			klog.Fatalf("unable to set the calculator policies: %v", err)
+		}
+	}
+	if err := evaluatorsRegistry.SetCompositionStrategy(v1alpha1.CalculatorCompositionStrategy(*calculatorComposition)); err != nil {
+		klog.Fatalf("unable to set the calculator composition: %v", err)
+	}
+	evaluatorsRegistry.SetUsageCache(*usageCacheTTL, *usageCacheMaxEntries)
+	// the informers the dry runs read from are only started by the first dry run
+	var calculatorInformers []cache.SharedIndexInformer
+	if v1alpha1.VmiCalcConfigName(*launcherConfig) != v1alpha1.IgnoreVmiCalculator {
+		vmiInformer := informers.GetVMIInformer(aaqCli)
+		migrationInformer := informers.GetMigrationInformer(aaqCli)
+		calculatorInformers = append(calculatorInformers, vmiInformer, migrationInformer)
+		evaluatorsRegistry.Add(built_in_usage_calculators.NewVirtLauncherCalculator(vmiInformer, migrationInformer, v1alpha1.VmiCalcConfigName(*launcherConfig)))
+	}
+
+	if *celCalculators != "" {
+		var calculators []v1alpha1.CELCalculator
+		if err := json.Unmarshal([]byte(*celCalculators), &calculators); err != nil {
+			klog.Fatalf("unable to parse the CEL calculators: %v", err)
+		}
+		compiled, err := built_in_usage_calculators.NewCELCalculators(calculators)
+		if err != nil {
+			klog.Errorf("skipping the CEL calculators that failed to compile: %v", err)
+		}
+		for _, calculator := range compiled {
+			evaluatorsRegistry.Add(calculator)
+		}
+	}
+
+	if *wasmCalculators != "" {
+		var calculators []v1alpha1.WasmCalculator
+		if err := json.Unmarshal([]byte(*wasmCalculators), &calculators); err != nil {
+			klog.Fatalf("unable to parse the wasm calculators: %v", err)
+		}
+		loaded, err := aaq_evaluator.LoadWasmCalculators(aaqCli.CoreV1(), aaqNS, calculators)
+		if err != nil {
+			klog.Fatalf("unable to load the wasm calculators: %v", err)
+		}
+		for _, calculator := range loaded {
+			evaluatorsRegistry.Add(calculator)
+		}
+	}
+
+	podInformer := informers.GetPodInformer(aaqCli)
+	if *stripPodFields {
+		if err := informers.ValidatePodFields(*calculatorPodFields); err != nil {
+			klog.Fatalf("unable to set the calculator pod fields: %v", err)
+		}
+		evaluatorsRegistry.SetCalculatorPodFields(*calculatorPodFields)
+		if err := podInformer.SetTransform(informers.NewPodTransform(evaluatorsRegistry.RequiredPodFields())); err != nil {
+			klog.Fatalf("unable to set the pod transform: %v", err)
+		}
+	}
+	var acrqInformer cache.SharedIndexInformer
+	if *clusterQuotaEnabled {
+		acrqInformer = informers.GetApplicationAwareClusterResourceQuotaInformer(aaqCli)
+	}
+	dryRunCache := aaq_server.NewDryRunCache(podInformer, informers.GetApplicationAwareResourceQuotaInformer(aaqCli), acrqInformer, calculatorInformers, stop)
+
 	aaqServer, err := aaq_server.AaqServer(aaqNS,
 		util.DefaultHost,
 		util.DefaultPort,
 		secretCertManager,
 		aaqCli,
 		*isOnOpenshift,
+		evaluatorsRegistry,
+		dryRunCache,
+		*controllerCalculators,
 	)
 	if err != nil {
 		klog.Fatalf("UploadProxy failed to initialize: %v\n", errors.WithStack(err))
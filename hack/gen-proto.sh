@@ -5,5 +5,11 @@ set -e
 source $(dirname "$0")/build/common.sh
 source $(dirname "$0")/build/config.sh
 
-protoc --go_out=plugins=grpc:. staging/src/kubevirt.io/application-aware-quota-api/libsidecar/evaluator-server-com/evaluate.proto
-cp staging/src/kubevirt.io/application-aware-quota-api/libsidecar/evaluator-server-com/evaluate.pb.go pkg/util/net/generated
\ No newline at end of file
+LIBSIDECAR_PROTO_DIR=staging/src/kubevirt.io/application-aware-quota-api/libsidecar/evaluator-server-com
+
+protoc --go_out=plugins=grpc:. ${LIBSIDECAR_PROTO_DIR}/evaluate.proto
+cp ${LIBSIDECAR_PROTO_DIR}/evaluate.pb.go pkg/util/net/generated
+
+# v2 embeds the kubernetes types, their protos are resolved from vendor
+protoc -I . -I vendor --go_out=paths=source_relative:. --go-grpc_out=paths=source_relative:. ${LIBSIDECAR_PROTO_DIR}/v2/evaluate.proto
+cp ${LIBSIDECAR_PROTO_DIR}/v2/evaluate.pb.go ${LIBSIDECAR_PROTO_DIR}/v2/evaluate_grpc.pb.go pkg/util/net/generated/v2
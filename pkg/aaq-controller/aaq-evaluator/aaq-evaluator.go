@@ -18,6 +18,9 @@ import (
 	"kubevirt.io/application-aware-quota/pkg/util"
 )
 
+// PodEvaluatorCalculator names the kubernetes pod evaluator the usage falls back to when no calculator matches
+const PodEvaluatorCalculator = "PodEvaluator"
+
 // NewAaqEvaluator returns an evaluator that can evaluate pods with apps consideration
 func NewAaqEvaluator(podLister v1.PodLister, aaqEvalRegistery Registry, clock clock.Clock) *AaqEvaluator {
 	podEvaluator := core.NewPodEvaluator(nil, clock)
@@ -65,22 +68,36 @@ func (aaqe *AaqEvaluator) MatchingResources(input []corev1.ResourceName) []corev
 }
 
 func (aaqe *AaqEvaluator) Usage(item runtime.Object) (corev1.ResourceList, error) {
+	rl, _, err := aaqe.UsageBreakdown(item)
+	return rl, err
+}
+
+// UsageBreakdown returns the usage of the item along with what each calculator computed for it.
+// When no calculator matches, the usage of the pod evaluator is reported under PodEvaluatorCalculator,
+// unless a calculator with the FailClosed policy failed to evaluate the item
+func (aaqe *AaqEvaluator) UsageBreakdown(item runtime.Object) (corev1.ResourceList, []CalculatorUsage, error) {
 	pod, err := util.ToExternalPodOrError(item)
 	if err != nil {
-		return corev1.ResourceList{}, err
+		return corev1.ResourceList{}, nil, err
 	} else if pod.Spec.SchedulingGates != nil &&
 		len(pod.Spec.SchedulingGates) > 0 {
-		return corev1.ResourceList{}, nil
+		return corev1.ResourceList{}, nil, nil
 	}
 	existingPods, err := aaqe.podLister.Pods(pod.Namespace).List(labels.Everything())
 	if err != nil {
-		return corev1.ResourceList{}, fmt.Errorf("failed to list content: %v", err)
+		return corev1.ResourceList{}, nil, fmt.Errorf("failed to list content: %v", err)
 	}
-	rl, err := aaqe.aaqEvalRegistery.Usage(pod, existingPods)
-	if err != nil {
-		return aaqe.podEvaluator.Usage(item)
+	rl, breakdown, err := aaqe.aaqEvalRegistery.UsageBreakdown(pod, existingPods)
+	if _, failedClosed := AsCalculatorFailedError(err); failedClosed {
+		return nil, breakdown, err
+	} else if err != nil {
+		rl, err = aaqe.podEvaluator.Usage(item)
+		if err == nil {
+			breakdown = append(breakdown, CalculatorUsage{Calculator: PodEvaluatorCalculator, Usage: rl, Match: true})
+		}
+		return rl, breakdown, err
 	}
-	return rl, err
+	return rl, breakdown, err
 }
 
 func (aaqe *AaqEvaluator) CalculatorUsage(pod *corev1.Pod, existingPods []*corev1.Pod) (corev1.ResourceList, error) {
@@ -89,7 +106,9 @@ func (aaqe *AaqEvaluator) CalculatorUsage(pod *corev1.Pod, existingPods []*corev
 		return corev1.ResourceList{}, nil
 	}
 	rl, err := aaqe.aaqEvalRegistery.Usage(pod, existingPods)
-	if err != nil {
+	if _, failedClosed := AsCalculatorFailedError(err); failedClosed {
+		return nil, err
+	} else if err != nil {
 		return aaqe.podEvaluator.Usage(pod)
 	}
 	return rl, err
@@ -106,37 +125,74 @@ func (aaqe *AaqEvaluator) UsageStats(options v12.UsageStatsOptions) (v12.UsageSt
 		return result, fmt.Errorf("failed to list content: %v", err)
 	}
 
+	var podsToEvaluate []*corev1.Pod
 	for _, pod := range existingPods {
 		// need to verify that the item matches the set of scopes
-		matchesScopes := true
-		for _, scope := range options.Scopes {
-			innerMatch, err := podMatchesScopeFunc(corev1.ScopedResourceSelectorRequirement{ScopeName: scope, Operator: corev1.ScopeSelectorOpExists}, pod)
-			if err != nil {
-				return result, nil
-			}
-			if !innerMatch {
-				matchesScopes = false
-			}
+		matchesScopes, err := PodMatchesScopes(pod, options.Scopes, options.ScopeSelector)
+		if err != nil {
+			return result, nil
 		}
-		if options.ScopeSelector != nil {
-			for _, selector := range options.ScopeSelector.MatchExpressions {
-				innerMatch, err := podMatchesScopeFunc(selector, pod)
-				if err != nil {
-					return result, nil
-				}
-				matchesScopes = matchesScopes && innerMatch
-			}
+		// only count usage if there was a match, gated pods don't use any
+		if matchesScopes && len(pod.Spec.SchedulingGates) == 0 {
+			podsToEvaluate = append(podsToEvaluate, pod)
+		}
+	}
+
+	usages, errs := aaqe.PodsUsage(podsToEvaluate, existingPods)
+	for i := range podsToEvaluate {
+		if errs[i] != nil {
+			// the quota keeps its last usage rather than under-counting the pod
+			return result, errs[i]
+		}
+		result.Used = quota.Add(result.Used, usages[i])
+	}
+	return result, nil
+}
+
+// PodsUsage returns the usage of each of the pods, falling back to the pod evaluator for the pods no calculator
+// matched. A pod fails with a CalculatorFailedError when a calculator with the FailClosed policy failed to evaluate it
+func (aaqe *AaqEvaluator) PodsUsage(pods []*corev1.Pod, existingPods []*corev1.Pod) ([]corev1.ResourceList, []error) {
+	usages, errs := aaqe.aaqEvalRegistery.UsageBatch(pods, existingPods)
+	return aaqe.fallbackToPodEvaluator(pods, usages, errs)
+}
+
+// RecomputePodsUsage is like PodsUsage but evaluates the pods again rather than reusing their cached usages
+func (aaqe *AaqEvaluator) RecomputePodsUsage(pods []*corev1.Pod, existingPods []*corev1.Pod) ([]corev1.ResourceList, []error) {
+	usages, errs := aaqe.aaqEvalRegistery.RecomputeUsageBatch(pods, existingPods)
+	return aaqe.fallbackToPodEvaluator(pods, usages, errs)
+}
+
+func (aaqe *AaqEvaluator) fallbackToPodEvaluator(pods []*corev1.Pod, usages []corev1.ResourceList, errs []error) ([]corev1.ResourceList, []error) {
+	for i, pod := range pods {
+		if _, failedClosed := AsCalculatorFailedError(errs[i]); failedClosed {
+			usages[i] = nil
+		} else if errs[i] != nil {
+			usages[i], errs[i] = aaqe.podEvaluator.Usage(pod)
+		}
+	}
+	return usages, errs
+}
+
+// PodMatchesScopes returns whether the pod is counted by a quota with the scopes and the scope selector
+func PodMatchesScopes(pod *corev1.Pod, scopes []corev1.ResourceQuotaScope, scopeSelector *corev1.ScopeSelector) (bool, error) {
+	matchesScopes := true
+	for _, scope := range scopes {
+		innerMatch, err := podMatchesScopeFunc(corev1.ScopedResourceSelectorRequirement{ScopeName: scope, Operator: corev1.ScopeSelectorOpExists}, pod)
+		if err != nil {
+			return false, err
 		}
-		// only count usage if there was a match
-		if matchesScopes {
-			usage, err := aaqe.CalculatorUsage(pod, existingPods)
+		matchesScopes = matchesScopes && innerMatch
+	}
+	if scopeSelector != nil {
+		for _, selector := range scopeSelector.MatchExpressions {
+			innerMatch, err := podMatchesScopeFunc(selector, pod)
 			if err != nil {
-				return result, err
+				return false, err
 			}
-			result.Used = quota.Add(result.Used, usage)
+			matchesScopes = matchesScopes && innerMatch
 		}
 	}
-	return result, nil
+	return matchesScopes, nil
 }
 
 // todo: ask kubernetes to make this funcs global and remove all this code
@@ -0,0 +1,86 @@
+package aaq_evaluator
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	ggrpc "google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/metrics"
+	"kubevirt.io/application-aware-quota/pkg/tracing"
+	"time"
+)
+
+// AaqRemoteCalculator calls an evaluator serving over TCP with mutual TLS, it speaks the same protocols as the sidecars
+type AaqRemoteCalculator struct {
+	name    string
+	address string
+	// conn is kept open across calls and reestablished by grpc whenever it breaks
+	conn *ggrpc.ClientConn
+	// protocolVersion is the newest protocol the evaluator serves, negotiated on each health check
+	protocolVersion int
+	// timeout of each call to the evaluator, set from the calculator policy
+	timeout time.Duration
+}
+
+var _ = AaqBatchCalculator(&AaqRemoteCalculator{})
+
+func (aaqrc *AaqRemoteCalculator) PodUsageFunc(pod *corev1.Pod, podsState []*corev1.Pod) (rl corev1.ResourceList, err error, match bool) {
+	start := time.Now()
+	spanCtx, span := tracing.Tracer().Start(tracing.PodContext(context.Background(), pod), "aaq.remote.podUsage",
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attribute.String("aaq.remote", aaqrc.name)))
+	defer func() {
+		metrics.ObserveSidecarCalculatorCall(calculatorName(aaqrc), time.Since(start), err)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.SetAttributes(attribute.Bool("aaq.remote.match", match))
+		span.End()
+	}()
+
+	ctx, cancel := context.WithTimeout(tracing.OutgoingGRPCContext(spanCtx), aaqrc.callTimeout())
+	defer cancel()
+
+	if aaqrc.protocolVersion == SidecarProtocolV2 {
+		return podUsageV2(ctx, aaqrc.conn, pod, podsState)
+	}
+	return podUsageV1(ctx, aaqrc.conn, pod, podsState)
+}
+
+// PodsUsageFunc evaluates all the pods in a single call to evaluators that serve v2,
+// and falls back to a call per pod for evaluators that only serve v1
+func (aaqrc *AaqRemoteCalculator) PodsUsageFunc(pods []*corev1.Pod, podsState []*corev1.Pod) (results []PodUsageResult, err error) {
+	if aaqrc.protocolVersion != SidecarProtocolV2 {
+		for _, pod := range pods {
+			rl, err, match := aaqrc.PodUsageFunc(pod, podsState)
+			results = append(results, PodUsageResult{ResourceList: rl, Match: match, Err: err})
+		}
+		return results, nil
+	}
+
+	start := time.Now()
+	spanCtx, span := tracing.Tracer().Start(context.Background(), "aaq.remote.podsUsage", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("aaq.remote", aaqrc.name), attribute.Int("aaq.remote.pods", len(pods))))
+	defer func() {
+		metrics.ObserveSidecarCalculatorCall(calculatorName(aaqrc), time.Since(start), err)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	ctx, cancel := context.WithTimeout(tracing.OutgoingGRPCContext(spanCtx), aaqrc.callTimeout())
+	defer cancel()
+
+	return podsUsageV2(ctx, aaqrc.conn, pods, podsState)
+}
+
+func (aaqrc *AaqRemoteCalculator) callTimeout() time.Duration {
+	if aaqrc.timeout <= 0 {
+		return defaultCalculatorTimeout
+	}
+	return aaqrc.timeout
+}
@@ -0,0 +1,153 @@
+package aaq_evaluator
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/library-go/pkg/crypto"
+	ggrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authentication/user"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	pbv2 "kubevirt.io/application-aware-quota/pkg/util/net/generated/v2"
+	"kubevirt.io/application-aware-quota/pkg/util/net/grpc"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func newTestCA(name string) *crypto.CA {
+	config, err := crypto.MakeSelfSignedCAConfigForDuration(name, time.Hour)
+	Expect(err).ToNot(HaveOccurred())
+	return &crypto.CA{Config: config, SerialGenerator: &crypto.RandomSerialGenerator{}}
+}
+
+// writeKeyPair writes the certificate and key of config to dir, as they are mounted from a TLS secret
+func writeKeyPair(dir string, config *crypto.TLSCertificateConfig) {
+	certPEM, keyPEM, err := config.GetPEMBytes()
+	Expect(err).ToNot(HaveOccurred())
+	Expect(os.WriteFile(filepath.Join(dir, grpc.CertFile), certPEM, 0600)).To(Succeed())
+	Expect(os.WriteFile(filepath.Join(dir, grpc.KeyFile), keyPEM, 0600)).To(Succeed())
+}
+
+func caPEM(ca *crypto.CA) []byte {
+	certPEM, _, err := ca.Config.GetPEMBytes()
+	Expect(err).ToNot(HaveOccurred())
+	return certPEM
+}
+
+// serveRemote starts a grpc server on localhost serving a certificate issued by serverCA,
+// which only accepts clients presenting a certificate issued by clientCA
+func serveRemote(serverCA, clientCA *crypto.CA, evaluator pbv2.PodUsageServer) string {
+	serverCert, err := serverCA.MakeServerCertForDuration(sets.New("localhost"), time.Hour)
+	Expect(err).ToNot(HaveOccurred())
+	certPEM, keyPEM, err := serverCert.GetPEMBytes()
+	Expect(err).ToNot(HaveOccurred())
+	keyPair, err := tls.X509KeyPair(certPEM, keyPEM)
+	Expect(err).ToNot(HaveOccurred())
+	clientCAs := x509.NewCertPool()
+	Expect(clientCAs.AppendCertsFromPEM(caPEM(clientCA))).To(BeTrue())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).ToNot(HaveOccurred())
+	server := ggrpc.NewServer(ggrpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{keyPair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	})))
+	pbv2.RegisterPodUsageServer(server, evaluator)
+	go server.Serve(listener)
+	DeferCleanup(server.Stop)
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	Expect(err).ToNot(HaveOccurred())
+	return net.JoinHostPort("localhost", port)
+}
+
+var _ = Describe("AaqRemoteCalculator", func() {
+	var evaluatorsCA *crypto.CA
+	var certDir, caDir string
+	var registry *AaqEvaluatorRegistry
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "test", Labels: map[string]string{"match": "true"}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:      "ctr",
+			Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")}},
+		}}},
+	}
+
+	// calledCalculators are the calculators pods are sent to, remote evaluators that are down only fail their evaluation
+	calledCalculators := func() []AaqCalculator {
+		var called []AaqCalculator
+		for _, calculator := range registry.calculators() {
+			if _, unavailable := calculator.(*unavailableCalculator); !unavailable {
+				called = append(called, calculator)
+			}
+		}
+		return called
+	}
+
+	BeforeEach(func() {
+		evaluatorsCA = newTestCA("aaq-evaluator-signer")
+		certDir, caDir = GinkgoT().TempDir(), GinkgoT().TempDir()
+		clientCert, err := evaluatorsCA.MakeClientCertificateForDuration(&user.DefaultInfo{Name: "aaq-controller"}, time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		writeKeyPair(certDir, clientCert)
+		Expect(os.WriteFile(filepath.Join(caDir, grpc.CABundleFile), caPEM(evaluatorsCA), 0600)).To(Succeed())
+		registry = newAaqEvaluatorsRegistry(1, newSocketDir())
+	})
+
+	It("should evaluate pods with healthy remote evaluators over mutual TLS", func() {
+		evaluator := &fakeSidecarV2{}
+		address := serveRemote(evaluatorsCA, evaluatorsCA, evaluator)
+		Expect(registry.SetRemoteEvaluators([]v1alpha1.RemoteEvaluator{{Name: "test", Address: address}}, certDir, caDir)).To(Succeed())
+		// remote evaluators aren't called before their first successful health check
+		Expect(calledCalculators()).To(BeEmpty())
+		Expect(registry.calculators()).To(HaveLen(1))
+
+		Expect(registry.Sync()).To(Succeed())
+		Expect(calledCalculators()).To(HaveLen(1))
+		Expect(calculatorName(calledCalculators()[0])).To(Equal("remote/test"))
+		Expect(calledCalculators()[0].(*AaqRemoteCalculator).protocolVersion).To(Equal(SidecarProtocolV2))
+
+		usages, errs := registry.UsageBatch([]*corev1.Pod{pod, pod}, nil)
+		Expect(errs).To(Equal([]error{nil, nil}))
+		Expect(quota.Equals(usages[0], corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("2Gi")})).To(BeTrue())
+		Expect(evaluator.calls.Load()).To(Equal(int32(1)))
+	})
+
+	It("should only trust evaluators serving a certificate of the evaluators CA or of their CABundle", func() {
+		otherCA := newTestCA("other-signer")
+		address := serveRemote(otherCA, evaluatorsCA, &fakeSidecarV2{})
+		Expect(registry.SetRemoteEvaluators([]v1alpha1.RemoteEvaluator{{Name: "test", Address: address}}, certDir, caDir)).To(Succeed())
+		Expect(registry.Sync()).To(Succeed())
+		Expect(calledCalculators()).To(BeEmpty())
+
+		Expect(registry.SetRemoteEvaluators([]v1alpha1.RemoteEvaluator{{Name: "test", Address: address, CABundle: caPEM(otherCA)}}, certDir, caDir)).To(Succeed())
+		Expect(registry.Sync()).To(Succeed())
+		Expect(calledCalculators()).To(HaveLen(1))
+	})
+
+	It("should not be trusted by evaluators without a client certificate of the evaluators CA", func() {
+		address := serveRemote(evaluatorsCA, newTestCA("other-signer"), &fakeSidecarV2{})
+		Expect(registry.SetRemoteEvaluators([]v1alpha1.RemoteEvaluator{{Name: "test", Address: address}}, certDir, caDir)).To(Succeed())
+		Expect(registry.Sync()).To(Succeed())
+		Expect(calledCalculators()).To(BeEmpty())
+	})
+
+	It("should reject remote evaluators without a name or an address", func() {
+		Expect(registry.SetRemoteEvaluators([]v1alpha1.RemoteEvaluator{{Address: "localhost:9443"}}, certDir, caDir)).ToNot(Succeed())
+		Expect(registry.SetRemoteEvaluators([]v1alpha1.RemoteEvaluator{{Name: "test"}}, certDir, caDir)).ToNot(Succeed())
+		Expect(registry.SetRemoteEvaluators([]v1alpha1.RemoteEvaluator{
+			{Name: "test", Address: "localhost:9443"},
+			{Name: "test", Address: "localhost:9444"},
+		}, certDir, caDir)).ToNot(Succeed())
+	})
+})
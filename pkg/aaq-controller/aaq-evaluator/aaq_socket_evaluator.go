@@ -4,18 +4,52 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	ggrpc "google.golang.org/grpc"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/metrics"
 	"kubevirt.io/application-aware-quota/pkg/log"
+	"kubevirt.io/application-aware-quota/pkg/tracing"
 	pb "kubevirt.io/application-aware-quota/pkg/util/net/generated"
+	pbv2 "kubevirt.io/application-aware-quota/pkg/util/net/generated/v2"
 	"kubevirt.io/application-aware-quota/pkg/util/net/grpc"
+	"path/filepath"
 	"time"
 )
 
+const (
+	// SidecarProtocolV1 passes pods and resource lists as JSON, one pod per call
+	SidecarProtocolV1 = 1
+	// SidecarProtocolV2 passes typed pods and resource lists and can evaluate many pods per call
+	SidecarProtocolV2 = 2
+)
+
 type AaqSocketCalculator struct {
 	sidecarSocketPath string
+	// protocolVersion is the newest protocol the sidecar serves, negotiated when it is collected
+	protocolVersion int
+	// timeout of each call to the sidecar, set from the calculator policy
+	timeout time.Duration
 }
 
-func (aaqsc *AaqSocketCalculator) PodUsageFunc(pod *corev1.Pod, podsState []*corev1.Pod) (corev1.ResourceList, error, bool) {
+var _ = AaqBatchCalculator(&AaqSocketCalculator{})
+
+func (aaqsc *AaqSocketCalculator) PodUsageFunc(pod *corev1.Pod, podsState []*corev1.Pod) (rl corev1.ResourceList, err error, match bool) {
+	start := time.Now()
+	spanCtx, span := tracing.Tracer().Start(tracing.PodContext(context.Background(), pod), "aaq.sidecar.podUsage",
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attribute.String("aaq.sidecar", filepath.Base(aaqsc.sidecarSocketPath))))
+	defer func() {
+		metrics.ObserveSidecarCalculatorCall(filepath.Base(aaqsc.sidecarSocketPath), time.Since(start), err)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.SetAttributes(attribute.Bool("aaq.sidecar.match", match))
+		span.End()
+	}()
 	conn, err := grpc.DialSocketWithTimeout(aaqsc.sidecarSocketPath, 1)
 	if err != nil {
 		log.Log.Reason(err).Errorf(dialSockErr, aaqsc.sidecarSocketPath)
@@ -23,9 +57,59 @@ func (aaqsc *AaqSocketCalculator) PodUsageFunc(pod *corev1.Pod, podsState []*cor
 	}
 	defer conn.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	// the sidecar can continue the trace from the traceparent in the request metadata
+	ctx, cancel := context.WithTimeout(tracing.OutgoingGRPCContext(spanCtx), aaqsc.callTimeout())
 	defer cancel()
 
+	if aaqsc.protocolVersion == SidecarProtocolV2 {
+		return podUsageV2(ctx, conn, pod, podsState)
+	}
+	return podUsageV1(ctx, conn, pod, podsState)
+}
+
+// PodsUsageFunc evaluates all the pods in a single call to sidecars that serve v2,
+// and falls back to a call per pod for sidecars that only serve v1
+func (aaqsc *AaqSocketCalculator) PodsUsageFunc(pods []*corev1.Pod, podsState []*corev1.Pod) (results []PodUsageResult, err error) {
+	if aaqsc.protocolVersion != SidecarProtocolV2 {
+		for _, pod := range pods {
+			rl, err, match := aaqsc.PodUsageFunc(pod, podsState)
+			results = append(results, PodUsageResult{ResourceList: rl, Match: match, Err: err})
+		}
+		return results, nil
+	}
+
+	start := time.Now()
+	spanCtx, span := tracing.Tracer().Start(context.Background(), "aaq.sidecar.podsUsage", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("aaq.sidecar", filepath.Base(aaqsc.sidecarSocketPath)), attribute.Int("aaq.sidecar.pods", len(pods))))
+	defer func() {
+		metrics.ObserveSidecarCalculatorCall(filepath.Base(aaqsc.sidecarSocketPath), time.Since(start), err)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+	conn, err := grpc.DialSocketWithTimeout(aaqsc.sidecarSocketPath, 1)
+	if err != nil {
+		log.Log.Reason(err).Errorf(dialSockErr, aaqsc.sidecarSocketPath)
+		return nil, err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(tracing.OutgoingGRPCContext(spanCtx), aaqsc.callTimeout())
+	defer cancel()
+
+	return podsUsageV2(ctx, conn, pods, podsState)
+}
+
+func (aaqsc *AaqSocketCalculator) callTimeout() time.Duration {
+	if aaqsc.timeout <= 0 {
+		return defaultCalculatorTimeout
+	}
+	return aaqsc.timeout
+}
+
+func podUsageV1(ctx context.Context, conn *ggrpc.ClientConn, pod *corev1.Pod, podsState []*corev1.Pod) (corev1.ResourceList, error, bool) {
 	client := pb.NewPodUsageClient(conn)
 	podData, err := json.Marshal(pod)
 	if err != nil {
@@ -57,3 +141,49 @@ func (aaqsc *AaqSocketCalculator) PodUsageFunc(pod *corev1.Pod, podsState []*cor
 	}
 	return rl, resErr, result.Match
 }
+
+func podUsageV2(ctx context.Context, conn *ggrpc.ClientConn, pod *corev1.Pod, podsState []*corev1.Pod) (corev1.ResourceList, error, bool) {
+	result, err := pbv2.NewPodUsageClient(conn).PodUsageFunc(ctx, &pbv2.PodUsageRequest{
+		Pod:       pod,
+		PodsState: podsState,
+	})
+	if err != nil {
+		log.Log.Reason(err).Errorf("Failed to call PodUsageFunc with pod %v/%v", pod.Namespace, pod.Name)
+		return nil, err, false
+	}
+	return fromPodUsageResponse(result)
+}
+
+func podsUsageV2(ctx context.Context, conn *ggrpc.ClientConn, pods []*corev1.Pod, podsState []*corev1.Pod) ([]PodUsageResult, error) {
+	response, err := pbv2.NewPodUsageClient(conn).PodsUsage(ctx, &pbv2.PodsUsageRequest{
+		Pods:      pods,
+		PodsState: podsState,
+	})
+	if err != nil {
+		log.Log.Reason(err).Errorf("Failed to call PodsUsage with %v pods", len(pods))
+		return nil, err
+	}
+	if len(response.GetUsages()) != len(pods) {
+		return nil, fmt.Errorf("evaluator returned %v usages for %v pods", len(response.GetUsages()), len(pods))
+	}
+	var results []PodUsageResult
+	for _, usage := range response.GetUsages() {
+		rl, err, match := fromPodUsageResponse(usage)
+		results = append(results, PodUsageResult{ResourceList: rl, Match: match, Err: err})
+	}
+	return results, nil
+}
+
+func fromPodUsageResponse(response *pbv2.PodUsageResponse) (corev1.ResourceList, error, bool) {
+	rl := corev1.ResourceList{}
+	for name, quantity := range response.GetResourceList() {
+		if quantity == nil {
+			quantity = &resource.Quantity{}
+		}
+		rl[corev1.ResourceName(name)] = *quantity
+	}
+	if response.GetError() != "" {
+		return rl, fmt.Errorf("%s", response.GetError()), response.GetMatch()
+	}
+	return rl, nil, response.GetMatch()
+}
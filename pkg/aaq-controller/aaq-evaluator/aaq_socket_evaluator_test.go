@@ -0,0 +1,178 @@
+package aaq_evaluator
+
+import (
+	"context"
+	"encoding/json"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	ggrpc "google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	v1 "k8s.io/client-go/listers/core/v1"
+	testingclock "k8s.io/utils/clock/testing"
+	fakeinformers "kubevirt.io/application-aware-quota/pkg/tests-utils"
+	pb "kubevirt.io/application-aware-quota/pkg/util/net/generated"
+	pbv2 "kubevirt.io/application-aware-quota/pkg/util/net/generated/v2"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// sidecarUsage is the usage the fake sidecars compute: the pod's memory requests, doubled
+func sidecarUsage(pod *corev1.Pod) corev1.ResourceList {
+	memory := pod.Spec.Containers[0].Resources.Requests.Memory().DeepCopy()
+	memory.Add(memory)
+	return corev1.ResourceList{corev1.ResourceRequestsMemory: memory}
+}
+
+// fakeSidecarV1 only serves the v1 protocol, like sidecars built before v2
+type fakeSidecarV1 struct {
+	calls atomic.Int32
+}
+
+func (fs *fakeSidecarV1) PodUsageFunc(_ context.Context, request *pb.PodUsageRequest) (*pb.PodUsageResponse, error) {
+	fs.calls.Add(1)
+	pod := &corev1.Pod{}
+	if err := json.Unmarshal(request.Pod.PodJson, pod); err != nil {
+		return nil, err
+	}
+	rlData, err := json.Marshal(sidecarUsage(pod))
+	if err != nil {
+		return nil, err
+	}
+	return &pb.PodUsageResponse{ResourceList: &pb.ResourceList{ResourceListJson: rlData}, Match: true, Error: &pb.Error{}}, nil
+}
+
+func (fs *fakeSidecarV1) HealthCheck(_ context.Context, _ *pb.HealthCheckRequest) (*pb.HealthCheckResponse, error) {
+	return &pb.HealthCheckResponse{Healthy: true}, nil
+}
+
+type fakeSidecarV2 struct {
+	pbv2.UnimplementedPodUsageServer
+	calls          atomic.Int32
+	podsStateSizes []int
+}
+
+func (fs *fakeSidecarV2) PodUsageFunc(_ context.Context, request *pbv2.PodUsageRequest) (*pbv2.PodUsageResponse, error) {
+	fs.calls.Add(1)
+	return fakeV2Response(request.Pod), nil
+}
+
+func (fs *fakeSidecarV2) PodsUsage(_ context.Context, request *pbv2.PodsUsageRequest) (*pbv2.PodsUsageResponse, error) {
+	fs.calls.Add(1)
+	fs.podsStateSizes = append(fs.podsStateSizes, len(request.PodsState))
+	response := &pbv2.PodsUsageResponse{}
+	for _, pod := range request.Pods {
+		response.Usages = append(response.Usages, fakeV2Response(pod))
+	}
+	return response, nil
+}
+
+func (fs *fakeSidecarV2) HealthCheck(_ context.Context, _ *pbv2.HealthCheckRequest) (*pbv2.HealthCheckResponse, error) {
+	return &pbv2.HealthCheckResponse{Healthy: true}, nil
+}
+
+func fakeV2Response(pod *corev1.Pod) *pbv2.PodUsageResponse {
+	if pod.Labels["match"] != "true" {
+		return &pbv2.PodUsageResponse{}
+	}
+	response := &pbv2.PodUsageResponse{ResourceList: map[string]*resource.Quantity{}, Match: true}
+	for name, quantity := range sidecarUsage(pod) {
+		q := quantity.DeepCopy()
+		response.ResourceList[string(name)] = &q
+	}
+	return response
+}
+
+// serveSidecar starts a grpc server on socketPath, registering the services with register.
+// The socket is removed once the returned server stops
+func serveSidecar(socketPath string, register func(server *ggrpc.Server)) *ggrpc.Server {
+	socket, err := net.Listen("unix", socketPath)
+	Expect(err).ToNot(HaveOccurred())
+	server := ggrpc.NewServer()
+	register(server)
+	go server.Serve(socket)
+	DeferCleanup(server.Stop)
+	return server
+}
+
+// newSocketDir returns a directory for sidecar sockets, which are limited in length so it is kept short
+func newSocketDir() string {
+	socketDir, err := os.MkdirTemp("", "aaq-sock")
+	Expect(err).ToNot(HaveOccurred())
+	DeferCleanup(os.RemoveAll, socketDir)
+	return socketDir
+}
+
+var _ = Describe("AaqSocketCalculator", func() {
+	var socketDir string
+
+	// serve starts a grpc server on a socket in socketDir, registering the services with register
+	serve := func(register func(server *ggrpc.Server)) {
+		serveSidecar(filepath.Join(socketDir, "sidecar.sock"), register)
+	}
+
+	newPod := func(name, memory string, match bool) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test", Labels: map[string]string{"match": strconv.FormatBool(match)}},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:      "ctr",
+				Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(memory)}},
+			}}},
+		}
+	}
+
+	BeforeEach(func() {
+		socketDir = newSocketDir()
+	})
+
+	It("should negotiate v2 with sidecars serving it and evaluate all the pods of UsageStats in a single call", func() {
+		sidecar := &fakeSidecarV2{}
+		serve(func(server *ggrpc.Server) {
+			pb.RegisterPodUsageServer(server, &fakeSidecarV1{})
+			pbv2.RegisterPodUsageServer(server, sidecar)
+		})
+		registry := newAaqEvaluatorsRegistry(1, socketDir)
+		Expect(registry.Sync()).To(Succeed())
+		Expect(registry.calculators()).To(HaveLen(1))
+		Expect(registry.calculators()[0].(*AaqSocketCalculator).protocolVersion).To(Equal(SidecarProtocolV2))
+
+		pods := []metav1.Object{newPod("p1", "1Gi", true), newPod("p2", "512Mi", true), newPod("p3", "256Mi", false)}
+		podInformer := fakeinformers.NewFakeSharedIndexInformer(pods)
+		eval := NewAaqEvaluator(v1.NewPodLister(podInformer.GetIndexer()), registry, testingclock.NewFakeClock(time.Now()))
+		stats, err := eval.UsageStats(quota.UsageStatsOptions{Namespace: "test", Resources: []corev1.ResourceName{corev1.ResourceRequestsMemory}})
+		Expect(err).ToNot(HaveOccurred())
+		// p3 doesn't match the sidecar, so it falls back to the pod evaluator
+		Expect(stats.Used.Name(corev1.ResourceRequestsMemory, resource.BinarySI).Cmp(resource.MustParse("3328Mi"))).To(BeZero())
+		Expect(sidecar.calls.Load()).To(Equal(int32(1)))
+		Expect(sidecar.podsStateSizes).To(Equal([]int{3}))
+
+		rl, err, match := registry.calculators()[0].PodUsageFunc(pods[0].(*corev1.Pod), nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(match).To(BeTrue())
+		Expect(quota.Equals(rl, corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("2Gi")})).To(BeTrue())
+	})
+
+	It("should keep speaking v1 to sidecars that don't serve v2", func() {
+		sidecar := &fakeSidecarV1{}
+		serve(func(server *ggrpc.Server) {
+			pb.RegisterPodUsageServer(server, sidecar)
+		})
+		registry := newAaqEvaluatorsRegistry(1, socketDir)
+		Expect(registry.Sync()).To(Succeed())
+		Expect(registry.calculators()).To(HaveLen(1))
+		Expect(registry.calculators()[0].(*AaqSocketCalculator).protocolVersion).To(Equal(SidecarProtocolV1))
+
+		pods := []*corev1.Pod{newPod("p1", "1Gi", true), newPod("p2", "512Mi", true)}
+		usages, errs := registry.UsageBatch(pods, pods)
+		Expect(errs).To(Equal([]error{nil, nil}))
+		Expect(quota.Equals(usages[0], corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("2Gi")})).To(BeTrue())
+		Expect(quota.Equals(usages[1], corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("1Gi")})).To(BeTrue())
+		Expect(sidecar.calls.Load()).To(Equal(int32(2)))
+	})
+})
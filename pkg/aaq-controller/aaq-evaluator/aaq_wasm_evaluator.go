@@ -0,0 +1,199 @@
+package aaq_evaluator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	corev1 "k8s.io/api/core/v1"
+	"kubevirt.io/application-aware-quota-api/libwasm/abi"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/metrics"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWasmMemoryLimit = 128 * 1024 * 1024
+	defaultWasmTimeout     = time.Second
+	wasmPageSize           = 64 * 1024
+	maxWasmMemoryPages     = 65536
+	// maxIdleWasmInstances bounds the instances kept around between calls, each of them can use up to the memory limit
+	maxIdleWasmInstances = 4
+)
+
+// AaqWasmCalculator evaluates pods with a WebAssembly module run in-process. An instance of the module serves a
+// single call at a time, instances that fail a call are discarded so a broken one is never reused
+type AaqWasmCalculator struct {
+	name    string
+	runtime wazero.Runtime
+	module  wazero.CompiledModule
+	// timeout of each call, the instance is stopped once it runs out
+	timeout time.Duration
+
+	lock sync.Mutex
+	idle []api.Module
+}
+
+// NewAaqWasmCalculator compiles the module, which can't grow its memory beyond memoryLimit bytes
+func NewAaqWasmCalculator(name string, binary []byte, memoryLimit int64, timeout time.Duration) (*AaqWasmCalculator, error) {
+	if memoryLimit <= 0 {
+		memoryLimit = defaultWasmMemoryLimit
+	}
+	if timeout <= 0 {
+		timeout = defaultWasmTimeout
+	}
+	pages := memoryLimit / wasmPageSize
+	if pages < 1 {
+		pages = 1
+	} else if pages > maxWasmMemoryPages {
+		pages = maxWasmMemoryPages
+	}
+	ctx := context.Background()
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(uint32(pages)).
+		WithCloseOnContextDone(true))
+	wasmcalc := &AaqWasmCalculator{name: name, runtime: runtime, timeout: timeout}
+	if err := wasmcalc.compile(ctx, binary); err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("invalid module of wasm calculator %s: %v", name, err)
+	}
+	return wasmcalc, nil
+}
+
+func (wasmcalc *AaqWasmCalculator) compile(ctx context.Context, binary []byte) error {
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, wasmcalc.runtime); err != nil {
+		return err
+	}
+	module, err := wasmcalc.runtime.CompileModule(ctx, binary)
+	if err != nil {
+		return err
+	}
+	for _, export := range []string{abi.AllocateExport, abi.PodUsageExport} {
+		if _, exported := module.ExportedFunctions()[export]; !exported {
+			return fmt.Errorf("module doesn't export %s", export)
+		}
+	}
+	wasmcalc.module = module
+
+	// the module is instantiated once to fail early on modules that don't start or implement another ABI version
+	ctx, cancel := context.WithTimeout(ctx, wasmcalc.timeout)
+	defer cancel()
+	instance, err := wasmcalc.instantiate(ctx)
+	if err != nil {
+		return err
+	}
+	if version := instance.ExportedFunction(abi.VersionExport); version != nil {
+		results, err := version.Call(ctx)
+		if err != nil {
+			instance.Close(ctx)
+			return err
+		}
+		if len(results) != 1 || results[0] != abi.Version {
+			instance.Close(ctx)
+			return fmt.Errorf("module implements ABI version %v rather than %d", results, abi.Version)
+		}
+	}
+	wasmcalc.release(instance)
+	return nil
+}
+
+func (wasmcalc *AaqWasmCalculator) Name() string {
+	return "wasm/" + wasmcalc.name
+}
+
+// Close releases the module and all of its instances
+func (wasmcalc *AaqWasmCalculator) Close() error {
+	return wasmcalc.runtime.Close(context.Background())
+}
+
+func (wasmcalc *AaqWasmCalculator) PodUsageFunc(pod *corev1.Pod, podsState []*corev1.Pod) (rl corev1.ResourceList, err error, match bool) {
+	start := time.Now()
+	defer func() {
+		metrics.ObserveSidecarCalculatorCall(wasmcalc.Name(), time.Since(start), err)
+	}()
+
+	request, err := json.Marshal(abi.PodUsageRequest{Pod: pod, PodsState: podsState})
+	if err != nil {
+		return nil, err, false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), wasmcalc.timeout)
+	defer cancel()
+	instance, err := wasmcalc.acquire(ctx)
+	if err != nil {
+		return nil, err, false
+	}
+	response, err := wasmcalc.call(ctx, instance, request)
+	if err != nil {
+		instance.Close(context.Background())
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("wasm calculator %s didn't evaluate pod %s/%s within %v", wasmcalc.name, pod.Namespace, pod.Name, wasmcalc.timeout), false
+		}
+		return nil, fmt.Errorf("wasm calculator %s failed to evaluate pod %s/%s: %v", wasmcalc.name, pod.Namespace, pod.Name, err), false
+	}
+	wasmcalc.release(instance)
+	if response.Error != "" {
+		return response.ResourceList, fmt.Errorf("%s", response.Error), response.Match
+	}
+	return response.ResourceList, nil, response.Match
+}
+
+// call writes the request to the memory of the instance, evaluates it and reads back the response
+func (wasmcalc *AaqWasmCalculator) call(ctx context.Context, instance api.Module, request []byte) (*abi.PodUsageResponse, error) {
+	results, err := instance.ExportedFunction(abi.AllocateExport).Call(ctx, uint64(len(request)))
+	if err != nil {
+		return nil, err
+	}
+	ptr := uint32(results[0])
+	if !instance.Memory().Write(ptr, request) {
+		return nil, fmt.Errorf("allocated memory is out of range")
+	}
+	results, err = instance.ExportedFunction(abi.PodUsageExport).Call(ctx, uint64(ptr), uint64(len(request)))
+	if err != nil {
+		return nil, err
+	}
+	responsePtr, responseSize := abi.Unpack(results[0])
+	data, ok := instance.Memory().Read(responsePtr, responseSize)
+	if !ok {
+		return nil, fmt.Errorf("response is out of range")
+	}
+	response := &abi.PodUsageResponse{}
+	if err := json.Unmarshal(data, response); err != nil {
+		return nil, fmt.Errorf("invalid response: %v", err)
+	}
+	return response, nil
+}
+
+func (wasmcalc *AaqWasmCalculator) acquire(ctx context.Context) (api.Module, error) {
+	wasmcalc.lock.Lock()
+	if len(wasmcalc.idle) > 0 {
+		instance := wasmcalc.idle[len(wasmcalc.idle)-1]
+		wasmcalc.idle = wasmcalc.idle[:len(wasmcalc.idle)-1]
+		wasmcalc.lock.Unlock()
+		return instance, nil
+	}
+	wasmcalc.lock.Unlock()
+	return wasmcalc.instantiate(ctx)
+}
+
+func (wasmcalc *AaqWasmCalculator) release(instance api.Module) {
+	wasmcalc.lock.Lock()
+	defer wasmcalc.lock.Unlock()
+	if len(wasmcalc.idle) >= maxIdleWasmInstances {
+		instance.Close(context.Background())
+		return
+	}
+	wasmcalc.idle = append(wasmcalc.idle, instance)
+}
+
+func (wasmcalc *AaqWasmCalculator) instantiate(ctx context.Context) (api.Module, error) {
+	// instances are anonymous so the module can be instantiated any number of times. Some libraries,
+	// klog among them, expect the program name in the arguments
+	return wasmcalc.runtime.InstantiateModule(ctx, wasmcalc.module, wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(wasmcalc.name).
+		WithStartFunctions(abi.InitializeExport).
+		WithSysWalltime().
+		WithSysNanotime())
+}
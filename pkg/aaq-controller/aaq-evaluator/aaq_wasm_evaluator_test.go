@@ -0,0 +1,244 @@
+package aaq_evaluator
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"kubevirt.io/application-aware-quota-api/libwasm/abi"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+const (
+	testWasmRequestOffset  = 8192
+	testWasmResponseOffset = 4096
+	testWasmResponse       = `{"resourceList":{"requests.memory":"2Gi"},"match":true}`
+)
+
+func uleb128(v uint64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			out = append(out, b|0x80)
+			continue
+		}
+		return append(out, b)
+	}
+}
+
+func sleb128(v int64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && b&0x40 == 0) || (v == -1 && b&0x40 != 0) {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func wasmVec(items ...[]byte) []byte {
+	out := uleb128(uint64(len(items)))
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+func wasmName(name string) []byte {
+	return append(uleb128(uint64(len(name))), name...)
+}
+
+func wasmSection(id byte, contents []byte) []byte {
+	return append(append([]byte{id}, uleb128(uint64(len(contents)))...), contents...)
+}
+
+func wasmFunc(body ...[]byte) []byte {
+	code := []byte{0x00} // no locals
+	for _, instructions := range body {
+		code = append(code, instructions...)
+	}
+	code = append(code, 0x0b)
+	return append(uleb128(uint64(len(code))), code...)
+}
+
+// returnResponse returns the pointer and size of testWasmResponse, which is written to the memory by a data segment
+func returnResponse() []byte {
+	return append([]byte{0x42}, sleb128(int64(abi.Pack(testWasmResponseOffset, uint32(len(testWasmResponse)))))...)
+}
+
+// growMemory grows the memory by pages, trapping if it can't
+func growMemory(pages int32) []byte {
+	return append(append([]byte{0x41}, sleb128(int64(pages))...),
+		0x40, 0x00, // memory.grow
+		0x41, 0x7f, // i32.const -1
+		0x46,             // i32.eq
+		0x04, 0x40, 0x00, // if unreachable
+		0x0b, // end
+	)
+}
+
+// loopForever never returns
+func loopForever() []byte {
+	return []byte{0x03, 0x40, 0x0c, 0x00, 0x0b, 0x00} // loop br 0 end unreachable
+}
+
+// newTestWasmModule assembles a module implementing the calculators ABI, its aaq_pod_usage runs podUsage
+func newTestWasmModule(version int32, podUsage ...[]byte) []byte {
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	module = append(module, wasmSection(1, wasmVec(
+		[]byte{0x60, 0x01, 0x7f, 0x01, 0x7f},       // (i32) -> i32
+		[]byte{0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e}, // (i32, i32) -> i64
+		[]byte{0x60, 0x00, 0x01, 0x7f},             // () -> i32
+	))...)
+	module = append(module, wasmSection(3, wasmVec([]byte{0x00}, []byte{0x01}, []byte{0x02}))...)
+	module = append(module, wasmSection(5, wasmVec([]byte{0x00, 0x01}))...)
+	module = append(module, wasmSection(7, wasmVec(
+		append(wasmName("memory"), 0x02, 0x00),
+		append(wasmName(abi.AllocateExport), 0x00, 0x00),
+		append(wasmName(abi.PodUsageExport), 0x00, 0x01),
+		append(wasmName(abi.VersionExport), 0x00, 0x02),
+	))...)
+	module = append(module, wasmSection(10, wasmVec(
+		wasmFunc(append([]byte{0x41}, sleb128(testWasmRequestOffset)...)),
+		wasmFunc(append(podUsage, returnResponse())...),
+		wasmFunc(append([]byte{0x41}, sleb128(int64(version))...)),
+	))...)
+	segment := append([]byte{0x00, 0x41}, sleb128(testWasmResponseOffset)...)
+	segment = append(segment, 0x0b)
+	segment = append(segment, wasmName(testWasmResponse)...)
+	return append(module, wasmSection(11, wasmVec(segment))...)
+}
+
+func tarWithFile(name string, data []byte) []byte {
+	var buffer bytes.Buffer
+	writer := tar.NewWriter(&buffer)
+	Expect(writer.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data))})).To(Succeed())
+	_, err := writer.Write(data)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(writer.Close()).To(Succeed())
+	return buffer.Bytes()
+}
+
+var _ = Describe("AaqWasmCalculator", func() {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "test"}}
+	expectedUsage := corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("2Gi")}
+
+	newCalculator := func(binary []byte, memoryLimit int64, timeout time.Duration) *AaqWasmCalculator {
+		calculator, err := NewAaqWasmCalculator("test", binary, memoryLimit, timeout)
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(calculator.Close)
+		return calculator
+	}
+
+	It("should evaluate pods with the module", func() {
+		calculator := newCalculator(newTestWasmModule(abi.Version), 0, 0)
+		Expect(calculatorName(calculator)).To(Equal("wasm/test"))
+		for i := 0; i < 2*maxIdleWasmInstances; i++ {
+			rl, err, match := calculator.PodUsageFunc(pod, []*corev1.Pod{pod})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(match).To(BeTrue())
+			Expect(quota.Equals(rl, expectedUsage)).To(BeTrue())
+		}
+	})
+
+	It("should stop calls that run out of time", func() {
+		calculator := newCalculator(newTestWasmModule(abi.Version, loopForever()), 0, 50*time.Millisecond)
+		_, err, match := calculator.PodUsageFunc(pod, nil)
+		Expect(err).To(MatchError(ContainSubstring("within 50ms")))
+		Expect(match).To(BeFalse())
+		Expect(calculator.idle).To(BeEmpty())
+	})
+
+	It("should not let the module grow its memory beyond the limit", func() {
+		calculator := newCalculator(newTestWasmModule(abi.Version, growMemory(32)), 0, 0)
+		_, err, _ := calculator.PodUsageFunc(pod, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		calculator = newCalculator(newTestWasmModule(abi.Version, growMemory(32)), 1024*1024, 0)
+		_, err, _ = calculator.PodUsageFunc(pod, nil)
+		Expect(err).To(MatchError(ContainSubstring("unreachable")))
+	})
+
+	It("should reject modules that don't implement the ABI", func() {
+		_, err := NewAaqWasmCalculator("test", newTestWasmModule(abi.Version+1), 0, 0)
+		Expect(err).To(MatchError(ContainSubstring("ABI version")))
+		_, err = NewAaqWasmCalculator("test", []byte("not a module"), 0, 0)
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("LoadWasmCalculators", func() {
+		It("should load modules from ConfigMaps", func() {
+			cli := fake.NewSimpleClientset(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "calculators", Namespace: "aaq"},
+				BinaryData: map[string][]byte{"test.wasm": newTestWasmModule(abi.Version)},
+			})
+			calculators, err := LoadWasmCalculators(cli.CoreV1(), "aaq", []v1alpha1.WasmCalculator{
+				{Name: "test", ConfigMap: &v1alpha1.WasmConfigMapSource{Name: "calculators", Key: "test.wasm"}},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(calculators).To(HaveLen(1))
+			defer calculators[0].Close()
+			rl, err, match := calculators[0].PodUsageFunc(pod, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(match).To(BeTrue())
+			Expect(quota.Equals(rl, expectedUsage)).To(BeTrue())
+
+			_, err = LoadWasmCalculators(cli.CoreV1(), "aaq", []v1alpha1.WasmCalculator{
+				{Name: "test", ConfigMap: &v1alpha1.WasmConfigMapSource{Name: "calculators", Key: "other.wasm"}},
+			})
+			Expect(err).To(MatchError(ContainSubstring("no other.wasm key")))
+		})
+
+		It("should reject invalid calculators", func() {
+			cli := fake.NewSimpleClientset()
+			for _, calculator := range []v1alpha1.WasmCalculator{
+				{Image: "example.com/calculator:v1"},
+				{Name: "test"},
+				{Name: "test", Image: "example.com/calculator:v1", ConfigMap: &v1alpha1.WasmConfigMapSource{Name: "calculators", Key: "test.wasm"}},
+			} {
+				_, err := LoadWasmCalculators(cli.CoreV1(), "aaq", []v1alpha1.WasmCalculator{calculator})
+				Expect(err).To(HaveOccurred())
+			}
+		})
+
+		DescribeTable("should pull modules from images", func(layer func([]byte) []byte, mediaType types.MediaType) {
+			server := httptest.NewTLSServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+			DeferCleanup(server.Close)
+			image := fmt.Sprintf("%s/calculators/test:v1", strings.TrimPrefix(server.URL, "https://"))
+			ref, err := name.ParseReference(image)
+			Expect(err).ToNot(HaveOccurred())
+			img, err := mutate.AppendLayers(empty.Image, static.NewLayer(layer(newTestWasmModule(abi.Version)), mediaType))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(remote.Write(ref, img, remote.WithTransport(server.Client().Transport))).To(Succeed())
+
+			binary, err := pullWasmModule(image, remote.WithTransport(server.Client().Transport))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(binary).To(Equal(newTestWasmModule(abi.Version)))
+		},
+			Entry("as a wasm layer", func(binary []byte) []byte { return binary }, WasmLayerMediaType),
+			Entry("as a .wasm file", func(binary []byte) []byte { return tarWithFile("plugin/calculator.wasm", binary) }, types.OCIUncompressedLayer),
+		)
+	})
+})
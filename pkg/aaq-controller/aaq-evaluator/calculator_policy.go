@@ -0,0 +1,218 @@
+package aaq_evaluator
+
+import (
+	"errors"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"kubevirt.io/application-aware-quota/pkg/log"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCalculatorTimeout              = time.Minute
+	defaultCircuitBreakerFailureThreshold = 5
+	defaultCircuitBreakerOpenDuration     = 30 * time.Second
+	circuitBreakerOpenErr                 = "circuit breaker is open, the calculator isn't called until %v"
+	evaluatorUnavailableErr               = "evaluator is unavailable: %s"
+)
+
+// uncachedByDefaultPrefixes are the prefixes of the calculators whose usages are only cached when their policy sets a
+// cache TTL. Their usages may depend on the other pods or on objects the registry isn't told about
+var uncachedByDefaultPrefixes = []string{"sidecar/", "remote/", "wasm/", "cel/"}
+
+// calculatorPolicy is the CalculatorPolicy of a calculator with the defaults applied
+type calculatorPolicy struct {
+	failurePolicy v1alpha1.CalculatorFailurePolicy
+	timeout       time.Duration
+	// attempts is the number of times the calculator is called before it is considered failed
+	attempts         int
+	failureThreshold int
+	openDuration     time.Duration
+	priority         int
+	// cacheTTL is how long the usages of the calculator are cached, zero disables caching them
+	cacheTTL time.Duration
+}
+
+// circuitBreaker tracks the evaluations a calculator failed in a row
+type circuitBreaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+// unavailableCalculator stands for a sidecar or a remote evaluator that is down, it fails to evaluate every pod
+type unavailableCalculator struct {
+	name    string
+	message string
+}
+
+func (c *unavailableCalculator) PodUsageFunc(_ *corev1.Pod, _ []*corev1.Pod) (corev1.ResourceList, error, bool) {
+	return nil, fmt.Errorf(evaluatorUnavailableErr, c.message), false
+}
+
+func (c *unavailableCalculator) Name() string {
+	return c.name
+}
+
+// CalculatorFailedError is returned when a calculator with the FailClosed policy fails to evaluate a pod,
+// its usage must then not be replaced by the usage of the pod evaluator
+type CalculatorFailedError struct {
+	Calculator string
+	// Pod is the namespace/name of the pod the calculator failed to evaluate
+	Pod string
+	Err string
+}
+
+func (e *CalculatorFailedError) Error() string {
+	return fmt.Sprintf("calculator %s failed to evaluate pod %s: %s", e.Calculator, e.Pod, e.Err)
+}
+
+// AsCalculatorFailedError returns the CalculatorFailedError err wraps or aggregates, if any
+func AsCalculatorFailedError(err error) (*CalculatorFailedError, bool) {
+	var calculatorErr *CalculatorFailedError
+	if errors.As(err, &calculatorErr) {
+		return calculatorErr, true
+	}
+	var aggregate utilerrors.Aggregate
+	if errors.As(err, &aggregate) {
+		for _, aggregatedErr := range aggregate.Errors() {
+			if calculatorErr, ok := AsCalculatorFailedError(aggregatedErr); ok {
+				return calculatorErr, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// SetCalculatorPolicies replaces the policies calculators are matched against by name, the first matching policy applies
+func (aaqe *AaqEvaluatorRegistry) SetCalculatorPolicies(policies []v1alpha1.CalculatorPolicy) error {
+	for _, policy := range policies {
+		if _, err := path.Match(policy.Calculator, ""); err != nil {
+			return fmt.Errorf("invalid calculator pattern %q: %v", policy.Calculator, err)
+		}
+		switch policy.FailurePolicy {
+		case "", v1alpha1.FailClosed, v1alpha1.FailOpen, v1alpha1.Fallback:
+		default:
+			return fmt.Errorf("invalid failure policy %q for calculator %q", policy.FailurePolicy, policy.Calculator)
+		}
+	}
+	aaqe.lock.Lock()
+	defer aaqe.lock.Unlock()
+	aaqe.policies = policies
+	for _, sidecar := range aaqe.sidecars {
+		sidecar.calculator.timeout = aaqe.policyLocked(calculatorName(sidecar.calculator)).timeout
+	}
+	for _, remote := range aaqe.remotes {
+		remote.calculator.timeout = aaqe.policyLocked(calculatorName(remote.calculator)).timeout
+	}
+	return nil
+}
+
+func (aaqe *AaqEvaluatorRegistry) policy(calculator string) calculatorPolicy {
+	aaqe.lock.RLock()
+	defer aaqe.lock.RUnlock()
+	return aaqe.policyLocked(calculator)
+}
+
+// policyLocked must be called with the lock held
+func (aaqe *AaqEvaluatorRegistry) policyLocked(calculator string) calculatorPolicy {
+	policy := calculatorPolicy{
+		failurePolicy:    v1alpha1.Fallback,
+		timeout:          defaultCalculatorTimeout,
+		attempts:         aaqe.retriesOnMatchFailure,
+		failureThreshold: defaultCircuitBreakerFailureThreshold,
+		openDuration:     defaultCircuitBreakerOpenDuration,
+		cacheTTL:         aaqe.usageCacheTTL,
+	}
+	for _, prefix := range uncachedByDefaultPrefixes {
+		if strings.HasPrefix(calculator, prefix) {
+			policy.cacheTTL = 0
+		}
+	}
+	for _, configured := range aaqe.policies {
+		if match, _ := path.Match(configured.Calculator, calculator); !match {
+			continue
+		}
+		if configured.FailurePolicy != "" {
+			policy.failurePolicy = configured.FailurePolicy
+		}
+		if configured.Timeout != nil {
+			policy.timeout = configured.Timeout.Duration
+		}
+		if configured.Retries != nil {
+			policy.attempts = int(*configured.Retries) + 1
+		}
+		if configured.CircuitBreaker.FailureThreshold != nil {
+			policy.failureThreshold = int(*configured.CircuitBreaker.FailureThreshold)
+		}
+		if configured.CircuitBreaker.OpenDuration != nil {
+			policy.openDuration = configured.CircuitBreaker.OpenDuration.Duration
+		}
+		if configured.Priority != nil {
+			policy.priority = int(*configured.Priority)
+		}
+		if configured.CacheTTL != nil {
+			policy.cacheTTL = configured.CacheTTL.Duration
+		}
+		break
+	}
+	return policy
+}
+
+// coversUnavailableLocked returns whether the calculator must stay evaluated while it is down, which it must unless its
+// policy admits the pods it fails to evaluate anyway. It must be called with the lock held
+func (aaqe *AaqEvaluatorRegistry) coversUnavailableLocked(calculator string) bool {
+	failurePolicy := aaqe.policyLocked(calculator).failurePolicy
+	return failurePolicy == v1alpha1.FailClosed || failurePolicy == v1alpha1.Fallback
+}
+
+// breakerOpenUntil returns when the circuit breaker of the calculator closes, or zero if the calculator can be called
+func (aaqe *AaqEvaluatorRegistry) breakerOpenUntil(calculator string) time.Time {
+	aaqe.breakersLock.Lock()
+	defer aaqe.breakersLock.Unlock()
+	breaker, exists := aaqe.breakers[calculator]
+	if !exists || !aaqe.clock.Now().Before(breaker.openUntil) {
+		return time.Time{}
+	}
+	return breaker.openUntil
+}
+
+// recordEvaluation opens the circuit breaker of the calculator once it failed failureThreshold evaluations in a row.
+// After openDuration the calculator is called again and a single failure opens the breaker again, until it succeeds
+func (aaqe *AaqEvaluatorRegistry) recordEvaluation(calculator string, policy calculatorPolicy, failed bool) {
+	aaqe.breakersLock.Lock()
+	defer aaqe.breakersLock.Unlock()
+	if !failed {
+		delete(aaqe.breakers, calculator)
+		return
+	}
+	if policy.failureThreshold <= 0 {
+		return
+	}
+	breaker, exists := aaqe.breakers[calculator]
+	if !exists {
+		breaker = &circuitBreaker{}
+		aaqe.breakers[calculator] = breaker
+	}
+	breaker.failures++
+	if breaker.failures >= policy.failureThreshold {
+		breaker.openUntil = aaqe.clock.Now().Add(policy.openDuration)
+		log.Log.Infof("Opening the circuit breaker of calculator %s after %d failed evaluations, it isn't called for %v",
+			calculator, breaker.failures, policy.openDuration)
+	}
+}
+
+// applyFailurePolicy returns whether the pod is accepted by a calculator that failed to evaluate it,
+// and the error to fail its evaluation with if the calculator fails closed
+func (aaqe *AaqEvaluatorRegistry) applyFailurePolicy(calculatorUsage CalculatorUsage, pod *corev1.Pod) (bool, error) {
+	switch aaqe.policy(calculatorUsage.Calculator).failurePolicy {
+	case v1alpha1.FailClosed:
+		return false, &CalculatorFailedError{Calculator: calculatorUsage.Calculator, Pod: pod.Namespace + "/" + pod.Name, Err: calculatorUsage.Error}
+	case v1alpha1.FailOpen:
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,186 @@
+package aaq_evaluator
+
+import (
+	"context"
+	"fmt"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	ggrpc "google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	v1 "k8s.io/client-go/listers/core/v1"
+	testingclock "k8s.io/utils/clock/testing"
+	"k8s.io/utils/pointer"
+	fakeinformers "kubevirt.io/application-aware-quota/pkg/tests-utils"
+	pbv2 "kubevirt.io/application-aware-quota/pkg/util/net/generated/v2"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"path/filepath"
+	"time"
+)
+
+// slowSidecar answers after delay
+type slowSidecar struct {
+	fakeSidecarV2
+	delay time.Duration
+}
+
+func (ss *slowSidecar) PodUsageFunc(ctx context.Context, request *pbv2.PodUsageRequest) (*pbv2.PodUsageResponse, error) {
+	select {
+	case <-time.After(ss.delay):
+	case <-ctx.Done():
+	}
+	return ss.fakeSidecarV2.PodUsageFunc(ctx, request)
+}
+
+var _ = Describe("Calculator policies", func() {
+	const fakeCalculatorName = "aaq_evaluator.FakeUsageCalculator"
+	var registry *AaqEvaluatorRegistry
+	var fakeClock *testingclock.FakeClock
+	var calls int
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "test"},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:      "ctr",
+			Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("100Mi")}},
+		}}},
+	}
+
+	failingCalculator := func() *FakeUsageCalculator {
+		return NewFakeUsageCalculator(func(_ *corev1.Pod, _ []*corev1.Pod) (corev1.ResourceList, error, bool) {
+			calls++
+			return nil, fmt.Errorf("calculator failure"), false
+		})
+	}
+
+	newEvaluator := func() *AaqEvaluator {
+		podInformer := fakeinformers.NewFakeSharedIndexInformer([]metav1.Object{pod})
+		return NewAaqEvaluator(v1.NewPodLister(podInformer.GetIndexer()), registry, fakeClock)
+	}
+
+	setPolicy := func(policy v1alpha1.CalculatorPolicy) {
+		Expect(registry.SetCalculatorPolicies([]v1alpha1.CalculatorPolicy{policy})).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		registry = newAaqEvaluatorsRegistry(1, "/fakeSocketSharedDirectory")
+		fakeClock = testingclock.NewFakeClock(time.Now())
+		registry.clock = fakeClock
+		calls = 0
+	})
+
+	It("should fall back to the pod evaluator by default", func() {
+		registry.Add(failingCalculator())
+		usage, err := newEvaluator().Usage(pod)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quota.Equals(usage, corev1.ResourceList{
+			corev1.ResourceRequestsMemory: resource.MustParse("100Mi"),
+			corev1.ResourceMemory:         resource.MustParse("100Mi"),
+			corev1.ResourcePods:           resource.MustParse("1"),
+			"count/pods":                  resource.MustParse("1"),
+		})).To(BeTrue())
+	})
+
+	It("should fail the evaluation of pods a FailClosed calculator failed to evaluate", func() {
+		setPolicy(v1alpha1.CalculatorPolicy{Calculator: "aaq_evaluator.*", FailurePolicy: v1alpha1.FailClosed})
+		registry.Add(failingCalculator())
+		eval := newEvaluator()
+		_, breakdown, err := eval.UsageBreakdown(pod)
+		calculatorErr, failedClosed := AsCalculatorFailedError(err)
+		Expect(failedClosed).To(BeTrue())
+		Expect(calculatorErr.Calculator).To(Equal(fakeCalculatorName))
+		Expect(calculatorErr.Pod).To(Equal("test/pod"))
+		Expect(breakdown).To(Equal([]CalculatorUsage{{Calculator: fakeCalculatorName, Error: "calculator failure"}}))
+
+		_, err = eval.UsageStats(quota.UsageStatsOptions{Namespace: "test", Resources: []corev1.ResourceName{corev1.ResourceRequestsMemory}})
+		_, failedClosed = AsCalculatorFailedError(err)
+		Expect(failedClosed).To(BeTrue())
+	})
+
+	It("should admit pods a FailOpen calculator failed to evaluate without its usage", func() {
+		setPolicy(v1alpha1.CalculatorPolicy{Calculator: fakeCalculatorName, FailurePolicy: v1alpha1.FailOpen})
+		registry.Add(failingCalculator())
+		usage, err := newEvaluator().Usage(pod)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(usage).To(BeEmpty())
+	})
+
+	It("should apply the first matching policy", func() {
+		Expect(registry.SetCalculatorPolicies([]v1alpha1.CalculatorPolicy{
+			{Calculator: "sidecar/*", FailurePolicy: v1alpha1.FailClosed},
+			{Calculator: "*", FailurePolicy: v1alpha1.FailOpen},
+			{Calculator: fakeCalculatorName, FailurePolicy: v1alpha1.FailClosed},
+		})).To(Succeed())
+		Expect(registry.policy("sidecar/evaluator").failurePolicy).To(Equal(v1alpha1.FailClosed))
+		Expect(registry.policy(fakeCalculatorName).failurePolicy).To(Equal(v1alpha1.FailOpen))
+	})
+
+	It("should reject invalid policies", func() {
+		Expect(registry.SetCalculatorPolicies([]v1alpha1.CalculatorPolicy{{Calculator: "[", FailurePolicy: v1alpha1.FailOpen}})).ToNot(Succeed())
+		Expect(registry.SetCalculatorPolicies([]v1alpha1.CalculatorPolicy{{Calculator: "*", FailurePolicy: "Ignore"}})).ToNot(Succeed())
+	})
+
+	It("should retry failed calls within the retries of the policy", func() {
+		setPolicy(v1alpha1.CalculatorPolicy{Calculator: "*", Retries: pointer.Int32(2),
+			CircuitBreaker: v1alpha1.CircuitBreaker{FailureThreshold: pointer.Int32(0)}})
+		registry.Add(failingCalculator())
+		_, err := registry.Usage(pod, nil)
+		Expect(err).To(HaveOccurred())
+		Expect(calls).To(Equal(3))
+	})
+
+	It("should stop calling a calculator that keeps failing until its circuit breaker closes", func() {
+		setPolicy(v1alpha1.CalculatorPolicy{Calculator: "*", FailurePolicy: v1alpha1.FailClosed, CircuitBreaker: v1alpha1.CircuitBreaker{
+			FailureThreshold: pointer.Int32(2),
+			OpenDuration:     &metav1.Duration{Duration: time.Minute},
+		}})
+		failing := true
+		registry.Add(NewFakeUsageCalculator(func(_ *corev1.Pod, _ []*corev1.Pod) (corev1.ResourceList, error, bool) {
+			calls++
+			if failing {
+				return nil, fmt.Errorf("calculator failure"), false
+			}
+			return corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")}, nil, true
+		}))
+		for i := 0; i < 3; i++ {
+			_, err := registry.Usage(pod, nil)
+			_, failedClosed := AsCalculatorFailedError(err)
+			Expect(failedClosed).To(BeTrue())
+		}
+		Expect(calls).To(Equal(2))
+
+		// once the breaker closes a single failure opens it again
+		fakeClock.Step(time.Minute)
+		_, err := registry.Usage(pod, nil)
+		Expect(err).To(HaveOccurred())
+		_, err = registry.Usage(pod, nil)
+		Expect(err).To(HaveOccurred())
+		Expect(calls).To(Equal(3))
+
+		fakeClock.Step(time.Minute)
+		failing = false
+		usage, err := registry.Usage(pod, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quota.Equals(usage, corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")})).To(BeTrue())
+		Expect(registry.breakers).To(BeEmpty())
+	})
+
+	It("should time out calls to sidecars after the timeout of their policy", func() {
+		socketDir := newSocketDir()
+		serveSidecar(filepath.Join(socketDir, "slow.sock"), func(server *ggrpc.Server) {
+			pbv2.RegisterPodUsageServer(server, &slowSidecar{delay: time.Minute})
+		})
+		registry = newAaqEvaluatorsRegistry(1, socketDir)
+		setPolicy(v1alpha1.CalculatorPolicy{Calculator: "sidecar/slow", FailurePolicy: v1alpha1.FailClosed, Timeout: &metav1.Duration{Duration: 100 * time.Millisecond}})
+		Expect(registry.Sync()).To(Succeed())
+
+		start := time.Now()
+		_, err := registry.Usage(pod, nil)
+		Expect(time.Since(start)).To(BeNumerically("<", 10*time.Second))
+		calculatorErr, failedClosed := AsCalculatorFailedError(err)
+		Expect(failedClosed).To(BeTrue())
+		Expect(calculatorErr.Calculator).To(Equal("sidecar/slow"))
+	})
+})
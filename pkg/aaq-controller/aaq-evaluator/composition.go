@@ -0,0 +1,127 @@
+package aaq_evaluator
+
+import (
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	"k8s.io/client-go/tools/record"
+	"kubevirt.io/application-aware-quota/pkg/log"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"sort"
+	"strings"
+)
+
+const (
+	// CalculatorConflictReason is the reason of the event emitted on pods matched by more than one calculator
+	CalculatorConflictReason = "CalculatorConflict"
+	// maxReportedConflicts bounds the pods conflicts are remembered for, each pod is reported once
+	maxReportedConflicts = 10000
+)
+
+// SetCompositionStrategy sets how the usages of the calculators matching the same pod are combined
+func (aaqe *AaqEvaluatorRegistry) SetCompositionStrategy(strategy v1alpha1.CalculatorCompositionStrategy) error {
+	switch strategy {
+	case "":
+		strategy = v1alpha1.SumComposition
+	case v1alpha1.SumComposition, v1alpha1.FirstMatchComposition, v1alpha1.MaxComposition:
+	default:
+		return fmt.Errorf("invalid calculator composition strategy %q", strategy)
+	}
+	aaqe.lock.Lock()
+	defer aaqe.lock.Unlock()
+	aaqe.compositionStrategy = strategy
+	return nil
+}
+
+// SetEventRecorder sets the recorder pods matched by more than one calculator are reported with
+func (aaqe *AaqEvaluatorRegistry) SetEventRecorder(recorder record.EventRecorder) {
+	aaqe.conflictsLock.Lock()
+	defer aaqe.conflictsLock.Unlock()
+	aaqe.recorder = recorder
+}
+
+func (aaqe *AaqEvaluatorRegistry) strategy() v1alpha1.CalculatorCompositionStrategy {
+	aaqe.lock.RLock()
+	defer aaqe.lock.RUnlock()
+	if aaqe.compositionStrategy == "" {
+		return v1alpha1.SumComposition
+	}
+	return aaqe.compositionStrategy
+}
+
+// sortCalculators orders the calculators by the priority of their policy, then by name, it must be called with the lock held
+func (aaqe *AaqEvaluatorRegistry) sortCalculators(calculators []AaqCalculator) {
+	type orderedCalculator struct {
+		calculator AaqCalculator
+		name       string
+		priority   int
+	}
+	ordered := make([]orderedCalculator, 0, len(calculators))
+	for _, calculator := range calculators {
+		name := calculatorName(calculator)
+		ordered = append(ordered, orderedCalculator{calculator: calculator, name: name, priority: aaqe.policyLocked(name).priority})
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].priority != ordered[j].priority {
+			return ordered[i].priority > ordered[j].priority
+		}
+		return ordered[i].name < ordered[j].name
+	})
+	for i := range ordered {
+		calculators[i] = ordered[i].calculator
+	}
+}
+
+// compose combines the usages of the calculators that matched the pod, which are in the order of the calculators
+func (aaqe *AaqEvaluatorRegistry) compose(pod *corev1.Pod, matched []CalculatorUsage) corev1.ResourceList {
+	if len(matched) == 0 {
+		return nil
+	}
+	strategy := aaqe.strategy()
+	if len(matched) > 1 {
+		aaqe.reportConflict(pod, matched, strategy)
+	}
+	switch strategy {
+	case v1alpha1.FirstMatchComposition:
+		return quota.Add(corev1.ResourceList{}, matched[0].Usage)
+	case v1alpha1.MaxComposition:
+		usage := corev1.ResourceList{}
+		for _, calculatorUsage := range matched {
+			usage = quota.Max(usage, calculatorUsage.Usage)
+		}
+		return usage
+	}
+	var usage corev1.ResourceList
+	for _, calculatorUsage := range matched {
+		usage = quota.Add(usage, calculatorUsage.Usage)
+	}
+	return usage
+}
+
+// reportConflict emits an event on a pod matched by more than one calculator, once per pod
+func (aaqe *AaqEvaluatorRegistry) reportConflict(pod *corev1.Pod, matched []CalculatorUsage, strategy v1alpha1.CalculatorCompositionStrategy) {
+	key := string(pod.UID)
+	if key == "" {
+		key = pod.Namespace + "/" + pod.Name
+	}
+	aaqe.conflictsLock.Lock()
+	defer aaqe.conflictsLock.Unlock()
+	if aaqe.reportedConflicts[key] {
+		return
+	}
+	if len(aaqe.reportedConflicts) >= maxReportedConflicts {
+		aaqe.reportedConflicts = make(map[string]bool)
+	}
+	aaqe.reportedConflicts[key] = true
+
+	var names []string
+	for _, calculatorUsage := range matched {
+		names = append(names, calculatorUsage.Calculator)
+	}
+	message := fmt.Sprintf("Pod is matched by calculators %s, their usages are combined with the %s composition",
+		strings.Join(names, ", "), strategy)
+	log.Log.Infof("%s/%s: %s", pod.Namespace, pod.Name, message)
+	if aaqe.recorder != nil {
+		aaqe.recorder.Event(pod, corev1.EventTypeWarning, CalculatorConflictReason, message)
+	}
+}
@@ -0,0 +1,105 @@
+package aaq_evaluator
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+)
+
+// namedCalculator matches every pod with a fixed usage
+type namedCalculator struct {
+	name  string
+	usage corev1.ResourceList
+}
+
+func (nc *namedCalculator) Name() string {
+	return nc.name
+}
+
+func (nc *namedCalculator) PodUsageFunc(_ *corev1.Pod, _ []*corev1.Pod) (corev1.ResourceList, error, bool) {
+	return nc.usage, nil, true
+}
+
+var _ = Describe("Calculator composition", func() {
+	var registry *AaqEvaluatorRegistry
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "test", UID: "pod-uid"}}
+	memoryAndCPU := func(memory, cpu string) corev1.ResourceList {
+		return corev1.ResourceList{
+			corev1.ResourceRequestsMemory: resource.MustParse(memory),
+			corev1.ResourceRequestsCPU:    resource.MustParse(cpu),
+		}
+	}
+
+	BeforeEach(func() {
+		registry = newAaqEvaluatorsRegistry(1, "/fakeSocketSharedDirectory")
+		registry.Add(&namedCalculator{name: "b", usage: memoryAndCPU("1Gi", "2")})
+		registry.Add(&namedCalculator{name: "a", usage: memoryAndCPU("2Gi", "1")})
+	})
+
+	DescribeTable("should combine the usages of the matching calculators", func(strategy v1alpha1.CalculatorCompositionStrategy, expectedUsage corev1.ResourceList) {
+		Expect(registry.SetCompositionStrategy(strategy)).To(Succeed())
+		usage, breakdown, err := registry.UsageBreakdown(pod, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quota.Equals(usage, expectedUsage)).To(BeTrue(), "usage is %v", usage)
+		Expect(breakdown).To(HaveLen(2))
+
+		usages, errs := registry.UsageBatch([]*corev1.Pod{pod}, nil)
+		Expect(errs[0]).ToNot(HaveOccurred())
+		Expect(quota.Equals(usages[0], expectedUsage)).To(BeTrue(), "usage is %v", usages[0])
+	},
+		Entry("summing them by default", v1alpha1.CalculatorCompositionStrategy(""), memoryAndCPU("3Gi", "3")),
+		Entry("summing them", v1alpha1.SumComposition, memoryAndCPU("3Gi", "3")),
+		Entry("taking the first one by name", v1alpha1.FirstMatchComposition, memoryAndCPU("2Gi", "1")),
+		Entry("taking the maximum of each resource", v1alpha1.MaxComposition, memoryAndCPU("2Gi", "2")),
+	)
+
+	It("should order the calculators by priority, then by name", func() {
+		registry.Add(&namedCalculator{name: "c", usage: memoryAndCPU("4Gi", "4")})
+		Expect(registry.SetCalculatorPolicies([]v1alpha1.CalculatorPolicy{
+			{Calculator: "c", Priority: pointer.Int32(10)},
+			{Calculator: "a", Priority: pointer.Int32(-1)},
+		})).To(Succeed())
+		var names []string
+		for _, calculator := range registry.calculators() {
+			names = append(names, calculatorName(calculator))
+		}
+		Expect(names).To(Equal([]string{"c", "b", "a"}))
+
+		Expect(registry.SetCompositionStrategy(v1alpha1.FirstMatchComposition)).To(Succeed())
+		usage, err := registry.Usage(pod, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(quota.Equals(usage, memoryAndCPU("4Gi", "4"))).To(BeTrue(), "usage is %v", usage)
+	})
+
+	It("should report pods matched by more than one calculator once", func() {
+		recorder := record.NewFakeRecorder(10)
+		registry.SetEventRecorder(recorder)
+		for i := 0; i < 2; i++ {
+			_, err := registry.Usage(pod, nil)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(recorder.Events).To(HaveLen(1))
+		Expect(<-recorder.Events).To(Equal("Warning CalculatorConflict Pod is matched by calculators a, b, their usages are combined with the Sum composition"))
+	})
+
+	It("should not report pods matched by a single calculator", func() {
+		registry = newAaqEvaluatorsRegistry(1, "/fakeSocketSharedDirectory")
+		registry.Add(&namedCalculator{name: "a", usage: memoryAndCPU("2Gi", "1")})
+		recorder := record.NewFakeRecorder(10)
+		registry.SetEventRecorder(recorder)
+		_, err := registry.Usage(pod, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	It("should reject unknown strategies", func() {
+		Expect(registry.SetCompositionStrategy("Average")).ToNot(Succeed())
+	})
+})
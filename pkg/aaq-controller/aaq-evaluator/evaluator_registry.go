@@ -3,14 +3,19 @@ package aaq_evaluator
 import (
 	"context"
 	"fmt"
+	ggrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	corev1 "k8s.io/api/core/v1"
-	quota "k8s.io/apiserver/pkg/quota/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
 	"kubevirt.io/application-aware-quota/pkg/log"
 	"kubevirt.io/application-aware-quota/pkg/util"
 	pb "kubevirt.io/application-aware-quota/pkg/util/net/generated"
+	pbv2 "kubevirt.io/application-aware-quota/pkg/util/net/generated/v2"
 	"kubevirt.io/application-aware-quota/pkg/util/net/grpc"
-	"os"
-	"path/filepath"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"strings"
 	"sync"
 	"time"
 )
@@ -24,23 +29,90 @@ type AaqCalculator interface {
 	PodUsageFunc(pod *corev1.Pod, podsState []*corev1.Pod) (corev1.ResourceList, error, bool)
 }
 
+// AaqBatchCalculator is implemented by calculators that can evaluate many pods against the same pods state at once
+type AaqBatchCalculator interface {
+	AaqCalculator
+	// PodsUsageFunc returns a result for each of the pods, in the same order
+	PodsUsageFunc(pods []*corev1.Pod, podsState []*corev1.Pod) ([]PodUsageResult, error)
+}
+
+// AaqNamedCalculator is implemented by calculators of the same type that are told apart by name
+type AaqNamedCalculator interface {
+	AaqCalculator
+	// Name is the name the calculator is reported and matched by calculator policies with
+	Name() string
+}
+
+// PodUsageResult is the result of a batch calculator for a single pod
+type PodUsageResult struct {
+	ResourceList corev1.ResourceList
+	Match        bool
+	Err          error
+}
+
 type Registry interface {
 	Add(aaqCalculator AaqCalculator)
-	Collect(numberOfRequestedEvaluatorsSidecars uint, timeout time.Duration) error
 	Usage(*corev1.Pod, []*corev1.Pod) (corev1.ResourceList, error)
+	// UsageBreakdown is like Usage but also returns what each calculator computed for the pod
+	UsageBreakdown(*corev1.Pod, []*corev1.Pod) (corev1.ResourceList, []CalculatorUsage, error)
+	// UsageBatch is like Usage for each of the pods, with batch calculators evaluating all of them in a single call
+	UsageBatch([]*corev1.Pod, []*corev1.Pod) ([]corev1.ResourceList, []error)
+	// RecomputeUsageBatch is like UsageBatch but evaluates the pods again rather than reusing their cached usages,
+	// which are replaced by the new ones
+	RecomputeUsageBatch([]*corev1.Pod, []*corev1.Pod) ([]corev1.ResourceList, []error)
+}
+
+// CalculatorUsage is the result of a single calculator for a pod
+type CalculatorUsage struct {
+	// Calculator names the calculator, sidecar calculators are named after their container and remote ones after the evaluator
+	Calculator string              `json:"calculator"`
+	Usage      corev1.ResourceList `json:"usage,omitempty"`
+	Match      bool                `json:"match"`
+	Error      string              `json:"error,omitempty"`
 }
 
 type AaqEvaluatorRegistry struct {
-	aaqCalculators        []AaqCalculator
+	lock           sync.RWMutex
+	aaqCalculators []AaqCalculator
+	// sidecars are keyed by the name of their socket in socketSharedDirectory
+	sidecars              map[string]*sidecar
 	socketSharedDirectory string
+	// remotes are keyed by evaluator name
+	remotes map[string]*remoteEvaluator
 	// used to track time
 	retriesOnMatchFailure int
+	probePeriod           time.Duration
+	policies              []v1alpha1.CalculatorPolicy
+	// breakers are keyed by calculator name
+	breakersLock sync.Mutex
+	breakers     map[string]*circuitBreaker
+	clock        clock.Clock
+	// compositionStrategy combines the usages of the calculators matching the same pod
+	compositionStrategy v1alpha1.CalculatorCompositionStrategy
+	// reportedConflicts are the pods already reported as matched by more than one calculator
+	conflictsLock     sync.Mutex
+	reportedConflicts map[string]bool
+	recorder          record.EventRecorder
+	// usageCacheTTL is how long usages are cached unless a calculator policy overrides it
+	usageCacheTTL time.Duration
+	usageCache    *usageCache
+	// calculatorPodFields are the pod fields the calculators that can't declare theirs require
+	calculatorPodFields []string
 }
 
 func newAaqEvaluatorsRegistry(retriesOnMatchFailure int, socketSharedDirectory string) *AaqEvaluatorRegistry {
 	return &AaqEvaluatorRegistry{
+		sidecars:              make(map[string]*sidecar),
+		remotes:               make(map[string]*remoteEvaluator),
 		retriesOnMatchFailure: retriesOnMatchFailure,
 		socketSharedDirectory: socketSharedDirectory,
+		probePeriod:           sidecarsProbePeriod,
+		breakers:              make(map[string]*circuitBreaker),
+		clock:                 clock.RealClock{},
+		compositionStrategy:   v1alpha1.SumComposition,
+		reportedConflicts:     make(map[string]bool),
+		usageCacheTTL:         util.DefaultUsageCacheTTL,
+		usageCache:            newUsageCache(util.DefaultUsageCacheMaxEntries, clock.RealClock{}),
 	}
 }
 
@@ -51,98 +123,268 @@ func GetAaqEvaluatorsRegistry() *AaqEvaluatorRegistry {
 	return aaqEvaluatorsRegistry
 }
 
-func (aaqe *AaqEvaluatorRegistry) Collect(numberOfRequestedEvaluatorsSidecars uint, timeout time.Duration) error {
-	socketsPaths, err := aaqe.collectSidecarSockets(numberOfRequestedEvaluatorsSidecars, timeout)
-	if err != nil {
-		return err
-	}
-	for _, socketPath := range socketsPaths {
-		aaqe.aaqCalculators = append(aaqe.aaqCalculators, &AaqSocketCalculator{socketPath})
-	}
-	log.Log.Info("Collected all requested evaluators sidecars sockets")
-	return nil
-}
-
 func (aaqe *AaqEvaluatorRegistry) Add(aaqCalculator AaqCalculator) {
+	if dependent, ok := aaqCalculator.(AaqDependentCalculator); ok {
+		dependent.OnDependencyChange(aaqe.invalidateUsages)
+	}
+	aaqe.lock.Lock()
+	defer aaqe.lock.Unlock()
 	aaqe.aaqCalculators = append(aaqe.aaqCalculators, aaqCalculator)
 }
 
-func (aaqe *AaqEvaluatorRegistry) collectSidecarSockets(numberOfRequestedEvaluatorsSidecars uint, timeout time.Duration) ([]string, error) {
-	var sidecarSockets []string
-	processedSockets := make(map[string]bool)
-
-	timeoutCh := time.After(timeout)
-
-	for uint(len(processedSockets)) < numberOfRequestedEvaluatorsSidecars {
-		sockets, err := os.ReadDir(aaqe.socketSharedDirectory)
-		if err != nil {
-			return nil, err
+// calculators returns the in-process calculators, the sidecars and the remote evaluators, ordered by priority and name.
+// Sidecars and remote evaluators that are down are only returned if a FailClosed or Fallback policy covers them,
+// as calculators that always fail, so that their policy applies to the pods they would have evaluated
+func (aaqe *AaqEvaluatorRegistry) calculators() []AaqCalculator {
+	aaqe.lock.RLock()
+	defer aaqe.lock.RUnlock()
+	calculators := append([]AaqCalculator{}, aaqe.aaqCalculators...)
+	for _, socket := range aaqe.sortedSockets() {
+		sidecar := aaqe.sidecars[socket]
+		if sidecar.status.Healthy {
+			calculators = append(calculators, sidecar.calculator)
+		} else if name := calculatorName(sidecar.calculator); aaqe.coversUnavailableLocked(name) {
+			calculators = append(calculators, &unavailableCalculator{name: name, message: sidecar.status.Message})
 		}
-		for _, socket := range sockets {
-			select {
-			case <-timeoutCh:
-				return nil, fmt.Errorf("Failed to collect all expected evaluators sidecars sockets within given timeout")
-			default:
-				if _, processed := processedSockets[socket.Name()]; processed {
-					continue
-				}
-
-				callBackClient, notReady, err := processSideCarSocket(filepath.Join(aaqe.socketSharedDirectory, socket.Name()))
-				if notReady {
-					log.Log.Info("Sidecar server might not be ready yet, retrying in the next iteration")
-					continue
-				} else if err != nil {
-					log.Log.Reason(err).Infof("Failed to process sidecar socket: %s", socket.Name())
-					return nil, err
-				}
-				sidecarSockets = append(sidecarSockets, callBackClient)
-				processedSockets[socket.Name()] = true
-			}
+	}
+	for _, name := range aaqe.sortedRemotes() {
+		remote := aaqe.remotes[name]
+		if remote.healthy {
+			calculators = append(calculators, remote.calculator)
+		} else if name := calculatorName(remote.calculator); aaqe.coversUnavailableLocked(name) {
+			calculators = append(calculators, &unavailableCalculator{name: name, message: remote.message})
 		}
-		time.Sleep(time.Second)
 	}
-	return sidecarSockets, nil
+	aaqe.sortCalculators(calculators)
+	return calculators
 }
 
-func processSideCarSocket(socketPath string) (string, bool, error) {
+func processSideCarSocket(socketPath string) (*AaqSocketCalculator, bool, error) {
 	conn, err := grpc.DialSocketWithTimeout(socketPath, 1)
 	if err != nil {
 		log.Log.Reason(err).Infof(dialSockErr, socketPath)
-		return "", true, nil
+		return nil, true, nil
 	}
 	defer conn.Close()
 
-	infoClient := pb.NewPodUsageClient(conn)
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
-	health, err := infoClient.HealthCheck(ctx, &pb.HealthCheckRequest{})
-	if err != nil || health == nil || !health.Healthy {
+	protocolVersion, healthy, err := negotiateProtocolVersion(ctx, conn)
+	if err != nil || !healthy {
 		if err == nil {
 			err = fmt.Errorf("HealthCheck failed with following socket: %v", socketPath)
 		}
-		return "", false, err
+		return nil, false, err
 	}
-	return socketPath, false, nil
+	return &AaqSocketCalculator{sidecarSocketPath: socketPath, protocolVersion: protocolVersion}, false, nil
+}
+
+// negotiateProtocolVersion health checks the sidecar with the newest protocol it serves.
+// Sidecars that predate v2 don't implement its service, so they are spoken to in v1
+func negotiateProtocolVersion(ctx context.Context, conn *ggrpc.ClientConn) (int, bool, error) {
+	health, err := pbv2.NewPodUsageClient(conn).HealthCheck(ctx, &pbv2.HealthCheckRequest{})
+	if status.Code(err) != codes.Unimplemented {
+		return SidecarProtocolV2, health.GetHealthy(), err
+	}
+	healthV1, err := pb.NewPodUsageClient(conn).HealthCheck(ctx, &pb.HealthCheckRequest{})
+	return SidecarProtocolV1, healthV1.GetHealthy(), err
+}
+
+func (aaqe *AaqEvaluatorRegistry) Usage(pod *corev1.Pod, podsState []*corev1.Pod) (corev1.ResourceList, error) {
+	rl, _, err := aaqe.UsageBreakdown(pod, podsState)
+	return rl, err
 }
 
-func (aaqe *AaqEvaluatorRegistry) Usage(pod *corev1.Pod, podsState []*corev1.Pod) (rlToRet corev1.ResourceList, acceptedErr error) {
+// UsageBreakdown fails with a CalculatorFailedError when a calculator with the FailClosed policy fails to evaluate the pod
+func (aaqe *AaqEvaluatorRegistry) UsageBreakdown(pod *corev1.Pod, podsState []*corev1.Pod) (rlToRet corev1.ResourceList, breakdown []CalculatorUsage, acceptedErr error) {
 	accepted := false
-	for _, calculator := range aaqe.aaqCalculators {
-		for retries := 0; retries < aaqe.retriesOnMatchFailure; retries++ {
-			rl, err, match := calculator.PodUsageFunc(pod, podsState)
-			if !match && err == nil {
-				break
-			} else if err == nil {
-				accepted = true
-				rlToRet = quota.Add(rlToRet, rl)
-				break
-			} else {
-				log.Log.Infof(fmt.Sprintf("Retries: %v Error: %v ", retries, err))
+	var failedErr error
+	var matched []CalculatorUsage
+	for _, calculator := range aaqe.calculators() {
+		calculatorUsage := aaqe.calculatorUsage(calculator, pod, podsState, false)
+		if calculatorUsage.Match {
+			accepted = true
+			matched = append(matched, calculatorUsage)
+		} else if calculatorUsage.Error != "" {
+			failedOpen, err := aaqe.applyFailurePolicy(calculatorUsage, pod)
+			accepted = accepted || failedOpen
+			if failedErr == nil {
+				failedErr = err
 			}
 		}
+		breakdown = append(breakdown, calculatorUsage)
 	}
+	if failedErr != nil {
+		return nil, breakdown, failedErr
+	}
+	rlToRet = aaqe.compose(pod, matched)
 	if !accepted {
 		acceptedErr = fmt.Errorf("pod didn't match any usageFunc")
 	}
-	return rlToRet, acceptedErr
+	return rlToRet, breakdown, acceptedErr
+}
+
+func (aaqe *AaqEvaluatorRegistry) UsageBatch(pods []*corev1.Pod, podsState []*corev1.Pod) ([]corev1.ResourceList, []error) {
+	return aaqe.usageBatch(pods, podsState, false)
+}
+
+func (aaqe *AaqEvaluatorRegistry) RecomputeUsageBatch(pods []*corev1.Pod, podsState []*corev1.Pod) ([]corev1.ResourceList, []error) {
+	return aaqe.usageBatch(pods, podsState, true)
+}
+
+// usageBatch skips the cached usages when recomputing
+func (aaqe *AaqEvaluatorRegistry) usageBatch(pods []*corev1.Pod, podsState []*corev1.Pod, recompute bool) ([]corev1.ResourceList, []error) {
+	usages := make([]corev1.ResourceList, len(pods))
+	errs := make([]error, len(pods))
+	accepted := make([]bool, len(pods))
+	matched := make([][]CalculatorUsage, len(pods))
+	for _, calculator := range aaqe.calculators() {
+		var calculatorUsages []CalculatorUsage
+		if batchCalculator, ok := calculator.(AaqBatchCalculator); ok {
+			calculatorUsages = aaqe.batchCalculatorUsages(batchCalculator, pods, podsState, recompute)
+		} else {
+			for _, pod := range pods {
+				calculatorUsages = append(calculatorUsages, aaqe.calculatorUsage(calculator, pod, podsState, recompute))
+			}
+		}
+		for i, calculatorUsage := range calculatorUsages {
+			if calculatorUsage.Match {
+				accepted[i] = true
+				matched[i] = append(matched[i], calculatorUsage)
+			} else if calculatorUsage.Error != "" {
+				failedOpen, err := aaqe.applyFailurePolicy(calculatorUsage, pods[i])
+				accepted[i] = accepted[i] || failedOpen
+				if errs[i] == nil {
+					errs[i] = err
+				}
+			}
+		}
+	}
+	for i := range pods {
+		if errs[i] != nil {
+			continue
+		}
+		usages[i] = aaqe.compose(pods[i], matched[i])
+		if !accepted[i] {
+			errs[i] = fmt.Errorf("pod didn't match any usageFunc")
+		}
+	}
+	return usages, errs
+}
+
+// calculatorUsage evaluates the pod with the calculator, retrying as long as the calculator fails within its policy.
+// The usage is reused as long as the pod doesn't change, unless it is recomputed
+func (aaqe *AaqEvaluatorRegistry) calculatorUsage(calculator AaqCalculator, pod *corev1.Pod, podsState []*corev1.Pod, recompute bool) CalculatorUsage {
+	calculatorUsage := CalculatorUsage{Calculator: calculatorName(calculator)}
+	if !recompute {
+		if cachedUsage, cached := aaqe.cachedUsage(pod, calculatorUsage.Calculator); cached {
+			return cachedUsage
+		}
+	}
+	if unavailable, ok := calculator.(*unavailableCalculator); ok {
+		// there is nothing to retry until the evaluator is up again
+		_, err, _ := unavailable.PodUsageFunc(pod, podsState)
+		calculatorUsage.Error = err.Error()
+		return calculatorUsage
+	}
+	if openUntil := aaqe.breakerOpenUntil(calculatorUsage.Calculator); !openUntil.IsZero() {
+		calculatorUsage.Error = fmt.Sprintf(circuitBreakerOpenErr, openUntil)
+		return calculatorUsage
+	}
+	policy := aaqe.policy(calculatorUsage.Calculator)
+	generation := aaqe.usageCache.currentGeneration()
+	for retries := 0; retries < policy.attempts; retries++ {
+		rl, err, match := calculator.PodUsageFunc(pod, podsState)
+		if !match && err == nil {
+			calculatorUsage.Error = ""
+			break
+		} else if err == nil {
+			calculatorUsage.Usage = rl
+			calculatorUsage.Match = true
+			calculatorUsage.Error = ""
+			break
+		} else {
+			calculatorUsage.Error = err.Error()
+			log.Log.Infof(fmt.Sprintf("Retries: %v Error: %v ", retries, err))
+		}
+	}
+	aaqe.recordEvaluation(calculatorUsage.Calculator, policy, calculatorUsage.Error != "")
+	aaqe.cacheUsage(calculator, pod, calculatorUsage, policy, generation)
+	return calculatorUsage
+}
+
+// batchCalculatorUsages evaluates all the pods with the calculator at once, retrying only the pods it failed to evaluate.
+// Pods whose usage is cached aren't sent to the calculator, unless they are recomputed
+func (aaqe *AaqEvaluatorRegistry) batchCalculatorUsages(calculator AaqBatchCalculator, pods []*corev1.Pod, podsState []*corev1.Pod, recompute bool) []CalculatorUsage {
+	name := calculatorName(calculator)
+	calculatorUsages := make([]CalculatorUsage, len(pods))
+	var pending []int
+	for i, pod := range pods {
+		if !recompute {
+			if cachedUsage, cached := aaqe.cachedUsage(pod, name); cached {
+				calculatorUsages[i] = cachedUsage
+				continue
+			}
+		}
+		calculatorUsages[i].Calculator = name
+		pending = append(pending, i)
+	}
+	if len(pending) == 0 {
+		return calculatorUsages
+	}
+	if openUntil := aaqe.breakerOpenUntil(name); !openUntil.IsZero() {
+		for _, i := range pending {
+			calculatorUsages[i].Error = fmt.Sprintf(circuitBreakerOpenErr, openUntil)
+		}
+		return calculatorUsages
+	}
+	evaluated := pending
+	policy := aaqe.policy(name)
+	generation := aaqe.usageCache.currentGeneration()
+	for retries := 0; retries < policy.attempts && len(pending) > 0; retries++ {
+		podsToEvaluate := make([]*corev1.Pod, 0, len(pending))
+		for _, i := range pending {
+			podsToEvaluate = append(podsToEvaluate, pods[i])
+		}
+		results, err := calculator.PodsUsageFunc(podsToEvaluate, podsState)
+		if err != nil {
+			for _, i := range pending {
+				calculatorUsages[i].Error = err.Error()
+			}
+			log.Log.Infof(fmt.Sprintf("Retries: %v Error: %v ", retries, err))
+			continue
+		}
+		var failed []int
+		for j, i := range pending {
+			result := results[j]
+			if result.Err != nil {
+				calculatorUsages[i].Error = result.Err.Error()
+				failed = append(failed, i)
+				continue
+			}
+			calculatorUsages[i].Error = ""
+			if result.Match {
+				calculatorUsages[i].Usage = result.ResourceList
+				calculatorUsages[i].Match = true
+			}
+		}
+		pending = failed
+	}
+	aaqe.recordEvaluation(name, policy, len(pending) > 0)
+	for _, i := range evaluated {
+		aaqe.cacheUsage(calculator, pods[i], calculatorUsages[i], policy, generation)
+	}
+	return calculatorUsages
+}
+
+func calculatorName(calculator AaqCalculator) string {
+	switch c := calculator.(type) {
+	case *AaqSocketCalculator:
+		return "sidecar/" + sidecarName(c.sidecarSocketPath)
+	case *AaqRemoteCalculator:
+		return "remote/" + c.name
+	case AaqNamedCalculator:
+		return c.Name()
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", calculator), "*")
 }
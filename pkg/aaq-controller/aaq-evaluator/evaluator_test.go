@@ -872,6 +872,33 @@ var _ = Describe("AaqEvaluator", func() {
 			registry.Add(fakeCalculator)
 		})
 
+		It("UsageBreakdown should report the result of each calculator", func() {
+			podInformer := fakeinformers.NewFakeSharedIndexInformer([]metav1.Object{testPod})
+			registry.Add(NewFakeUsageCalculator(func(pod *corev1.Pod, podsState []*corev1.Pod) (corev1.ResourceList, error, bool) {
+				return corev1.ResourceList{"cpu": resource.MustParse("100m")}, nil, true
+			}))
+			registry.Add(NewFakeUsageCalculator(func(pod *corev1.Pod, podsState []*corev1.Pod) (corev1.ResourceList, error, bool) {
+				return nil, fmt.Errorf("calculator failure"), false
+			}))
+			eval := NewAaqEvaluator(v1.NewPodLister(podInformer.GetIndexer()), registry, testingclock.NewFakeClock(time.Now()))
+			usage, breakdown, err := eval.UsageBreakdown(testPod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(quota.Equals(usage, corev1.ResourceList{"cpu": resource.MustParse("100m")})).To(BeTrue())
+			Expect(breakdown).To(Equal([]CalculatorUsage{
+				{Calculator: "aaq_evaluator.FakeUsageCalculator", Usage: corev1.ResourceList{"cpu": resource.MustParse("100m")}, Match: true},
+				{Calculator: "aaq_evaluator.FakeUsageCalculator", Error: "calculator failure"},
+			}))
+		})
+
+		It("UsageBreakdown should report the pod evaluator when no calculator matches", func() {
+			podInformer := fakeinformers.NewFakeSharedIndexInformer([]metav1.Object{testPod})
+			eval := NewAaqEvaluator(v1.NewPodLister(podInformer.GetIndexer()), registry, testingclock.NewFakeClock(time.Now()))
+			usage, breakdown, err := eval.UsageBreakdown(testPod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(quota.Equals(usage, testPodUsage)).To(BeTrue())
+			Expect(breakdown).To(Equal([]CalculatorUsage{{Calculator: PodEvaluatorCalculator, Usage: usage, Match: true}}))
+		})
+
 		DescribeTable("Test calculators-registery when ", func(pod *corev1.Pod, expectedUsage corev1.ResourceList,
 			fakeCalc1 *FakeUsageCalculator, fakeCalc2 *FakeUsageCalculator) {
 			pods := []metav1.Object{pod}
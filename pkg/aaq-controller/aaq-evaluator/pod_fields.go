@@ -0,0 +1,45 @@
+package aaq_evaluator
+
+import (
+	"sort"
+)
+
+// AaqPodFieldsCalculator is implemented by calculators that declare which of the strippable pod fields they read,
+// see informers.PodFields. The pods the controller caches are only stripped of the fields no calculator requires
+type AaqPodFieldsCalculator interface {
+	AaqCalculator
+	// RequiredPodFields returns the strippable pod fields the calculator reads
+	RequiredPodFields() []string
+}
+
+// SetCalculatorPodFields sets the pod fields the sidecar, remote, CEL and wasm calculators require. These calculators
+// can't declare their fields, and sidecars are registered after the pods are cached already
+func (aaqe *AaqEvaluatorRegistry) SetCalculatorPodFields(fields []string) {
+	aaqe.lock.Lock()
+	defer aaqe.lock.Unlock()
+	aaqe.calculatorPodFields = append([]string(nil), fields...)
+}
+
+// RequiredPodFields returns the strippable pod fields the calculators require, the ones the in-process calculators
+// declare along with the ones set for the rest of them
+func (aaqe *AaqEvaluatorRegistry) RequiredPodFields() []string {
+	aaqe.lock.RLock()
+	defer aaqe.lock.RUnlock()
+	required := map[string]bool{}
+	for _, field := range aaqe.calculatorPodFields {
+		required[field] = true
+	}
+	for _, calculator := range aaqe.aaqCalculators {
+		if declaring, ok := calculator.(AaqPodFieldsCalculator); ok {
+			for _, field := range declaring.RequiredPodFields() {
+				required[field] = true
+			}
+		}
+	}
+	var fields []string
+	for field := range required {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
@@ -0,0 +1,33 @@
+package aaq_evaluator
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// fieldsCalculator declares the pod fields it reads
+type fieldsCalculator struct {
+	fields []string
+}
+
+func (fc *fieldsCalculator) PodUsageFunc(_ *corev1.Pod, _ []*corev1.Pod) (corev1.ResourceList, error, bool) {
+	return corev1.ResourceList{}, nil, false
+}
+
+func (fc *fieldsCalculator) RequiredPodFields() []string {
+	return fc.fields
+}
+
+var _ = Describe("Required pod fields", func() {
+	It("should require the fields the calculators declare along with the ones set for the rest", func() {
+		registry := newAaqEvaluatorsRegistry(0, "")
+		Expect(registry.RequiredPodFields()).To(BeEmpty())
+
+		registry.Add(&fieldsCalculator{fields: []string{"spec.volumes"}})
+		registry.Add(&fieldsCalculator{fields: []string{"spec.containers.env", "spec.volumes"}})
+		registry.Add(&countingCalculator{})
+		registry.SetCalculatorPodFields([]string{"spec.containers.command"})
+		Expect(registry.RequiredPodFields()).To(Equal([]string{"spec.containers.command", "spec.containers.env", "spec.volumes"}))
+	})
+})
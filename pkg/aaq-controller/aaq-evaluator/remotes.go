@@ -0,0 +1,125 @@
+package aaq_evaluator
+
+import (
+	"context"
+	"fmt"
+	"kubevirt.io/application-aware-quota/pkg/log"
+	"kubevirt.io/application-aware-quota/pkg/util/net/grpc"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"sort"
+	"time"
+)
+
+// remoteHealthCheckTimeout is longer than the one of sidecars since it includes the TLS handshake of a new connection
+const remoteHealthCheckTimeout = 5 * time.Second
+
+// remoteEvaluator tracks an evaluator the controller calls over the network
+type remoteEvaluator struct {
+	calculator *AaqRemoteCalculator
+	healthy    bool
+	// message tells why the evaluator isn't healthy
+	message string
+}
+
+// SetRemoteEvaluators replaces the remote evaluators, which are called presenting the client certificate in certDir
+// and trusting the CA bundle in caDir along with their own CABundle. They are used once a health check succeeds
+func (aaqe *AaqEvaluatorRegistry) SetRemoteEvaluators(evaluators []v1alpha1.RemoteEvaluator, certDir, caDir string) error {
+	remotes := make(map[string]*remoteEvaluator)
+	for _, evaluator := range evaluators {
+		err := validateRemoteEvaluator(evaluator, remotes)
+		var calculator *AaqRemoteCalculator
+		if err == nil {
+			calculator = &AaqRemoteCalculator{name: evaluator.Name, address: evaluator.Address}
+			calculator.conn, err = grpc.DialTLS(evaluator.Address, grpc.MutualTLSConfig(certDir, caDir, evaluator.CABundle))
+		}
+		if err != nil {
+			closeRemotes(remotes)
+			return err
+		}
+		remotes[evaluator.Name] = &remoteEvaluator{calculator: calculator, message: "it wasn't health checked yet"}
+	}
+
+	aaqe.lock.Lock()
+	defer aaqe.lock.Unlock()
+	closeRemotes(aaqe.remotes)
+	for _, remote := range remotes {
+		remote.calculator.timeout = aaqe.policyLocked(calculatorName(remote.calculator)).timeout
+	}
+	aaqe.remotes = remotes
+	return nil
+}
+
+func validateRemoteEvaluator(evaluator v1alpha1.RemoteEvaluator, remotes map[string]*remoteEvaluator) error {
+	if evaluator.Name == "" {
+		return fmt.Errorf("remote evaluator with address %q has no name", evaluator.Address)
+	}
+	if evaluator.Address == "" {
+		return fmt.Errorf("remote evaluator %s has no address", evaluator.Name)
+	}
+	if _, exists := remotes[evaluator.Name]; exists {
+		return fmt.Errorf("remote evaluator %s is listed more than once", evaluator.Name)
+	}
+	return nil
+}
+
+func closeRemotes(remotes map[string]*remoteEvaluator) {
+	for _, remote := range remotes {
+		remote.calculator.conn.Close()
+	}
+}
+
+// syncRemotes health checks the remote evaluators, negotiating the protocol they serve.
+// Unlike sidecars they are never dropped, since their address doesn't change when they restart
+func (aaqe *AaqEvaluatorRegistry) syncRemotes() {
+	aaqe.lock.RLock()
+	remotes := make([]*remoteEvaluator, 0, len(aaqe.remotes))
+	for _, name := range aaqe.sortedRemotes() {
+		remotes = append(remotes, aaqe.remotes[name])
+	}
+	aaqe.lock.RUnlock()
+
+	for _, remote := range remotes {
+		// health checks are done without holding the lock so evaluations aren't held by a slow evaluator
+		ctx, cancel := context.WithTimeout(context.Background(), remoteHealthCheckTimeout)
+		protocolVersion, healthy, err := negotiateProtocolVersion(ctx, remote.calculator.conn)
+		cancel()
+		if err == nil && !healthy {
+			err = fmt.Errorf("HealthCheck failed with remote evaluator %s", remote.calculator.address)
+		}
+		aaqe.updateRemote(remote, protocolVersion, err)
+	}
+}
+
+func (aaqe *AaqEvaluatorRegistry) updateRemote(remote *remoteEvaluator, protocolVersion int, err error) {
+	aaqe.lock.Lock()
+	defer aaqe.lock.Unlock()
+	name := remote.calculator.name
+	if err != nil {
+		if remote.healthy {
+			log.Log.Reason(err).Infof("Remote evaluator %s is unhealthy", name)
+		}
+		remote.healthy = false
+		remote.message = err.Error()
+		return
+	}
+	if !remote.healthy {
+		log.Log.Infof("Remote evaluator %s at %s is healthy, it serves protocol v%d", name, remote.calculator.address, protocolVersion)
+		aaqe.usageCache.forgetCalculator(calculatorName(remote.calculator))
+	}
+	// the calculator is replaced rather than updated since evaluations use it without holding the lock
+	calculator := *remote.calculator
+	calculator.protocolVersion = protocolVersion
+	remote.calculator = &calculator
+	remote.healthy = true
+	remote.message = ""
+}
+
+// sortedRemotes must be called with the lock held
+func (aaqe *AaqEvaluatorRegistry) sortedRemotes() []string {
+	var names []string
+	for name := range aaqe.remotes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
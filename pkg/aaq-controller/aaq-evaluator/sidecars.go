@@ -0,0 +1,233 @@
+package aaq_evaluator
+
+import (
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"kubevirt.io/application-aware-quota/pkg/log"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// sidecarsProbePeriod is how often the registered sidecars are health checked and the sockets directory is rescanned
+	sidecarsProbePeriod = 10 * time.Second
+	// sidecarFailureThreshold is the number of consecutive failed health checks after which a sidecar is down.
+	// A sidecar that restarts serves on the same socket, named after its container, and is healthy again from there
+	sidecarFailureThreshold = 3
+)
+
+// sidecar tracks a sidecar evaluator serving on a socket of the shared directory
+type sidecar struct {
+	calculator *AaqSocketCalculator
+	status     v1alpha1.SidecarEvaluatorStatus
+	// failures counts the consecutive failed health checks
+	failures int
+	// down is set once the sidecar failed sidecarFailureThreshold health checks or its socket was removed. Down sidecars
+	// a FailClosed or Fallback policy covers are kept until they serve on their socket again, others are dropped
+	down bool
+}
+
+// Run watches the shared sockets directory so sidecars are registered as soon as they serve and dropped once
+// their socket is removed, and health checks the registered sidecars periodically until stop is closed
+func (aaqe *AaqEvaluatorRegistry) Run(stop <-chan struct{}) {
+	var events chan fsnotify.Event
+	var watchErrors chan error
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		defer watcher.Close()
+		err = watcher.Add(aaqe.socketSharedDirectory)
+		events, watchErrors = watcher.Events, watcher.Errors
+	}
+	if err != nil {
+		log.Log.Reason(err).Warningf("Failed to watch %s, sidecars are only discovered every %v", aaqe.socketSharedDirectory, aaqe.probePeriod)
+	}
+
+	ticker := time.NewTicker(aaqe.probePeriod)
+	defer ticker.Stop()
+	for {
+		if err := aaqe.Sync(); err != nil {
+			log.Log.Reason(err).Errorf("Failed to sync the sidecars of %s", aaqe.socketSharedDirectory)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case event := <-events:
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Remove) {
+				continue
+			}
+		case err := <-watchErrors:
+			log.Log.Reason(err).Warningf("Failed to watch %s", aaqe.socketSharedDirectory)
+		}
+	}
+}
+
+// Sync health checks the remote evaluators, registers the sidecars serving on new sockets and health checks the registered ones.
+// Sidecars are down when their socket is removed or after sidecarFailureThreshold failed health checks in a row
+func (aaqe *AaqEvaluatorRegistry) Sync() error {
+	aaqe.syncRemotes()
+	entries, err := os.ReadDir(aaqe.socketSharedDirectory)
+	if err != nil {
+		return err
+	}
+	sockets := make(map[string]bool)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			sockets[entry.Name()] = true
+		}
+	}
+	aaqe.lock.RLock()
+	for socket := range aaqe.sidecars {
+		sockets[socket] = true
+	}
+	aaqe.lock.RUnlock()
+
+	for socket := range sockets {
+		socketPath := filepath.Join(aaqe.socketSharedDirectory, socket)
+		if _, err := os.Stat(socketPath); err != nil {
+			aaqe.sidecarDown(socket, "its socket was removed")
+			continue
+		}
+		// health checks are done without holding the lock so evaluations aren't held by a slow sidecar
+		calculator, notReady, err := processSideCarSocket(socketPath)
+		if notReady {
+			err = fmt.Errorf("sidecar is not serving on socket %s", socket)
+		}
+		aaqe.updateSidecar(socket, calculator, err)
+	}
+	return nil
+}
+
+func (aaqe *AaqEvaluatorRegistry) updateSidecar(socket string, calculator *AaqSocketCalculator, err error) {
+	aaqe.lock.Lock()
+	defer aaqe.lock.Unlock()
+	now := metav1.NewTime(time.Now().Truncate(time.Second))
+	existing, registered := aaqe.sidecars[socket]
+	if !registered {
+		// sockets that don't serve yet are retried on the next sync
+		if err != nil {
+			return
+		}
+		log.Log.Infof("Registering sidecar evaluator on socket %s, it serves protocol v%d", socket, calculator.protocolVersion)
+		calculator.timeout = aaqe.policyLocked(calculatorName(calculator)).timeout
+		aaqe.usageCache.forgetCalculator(calculatorName(calculator))
+		aaqe.sidecars[socket] = &sidecar{
+			calculator: calculator,
+			status: v1alpha1.SidecarEvaluatorStatus{
+				Socket:             socket,
+				Calculator:         calculatorName(calculator),
+				ProtocolVersion:    int32(calculator.protocolVersion),
+				Healthy:            true,
+				LastTransitionTime: now,
+			},
+		}
+		return
+	}
+
+	if err != nil {
+		if existing.down {
+			return
+		}
+		existing.failures++
+		if existing.failures >= sidecarFailureThreshold {
+			aaqe.sidecarDownLocked(socket, fmt.Sprintf("it failed %d health checks: %v", existing.failures, err))
+			return
+		}
+		if existing.status.Healthy {
+			log.Log.Reason(err).Infof("Sidecar evaluator on socket %s is unhealthy", socket)
+			existing.status.LastTransitionTime = now
+		}
+		existing.status.Healthy = false
+		existing.status.Message = err.Error()
+		return
+	}
+	existing.failures = 0
+	existing.down = false
+	if !existing.status.Healthy {
+		log.Log.Infof("Sidecar evaluator on socket %s is healthy again", socket)
+		existing.status.LastTransitionTime = now
+	}
+	calculator.timeout = aaqe.policyLocked(calculatorName(calculator)).timeout
+	existing.calculator = calculator
+	existing.status.ProtocolVersion = int32(calculator.protocolVersion)
+	existing.status.Healthy = true
+	existing.status.Message = ""
+}
+
+func (aaqe *AaqEvaluatorRegistry) sidecarDown(socket, reason string) {
+	aaqe.lock.Lock()
+	defer aaqe.lock.Unlock()
+	if existing, registered := aaqe.sidecars[socket]; registered && !existing.down {
+		aaqe.sidecarDownLocked(socket, reason)
+	}
+}
+
+// sidecarDownLocked keeps the sidecar as down if its policy requires its pods to fail their evaluation, and drops it
+// otherwise. It must be called with the lock held
+func (aaqe *AaqEvaluatorRegistry) sidecarDownLocked(socket, reason string) {
+	existing := aaqe.sidecars[socket]
+	if !aaqe.coversUnavailableLocked(calculatorName(existing.calculator)) {
+		log.Log.Infof("Dropping sidecar evaluator on socket %s since %s", socket, reason)
+		delete(aaqe.sidecars, socket)
+		return
+	}
+	log.Log.Infof("Sidecar evaluator on socket %s is down since %s, the pods it evaluates fail their evaluation until it serves again", socket, reason)
+	if existing.status.Healthy {
+		existing.status.LastTransitionTime = metav1.NewTime(time.Now().Truncate(time.Second))
+	}
+	existing.down = true
+	existing.status.Healthy = false
+	existing.status.Message = fmt.Sprintf("sidecar is down since %s", reason)
+}
+
+// sidecarName returns the stable name of the sidecar serving on the socket, the container name for sockets named
+// sidecar-<container name>.sock, so that its policy, circuit breaker and cached usages outlive its restarts
+func sidecarName(socketPath string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(filepath.Base(socketPath), "sidecar-"), ".sock")
+}
+
+// SidecarStatuses returns the state of the registered sidecars, ordered by socket
+func (aaqe *AaqEvaluatorRegistry) SidecarStatuses() []v1alpha1.SidecarEvaluatorStatus {
+	aaqe.lock.RLock()
+	defer aaqe.lock.RUnlock()
+	var statuses []v1alpha1.SidecarEvaluatorStatus
+	for _, socket := range aaqe.sortedSockets() {
+		statuses = append(statuses, aaqe.sidecars[socket].status)
+	}
+	return statuses
+}
+
+// HealthySidecars returns the number of registered sidecars that are healthy
+func (aaqe *AaqEvaluatorRegistry) HealthySidecars() uint {
+	var healthy uint
+	for _, status := range aaqe.SidecarStatuses() {
+		if status.Healthy {
+			healthy++
+		}
+	}
+	return healthy
+}
+
+// WaitForSidecars blocks until numberOfSidecars healthy sidecars are registered, and returns false if they
+// weren't within the timeout. Sidecars keep being registered by Run afterwards
+func (aaqe *AaqEvaluatorRegistry) WaitForSidecars(numberOfSidecars uint, timeout time.Duration) bool {
+	return wait.PollImmediate(time.Second, timeout, func() (bool, error) {
+		return aaqe.HealthySidecars() >= numberOfSidecars, nil
+	}) == nil
+}
+
+// sortedSockets must be called with the lock held
+func (aaqe *AaqEvaluatorRegistry) sortedSockets() []string {
+	var sockets []string
+	for socket := range aaqe.sidecars {
+		sockets = append(sockets, socket)
+	}
+	sort.Strings(sockets)
+	return sockets
+}
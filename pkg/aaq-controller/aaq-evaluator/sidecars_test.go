@@ -0,0 +1,170 @@
+package aaq_evaluator
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	ggrpc "google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pb "kubevirt.io/application-aware-quota/pkg/util/net/generated"
+	pbv2 "kubevirt.io/application-aware-quota/pkg/util/net/generated/v2"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var _ = Describe("Sidecar evaluators lifecycle", func() {
+	var socketDir string
+	var registry *AaqEvaluatorRegistry
+
+	registerV2 := func(server *ggrpc.Server) {
+		pbv2.RegisterPodUsageServer(server, &fakeSidecarV2{})
+	}
+
+	sockets := func() []string {
+		var sockets []string
+		for _, status := range registry.SidecarStatuses() {
+			sockets = append(sockets, status.Socket)
+		}
+		return sockets
+	}
+
+	setFailurePolicy := func(failurePolicy v1alpha1.CalculatorFailurePolicy) {
+		Expect(registry.SetCalculatorPolicies([]v1alpha1.CalculatorPolicy{{Calculator: "sidecar/*", FailurePolicy: failurePolicy}})).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		socketDir = newSocketDir()
+		registry = newAaqEvaluatorsRegistry(1, socketDir)
+	})
+
+	It("Run should register sidecars as they start serving and drop them once their socket is removed", func() {
+		setFailurePolicy(v1alpha1.FailOpen)
+		registry.probePeriod = 100 * time.Millisecond
+		stop := make(chan struct{})
+		defer close(stop)
+		go registry.Run(stop)
+		Expect(registry.WaitForSidecars(1, time.Second)).To(BeFalse())
+
+		first := serveSidecar(filepath.Join(socketDir, "first.sock"), registerV2)
+		Expect(registry.WaitForSidecars(1, 10*time.Second)).To(BeTrue())
+		serveSidecar(filepath.Join(socketDir, "second.sock"), func(server *ggrpc.Server) {
+			pb.RegisterPodUsageServer(server, &fakeSidecarV1{})
+		})
+		Eventually(sockets, 10*time.Second).Should(Equal([]string{"first.sock", "second.sock"}))
+		statuses := registry.SidecarStatuses()
+		Expect(statuses[0].ProtocolVersion).To(Equal(int32(SidecarProtocolV2)))
+		Expect(statuses[1].ProtocolVersion).To(Equal(int32(SidecarProtocolV1)))
+		Expect(registry.calculators()).To(HaveLen(2))
+
+		first.Stop()
+		Eventually(sockets, 10*time.Second).Should(Equal([]string{"second.sock"}))
+		Expect(registry.calculators()).To(HaveLen(1))
+	})
+
+	It("Sync should stop using sidecars that fail their health checks and drop them after the failure threshold", func() {
+		setFailurePolicy(v1alpha1.FailOpen)
+		socketPath := filepath.Join(socketDir, "sidecar.sock")
+		server := serveSidecar(socketPath, registerV2)
+		Expect(registry.Sync()).To(Succeed())
+		Expect(registry.SidecarStatuses()).To(HaveLen(1))
+		Expect(registry.SidecarStatuses()[0].Healthy).To(BeTrue())
+
+		// the sidecar crashed, leaving its socket behind
+		server.Stop()
+		Expect(os.WriteFile(socketPath, nil, 0644)).To(Succeed())
+		for i := 1; i < sidecarFailureThreshold; i++ {
+			Expect(registry.Sync()).To(Succeed())
+			statuses := registry.SidecarStatuses()
+			Expect(statuses).To(HaveLen(1))
+			Expect(statuses[0].Healthy).To(BeFalse())
+			Expect(statuses[0].Message).ToNot(BeEmpty())
+			Expect(registry.calculators()).To(BeEmpty())
+			Expect(registry.HealthySidecars()).To(BeZero())
+		}
+		Expect(registry.Sync()).To(Succeed())
+		Expect(registry.SidecarStatuses()).To(BeEmpty())
+
+		// the sidecar restarted on a new socket
+		serveSidecar(filepath.Join(socketDir, "restarted.sock"), registerV2)
+		Expect(registry.Sync()).To(Succeed())
+		statuses := registry.SidecarStatuses()
+		Expect(statuses).To(HaveLen(1))
+		Expect(statuses[0].Socket).To(Equal("restarted.sock"))
+		Expect(statuses[0].Healthy).To(BeTrue())
+	})
+
+	It("should fail the evaluation of the pods of a dead FailClosed sidecar until it serves on its socket again", func() {
+		setFailurePolicy(v1alpha1.FailClosed)
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "test", Labels: map[string]string{"match": "true"}},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:      "ctr",
+				Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")}},
+			}}},
+		}
+		socketPath := filepath.Join(socketDir, "sidecar.sock")
+		server := serveSidecar(socketPath, registerV2)
+		Expect(registry.Sync()).To(Succeed())
+		_, err := registry.Usage(pod, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		// the sidecar crashed, leaving its socket behind
+		server.Stop()
+		Expect(os.WriteFile(socketPath, nil, 0644)).To(Succeed())
+		for i := 0; i < sidecarFailureThreshold+1; i++ {
+			Expect(registry.Sync()).To(Succeed())
+			statuses := registry.SidecarStatuses()
+			Expect(statuses).To(HaveLen(1))
+			Expect(statuses[0].Healthy).To(BeFalse())
+			_, breakdown, err := registry.UsageBreakdown(pod, nil)
+			calculatorErr, failedClosed := AsCalculatorFailedError(err)
+			Expect(failedClosed).To(BeTrue())
+			Expect(calculatorErr.Calculator).To(Equal("sidecar/sidecar"))
+			Expect(breakdown).To(HaveLen(1))
+		}
+		Expect(registry.SidecarStatuses()[0].Message).To(ContainSubstring("down"))
+
+		// the sidecar's socket is removed and another sidecar starts, it doesn't take the dead sidecar's place
+		Expect(os.Remove(socketPath)).To(Succeed())
+		Expect(registry.Sync()).To(Succeed())
+		_, err = registry.Usage(pod, nil)
+		_, failedClosed := AsCalculatorFailedError(err)
+		Expect(failedClosed).To(BeTrue())
+		serveSidecar(filepath.Join(socketDir, "other.sock"), registerV2)
+		Expect(registry.Sync()).To(Succeed())
+		Expect(sockets()).To(Equal([]string{"other.sock", "sidecar.sock"}))
+		_, err = registry.Usage(pod, nil)
+		calculatorErr, failedClosed := AsCalculatorFailedError(err)
+		Expect(failedClosed).To(BeTrue())
+		Expect(calculatorErr.Calculator).To(Equal("sidecar/sidecar"))
+
+		// the sidecar restarts on its socket
+		serveSidecar(socketPath, registerV2)
+		Expect(registry.Sync()).To(Succeed())
+		statuses := registry.SidecarStatuses()
+		Expect(statuses).To(HaveLen(2))
+		Expect(statuses[1].Socket).To(Equal("sidecar.sock"))
+		Expect(statuses[1].Healthy).To(BeTrue())
+		_, err = registry.Usage(pod, nil)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should name the sidecars after their container, so each can have its own policy", func() {
+		Expect(registry.SetCalculatorPolicies([]v1alpha1.CalculatorPolicy{
+			{Calculator: "sidecar/a", FailurePolicy: v1alpha1.FailClosed},
+			{Calculator: "sidecar/*", FailurePolicy: v1alpha1.FailOpen},
+		})).To(Succeed())
+		serveSidecar(filepath.Join(socketDir, "sidecar-a.sock"), registerV2)
+		serveSidecar(filepath.Join(socketDir, "sidecar-b.sock"), registerV2)
+		Expect(registry.Sync()).To(Succeed())
+		statuses := registry.SidecarStatuses()
+		Expect(statuses).To(HaveLen(2))
+		Expect(statuses[0].Calculator).To(Equal("sidecar/a"))
+		Expect(statuses[1].Calculator).To(Equal("sidecar/b"))
+		Expect(registry.policy("sidecar/a").failurePolicy).To(Equal(v1alpha1.FailClosed))
+		Expect(registry.policy("sidecar/b").failurePolicy).To(Equal(v1alpha1.FailOpen))
+	})
+})
@@ -0,0 +1,208 @@
+package aaq_evaluator
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/metrics"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	"sync"
+	"time"
+)
+
+// AaqDependentCalculator is implemented by calculators whose usages depend on other objects than the pod,
+// the usages they computed are dropped from the cache as soon as one of these objects changes
+type AaqDependentCalculator interface {
+	AaqCalculator
+	// Dependencies returns the keys of the objects the usage of the pod depends on. Keys are opaque to the
+	// registry, they only have to be the same as the ones the calculator reports changes with
+	Dependencies(pod *corev1.Pod) []string
+	// OnDependencyChange registers the function the calculator calls with the key of each object that changes
+	OnDependencyChange(invalidate func(key string))
+}
+
+type usageCacheKey struct {
+	uid        types.UID
+	calculator string
+}
+
+type usageCacheEntry struct {
+	resourceVersion string
+	usage           CalculatorUsage
+	expiry          time.Time
+	dependencies    []string
+}
+
+// usageCache holds the usages calculators computed for the latest revision of each pod. Pods that weren't
+// created yet, like the ones admission evaluates, have no UID and are never cached
+type usageCache struct {
+	lock       sync.Mutex
+	maxEntries int
+	entries    map[usageCacheKey]*usageCacheEntry
+	// dependents are the entries depending on each object
+	dependents map[string]map[usageCacheKey]bool
+	// generation changes on every invalidation, a usage computed while it changed may be stale and isn't cached
+	generation uint64
+	clock      clock.Clock
+}
+
+func newUsageCache(maxEntries int, clock clock.Clock) *usageCache {
+	return &usageCache{
+		maxEntries: maxEntries,
+		entries:    make(map[usageCacheKey]*usageCacheEntry),
+		dependents: make(map[string]map[usageCacheKey]bool),
+		clock:      clock,
+	}
+}
+
+// SetUsageCache sets how long the usages calculators computed for a pod are reused, zero disables the cache
+func (aaqe *AaqEvaluatorRegistry) SetUsageCache(ttl time.Duration, maxEntries int) {
+	aaqe.lock.Lock()
+	aaqe.usageCacheTTL = ttl
+	aaqe.lock.Unlock()
+	aaqe.usageCache.reset(maxEntries)
+}
+
+// invalidateUsages drops the usages that depend on the object
+func (aaqe *AaqEvaluatorRegistry) invalidateUsages(key string) {
+	aaqe.usageCache.invalidate(key)
+}
+
+// cachedUsage returns the usage the calculator computed for the current revision of the pod, if it is cached
+func (aaqe *AaqEvaluatorRegistry) cachedUsage(pod *corev1.Pod, calculator string) (CalculatorUsage, bool) {
+	usage, cached := aaqe.usageCache.get(pod, calculator)
+	metrics.ObserveUsageCacheLookup(calculator, cached)
+	return usage, cached
+}
+
+// cacheUsage caches a usage the calculator computed successfully, failures are always evaluated again.
+// The generation is the one of the cache before the usage was computed
+func (aaqe *AaqEvaluatorRegistry) cacheUsage(calculator AaqCalculator, pod *corev1.Pod, usage CalculatorUsage, policy calculatorPolicy, generation uint64) {
+	if usage.Error != "" || policy.cacheTTL <= 0 {
+		return
+	}
+	var dependencies []string
+	if dependent, ok := calculator.(AaqDependentCalculator); ok {
+		dependencies = dependent.Dependencies(pod)
+	}
+	aaqe.usageCache.add(pod, usage, policy.cacheTTL, dependencies, generation)
+}
+
+func (uc *usageCache) get(pod *corev1.Pod, calculator string) (CalculatorUsage, bool) {
+	if pod.UID == "" || pod.ResourceVersion == "" {
+		return CalculatorUsage{}, false
+	}
+	key := usageCacheKey{uid: pod.UID, calculator: calculator}
+	uc.lock.Lock()
+	defer uc.lock.Unlock()
+	entry, exists := uc.entries[key]
+	if !exists {
+		return CalculatorUsage{}, false
+	}
+	if entry.resourceVersion != pod.ResourceVersion || !uc.clock.Now().Before(entry.expiry) {
+		uc.removeLocked(key)
+		return CalculatorUsage{}, false
+	}
+	return entry.usage, true
+}
+
+// currentGeneration must be read before computing a usage that is added to the cache afterwards
+func (uc *usageCache) currentGeneration() uint64 {
+	uc.lock.Lock()
+	defer uc.lock.Unlock()
+	return uc.generation
+}
+
+// add caches the usage unless the cache was invalidated since the generation, as the invalidation may have come
+// after the usage was computed from the objects it depends on
+func (uc *usageCache) add(pod *corev1.Pod, usage CalculatorUsage, ttl time.Duration, dependencies []string, generation uint64) {
+	if pod.UID == "" || pod.ResourceVersion == "" {
+		return
+	}
+	key := usageCacheKey{uid: pod.UID, calculator: usage.Calculator}
+	uc.lock.Lock()
+	defer uc.lock.Unlock()
+	if uc.generation != generation {
+		return
+	}
+	uc.removeLocked(key)
+	if len(uc.entries) >= uc.maxEntries {
+		uc.evictLocked()
+	}
+	uc.entries[key] = &usageCacheEntry{
+		resourceVersion: pod.ResourceVersion,
+		usage:           usage,
+		expiry:          uc.clock.Now().Add(ttl),
+		dependencies:    dependencies,
+	}
+	for _, dependency := range dependencies {
+		if uc.dependents[dependency] == nil {
+			uc.dependents[dependency] = make(map[usageCacheKey]bool)
+		}
+		uc.dependents[dependency][key] = true
+	}
+}
+
+func (uc *usageCache) invalidate(dependency string) {
+	uc.lock.Lock()
+	defer uc.lock.Unlock()
+	uc.generation++
+	for key := range uc.dependents[dependency] {
+		uc.removeLocked(key)
+	}
+}
+
+// forgetCalculator drops the usages of a calculator, sidecars and remote evaluators that come back may have been upgraded
+func (uc *usageCache) forgetCalculator(calculator string) {
+	uc.lock.Lock()
+	defer uc.lock.Unlock()
+	uc.generation++
+	for key := range uc.entries {
+		if key.calculator == calculator {
+			uc.removeLocked(key)
+		}
+	}
+}
+
+func (uc *usageCache) reset(maxEntries int) {
+	if maxEntries <= 0 {
+		maxEntries = util.DefaultUsageCacheMaxEntries
+	}
+	uc.lock.Lock()
+	defer uc.lock.Unlock()
+	uc.maxEntries = maxEntries
+	uc.generation++
+	uc.entries = make(map[usageCacheKey]*usageCacheEntry)
+	uc.dependents = make(map[string]map[usageCacheKey]bool)
+}
+
+// evictLocked drops the expired entries, then arbitrary ones until a tenth of the cache is free, it must be called with the lock held
+func (uc *usageCache) evictLocked() {
+	now := uc.clock.Now()
+	for key, entry := range uc.entries {
+		if !now.Before(entry.expiry) {
+			uc.removeLocked(key)
+		}
+	}
+	for key := range uc.entries {
+		if len(uc.entries) < uc.maxEntries-uc.maxEntries/10 {
+			return
+		}
+		uc.removeLocked(key)
+	}
+}
+
+// removeLocked must be called with the lock held
+func (uc *usageCache) removeLocked(key usageCacheKey) {
+	entry, exists := uc.entries[key]
+	if !exists {
+		return
+	}
+	delete(uc.entries, key)
+	for _, dependency := range entry.dependencies {
+		delete(uc.dependents[dependency], key)
+		if len(uc.dependents[dependency]) == 0 {
+			delete(uc.dependents, dependency)
+		}
+	}
+}
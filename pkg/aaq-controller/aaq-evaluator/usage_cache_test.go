@@ -0,0 +1,220 @@
+package aaq_evaluator
+
+import (
+	"fmt"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	testingclock "k8s.io/utils/clock/testing"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"time"
+)
+
+// countingCalculator matches every pod and counts the pods it evaluated
+type countingCalculator struct {
+	name  string
+	usage corev1.ResourceList
+	err   error
+	calls int
+	// dependencies are returned for every pod
+	dependencies []string
+	invalidate   func(key string)
+	// evaluating is called on every evaluation
+	evaluating func()
+}
+
+func (cc *countingCalculator) Name() string {
+	if cc.name != "" {
+		return cc.name
+	}
+	return "counting"
+}
+
+func (cc *countingCalculator) PodUsageFunc(_ *corev1.Pod, _ []*corev1.Pod) (corev1.ResourceList, error, bool) {
+	cc.calls++
+	if cc.evaluating != nil {
+		cc.evaluating()
+	}
+	return cc.usage, cc.err, cc.err == nil
+}
+
+func (cc *countingCalculator) Dependencies(_ *corev1.Pod) []string {
+	return cc.dependencies
+}
+
+func (cc *countingCalculator) OnDependencyChange(invalidate func(key string)) {
+	cc.invalidate = invalidate
+}
+
+// countingBatchCalculator records the pods of each batch
+type countingBatchCalculator struct {
+	countingCalculator
+	batches [][]string
+}
+
+func (cbc *countingBatchCalculator) PodsUsageFunc(pods []*corev1.Pod, _ []*corev1.Pod) ([]PodUsageResult, error) {
+	var names []string
+	results := make([]PodUsageResult, len(pods))
+	for i, pod := range pods {
+		names = append(names, pod.Name)
+		results[i] = PodUsageResult{ResourceList: cbc.usage, Match: true}
+	}
+	cbc.batches = append(cbc.batches, names)
+	return results, nil
+}
+
+var _ = Describe("Usage cache", func() {
+	var registry *AaqEvaluatorRegistry
+	var fakeClock *testingclock.FakeClock
+	var calculator *countingCalculator
+	usage := corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("1Gi")}
+
+	newPod := func(name, resourceVersion string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       "test",
+			UID:             types.UID(name + "-uid"),
+			ResourceVersion: resourceVersion,
+		}}
+	}
+
+	expectUsage := func(pod *corev1.Pod, calls int) {
+		rl, err := registry.Usage(pod, nil)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		ExpectWithOffset(1, quota.Equals(rl, usage)).To(BeTrue(), "usage is %v", rl)
+		ExpectWithOffset(1, calculator.calls).To(Equal(calls))
+	}
+
+	BeforeEach(func() {
+		registry = newAaqEvaluatorsRegistry(1, "/fakeSocketSharedDirectory")
+		fakeClock = testingclock.NewFakeClock(time.Now())
+		registry.usageCache.clock = fakeClock
+		calculator = &countingCalculator{usage: usage, dependencies: []string{"vmi"}}
+		registry.Add(calculator)
+	})
+
+	It("should reuse the usage of a pod until it changes", func() {
+		pod := newPod("pod", "1")
+		expectUsage(pod, 1)
+		expectUsage(pod, 1)
+		expectUsage(newPod("pod", "2"), 2)
+		expectUsage(newPod("other", "1"), 3)
+	})
+
+	It("should not cache pods that weren't created yet", func() {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "test"}}
+		expectUsage(pod, 1)
+		expectUsage(pod, 2)
+	})
+
+	It("should not cache failures", func() {
+		calculator.err = fmt.Errorf("calculator failure")
+		pod := newPod("pod", "1")
+		for i := 0; i < 2; i++ {
+			_, breakdown, _ := registry.UsageBreakdown(pod, nil)
+			Expect(breakdown[0].Error).To(Equal("calculator failure"))
+		}
+		Expect(calculator.calls).To(Equal(2))
+	})
+
+	It("should evaluate pods again once their usage expires", func() {
+		pod := newPod("pod", "1")
+		expectUsage(pod, 1)
+		fakeClock.Step(util.DefaultUsageCacheTTL)
+		expectUsage(pod, 2)
+
+		registry.SetUsageCache(time.Minute, 0)
+		expectUsage(pod, 3)
+		fakeClock.Step(30 * time.Second)
+		expectUsage(pod, 3)
+		fakeClock.Step(30 * time.Second)
+		expectUsage(pod, 4)
+	})
+
+	It("should drop the usages depending on an object that changed", func() {
+		pod := newPod("pod", "1")
+		expectUsage(pod, 1)
+		calculator.invalidate("other")
+		expectUsage(pod, 1)
+		calculator.invalidate("vmi")
+		expectUsage(pod, 2)
+		expectUsage(pod, 2)
+	})
+
+	It("should not cache a usage whose dependencies changed while it was computed", func() {
+		pod := newPod("pod", "1")
+		calculator.evaluating = func() { calculator.invalidate("vmi") }
+		expectUsage(pod, 1)
+		calculator.evaluating = nil
+		expectUsage(pod, 2)
+		expectUsage(pod, 2)
+	})
+
+	It("should only cache the usages of sidecar, remote, wasm and CEL calculators when their policy sets a TTL", func() {
+		registry = newAaqEvaluatorsRegistry(1, "/fakeSocketSharedDirectory")
+		calculator = &countingCalculator{name: "cel/db", usage: usage}
+		registry.Add(calculator)
+		pod := newPod("pod", "1")
+		expectUsage(pod, 1)
+		expectUsage(pod, 2)
+
+		Expect(registry.SetCalculatorPolicies([]v1alpha1.CalculatorPolicy{
+			{Calculator: "cel/*", CacheTTL: &metav1.Duration{Duration: time.Minute}},
+		})).To(Succeed())
+		expectUsage(pod, 3)
+		expectUsage(pod, 3)
+	})
+
+	It("should evaluate the pods again when recomputing their usage and cache the new usage", func() {
+		pod := newPod("pod", "1")
+		expectUsage(pod, 1)
+		usages, errs := registry.RecomputeUsageBatch([]*corev1.Pod{pod}, nil)
+		Expect(errs).To(HaveEach(BeNil()))
+		Expect(quota.Equals(usages[0], usage)).To(BeTrue(), "usage is %v", usages[0])
+		Expect(calculator.calls).To(Equal(2))
+		expectUsage(pod, 2)
+	})
+
+	It("should let calculator policies disable the cache", func() {
+		Expect(registry.SetCalculatorPolicies([]v1alpha1.CalculatorPolicy{
+			{Calculator: "counting", CacheTTL: &metav1.Duration{}},
+		})).To(Succeed())
+		pod := newPod("pod", "1")
+		expectUsage(pod, 1)
+		expectUsage(pod, 2)
+	})
+
+	It("should stay within its maximum number of entries", func() {
+		registry.SetUsageCache(time.Minute, 10)
+		for i := 0; i < 25; i++ {
+			expectUsage(newPod(fmt.Sprintf("pod-%d", i), "1"), i+1)
+			Expect(len(registry.usageCache.entries)).To(BeNumerically("<=", 10))
+		}
+		expectUsage(newPod("pod-24", "1"), 25)
+	})
+
+	It("should only send the pods that aren't cached to batch calculators", func() {
+		registry = newAaqEvaluatorsRegistry(1, "/fakeSocketSharedDirectory")
+		batchCalculator := &countingBatchCalculator{countingCalculator: countingCalculator{usage: usage}}
+		registry.Add(batchCalculator)
+		pods := []*corev1.Pod{newPod("a", "1"), newPod("b", "1")}
+
+		_, errs := registry.UsageBatch(pods, nil)
+		Expect(errs).To(HaveEach(BeNil()))
+		pods = append(pods, newPod("c", "1"))
+		pods[1] = newPod("b", "2")
+		usages, errs := registry.UsageBatch(pods, nil)
+		Expect(errs).To(HaveEach(BeNil()))
+		for _, rl := range usages {
+			Expect(quota.Equals(rl, usage)).To(BeTrue(), "usage is %v", rl)
+		}
+		_, errs = registry.UsageBatch(pods, nil)
+		Expect(errs).To(HaveEach(BeNil()))
+		Expect(batchCalculator.batches).To(Equal([][]string{{"a", "b"}, {"b", "c"}}))
+	})
+})
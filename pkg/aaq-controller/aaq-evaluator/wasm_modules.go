@@ -0,0 +1,150 @@
+package aaq_evaluator
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"io"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"kubevirt.io/application-aware-quota/pkg/log"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"path"
+	"time"
+)
+
+const (
+	// WasmLayerMediaType is the media type of OCI layers holding a WebAssembly module
+	WasmLayerMediaType types.MediaType = "application/vnd.wasm.content.layer.v1+wasm"
+	// maxWasmModuleSize bounds the modules read from images, so a wrong reference can't exhaust the memory of the pod
+	maxWasmModuleSize = 256 * 1024 * 1024
+)
+
+// LoadWasmCalculators fetches the modules of the calculators, from ConfigMaps in namespace or from OCI images,
+// and compiles them
+func LoadWasmCalculators(configMaps corev1client.ConfigMapsGetter, namespace string, calculators []v1alpha1.WasmCalculator) ([]*AaqWasmCalculator, error) {
+	names := make(map[string]bool)
+	var wasmCalculators []*AaqWasmCalculator
+	closeAll := func() {
+		for _, wasmCalculator := range wasmCalculators {
+			wasmCalculator.Close()
+		}
+	}
+	for _, calculator := range calculators {
+		if calculator.Name == "" {
+			closeAll()
+			return nil, fmt.Errorf("wasm calculator has no name")
+		}
+		if names[calculator.Name] {
+			closeAll()
+			return nil, fmt.Errorf("wasm calculator %s is listed more than once", calculator.Name)
+		}
+		names[calculator.Name] = true
+
+		binary, err := fetchWasmModule(configMaps, namespace, calculator)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("failed to fetch the module of wasm calculator %s: %v", calculator.Name, err)
+		}
+		var memoryLimit int64
+		if calculator.MemoryLimit != nil {
+			memoryLimit = calculator.MemoryLimit.Value()
+		}
+		var timeout time.Duration
+		if calculator.Timeout != nil {
+			timeout = calculator.Timeout.Duration
+		}
+		wasmCalculator, err := NewAaqWasmCalculator(calculator.Name, binary, memoryLimit, timeout)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		log.Log.Infof("Loaded wasm calculator %s", calculator.Name)
+		wasmCalculators = append(wasmCalculators, wasmCalculator)
+	}
+	return wasmCalculators, nil
+}
+
+func fetchWasmModule(configMaps corev1client.ConfigMapsGetter, namespace string, calculator v1alpha1.WasmCalculator) ([]byte, error) {
+	switch {
+	case calculator.ConfigMap != nil && calculator.Image != "":
+		return nil, fmt.Errorf("only one of configMap and image can be set")
+	case calculator.ConfigMap != nil:
+		cm, err := configMaps.ConfigMaps(namespace).Get(context.Background(), calculator.ConfigMap.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		binary, ok := cm.BinaryData[calculator.ConfigMap.Key]
+		if !ok {
+			return nil, fmt.Errorf("ConfigMap %s has no %s key in its binaryData", calculator.ConfigMap.Name, calculator.ConfigMap.Key)
+		}
+		return binary, nil
+	case calculator.Image != "":
+		return pullWasmModule(calculator.Image)
+	}
+	return nil, fmt.Errorf("either configMap or image must be set")
+}
+
+// pullWasmModule returns the module of a wasm OCI artifact, or the first .wasm file of a regular image
+func pullWasmModule(image string, options ...remote.Option) ([]byte, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return nil, err
+	}
+	options = append(options, remote.WithPlatform(v1.Platform{OS: "wasip1", Architecture: "wasm"}))
+	img, err := remote.Image(ref, options...)
+	if err != nil {
+		return nil, err
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+	for _, layer := range layers {
+		mediaType, err := layer.MediaType()
+		if err != nil {
+			return nil, err
+		}
+		if mediaType != WasmLayerMediaType {
+			continue
+		}
+		blob, err := layer.Compressed()
+		if err != nil {
+			return nil, err
+		}
+		defer blob.Close()
+		return readWasmModule(blob)
+	}
+
+	filesystem := mutate.Extract(img)
+	defer filesystem.Close()
+	reader := tar.NewReader(filesystem)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("image has neither a %s layer nor a .wasm file", WasmLayerMediaType)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg && path.Ext(header.Name) == ".wasm" {
+			return readWasmModule(reader)
+		}
+	}
+}
+
+func readWasmModule(reader io.Reader) ([]byte, error) {
+	binary, err := io.ReadAll(io.LimitReader(reader, maxWasmModuleSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(binary) > maxWasmModuleSize {
+		return nil, fmt.Errorf("module is larger than %d bytes", maxWasmModuleSize)
+	}
+	return binary, nil
+}
@@ -2,18 +2,23 @@ package arq_controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"go.opentelemetry.io/otel/codes"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
 	"k8s.io/apimachinery/pkg/api/equality"
 	kapierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	utilwait "k8s.io/apimachinery/pkg/util/wait"
 	k8sadmission "k8s.io/apiserver/pkg/admission"
 	resourcequota2 "k8s.io/apiserver/pkg/admission/plugin/resourcequota"
 	"k8s.io/apiserver/pkg/admission/plugin/resourcequota/apis/resourcequota"
+	quota "k8s.io/apiserver/pkg/quota/v1"
 	v12 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
@@ -23,35 +28,40 @@ import (
 	_ "kubevirt.io/api/core/v1"
 	aaq_evaluator "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-evaluator"
 	"kubevirt.io/application-aware-quota/pkg/aaq-controller/additional-cluster-quota-controllers/clusterquotamapping"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/audit"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/metrics"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/sharding"
 	"kubevirt.io/application-aware-quota/pkg/client"
 	"kubevirt.io/application-aware-quota/pkg/generated/aaq/listers/core/v1alpha1"
+	"kubevirt.io/application-aware-quota/pkg/tracing"
 	"kubevirt.io/application-aware-quota/pkg/util"
 	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"sync"
 	"time"
 )
 
 type enqueueState string
 
 const (
-	Immediate                                    enqueueState = "Immediate"
-	Forget                                       enqueueState = "Forget"
-	BackOff                                      enqueueState = "BackOff"
-	AaqjqcName                                                = "aaqjqc"
-	ApplicationAwareResourceQuotaLockName                     = "application-aware-resource-quota-lock"
-	ApplicationAwareClusterResourceQuotaLockName              = "application-aware-cluster-resource-quota-lock"
+	Immediate  enqueueState = "Immediate"
+	Forget     enqueueState = "Forget"
+	BackOff    enqueueState = "BackOff"
+	AaqjqcName              = "aaqjqc"
+	// quotaSyncRetryPeriod is how long until a namespace is evaluated again while the usage of its quotas
+	// wasn't calculated since the controller started, or includes pods that are only reserved
+	quotaSyncRetryPeriod = time.Second
 )
 
-var locksNames = []string{
-	ApplicationAwareResourceQuotaLockName,
-	ApplicationAwareClusterResourceQuotaLockName,
-}
-
 type AaqGateController struct {
-	podInformer         cache.SharedIndexInformer
-	arqInformer         cache.SharedIndexInformer
-	acrqInformer        cache.SharedIndexInformer
-	aaqjqcInformer      cache.SharedIndexInformer
+	podInformer    cache.SharedIndexInformer
+	arqInformer    cache.SharedIndexInformer
+	acrqInformer   cache.SharedIndexInformer
+	aaqjqcInformer cache.SharedIndexInformer
+	// pdbInformer is nil unless preemption is enabled
+	pdbInformer         cache.SharedIndexInformer
 	nsQueue             workqueue.RateLimitingInterface
+	debouncer           *NamespaceDebouncer
+	releaseParallelism  int
 	aaqCli              client.AAQClient
 	aaqEvaluator        *aaq_evaluator.AaqEvaluator
 	clusterQuotaEnabled bool
@@ -59,6 +69,17 @@ type AaqGateController struct {
 	namespaceLister     v12.NamespaceLister
 	clusterQuotaMapper  clusterquotamapping.ClusterQuotaMapper
 	recorder            record.EventRecorder
+	queueingConfig      v1alpha12.QueueingConfiguration
+	enablePreemption    bool
+	gateTTLConfig       v1alpha12.GateTTLConfiguration
+	auditLogger         *audit.Logger
+	preemptions         map[types.UID]time.Time
+	preemptionsLock     sync.Mutex
+	reservations        *ReservationLedger
+	shards              *sharding.Sharder
+	cohortLocks         map[string]*sync.Mutex
+	cohortLocksLock     sync.Mutex
+	clock               clock.Clock
 	stop                <-chan struct{}
 }
 
@@ -67,11 +88,19 @@ func NewAaqGateController(aaqCli client.AAQClient,
 	arqInformer cache.SharedIndexInformer,
 	aaqjqcInformer cache.SharedIndexInformer,
 	acrqInformer cache.SharedIndexInformer,
+	pdbInformer cache.SharedIndexInformer,
 	evalRegistry *aaq_evaluator.AaqEvaluatorRegistry,
+	reservations *ReservationLedger,
+	shards *sharding.Sharder,
 	clusterQuotaLister v1alpha1.ApplicationAwareClusterResourceQuotaLister,
 	namespaceLister v12.NamespaceLister,
 	clusterQuotaMapper clusterquotamapping.ClusterQuotaMapper,
 	recorder record.EventRecorder,
+	queueingConfig v1alpha12.QueueingConfiguration,
+	enablePreemption bool,
+	gateTTLConfig v1alpha12.GateTTLConfiguration,
+	auditLogger *audit.Logger,
+	eventCoalescingConfig v1alpha12.EventCoalescingConfiguration,
 	clusterQuotaEnabled bool,
 	stop <-chan struct{},
 ) *AaqGateController {
@@ -81,15 +110,30 @@ func NewAaqGateController(aaqCli client.AAQClient,
 		podInformer:         podInformer,
 		arqInformer:         arqInformer,
 		acrqInformer:        acrqInformer,
+		pdbInformer:         pdbInformer,
 		nsQueue:             workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ns-queue"),
 		aaqEvaluator:        aaq_evaluator.NewAaqEvaluator(v12.NewPodLister(podInformer.GetIndexer()), evalRegistry, clock.RealClock{}),
 		clusterQuotaLister:  clusterQuotaLister,
 		namespaceLister:     namespaceLister,
 		clusterQuotaMapper:  clusterQuotaMapper,
 		recorder:            recorder,
+		queueingConfig:      queueingConfig,
+		enablePreemption:    enablePreemption,
+		gateTTLConfig:       gateTTLConfig,
+		auditLogger:         auditLogger,
+		preemptions:         map[types.UID]time.Time{},
+		cohortLocks:         map[string]*sync.Mutex{},
+		reservations:        reservations,
+		shards:              shards,
+		clock:               clock.RealClock{},
 		clusterQuotaEnabled: clusterQuotaEnabled,
 		stop:                stop,
 	}
+	ctrl.debouncer = NewNamespaceDebouncer(ctrl.nsQueue, eventCoalescingConfig, clock.RealClock{})
+	ctrl.releaseParallelism = util.DefaultReleaseParallelism
+	if eventCoalescingConfig.ReleaseParallelism != nil && *eventCoalescingConfig.ReleaseParallelism > 0 {
+		ctrl.releaseParallelism = int(*eventCoalescingConfig.ReleaseParallelism)
+	}
 
 	_, err := ctrl.podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    ctrl.addPod,
@@ -150,21 +194,28 @@ func (ctrl *AaqGateController) enqueueAll() {
 // When a ApplicationAwareResourceQuota is deleted, enqueue all gated pods for revaluation
 func (ctrl *AaqGateController) deleteArq(obj interface{}) {
 	arq := obj.(*v1alpha12.ApplicationAwareResourceQuota)
-	ctrl.nsQueue.Add(arq.Namespace)
+	ctrl.debouncer.Enqueue(arq.Namespace)
+	ctrl.enqueueCohort(arq.Spec.Cohort)
 	return
 }
 
 // When a ApplicationAwareResourceQuota is updated, enqueue all gated pods for revaluation
 func (ctrl *AaqGateController) addArq(obj interface{}) {
 	arq := obj.(*v1alpha12.ApplicationAwareResourceQuota)
-	ctrl.nsQueue.Add(arq.Namespace)
+	ctrl.debouncer.Enqueue(arq.Namespace)
+	ctrl.enqueueCohort(arq.Spec.Cohort)
 	return
 }
 
 // When a ApplicationAwareResourceQuota is updated, enqueue all gated pods for revaluation
 func (ctrl *AaqGateController) updateArq(old, cur interface{}) {
 	arq := cur.(*v1alpha12.ApplicationAwareResourceQuota)
-	ctrl.nsQueue.Add(arq.Namespace)
+	oldArq := old.(*v1alpha12.ApplicationAwareResourceQuota)
+	ctrl.debouncer.Enqueue(arq.Namespace)
+	ctrl.enqueueCohort(arq.Spec.Cohort)
+	if oldArq.Spec.Cohort != arq.Spec.Cohort {
+		ctrl.enqueueCohort(oldArq.Spec.Cohort)
+	}
 	return
 }
 
@@ -173,7 +224,7 @@ func (ctrl *AaqGateController) deleteAcrq(obj interface{}) {
 	acrq := obj.(*v1alpha12.ApplicationAwareClusterResourceQuota)
 	namespaces, _ := ctrl.clusterQuotaMapper.GetNamespacesFor(acrq.Name)
 	for _, ns := range namespaces {
-		ctrl.nsQueue.Add(ns)
+		ctrl.debouncer.Enqueue(ns)
 	}
 	return
 }
@@ -183,7 +234,7 @@ func (ctrl *AaqGateController) addAcrq(obj interface{}) {
 	acrq := obj.(*v1alpha12.ApplicationAwareClusterResourceQuota)
 	namespaces, _ := ctrl.clusterQuotaMapper.GetNamespacesFor(acrq.Name)
 	for _, ns := range namespaces {
-		ctrl.nsQueue.Add(ns)
+		ctrl.debouncer.Enqueue(ns)
 	}
 	return
 }
@@ -193,7 +244,7 @@ func (ctrl *AaqGateController) updateAcrq(old, cur interface{}) {
 	acrq := cur.(*v1alpha12.ApplicationAwareClusterResourceQuota)
 	namespaces, _ := ctrl.clusterQuotaMapper.GetNamespacesFor(acrq.Name)
 	for _, ns := range namespaces {
-		ctrl.nsQueue.Add(ns)
+		ctrl.debouncer.Enqueue(ns)
 	}
 	return
 }
@@ -201,14 +252,14 @@ func (ctrl *AaqGateController) updateAcrq(old, cur interface{}) {
 // When a ApplicationAwareResourceQuotAaqjqc.Status.PodsInJobQueuea is updated, enqueue all gated pods for revaluation
 func (ctrl *AaqGateController) updateAaqjqc(old, cur interface{}) {
 	aaqjqc := cur.(*v1alpha12.AAQJobQueueConfig)
-	ctrl.nsQueue.Add(aaqjqc.Namespace)
+	ctrl.debouncer.Enqueue(aaqjqc.Namespace)
 	return
 }
 
 // When a ApplicationAwareResourceQuota is updated, enqueue all gated pods for revaluation
 func (ctrl *AaqGateController) deleteAaqjqc(obj interface{}) {
 	aaqjqc := obj.(*v1alpha12.AAQJobQueueConfig)
-	ctrl.nsQueue.Add(aaqjqc.Namespace)
+	ctrl.debouncer.Enqueue(aaqjqc.Namespace)
 	return
 }
 
@@ -217,7 +268,7 @@ func (ctrl *AaqGateController) addPod(obj interface{}) {
 	if pod.Spec.SchedulingGates != nil &&
 		len(pod.Spec.SchedulingGates) == 1 &&
 		pod.Spec.SchedulingGates[0].Name == util.AAQGate {
-		ctrl.nsQueue.Add(pod.Namespace)
+		ctrl.debouncer.Enqueue(pod.Namespace)
 	}
 }
 
@@ -227,7 +278,7 @@ func (ctrl *AaqGateController) updatePod(old, curr interface{}) {
 	if pod.Spec.SchedulingGates != nil &&
 		len(pod.Spec.SchedulingGates) == 1 &&
 		pod.Spec.SchedulingGates[0].Name == util.AAQGate {
-		ctrl.nsQueue.Add(pod.Namespace)
+		ctrl.debouncer.Enqueue(pod.Namespace)
 	}
 }
 
@@ -262,6 +313,11 @@ func (ctrl *AaqGateController) Execute() bool {
 func (ctrl *AaqGateController) execute(ns string) (error, enqueueState) {
 	namespace, err := ctrl.namespaceLister.Get(ns)
 	if kapierrors.IsNotFound(err) || namespace.Status.Phase == v1.NamespaceTerminating {
+		metrics.DeleteGatedPods(ns)
+		ctrl.reservations.ForgetNamespace(ns)
+		return nil, Forget
+	}
+	if !ctrl.shards.OwnsNamespace(ns) {
 		return nil, Forget
 	}
 
@@ -270,89 +326,221 @@ func (ctrl *AaqGateController) execute(ns string) (error, enqueueState) {
 		return err, Immediate
 	}
 
-	if aaqjqc.Status.ControllerLock != nil && !ctrl.aaqjqcProcessed(aaqjqc) { //check if controller already processed and unlocked
-		err := ctrl.releasePods(aaqjqc.Status.PodsInJobQueue, ns)
-		return err, Immediate //wait until for controllers to process changes
+	// releases used to be handshaked with the quota controllers through the status, older versions may have left it behind
+	staleHandshake := aaqjqc.Status.ControllerLock != nil || len(aaqjqc.Status.PodsInJobQueue) > 0
+	aaqjqc.Status.ControllerLock = nil
+	aaqjqc.Status.PodsInJobQueue = nil
+	if !ctrl.podInformer.HasSynced() {
+		// the pods of namespaces entering the scope of the pod watch are still listed, the quotas may miss their usage
+		ctrl.nsQueue.AddAfter(ns, quotaSyncRetryPeriod)
+		return nil, Forget
 	}
-
-	aaqjqc.Status.PodsInJobQueue = []string{}
-	rqs, err := ctrl.getArtificialRqsForGateController(ns)
+	gatedPods, admittedGroupMembers, err := ctrl.getGatedPods(ns)
 	if err != nil {
 		return err, Immediate
 	}
-	podObjs, err := ctrl.podInformer.GetIndexer().ByIndex(cache.NamespaceIndex, ns)
+	var released []gatedPod
+	var gatedPodsStatus []v1alpha12.GatedPodStatus
+	evaluatedPods := gatedPods
+	defer func() { endEvaluationSpans(evaluatedPods, released, gatedPodsStatus) }()
+	gatedPods, nextExpiry, err := ctrl.expireGatedPods(gatedPods)
 	if err != nil {
 		return err, Immediate
 	}
-	for _, podObj := range podObjs {
-		pod := podObj.(*v1.Pod)
-		if pod.Spec.SchedulingGates != nil &&
-			len(pod.Spec.SchedulingGates) == 1 &&
-			pod.Spec.SchedulingGates[0].Name == util.AAQGate {
-			podCopy := pod.DeepCopy()
-			podCopy.Spec.SchedulingGates = []v1.PodSchedulingGate{}
-
-			podToCreateAttr := k8sadmission.NewAttributesRecord(podCopy, nil,
-				apiextensions.Kind("Pod").WithVersion("version"), podCopy.Namespace, podCopy.Name,
-				v1alpha12.Resource("pods").WithVersion("version"), "", k8sadmission.Create,
-				&metav1.CreateOptions{}, false, nil)
-
-			currPodLimitedResource, err := getCurrLimitedResource(ctrl.aaqEvaluator, podCopy)
-			if err != nil {
-				return nil, Immediate
-			}
+	if nextExpiry > 0 {
+		ctrl.nsQueue.AddAfter(ns, nextExpiry)
+	}
 
-			newRq, err := resourcequota2.CheckRequest(rqs, podToCreateAttr, ctrl.aaqEvaluator, []resourcequota.LimitedResource{currPodLimitedResource})
-			if err == nil {
-				rqs = newRq
-				aaqjqc.Status.PodsInJobQueue = append(aaqjqc.Status.PodsInJobQueue, pod.Name)
-			} else {
-				ctrl.recorder.Event(pod, v1.EventTypeWarning, v1.EventTypeWarning, util.IgnoreRqErr(err.Error()))
-			}
+	// the cluster quotas are resolved first since it may wait for the mapping of the namespace to settle,
+	// which must not hold the cohorts
+	var clusterQuotaNames []string
+	if ctrl.clusterQuotaEnabled {
+		clusterQuotaNames, err = ctrl.waitForReadyClusterQuotaNames(ns)
+		if err != nil {
+			return err, Immediate
+		}
+	}
+	// the cohorts are only held until the usage of the released pods is reserved, the API calls come afterwards
+	unlockCohorts := ctrl.lockCohorts(ns)
+	defer unlockCohorts()
+	rqs, reserving, err := ctrl.getArtificialRqsForGateController(ns, clusterQuotaNames)
+	if errors.Is(err, errQuotaNotSynced) {
+		// the pods released before the controller started may be missing from the quota usage
+		ctrl.nsQueue.AddAfter(ns, quotaSyncRetryPeriod)
+		return nil, Forget
+	} else if err != nil {
+		return err, Immediate
+	}
+	gatedPods = orderGatedPods(gatedPods, rqs, ctrl.queueingConfig, ctrl.agingPeriod(), ctrl.clock.Now())
+	queueBlocked := false
+	previousStatus := aaqjqc.Status.DeepCopy()
+	var auditRecords, releaseAuditRecords []*audit.Record
+	var conditions []quotaNotAdmitted
+	var preemptors []preemptor
+	calculatorFailed := false
+	for _, group := range groupGatedPods(gatedPods, admittedGroupMembers) {
+		if calculatorErr := group.calculatorFailure(); calculatorErr != nil {
+			gatedPodsStatus, auditRecords = ctrl.holdCalculatorFailedGroup(gatedPodsStatus, auditRecords, group, rqs, calculatorErr)
+			conditions = notAdmitted(conditions, group, CalculatorFailedReason, calculatorErr.Error())
+			calculatorFailed = true
+			continue
+		}
+		if queueBlocked {
+			gatedPodsStatus = appendGatedPodsStatus(gatedPodsStatus, group, WaitingInQueueReason, nil)
+			auditRecords = ctrl.auditGroup(auditRecords, group, rqs, audit.Gated, WaitingInQueueReason, "")
+			continue
+		}
+		if !group.ready() {
+			message := fmt.Sprintf("pod group %v has %v pods, waiting for %v", group.name, len(group.pods)+group.admitted, group.minMember)
+			ctrl.recorder.Event(group.pods[0].pod, v1.EventTypeNormal, PodGroupIncompleteReason, message)
+			conditions = notAdmitted(conditions, group, PodGroupIncompleteReason, message)
+			gatedPodsStatus = appendGatedPodsStatus(gatedPodsStatus, group, PodGroupIncompleteReason, nil)
+			auditRecords = ctrl.auditGroup(auditRecords, group, rqs, audit.Gated, PodGroupIncompleteReason, message)
+			continue
+		}
+		newRq, err := ctrl.checkPodGroup(group, rqs)
+		if err == nil {
+			releaseAuditRecords = ctrl.auditGroup(releaseAuditRecords, group, rqs, audit.Released, "", "")
+			rqs = newRq
+			released = append(released, group.pods...)
+			continue
+		}
+		message := ctrl.exceedsQuotaMessage(rqs, group.usage())
+		if message == "" {
+			message = util.IgnoreRqErr(err.Error())
+		}
+		for _, gp := range group.pods {
+			ctrl.recorder.Event(gp.pod, v1.EventTypeWarning, v1.EventTypeWarning, util.IgnoreRqErr(err.Error()))
+		}
+		conditions = notAdmitted(conditions, group, ExceedsQuotaReason, message)
+		gatedPodsStatus = appendGatedPodsStatus(gatedPodsStatus, group, ExceedsQuotaReason, ctrl.blockingQuotas(rqs, group.usage()))
+		auditRecords = ctrl.auditGroup(auditRecords, group, rqs, audit.Gated, ExceedsQuotaReason, message)
+		if ctrl.enablePreemption {
+			preemptors = append(preemptors, preemptor{group: group, rqs: rqs})
+		}
+		if group.strict {
+			queueBlocked = true // younger pods must wait until this one is released
+		}
+	}
+	// the usage of the released pods is reserved before the cohorts are unlocked, so that the other members of the
+	// cohorts don't borrow it meanwhile. Their gate is removed afterwards, which cancels the reservations that fail
+	for _, gp := range released {
+		ctrl.reservations.Reserve(gp.pod, gp.usage)
+	}
+	unlockCohorts()
+	cancelReservations := func() {
+		for _, gp := range released {
+			ctrl.reservations.Cancel(gp.pod)
 		}
 	}
 
-	if len(aaqjqc.Status.PodsInJobQueue) > 0 {
-		aaqjqc.Status.ControllerLock = map[string]bool{}
-		for _, lockName := range locksNames {
-			if lockName == ApplicationAwareClusterResourceQuotaLockName && !ctrl.clusterQuotaEnabled {
-				continue
-			}
-			aaqjqc.Status.ControllerLock[lockName] = true // after releasing we should wait for controllers to process and unlock
+	for _, condition := range conditions {
+		ctrl.setQuotaNotAdmittedCondition(condition.pod, condition.reason, condition.message)
+	}
+	for _, p := range preemptors {
+		// victims are evicted for one group at a time so the same victims are not counted twice. A failed preemption
+		// doesn't hold back the pods that fit, the namespace is evaluated again as pods come and go
+		preempting, err := ctrl.preempt(p.group, p.rqs)
+		if err != nil {
+			klog.Errorf("AaqGateController: failed to preempt pods for %v: %v", p.group.preemptorName(), err)
+			continue
 		}
+		if preempting {
+			break
+		}
+	}
+	aaqjqc.Status.GatedPods, aaqjqc.Status.TotalGatedPods = truncateGatedPodsStatus(gatedPodsStatus)
+	metrics.SetGatedPods(ns, len(gatedPodsStatus))
+	if calculatorFailed {
+		ctrl.nsQueue.AddAfter(ns, calculatorFailedRetryPeriod)
+	}
+	if reserving && len(gatedPodsStatus) > 0 {
+		// the pods may fit once the quotas usage replaces the reserved one, which can be less than what was reserved
+		ctrl.nsQueue.AddAfter(ns, quotaSyncRetryPeriod)
+	}
+
+	if staleHandshake || !equality.Semantic.DeepEqual(previousStatus, &aaqjqc.Status) {
 		aaqjqc, err = ctrl.aaqCli.AAQJobQueueConfigs(ns).UpdateStatus(context.Background(), aaqjqc, metav1.UpdateOptions{})
 		if err != nil {
+			cancelReservations()
 			return err, Immediate
 		}
 	}
 
-	err = ctrl.releasePods(aaqjqc.Status.PodsInJobQueue, ns)
+	// decisions are recorded once they are persisted, so a retried pass doesn't record them twice,
+	// releases are recorded once the pods are patched
+	for _, record := range auditRecords {
+		ctrl.auditLogger.Log(record)
+	}
+
+	err = ctrl.releasePods(released, releaseAuditRecords)
 	if err != nil {
 		return err, Immediate
 	}
 	return nil, Forget
 }
 
-func (ctrl *AaqGateController) releasePods(podsToRelease []string, ns string) error {
-	for _, podName := range podsToRelease {
-		obj, exists, err := ctrl.podInformer.GetIndexer().GetByKey(ns + "/" + podName)
-		if err != nil {
-			return err
-		}
-		if !exists {
-			continue
-		}
-		pod := obj.(*v1.Pod).DeepCopy()
-		if pod.Spec.SchedulingGates != nil && len(pod.Spec.SchedulingGates) == 1 && pod.Spec.SchedulingGates[0].Name == util.AAQGate {
-			pod.Spec.SchedulingGates = []v1.PodSchedulingGate{}
-			_, err = ctrl.aaqCli.CoreV1().Pods(ns).Update(context.Background(), pod, metav1.UpdateOptions{})
-			if err != nil {
-				return err
+// releasePatch removes the gate of a pod. Pods are patched rather than updated since the cached ones may be stripped
+// of fields an update would drop, the patch fails if the gates changed meanwhile
+var releasePatch = []byte(fmt.Sprintf(`[{"op": "test", "path": "/spec/schedulingGates", "value": [{"name": %q}]}, {"op": "remove", "path": "/spec/schedulingGates"}]`, util.AAQGate))
+
+// releasePods removes the gate of the pods admitted by the same evaluation, releaseParallelism of them at once.
+// Their usage is reserved by the caller until the quotas usage includes them, the reservation of the pods that can't
+// be released is canceled. The audit records of the pods are logged with the
+// outcome of their release, pods that were deleted or whose gate was removed meanwhile aren't recorded
+func (ctrl *AaqGateController) releasePods(podsToRelease []gatedPod, auditRecords []*audit.Record) error {
+	records := make(map[string]*audit.Record, len(auditRecords))
+	for _, record := range auditRecords {
+		records[record.Namespace+"/"+record.Pod] = record
+	}
+	var errs []error
+	var errsLock sync.Mutex
+	workqueue.ParallelizeUntil(context.Background(), ctrl.releaseParallelism, len(podsToRelease), func(i int) {
+		gp := podsToRelease[i]
+		released, err := ctrl.releasePod(gp)
+		if record := records[gp.pod.Namespace+"/"+gp.pod.Name]; record != nil && (released || err != nil) {
+			if !released {
+				record.Decision = audit.ReleaseFailed
+				record.Message = err.Error()
 			}
+			ctrl.auditLogger.Log(record)
 		}
-	}
-	return nil
+		if err != nil {
+			errsLock.Lock()
+			errs = append(errs, err)
+			errsLock.Unlock()
+		}
+	})
+	return utilerrors.NewAggregate(errs)
+}
 
+// releasePod returns whether the gate of the pod was removed
+func (ctrl *AaqGateController) releasePod(gp gatedPod) (bool, error) {
+	obj, exists, err := ctrl.podInformer.GetIndexer().GetByKey(gp.pod.Namespace + "/" + gp.pod.Name)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		ctrl.reservations.Cancel(gp.pod)
+		return false, nil
+	}
+	pod := obj.(*v1.Pod)
+	if pod.Spec.SchedulingGates == nil || len(pod.Spec.SchedulingGates) != 1 || pod.Spec.SchedulingGates[0].Name != util.AAQGate {
+		ctrl.reservations.Cancel(gp.pod)
+		return false, nil
+	}
+	ctx, span := tracing.Tracer().Start(tracing.PodContext(context.Background(), pod), "aaq.gate.release", podSpanAttributes(pod))
+	pod, err = ctrl.aaqCli.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.JSONPatchType, releasePatch, metav1.PatchOptions{})
+	if err != nil {
+		ctrl.reservations.Cancel(gp.pod)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return false, err
+	}
+	span.End()
+	metrics.ObserveGatedPodRelease(ctrl.clock.Since(pod.CreationTimestamp.Time))
+	return true, ctrl.clearQuotaAdmittedCondition(pod)
 }
 
 func (ctrl *AaqGateController) createAndGetAaqjqc(ns string) (*v1alpha12.AAQJobQueueConfig, error) {
@@ -375,36 +563,43 @@ func (ctrl *AaqGateController) createAndGetAaqjqc(ns string) (*v1alpha12.AAQJobQ
 	return aaqjqc, nil
 }
 
-func (ctrl *AaqGateController) getArtificialRqsForGateController(ns string) ([]v1.ResourceQuota, error) {
+// getArtificialRqsForGateController returns the quotas of the namespace, the given cluster quotas included, with the
+// usage reserved for the released pods their usage doesn't include yet. It also returns whether any usage is reserved,
+// and fails with errQuotaNotSynced while the usage of a quota wasn't calculated since the controller started
+func (ctrl *AaqGateController) getArtificialRqsForGateController(ns string, clusterQuotaNames []string) ([]v1.ResourceQuota, bool, error) {
 	arqsObjs, err := ctrl.arqInformer.GetIndexer().ByIndex(cache.NamespaceIndex, ns)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	var rqs []v1.ResourceQuota
+	var keys []QuotaKey
+	reserving := false
 	for _, arqObj := range arqsObjs {
 		arq := arqObj.(*v1alpha12.ApplicationAwareResourceQuota)
+		used, reserved, err := ctrl.arqUsage(arq)
+		if err != nil {
+			return nil, false, err
+		}
+		reserving = reserving || reserved
+		keys = append(keys, ArqKey(arq))
+		hard := arq.Status.Hard
+		if arq.Spec.Cohort != "" {
+			// pods can be admitted above the hard limit with capacity borrowed from the cohort
+			hard = quota.Add(hard, ctrl.cohortBorrowable(arq))
+		}
 		rq := v1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: arq.Name, Namespace: ns},
 			Spec:   v1.ResourceQuotaSpec{Hard: arq.Spec.Hard},
-			Status: v1.ResourceQuotaStatus{Hard: arq.Status.Hard, Used: arq.Status.Used},
+			Status: v1.ResourceQuotaStatus{Hard: hard, Used: used},
 		}
 		rqs = append(rqs, rq)
 	}
-	if !ctrl.clusterQuotaEnabled {
-		return rqs, nil
-	}
-
-	clusterQuotaNames, err := ctrl.waitForReadyClusterQuotaNames(ns)
-	if err != nil {
-		return nil, err
-	}
-
 	for _, clusterQuotaName := range clusterQuotaNames {
 		clusterQuota, err := ctrl.clusterQuotaLister.Get(clusterQuotaName)
 		if kapierrors.IsNotFound(err) {
 			continue
 		}
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 
 		// now convert to a ResourceQuota
@@ -412,12 +607,37 @@ func (ctrl *AaqGateController) getArtificialRqsForGateController(ns string) ([]v
 		convertedQuota.ObjectMeta = clusterQuota.ObjectMeta
 		convertedQuota.Namespace = ns
 		convertedQuota.Spec = clusterQuota.Spec.Quota
-		convertedQuota.Status = clusterQuota.Status.Total
+		convertedQuota.Status = *clusterQuota.Status.Total.DeepCopy()
+		// the pods released in any of the namespaces of the cluster quota count against it
+		namespaces, _ := ctrl.clusterQuotaMapper.GetNamespacesFor(clusterQuotaName)
+		for _, namespace := range namespaces {
+			key := AcrqKey(clusterQuota, namespace)
+			reserved, synced := ctrl.reservations.Reserved(key, clusterQuota.ResourceVersion)
+			if !synced {
+				return nil, false, errQuotaNotSynced
+			}
+			reserving = reserving || !quota.IsZero(reserved)
+			convertedQuota.Status.Used = quota.Add(convertedQuota.Status.Used, reserved)
+			if namespace == ns {
+				keys = append(keys, key)
+			}
+		}
 		rqs = append(rqs, convertedQuota)
 
 	}
 
-	return rqs, nil
+	ctrl.reservations.Prune(ns, keys)
+	return rqs, reserving, nil
+}
+
+// arqUsage returns the usage of the quota with the usage reserved for the released pods it doesn't include yet,
+// and whether any usage is reserved
+func (ctrl *AaqGateController) arqUsage(arq *v1alpha12.ApplicationAwareResourceQuota) (v1.ResourceList, bool, error) {
+	reserved, synced := ctrl.reservations.Reserved(ArqKey(arq), arq.ResourceVersion)
+	if !synced {
+		return nil, false, errQuotaNotSynced
+	}
+	return quota.Add(quota.Add(v1.ResourceList{}, arq.Status.Used), reserved), !quota.IsZero(reserved), nil
 }
 
 func (ctrl *AaqGateController) waitForReadyClusterQuotaNames(namespaceName string) ([]string, error) {
@@ -448,6 +668,7 @@ func (ctrl *AaqGateController) Run(ctx context.Context, threadiness int) {
 	klog.Info("Starting Aaq Gate controller")
 	defer klog.Info("Shutting down Aaq Gate controller")
 	defer ctrl.nsQueue.ShutDown()
+	defer ctrl.debouncer.Stop()
 
 	for i := 0; i < threadiness; i++ {
 		go wait.Until(ctrl.runWorker, time.Second, ctrl.stop)
@@ -457,37 +678,110 @@ func (ctrl *AaqGateController) Run(ctx context.Context, threadiness int) {
 
 }
 
-func getCurrLimitedResource(podEvaluator *aaq_evaluator.AaqEvaluator, podToCreate *v1.Pod) (resourcequota.LimitedResource, error) {
-	launcherLimitedResource := resourcequota.LimitedResource{
-		Resource:      "pods",
-		MatchContains: []string{},
-	}
-	usage, err := podEvaluator.Usage(podToCreate)
+// getGatedPods returns all pods in the namespace gated only by AAQ, along with the usage each one will consume once released.
+// It also returns the number of already released pods of each pod group
+func (ctrl *AaqGateController) getGatedPods(ns string) ([]gatedPod, map[string]int, error) {
+	podObjs, err := ctrl.podInformer.GetIndexer().ByIndex(cache.NamespaceIndex, ns)
 	if err != nil {
-		return launcherLimitedResource, err
+		return nil, nil, err
 	}
-	for k, _ := range usage {
-		launcherLimitedResource.MatchContains = append(launcherLimitedResource.MatchContains, string(k))
+	var gatedPods []gatedPod
+	admittedGroupMembers := map[string]int{}
+	for _, podObj := range podObjs {
+		pod := podObj.(*v1.Pod)
+		if pod.Spec.SchedulingGates != nil &&
+			len(pod.Spec.SchedulingGates) == 1 &&
+			pod.Spec.SchedulingGates[0].Name == util.AAQGate {
+			if pod.DeletionTimestamp != nil || pod.Status.Phase == v1.PodFailed {
+				continue // expired pods that were already deleted or failed
+			}
+			ctx, span := startEvaluationSpan(pod)
+			podCopy := podWithoutGates(pod)
+			tracing.SetPodTraceParent(ctx, podCopy) // sidecar calculators continue the evaluation span
+			usage, calculators, err := ctrl.aaqEvaluator.UsageBreakdown(podCopy)
+			if calculatorErr, failedClosed := aaq_evaluator.AsCalculatorFailedError(err); failedClosed {
+				// only the pod stays gated, the rest of the namespace is still evaluated
+				span.RecordError(err)
+				gatedPods = append(gatedPods, gatedPod{pod: pod, span: span, calculators: calculators, calculatorErr: calculatorErr})
+				continue
+			} else if err != nil {
+				span.RecordError(err)
+				span.End()
+				endEvaluationSpans(gatedPods, nil, nil)
+				return nil, nil, err
+			}
+			gatedPods = append(gatedPods, gatedPod{pod: pod, usage: usage, span: span, calculators: calculators})
+		} else if groupName := podGroupName(pod); groupName != "" && len(pod.Spec.SchedulingGates) == 0 &&
+			pod.DeletionTimestamp == nil && pod.Status.Phase != v1.PodSucceeded && pod.Status.Phase != v1.PodFailed {
+			admittedGroupMembers[groupName]++
+		}
 	}
-	return launcherLimitedResource, nil
+	return gatedPods, admittedGroupMembers, nil
 }
 
-func (ctrl *AaqGateController) aaqjqcProcessed(aaqjqc *v1alpha12.AAQJobQueueConfig) bool {
-	for rqName, locked := range aaqjqc.Status.ControllerLock {
-		if rqName == ApplicationAwareClusterResourceQuotaLockName && !ctrl.clusterQuotaEnabled {
-			continue
-		}
-		if locked {
-			return false
+// checkPodGroup checks that all the pods of the group fit in the quotas together
+// and returns the quotas updated with their usage
+func (ctrl *AaqGateController) checkPodGroup(group *podGroup, rqs []v1.ResourceQuota) ([]v1.ResourceQuota, error) {
+	for _, gp := range group.pods {
+		newRqs, err := resourcequota2.CheckRequest(rqs, podAdmissionAttributes(gp.pod), ctrl.aaqEvaluator, []resourcequota.LimitedResource{getCurrLimitedResource(gp.usage)})
+		if err != nil {
+			return nil, err
 		}
+		rqs = newRqs
 	}
-	return true
+	return rqs, nil
+}
+
+func podWithoutGates(pod *v1.Pod) *v1.Pod {
+	podCopy := pod.DeepCopy()
+	podCopy.Spec.SchedulingGates = []v1.PodSchedulingGate{}
+	return podCopy
+}
+
+// podAdmissionAttributes returns the admission attributes of creating the pod without its scheduling gates
+func podAdmissionAttributes(pod *v1.Pod) k8sadmission.Attributes {
+	podCopy := podWithoutGates(pod)
+	return k8sadmission.NewAttributesRecord(podCopy, nil,
+		apiextensions.Kind("Pod").WithVersion("version"), podCopy.Namespace, podCopy.Name,
+		v1alpha12.Resource("pods").WithVersion("version"), "", k8sadmission.Create,
+		&metav1.CreateOptions{}, false, nil)
+}
+
+func (ctrl *AaqGateController) agingPeriod() time.Duration {
+	if ctrl.queueingConfig.AgingPeriod != nil {
+		return ctrl.queueingConfig.AgingPeriod.Duration
+	}
+	return util.DefaultQueueingAgingPeriod
+}
+
+func getCurrLimitedResource(usage v1.ResourceList) resourcequota.LimitedResource {
+	launcherLimitedResource := resourcequota.LimitedResource{
+		Resource:      "pods",
+		MatchContains: []string{},
+	}
+	for k, _ := range usage {
+		launcherLimitedResource.MatchContains = append(launcherLimitedResource.MatchContains, string(k))
+	}
+	return launcherLimitedResource
 }
 
 func (ctrl *AaqGateController) AddMapping(_, namespaceName string) {
-	ctrl.nsQueue.Add(namespaceName)
+	ctrl.debouncer.Enqueue(namespaceName)
 }
 
 func (ctrl *AaqGateController) RemoveMapping(_, namespaceName string) {
-	ctrl.nsQueue.Add(namespaceName)
+	ctrl.debouncer.Enqueue(namespaceName)
+}
+
+// OwnershipChanged evaluates the namespaces that moved to the shards of the replica, and forgets the ones that
+// moved away so that their quotas are calculated again if they come back
+func (ctrl *AaqGateController) OwnershipChanged(namespaces []string) {
+	for _, ns := range namespaces {
+		if ctrl.shards.OwnsNamespace(ns) {
+			ctrl.nsQueue.Add(ns)
+			continue
+		}
+		metrics.DeleteGatedPods(ns)
+		ctrl.reservations.ForgetNamespace(ns)
+	}
 }
@@ -24,6 +24,7 @@ import (
 	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
 	"kubevirt.io/application-aware-quota/tests/builders"
 	"strings"
+	"time"
 )
 
 var _ = Describe("Test aaq-gate-controller", func() {
@@ -61,16 +62,72 @@ var _ = Describe("Test aaq-gate-controller", func() {
 		})
 	})
 
-	DescribeTable("Test execute when aaqjc is not empty", func(aaqjqc *v1alpha1.AAQJobQueueConfig, podsState []metav1.Object, expectedActionSet sets.String) {
+	Context("Test execute with FIFO queueing policy", func() {
+		It("should not release younger pods while the oldest gated pod doesn't fit", func() {
+			ctrl := gomock.NewController(GinkgoT())
+			cli := client.NewMockAAQClient(ctrl)
+			podsState := []metav1.Object{
+				&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: "pod-old", Namespace: testNs, CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour))},
+					Spec: corev1.PodSpec{
+						SchedulingGates: []corev1.PodSchedulingGate{{Name: util.AAQGate}},
+						Containers:      []corev1.Container{{Name: "ctr", Image: "image", Resources: testsutils.GetResourceRequirements(testsutils.GetResourceList("500m", "2Gi"), testsutils.GetResourceList("", ""))}},
+					},
+				},
+				&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: "pod-young", Namespace: testNs, CreationTimestamp: metav1.NewTime(time.Now())},
+					Spec: corev1.PodSpec{
+						SchedulingGates: []corev1.PodSchedulingGate{{Name: util.AAQGate}},
+						Containers:      []corev1.Container{{Name: "ctr", Image: "image", Resources: testsutils.GetResourceRequirements(testsutils.GetResourceList("500m", "512Mi"), testsutils.GetResourceList("", ""))}},
+					},
+				},
+			}
+			podInformer := testsutils.NewFakeSharedIndexInformer(podsState)
+			arqInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{
+				builders.NewArqBuilder().WithNamespace(testNs).WithName("testarq").WithResource(corev1.ResourceRequestsMemory, resource.MustParse("1Gi")).WithSyncStatusHardEmptyStatusUsed().Build(),
+			})
+			aaqjqcInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: AaqjqcName, Namespace: testNs}}})
+			namespaceLister := testsutils.FakeNamespaceLister{Namespaces: map[string]*corev1.Namespace{testNs: {ObjectMeta: metav1.ObjectMeta{Name: testNs}}}}
+			recorder := record.NewFakeRecorder(100)
+			cli.EXPECT().CoreV1().AnyTimes().Return(k8sfake.NewSimpleClientset(metav1ToRuntimePodsObjs(podsState)...).CoreV1())
+			aaqjqcInterfaceMock := client.NewMockAAQJobQueueConfigInterface(ctrl)
+			aaqjqcInterfaceMock.EXPECT().UpdateStatus(context.Background(), gomock.Any(), metav1.UpdateOptions{}).Times(1).DoAndReturn(
+				func(_ context.Context, aaqjqc *v1alpha1.AAQJobQueueConfig, _ metav1.UpdateOptions) (*v1alpha1.AAQJobQueueConfig, error) {
+					Expect(aaqjqc.Status.GatedPods).To(HaveLen(2))
+					Expect(aaqjqc.Status.GatedPods[0].Name).To(Equal("pod-old"))
+					Expect(aaqjqc.Status.GatedPods[0].Reason).To(Equal(ExceedsQuotaReason))
+					Expect(aaqjqc.Status.GatedPods[1].Name).To(Equal("pod-young"))
+					Expect(aaqjqc.Status.GatedPods[1].Position).To(Equal(int32(2)))
+					Expect(aaqjqc.Status.GatedPods[1].Reason).To(Equal(WaitingInQueueReason))
+					return aaqjqc, nil
+				})
+			cli.EXPECT().AAQJobQueueConfigs(testNs).Return(aaqjqcInterfaceMock).Times(1)
+			qc := setupAAQGateController(cli, podInformer, arqInformer, aaqjqcInformer, namespaceLister, recorder)
+			qc.queueingConfig = v1alpha1.QueueingConfiguration{Policy: v1alpha1.FIFO}
+			err, es := qc.execute(testNs)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(es).To(Equal(Forget))
+			Expect(recorder.Events).To(HaveLen(1))
+			Expect(recorder.Events).To(Receive(ContainSubstring("exceeded quota")))
+		})
+	})
+
+	DescribeTable("Test execute when aaqjc has the status of the former release handshake", func(aaqjqc *v1alpha1.AAQJobQueueConfig, podsState []metav1.Object, expectedActionSet sets.String) {
 		ctrl := gomock.NewController(GinkgoT())
 		cli := client.NewMockAAQClient(ctrl)
 		podInformer := testsutils.NewFakeSharedIndexInformer(podsState)
 		arqInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{})
 		aaqjqcInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{aaqjqc})
 		fakek8sCli := k8sfake.NewSimpleClientset(metav1ToRuntimePodsObjs(podsState)...)
-		if expectedActionSet != nil {
-			cli.EXPECT().CoreV1().Times(1).Return(fakek8sCli.CoreV1())
-		}
+		cli.EXPECT().CoreV1().AnyTimes().Return(fakek8sCli.CoreV1())
+		aaqjqcInterfaceMock := client.NewMockAAQJobQueueConfigInterface(ctrl)
+		aaqjqcInterfaceMock.EXPECT().UpdateStatus(context.Background(), gomock.Any(), metav1.UpdateOptions{}).Times(1).DoAndReturn(
+			func(_ context.Context, aaqjqc *v1alpha1.AAQJobQueueConfig, _ metav1.UpdateOptions) (*v1alpha1.AAQJobQueueConfig, error) {
+				Expect(aaqjqc.Status.PodsInJobQueue).To(BeEmpty())
+				Expect(aaqjqc.Status.ControllerLock).To(BeEmpty())
+				return aaqjqc, nil
+			})
+		cli.EXPECT().AAQJobQueueConfigs(testNs).Return(aaqjqcInterfaceMock).Times(1)
 		recorder := record.NewFakeRecorder(100)
 		namespaceLister := testsutils.FakeNamespaceLister{Namespaces: map[string]*corev1.Namespace{}}
 		for _, p := range podsState {
@@ -79,14 +136,18 @@ var _ = Describe("Test aaq-gate-controller", func() {
 		qc := setupAAQGateController(cli, podInformer, arqInformer, aaqjqcInformer, namespaceLister, recorder)
 		err, es := qc.execute(testNs)
 		Expect(err).ToNot(HaveOccurred())
-		Expect(es).To(Equal(Immediate))
+		Expect(es).To(Equal(Forget))
 		actionSet := sets.NewString()
 		for _, action := range fakek8sCli.Actions() {
-			actionSet.Insert(strings.Join([]string{action.GetVerb(), action.GetResource().Resource}, "-"))
+			resource := action.GetResource().Resource
+			if action.GetSubresource() != "" {
+				resource += "/" + action.GetSubresource()
+			}
+			actionSet.Insert(strings.Join([]string{action.GetVerb(), resource}, "-"))
 		}
 		Expect(actionSet.Equal(expectedActionSet)).To(BeTrue(), fmt.Sprintf("Expected actions:\n%v\n but got:\n%v\nDifference:\n%v", expectedActionSet, actionSet, expectedActionSet.Difference(actionSet)))
-	}, Entry(" should release gated pods and requeue",
-		&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: AaqjqcName, Namespace: testNs}, Status: v1alpha1.AAQJobQueueConfigStatus{PodsInJobQueue: []string{"pod-test"}, ControllerLock: map[string]bool{ApplicationAwareResourceQuotaLockName: true}}},
+	}, Entry(" should clear it and release gated pods",
+		&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: AaqjqcName, Namespace: testNs}, Status: v1alpha1.AAQJobQueueConfigStatus{PodsInJobQueue: []string{"pod-test"}, ControllerLock: map[string]bool{"ApplicationAwareResourceQuotaLock": true}}},
 		[]metav1.Object{
 			&corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Namespace: testNs},
@@ -97,10 +158,10 @@ var _ = Describe("Test aaq-gate-controller", func() {
 				},
 			},
 		}, sets.NewString(
-			strings.Join([]string{"update", "pods"}, "-"),
+			strings.Join([]string{"patch", "pods"}, "-"),
 		),
-	), Entry(" should not update pods without our gate and requeue",
-		&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: AaqjqcName, Namespace: testNs}, Status: v1alpha1.AAQJobQueueConfigStatus{PodsInJobQueue: []string{"pod-test"}, ControllerLock: map[string]bool{ApplicationAwareResourceQuotaLockName: true}}},
+	), Entry(" should clear it and not update pods without our gate",
+		&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: AaqjqcName, Namespace: testNs}, Status: v1alpha1.AAQJobQueueConfigStatus{PodsInJobQueue: []string{"pod-test"}, ControllerLock: map[string]bool{"ApplicationAwareResourceQuotaLock": true}}},
 		[]metav1.Object{
 			&corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Namespace: testNs},
@@ -109,21 +170,33 @@ var _ = Describe("Test aaq-gate-controller", func() {
 					Containers: []corev1.Container{{Name: "ctr", Image: "image", Resources: testsutils.GetResourceRequirements(testsutils.GetResourceList("500m", "1Gi"), testsutils.GetResourceList("", ""))}},
 				},
 			},
-		}, nil,
+		}, sets.NewString(),
 	),
 	)
 
-	DescribeTable("Test execute when aaqjc is empty and", func(expectedAaqjqc *v1alpha1.AAQJobQueueConfig, podsState []metav1.Object, arqsState []metav1.Object, expectedActionSet sets.String, shouldReceiveEvent bool) {
+	DescribeTable("Test execute when aaqjc is empty and", func(podsState []metav1.Object, arqsState []metav1.Object, expectedActionSet sets.String, expectedGatedPods []string) {
 		ctrl := gomock.NewController(GinkgoT())
 		cli := client.NewMockAAQClient(ctrl)
 		podInformer := testsutils.NewFakeSharedIndexInformer(podsState)
 		arqInformer := testsutils.NewFakeSharedIndexInformer(arqsState)
 		aaqjqcInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: AaqjqcName, Namespace: testNs}, Status: v1alpha1.AAQJobQueueConfigStatus{}}})
 		fakek8sCli := k8sfake.NewSimpleClientset(metav1ToRuntimePodsObjs(podsState)...)
-		if expectedAaqjqc != nil {
-			cli.EXPECT().CoreV1().MinTimes(1).Return(fakek8sCli.CoreV1())
+		cli.EXPECT().CoreV1().AnyTimes().Return(fakek8sCli.CoreV1())
+		// the status is only written while pods stay gated
+		if len(expectedGatedPods) > 0 {
 			aaqjqcInterfaceMock := client.NewMockAAQJobQueueConfigInterface(ctrl)
-			aaqjqcInterfaceMock.EXPECT().UpdateStatus(context.Background(), expectedAaqjqc, metav1.UpdateOptions{}).Times(1).Return(expectedAaqjqc, nil)
+			aaqjqcInterfaceMock.EXPECT().UpdateStatus(context.Background(), gomock.Any(), metav1.UpdateOptions{}).Times(1).DoAndReturn(
+				func(_ context.Context, aaqjqc *v1alpha1.AAQJobQueueConfig, _ metav1.UpdateOptions) (*v1alpha1.AAQJobQueueConfig, error) {
+					Expect(aaqjqc.Status.PodsInJobQueue).To(BeEmpty())
+					Expect(aaqjqc.Status.ControllerLock).To(BeEmpty())
+					var gatedPods []string
+					for _, gatedPodStatus := range aaqjqc.Status.GatedPods {
+						gatedPods = append(gatedPods, gatedPodStatus.Name)
+					}
+					Expect(gatedPods).To(Equal(expectedGatedPods))
+					Expect(aaqjqc.Status.TotalGatedPods).To(Equal(int32(len(expectedGatedPods))))
+					return aaqjqc, nil
+				})
 			cli.EXPECT().AAQJobQueueConfigs(testNs).Return(aaqjqcInterfaceMock).Times(1)
 		}
 		recorder := record.NewFakeRecorder(100)
@@ -137,20 +210,22 @@ var _ = Describe("Test aaq-gate-controller", func() {
 		Expect(es).To(Equal(Forget))
 		actionSet := sets.NewString()
 		for _, action := range fakek8sCli.Actions() {
-			actionSet.Insert(strings.Join([]string{action.GetVerb(), action.GetResource().Resource}, "-"))
+			resource := action.GetResource().Resource
+			if action.GetSubresource() != "" {
+				resource += "/" + action.GetSubresource()
+			}
+			actionSet.Insert(strings.Join([]string{action.GetVerb(), resource}, "-"))
 		}
 		Expect(actionSet.Equal(expectedActionSet)).To(BeTrue(), fmt.Sprintf("Expected actions:\n%v\n but got:\n%v\nDifference:\n%v", expectedActionSet, actionSet, expectedActionSet.Difference(actionSet)))
 
-		if shouldReceiveEvent {
+		if len(expectedGatedPods) > 0 {
 			ExpectWithOffset(1, recorder.Events).To(Receive(ContainSubstring("exceeded quota")))
 		}
 	}, Entry(" there aren't any pod in the test ns",
-		nil,
 		[]metav1.Object{}, []metav1.Object{},
 		sets.NewString(),
-		false,
-	), Entry(" there is a pod without gate",
 		nil,
+	), Entry(" there is a pod without gate",
 		[]metav1.Object{
 			&corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Namespace: testNs},
@@ -161,9 +236,8 @@ var _ = Describe("Test aaq-gate-controller", func() {
 			},
 		}, []metav1.Object{},
 		sets.NewString(),
-		false,
-	), Entry(" there is a pod with another gate",
 		nil,
+	), Entry(" there is a pod with another gate",
 		[]metav1.Object{
 			&corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Namespace: testNs},
@@ -175,9 +249,8 @@ var _ = Describe("Test aaq-gate-controller", func() {
 			},
 		}, []metav1.Object{},
 		sets.NewString(),
-		false,
-	), Entry(" there is a pod with several gates",
 		nil,
+	), Entry(" there is a pod with several gates",
 		[]metav1.Object{
 			&corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Namespace: testNs},
@@ -189,9 +262,8 @@ var _ = Describe("Test aaq-gate-controller", func() {
 			},
 		}, []metav1.Object{},
 		sets.NewString(),
-		false,
+		nil,
 	), Entry(" there is a pod with gate that should be ungated without arqs",
-		&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: AaqjqcName, Namespace: testNs}, Status: v1alpha1.AAQJobQueueConfigStatus{PodsInJobQueue: []string{"pod-test"}, ControllerLock: map[string]bool{ApplicationAwareResourceQuotaLockName: true}}},
 		[]metav1.Object{
 			&corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Namespace: testNs},
@@ -202,11 +274,10 @@ var _ = Describe("Test aaq-gate-controller", func() {
 				},
 			},
 		}, []metav1.Object{}, sets.NewString(
-			strings.Join([]string{"update", "pods"}, "-"),
+			strings.Join([]string{"patch", "pods"}, "-"),
 		),
-		false,
+		nil,
 	), Entry(" there is a pod with gate that should be ungated with non-blocking-arqs",
-		&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: AaqjqcName, Namespace: testNs}, Status: v1alpha1.AAQJobQueueConfigStatus{PodsInJobQueue: []string{"pod-test"}, ControllerLock: map[string]bool{ApplicationAwareResourceQuotaLockName: true}}},
 		[]metav1.Object{
 			&corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Namespace: testNs},
@@ -220,11 +291,10 @@ var _ = Describe("Test aaq-gate-controller", func() {
 			builders.NewArqBuilder().WithNamespace(testNs).WithName("testarq").WithResource(corev1.ResourceRequestsMemory, resource.MustParse("2Gi")).WithSyncStatusHardEmptyStatusUsed().Build(),
 		},
 		sets.NewString(
-			strings.Join([]string{"update", "pods"}, "-"),
+			strings.Join([]string{"patch", "pods"}, "-"),
 		),
-		false,
-	), Entry(" there is a pod with gate that should not be ungated with blocking-arqs",
 		nil,
+	), Entry(" there is a pod with gate that should not be ungated with blocking-arqs",
 		[]metav1.Object{
 			&corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Namespace: testNs},
@@ -237,10 +307,11 @@ var _ = Describe("Test aaq-gate-controller", func() {
 		}, []metav1.Object{
 			builders.NewArqBuilder().WithNamespace(testNs).WithName("testarq").WithResource(corev1.ResourceRequestsMemory, resource.MustParse("2Mi")).WithSyncStatusHardEmptyStatusUsed().Build(),
 		},
-		sets.NewString(),
-		true,
+		sets.NewString(
+			strings.Join([]string{"update", "pods/status"}, "-"),
+		),
+		[]string{"pod-test"},
 	), Entry(" there is a pod with gate that should not be ungated with two arqs one of them is blocking",
-		nil,
 		[]metav1.Object{
 			&corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Namespace: testNs},
@@ -254,10 +325,11 @@ var _ = Describe("Test aaq-gate-controller", func() {
 			builders.NewArqBuilder().WithNamespace(testNs).WithName("testarq").WithResource(corev1.ResourceRequestsMemory, resource.MustParse("2Gi")).WithSyncStatusHardEmptyStatusUsed().Build(),
 			builders.NewArqBuilder().WithNamespace(testNs).WithName("testarq1").WithResource(corev1.ResourceRequestsMemory, resource.MustParse("2Mi")).WithSyncStatusHardEmptyStatusUsed().Build(),
 		},
-		sets.NewString(),
-		true,
+		sets.NewString(
+			strings.Join([]string{"update", "pods/status"}, "-"),
+		),
+		[]string{"pod-test"},
 	), Entry(" there is a pod with gate that should be ungated with two non-blocking arqs",
-		&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: AaqjqcName, Namespace: testNs}, Status: v1alpha1.AAQJobQueueConfigStatus{PodsInJobQueue: []string{"pod-test"}, ControllerLock: map[string]bool{ApplicationAwareResourceQuotaLockName: true}}},
 		[]metav1.Object{
 			&corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Namespace: testNs},
@@ -272,11 +344,10 @@ var _ = Describe("Test aaq-gate-controller", func() {
 			builders.NewArqBuilder().WithNamespace(testNs).WithName("testarq1").WithResource(corev1.ResourceRequestsMemory, resource.MustParse("1Gi")).WithSyncStatusHardEmptyStatusUsed().Build(),
 		},
 		sets.NewString(
-			strings.Join([]string{"update", "pods"}, "-"),
+			strings.Join([]string{"patch", "pods"}, "-"),
 		),
-		false,
+		nil,
 	), Entry(" there are two pods with gate with args with enough place just for one of them",
-		&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: AaqjqcName, Namespace: testNs}, Status: v1alpha1.AAQJobQueueConfigStatus{PodsInJobQueue: []string{"pod-test2"}, ControllerLock: map[string]bool{ApplicationAwareResourceQuotaLockName: true}}},
 		[]metav1.Object{
 			&corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Namespace: testNs},
@@ -299,11 +370,11 @@ var _ = Describe("Test aaq-gate-controller", func() {
 			builders.NewArqBuilder().WithNamespace(testNs).WithName("testarq1").WithResource(corev1.ResourceRequestsMemory, resource.MustParse("1Gi")).WithSyncStatusHardEmptyStatusUsed().Build(),
 		},
 		sets.NewString(
-			strings.Join([]string{"update", "pods"}, "-"),
+			strings.Join([]string{"patch", "pods"}, "-"),
+			strings.Join([]string{"update", "pods/status"}, "-"),
 		),
-		true,
+		[]string{"pod-test"},
 	), Entry(" there are two pods with gate with blocking arqs each arq block another pod",
-		nil,
 		[]metav1.Object{
 			&corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Namespace: testNs},
@@ -325,8 +396,10 @@ var _ = Describe("Test aaq-gate-controller", func() {
 			builders.NewArqBuilder().WithNamespace(testNs).WithName("testarq").WithResource(corev1.ResourceRequestsCPU, resource.MustParse("400m")).WithSyncStatusHardEmptyStatusUsed().Build(),
 			builders.NewArqBuilder().WithNamespace(testNs).WithName("testarq1").WithResource(corev1.ResourceRequestsMemory, resource.MustParse("1Gi")).WithSyncStatusHardEmptyStatusUsed().Build(),
 		},
-		sets.NewString(),
-		true,
+		sets.NewString(
+			strings.Join([]string{"update", "pods/status"}, "-"),
+		),
+		[]string{"pod-test", "pod-test2"},
 	),
 	)
 
@@ -344,17 +417,31 @@ func setupAAQGateController(clientSet client.AAQClient, podInformer cache.Shared
 	if aaqjcInformer == nil {
 		aaqjcInformer = informerFactory.Aaq().V1alpha1().AAQJobQueueConfigs().Informer()
 	}
+	// the quota controllers calculated the usage of the initial quotas
+	reservations := NewReservationLedger(podInformer)
+	for _, obj := range arqInformer.GetIndexer().List() {
+		arq := obj.(*v1alpha1.ApplicationAwareResourceQuota)
+		reservations.Observed(ArqKey(arq), arq.ResourceVersion, 0)
+	}
 	stop := make(chan struct{})
 	qc := NewAaqGateController(clientSet,
 		podInformer,
 		arqInformer,
 		aaqjcInformer,
 		nil,
+		testsutils.NewFakeSharedIndexInformer(nil),
 		aaq_evaluator.GetAaqEvaluatorsRegistry(),
+		reservations,
+		nil,
 		nil,
 		nsLister,
 		nil,
 		recorder,
+		v1alpha1.QueueingConfiguration{},
+		false,
+		v1alpha1.GateTTLConfiguration{},
+		nil,
+		v1alpha1.EventCoalescingConfiguration{},
 		false,
 		stop,
 	)
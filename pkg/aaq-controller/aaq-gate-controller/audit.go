@@ -0,0 +1,40 @@
+package arq_controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/audit"
+)
+
+// auditGroup records the decision taken for each pod of the group, along with the quotas as they were when
+// the group was evaluated. Records are only built when an audit logger is configured
+func (ctrl *AaqGateController) auditGroup(records []*audit.Record, group *podGroup, rqs []v1.ResourceQuota, decision audit.Decision, reason, message string) []*audit.Record {
+	if ctrl.auditLogger == nil {
+		return records
+	}
+	var quotas []audit.QuotaRecord
+	for _, rq := range rqs {
+		quotas = append(quotas, audit.QuotaRecord{
+			Kind: ctrl.quotaKind(rq),
+			Name: rq.Name,
+			Hard: rq.Status.Hard,
+			Used: rq.Status.Used,
+		})
+	}
+	now := metav1.NewTime(ctrl.clock.Now())
+	for _, gp := range group.pods {
+		records = append(records, &audit.Record{
+			Time:        now,
+			Namespace:   gp.pod.Namespace,
+			Pod:         gp.pod.Name,
+			PodUID:      gp.pod.UID,
+			Decision:    decision,
+			Reason:      reason,
+			Message:     message,
+			Usage:       gp.usage,
+			Calculators: gp.calculators,
+			Quotas:      quotas,
+		})
+	}
+	return records
+}
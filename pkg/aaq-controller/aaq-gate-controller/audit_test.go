@@ -0,0 +1,123 @@
+package arq_controller
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	aaq_evaluator "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-evaluator"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/audit"
+	"kubevirt.io/application-aware-quota/pkg/client"
+	testsutils "kubevirt.io/application-aware-quota/pkg/tests-utils"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"kubevirt.io/application-aware-quota/tests/builders"
+	"sync"
+	"time"
+)
+
+type fakeAuditSink struct {
+	lock    sync.Mutex
+	records []*audit.Record
+}
+
+func (fas *fakeAuditSink) Write(record *audit.Record) error {
+	fas.lock.Lock()
+	defer fas.lock.Unlock()
+	fas.records = append(fas.records, record)
+	return nil
+}
+
+func (fas *fakeAuditSink) Close() error {
+	return nil
+}
+
+var _ = Describe("Test gate controller audit log", func() {
+	testNs := "test"
+
+	newGatedPod := func(name string, age time.Duration, memory string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNs, CreationTimestamp: metav1.NewTime(time.Now().Add(-age))},
+			Spec: corev1.PodSpec{
+				SchedulingGates: []corev1.PodSchedulingGate{{Name: util.AAQGate}},
+				Containers:      []corev1.Container{{Name: "ctr", Image: "image", Resources: testsutils.GetResourceRequirements(testsutils.GetResourceList("", memory), testsutils.GetResourceList("", ""))}},
+			},
+		}
+	}
+
+	It("execute should record the decision of each gated pod once it is persisted", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		cli := client.NewMockAAQClient(ctrl)
+		podsState := []metav1.Object{newGatedPod("pod-large", time.Hour, "2Gi"), newGatedPod("pod-small", 0, "512Mi")}
+		podInformer := testsutils.NewFakeSharedIndexInformer(podsState)
+		arqInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{
+			builders.NewArqBuilder().WithNamespace(testNs).WithName("testarq").WithResource(corev1.ResourceRequestsMemory, resource.MustParse("1Gi")).WithSyncStatusHardEmptyStatusUsed().Build(),
+		})
+		aaqjqcInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: AaqjqcName, Namespace: testNs}}})
+		namespaceLister := testsutils.FakeNamespaceLister{Namespaces: map[string]*corev1.Namespace{testNs: {ObjectMeta: metav1.ObjectMeta{Name: testNs}}}}
+		cli.EXPECT().CoreV1().AnyTimes().Return(k8sfake.NewSimpleClientset(metav1ToRuntimePodsObjs(podsState)...).CoreV1())
+		sink := &fakeAuditSink{}
+		aaqjqcInterfaceMock := client.NewMockAAQJobQueueConfigInterface(ctrl)
+		aaqjqcInterfaceMock.EXPECT().UpdateStatus(context.Background(), gomock.Any(), metav1.UpdateOptions{}).Times(1).DoAndReturn(
+			func(_ context.Context, aaqjqc *v1alpha1.AAQJobQueueConfig, _ metav1.UpdateOptions) (*v1alpha1.AAQJobQueueConfig, error) {
+				Expect(sink.records).To(BeEmpty())
+				return aaqjqc, nil
+			})
+		cli.EXPECT().AAQJobQueueConfigs(testNs).Return(aaqjqcInterfaceMock).AnyTimes()
+		qc := setupAAQGateController(cli, podInformer, arqInformer, aaqjqcInformer, namespaceLister, record.NewFakeRecorder(100))
+		qc.auditLogger = audit.NewLoggerWithSink(sink, 100)
+
+		err, es := qc.execute(testNs)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(es).To(Equal(Forget))
+
+		Expect(sink.records).To(HaveLen(2))
+		large, small := sink.records[0], sink.records[1]
+		Expect(large.Pod).To(Equal("pod-large"))
+		Expect(large.Decision).To(Equal(audit.Gated))
+		Expect(large.Reason).To(Equal(ExceedsQuotaReason))
+		Expect(large.Message).ToNot(BeEmpty())
+		Expect(large.Usage).To(HaveKeyWithValue(corev1.ResourceRequestsMemory, resource.MustParse("2Gi")))
+		Expect(large.Calculators).To(ContainElement(aaq_evaluator.CalculatorUsage{Calculator: aaq_evaluator.PodEvaluatorCalculator, Usage: large.Usage, Match: true}))
+		Expect(small.Pod).To(Equal("pod-small"))
+		Expect(small.Decision).To(Equal(audit.Released))
+		Expect(small.Reason).To(BeEmpty())
+		for _, record := range sink.records {
+			Expect(record.Namespace).To(Equal(testNs))
+			Expect(record.Quotas).To(HaveLen(1))
+			Expect(record.Quotas[0].Kind).To(Equal("ApplicationAwareResourceQuota"))
+			Expect(record.Quotas[0].Name).To(Equal("testarq"))
+			Expect(record.Quotas[0].Hard).To(HaveKeyWithValue(corev1.ResourceRequestsMemory, resource.MustParse("1Gi")))
+		}
+	})
+	It("execute should record the pods whose release failed", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		cli := client.NewMockAAQClient(ctrl)
+		podsState := []metav1.Object{newGatedPod("pod-small", 0, "512Mi")}
+		podInformer := testsutils.NewFakeSharedIndexInformer(podsState)
+		arqInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{
+			builders.NewArqBuilder().WithNamespace(testNs).WithName("testarq").WithResource(corev1.ResourceRequestsMemory, resource.MustParse("1Gi")).WithSyncStatusHardEmptyStatusUsed().Build(),
+		})
+		aaqjqcInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: AaqjqcName, Namespace: testNs}}})
+		namespaceLister := testsutils.FakeNamespaceLister{Namespaces: map[string]*corev1.Namespace{testNs: {ObjectMeta: metav1.ObjectMeta{Name: testNs}}}}
+		// the pod is missing from the API so patching it fails
+		cli.EXPECT().CoreV1().AnyTimes().Return(k8sfake.NewSimpleClientset().CoreV1())
+		sink := &fakeAuditSink{}
+		qc := setupAAQGateController(cli, podInformer, arqInformer, aaqjqcInformer, namespaceLister, record.NewFakeRecorder(100))
+		qc.auditLogger = audit.NewLoggerWithSink(sink, 100)
+
+		err, es := qc.execute(testNs)
+		Expect(err).To(HaveOccurred())
+		Expect(es).To(Equal(Immediate))
+
+		Expect(sink.records).To(HaveLen(1))
+		Expect(sink.records[0].Pod).To(Equal("pod-small"))
+		Expect(sink.records[0].Decision).To(Equal(audit.ReleaseFailed))
+		Expect(sink.records[0].Message).To(ContainSubstring("not found"))
+	})
+})
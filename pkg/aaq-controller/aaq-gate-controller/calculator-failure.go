@@ -0,0 +1,39 @@
+package arq_controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	aaq_evaluator "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-evaluator"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/audit"
+	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"time"
+)
+
+const (
+	// CalculatorFailedReason is set on pods a calculator with the FailClosed policy failed to evaluate
+	CalculatorFailedReason = "CalculatorFailed"
+	// calculatorFailedRetryPeriod is how long until pods a calculator failed to evaluate are evaluated again
+	calculatorFailedRetryPeriod = 30 * time.Second
+)
+
+// calculatorFailure returns the error of the first pod of the group a calculator failed closed on
+func (g *podGroup) calculatorFailure() *aaq_evaluator.CalculatorFailedError {
+	for _, gp := range g.pods {
+		if gp.calculatorErr != nil {
+			return gp.calculatorErr
+		}
+	}
+	return nil
+}
+
+// holdCalculatorFailedGroup keeps the group gated since the usage of some of its pods is unknown, the caller sets
+// the QuotaAdmitted condition of its pods
+func (ctrl *AaqGateController) holdCalculatorFailedGroup(gatedPodsStatus []v1alpha12.GatedPodStatus, auditRecords []*audit.Record,
+	group *podGroup, rqs []v1.ResourceQuota, calculatorErr *aaq_evaluator.CalculatorFailedError) ([]v1alpha12.GatedPodStatus, []*audit.Record) {
+	message := calculatorErr.Error()
+	for _, gp := range group.pods {
+		ctrl.recorder.Event(gp.pod, v1.EventTypeWarning, CalculatorFailedReason, message)
+	}
+	gatedPodsStatus = appendGatedPodsStatus(gatedPodsStatus, group, CalculatorFailedReason, nil)
+	auditRecords = ctrl.auditGroup(auditRecords, group, rqs, audit.Gated, CalculatorFailedReason, message)
+	return gatedPodsStatus, auditRecords
+}
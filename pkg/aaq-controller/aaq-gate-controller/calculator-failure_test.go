@@ -0,0 +1,107 @@
+package arq_controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	v1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+	aaq_evaluator "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-evaluator"
+	"kubevirt.io/application-aware-quota/pkg/client"
+	testsutils "kubevirt.io/application-aware-quota/pkg/tests-utils"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"kubevirt.io/application-aware-quota/tests/builders"
+	"time"
+)
+
+// failClosedRegistry fails closed on the pods labeled with fail and doesn't match the rest
+type failClosedRegistry struct{}
+
+func (failClosedRegistry) Add(_ aaq_evaluator.AaqCalculator) {}
+
+func (r failClosedRegistry) Usage(pod *corev1.Pod, podsState []*corev1.Pod) (corev1.ResourceList, error) {
+	rl, _, err := r.UsageBreakdown(pod, podsState)
+	return rl, err
+}
+
+func (failClosedRegistry) UsageBreakdown(pod *corev1.Pod, _ []*corev1.Pod) (corev1.ResourceList, []aaq_evaluator.CalculatorUsage, error) {
+	if pod.Labels["fail"] == "true" {
+		breakdown := []aaq_evaluator.CalculatorUsage{{Calculator: "sidecar/evaluator", Error: "unavailable"}}
+		return nil, breakdown, &aaq_evaluator.CalculatorFailedError{Calculator: "sidecar/evaluator", Pod: pod.Namespace + "/" + pod.Name, Err: "unavailable"}
+	}
+	return nil, nil, fmt.Errorf("pod didn't match any usageFunc")
+}
+
+func (r failClosedRegistry) UsageBatch(pods []*corev1.Pod, podsState []*corev1.Pod) ([]corev1.ResourceList, []error) {
+	usages := make([]corev1.ResourceList, len(pods))
+	errs := make([]error, len(pods))
+	for i, pod := range pods {
+		usages[i], errs[i] = r.Usage(pod, podsState)
+	}
+	return usages, errs
+}
+
+func (r failClosedRegistry) RecomputeUsageBatch(pods []*corev1.Pod, podsState []*corev1.Pod) ([]corev1.ResourceList, []error) {
+	return r.UsageBatch(pods, podsState)
+}
+
+var _ = Describe("Test calculator failures", func() {
+	testNs := "test"
+
+	It("should keep only the pods a calculator failed closed on gated", func() {
+		newGatedPod := func(name string, fail bool) *corev1.Pod {
+			labels := map[string]string{}
+			if fail {
+				labels["fail"] = "true"
+			}
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNs, Labels: labels, CreationTimestamp: metav1.NewTime(time.Now())},
+				Spec: corev1.PodSpec{
+					SchedulingGates: []corev1.PodSchedulingGate{{Name: util.AAQGate}},
+					Containers:      []corev1.Container{{Name: "ctr", Image: "image", Resources: testsutils.GetResourceRequirements(testsutils.GetResourceList("500m", "512Mi"), testsutils.GetResourceList("", ""))}},
+				},
+			}
+		}
+		podsState := []metav1.Object{newGatedPod("pod-failed", true), newGatedPod("pod-ok", false)}
+		ctrl := gomock.NewController(GinkgoT())
+		cli := client.NewMockAAQClient(ctrl)
+		podInformer := testsutils.NewFakeSharedIndexInformer(podsState)
+		arqInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{
+			builders.NewArqBuilder().WithNamespace(testNs).WithName("testarq").WithResource(corev1.ResourceRequestsMemory, resource.MustParse("1Gi")).WithSyncStatusHardEmptyStatusUsed().Build(),
+		})
+		aaqjqcInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: AaqjqcName, Namespace: testNs}}})
+		namespaceLister := testsutils.FakeNamespaceLister{Namespaces: map[string]*corev1.Namespace{testNs: {ObjectMeta: metav1.ObjectMeta{Name: testNs}}}}
+		recorder := record.NewFakeRecorder(100)
+		cli.EXPECT().CoreV1().AnyTimes().Return(k8sfake.NewSimpleClientset(metav1ToRuntimePodsObjs(podsState)...).CoreV1())
+		aaqjqcInterfaceMock := client.NewMockAAQJobQueueConfigInterface(ctrl)
+		aaqjqcInterfaceMock.EXPECT().UpdateStatus(context.Background(), gomock.Any(), metav1.UpdateOptions{}).Times(1).DoAndReturn(
+			func(_ context.Context, aaqjqc *v1alpha1.AAQJobQueueConfig, _ metav1.UpdateOptions) (*v1alpha1.AAQJobQueueConfig, error) {
+				Expect(aaqjqc.Status.GatedPods).To(HaveLen(1))
+				Expect(aaqjqc.Status.GatedPods[0].Name).To(Equal("pod-failed"))
+				Expect(aaqjqc.Status.GatedPods[0].Reason).To(Equal(CalculatorFailedReason))
+				return aaqjqc, nil
+			})
+		cli.EXPECT().AAQJobQueueConfigs(testNs).Return(aaqjqcInterfaceMock).Times(1)
+		qc := setupAAQGateController(cli, podInformer, arqInformer, aaqjqcInformer, namespaceLister, recorder)
+		qc.aaqEvaluator = aaq_evaluator.NewAaqEvaluator(v1.NewPodLister(podInformer.GetIndexer()), failClosedRegistry{}, testingclock.NewFakeClock(time.Now()))
+		err, es := qc.execute(testNs)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(es).To(Equal(Forget))
+		Expect(recorder.Events).To(Receive(ContainSubstring(CalculatorFailedReason)))
+
+		pod, err := cli.CoreV1().Pods(testNs).Get(context.Background(), "pod-failed", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pod.Status.Conditions).To(ContainElement(HaveField("Reason", CalculatorFailedReason)))
+		pod, err = cli.CoreV1().Pods(testNs).Get(context.Background(), "pod-ok", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pod.Spec.SchedulingGates).To(BeEmpty())
+	})
+})
@@ -0,0 +1,103 @@
+package arq_controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"sort"
+	"sync"
+)
+
+// cohortMembers returns all the quotas that belong to the cohort
+func (ctrl *AaqGateController) cohortMembers(cohort string) []*v1alpha12.ApplicationAwareResourceQuota {
+	var members []*v1alpha12.ApplicationAwareResourceQuota
+	for _, arqObj := range ctrl.arqInformer.GetIndexer().List() {
+		arq := arqObj.(*v1alpha12.ApplicationAwareResourceQuota)
+		if arq.Spec.Cohort == cohort {
+			members = append(members, arq)
+		}
+	}
+	return members
+}
+
+// namespaceCohorts returns the cohorts the namespace quotas belong to
+func (ctrl *AaqGateController) namespaceCohorts(ns string) []string {
+	arqObjs, err := ctrl.arqInformer.GetIndexer().ByIndex(cache.NamespaceIndex, ns)
+	if err != nil {
+		return nil
+	}
+	var cohorts []string
+	for _, arqObj := range arqObjs {
+		if cohort := arqObj.(*v1alpha12.ApplicationAwareResourceQuota).Spec.Cohort; cohort != "" {
+			cohorts = append(cohorts, cohort)
+		}
+	}
+	return cohorts
+}
+
+// lockCohorts locks the cohorts the namespace quotas belong to, so that namespaces of the same cohort are evaluated
+// one at a time and the same idle capacity isn't lent twice, while the other cohorts aren't held. The cohorts are
+// locked in order so that namespaces in several cohorts don't deadlock. The returned function unlocks them, and
+// does nothing once they are unlocked
+func (ctrl *AaqGateController) lockCohorts(ns string) func() {
+	cohorts := ctrl.namespaceCohorts(ns)
+	sort.Strings(cohorts)
+	var locks []*sync.Mutex
+	ctrl.cohortLocksLock.Lock()
+	for i, cohort := range cohorts {
+		if i > 0 && cohorts[i-1] == cohort {
+			continue
+		}
+		lock, ok := ctrl.cohortLocks[cohort]
+		if !ok {
+			lock = &sync.Mutex{}
+			ctrl.cohortLocks[cohort] = lock
+		}
+		locks = append(locks, lock)
+	}
+	ctrl.cohortLocksLock.Unlock()
+	for _, lock := range locks {
+		lock.Lock()
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			for i := len(locks) - 1; i >= 0; i-- {
+				locks[i].Unlock()
+			}
+		})
+	}
+}
+
+// enqueueCohort enqueues the namespaces of all the cohort quotas, since a change in the usage
+// of one of them may let the others borrow more or less
+func (ctrl *AaqGateController) enqueueCohort(cohort string) {
+	if cohort == "" {
+		return
+	}
+	for _, member := range ctrl.cohortMembers(cohort) {
+		ctrl.debouncer.Enqueue(member.Namespace)
+	}
+}
+
+// cohortBorrowable returns the amount of each resource the quota can borrow from the idle capacity of its cohort.
+// The usage reserved for the pods released against the other members counts as used, so that the same capacity
+// isn't lent twice, and nothing can be borrowed while the usage of a member wasn't calculated yet.
+// Must be called with the cohort locked
+func (ctrl *AaqGateController) cohortBorrowable(arq *v1alpha12.ApplicationAwareResourceQuota) v1.ResourceList {
+	var lenders []*v1alpha12.ApplicationAwareResourceQuota
+	for _, member := range ctrl.cohortMembers(arq.Spec.Cohort) {
+		if member.Namespace == arq.Namespace && member.Name == arq.Name {
+			continue
+		}
+		used, _, err := ctrl.arqUsage(member)
+		if err != nil {
+			return nil
+		}
+		lender := member.DeepCopy()
+		lender.Status.Used = used
+		lenders = append(lenders, lender)
+	}
+	return util.CohortBorrowable(arq, lenders)
+}
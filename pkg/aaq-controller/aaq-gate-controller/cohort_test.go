@@ -0,0 +1,190 @@
+package arq_controller
+
+import (
+	"fmt"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	"kubevirt.io/application-aware-quota/pkg/client"
+	testsutils "kubevirt.io/application-aware-quota/pkg/tests-utils"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"kubevirt.io/application-aware-quota/tests/builders"
+	"time"
+)
+
+var _ = Describe("Test cohort borrowing", func() {
+	newCohortArq := func(ns, hard, used string) *builders.ArqBuilder {
+		return builders.NewArqBuilder().WithNamespace(ns).WithName("testarq").WithCohort("cohort").
+			WithResource(corev1.ResourceRequestsMemory, resource.MustParse(hard)).WithSyncStatusHardEmptyStatusUsed().
+			WithStatusUsed(corev1.ResourceRequestsMemory, resource.MustParse(used))
+	}
+
+	It("cohortBorrowable should only lend idle capacity within the lending and borrowing limits", func() {
+		borrower := newCohortArq("borrower", "1Gi", "1Gi").Build()
+		arqInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{
+			borrower,
+			// lends at most 2Gi and uses none of it
+			newCohortArq("lender", "4Gi", "1Gi").WithLendingLimit(corev1.ResourceRequestsMemory, resource.MustParse("2Gi")).Build(),
+			// borrows 1Gi on top of its own 2Gi
+			newCohortArq("other-borrower", "2Gi", "3Gi").Build(),
+			builders.NewArqBuilder().WithNamespace("not-in-cohort").WithName("testarq").
+				WithResource(corev1.ResourceRequestsMemory, resource.MustParse("8Gi")).WithSyncStatusHardEmptyStatusUsed().Build(),
+		})
+		qc := setupAAQGateController(nil, nil, arqInformer, nil, testsutils.FakeNamespaceLister{}, record.NewFakeRecorder(100))
+
+		Expect(quota.Equals(qc.cohortBorrowable(borrower), corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("1Gi")})).To(BeTrue())
+
+		borrower.Spec.BorrowingLimit = corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("512Mi")}
+		Expect(quota.Equals(qc.cohortBorrowable(borrower), corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("512Mi")})).To(BeTrue())
+
+		// the pods released against the lender use its idle capacity until its usage includes them
+		released := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "released", Namespace: "lender", UID: "released-uid"}}
+		qc.reservations.Reserve(released, corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("2Gi")})
+		Expect(quota.IsZero(qc.cohortBorrowable(borrower))).To(BeTrue())
+		qc.reservations.Cancel(released)
+
+		// nothing is lent while the usage of a member wasn't calculated since the controller started
+		Expect(arqInformer.GetIndexer().Add(newCohortArq("new-member", "4Gi", "0").Build())).To(Succeed())
+		Expect(qc.cohortBorrowable(borrower)).To(BeEmpty())
+	})
+
+	It("execute should admit a pod above the hard limit with capacity borrowed from the cohort", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		cli := client.NewMockAAQClient(ctrl)
+		testNs := "borrower"
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Namespace: testNs},
+			Spec: corev1.PodSpec{
+				SchedulingGates: []corev1.PodSchedulingGate{{Name: util.AAQGate}},
+				Containers:      []corev1.Container{{Name: "ctr", Image: "image", Resources: testsutils.GetResourceRequirements(testsutils.GetResourceList("", "1Gi"), testsutils.GetResourceList("", ""))}},
+			},
+		}
+		podInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{pod})
+		borrower := newCohortArq(testNs, "1Gi", "512Mi").Build()
+		arqInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{
+			borrower,
+			newCohortArq("lender", "2Gi", "1Gi").Build(),
+		})
+		aaqjqcInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: AaqjqcName, Namespace: testNs}}})
+		namespaceLister := testsutils.FakeNamespaceLister{Namespaces: map[string]*corev1.Namespace{testNs: {ObjectMeta: metav1.ObjectMeta{Name: testNs}}}}
+		fakek8sCli := k8sfake.NewSimpleClientset(pod)
+		cli.EXPECT().CoreV1().AnyTimes().Return(fakek8sCli.CoreV1())
+		qc := setupAAQGateController(cli, podInformer, arqInformer, aaqjqcInformer, namespaceLister, record.NewFakeRecorder(100))
+
+		err, _ := qc.execute(testNs)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fakek8sCli.Actions()).To(ContainElement(WithTransform(func(action k8stesting.Action) string {
+			return action.GetVerb() + "-" + action.GetResource().Resource
+		}, Equal("patch-pods"))))
+		// other cohort namespaces can't borrow the capacity until the release is reflected in the quota usage
+		reserved, synced := qc.reservations.Reserved(ArqKey(borrower), borrower.ResourceVersion)
+		Expect(synced).To(BeTrue())
+		Expect(reserved).To(HaveKeyWithValue(corev1.ResourceRequestsMemory, resource.MustParse("1Gi")))
+	})
+
+	It("lockCohorts should only hold the namespaces of the same cohorts", func() {
+		arqInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{
+			newCohortArq("first", "1Gi", "0").Build(),
+			newCohortArq("second", "1Gi", "0").Build(),
+			newCohortArq("other", "1Gi", "0").WithCohort("other-cohort").Build(),
+		})
+		qc := setupAAQGateController(nil, nil, arqInformer, nil, testsutils.FakeNamespaceLister{}, record.NewFakeRecorder(100))
+
+		unlock := qc.lockCohorts("first")
+		otherLocked := make(chan struct{})
+		go func() {
+			qc.lockCohorts("other")()
+			close(otherLocked)
+		}()
+		Eventually(otherLocked).Should(BeClosed())
+
+		secondLocked := make(chan struct{})
+		go func() {
+			qc.lockCohorts("second")()
+			close(secondLocked)
+		}()
+		Consistently(secondLocked, 100*time.Millisecond).ShouldNot(BeClosed())
+		unlock()
+		Eventually(secondLocked).Should(BeClosed())
+		// unlocking again doesn't unlock the cohort for someone else
+		unlock()
+		unlock = qc.lockCohorts("first")
+		defer unlock()
+		Expect(qc.cohortLocks["cohort"].TryLock()).To(BeFalse())
+	})
+
+	It("execute should reserve the usage of the released pods and unlock the cohort before removing their gate", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		cli := client.NewMockAAQClient(ctrl)
+		testNs := "borrower"
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Namespace: testNs, UID: "pod-uid"},
+			Spec: corev1.PodSpec{
+				SchedulingGates: []corev1.PodSchedulingGate{{Name: util.AAQGate}},
+				Containers:      []corev1.Container{{Name: "ctr", Image: "image", Resources: testsutils.GetResourceRequirements(testsutils.GetResourceList("", "1Gi"), testsutils.GetResourceList("", ""))}},
+			},
+		}
+		podInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{pod})
+		arqInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{
+			newCohortArq(testNs, "1Gi", "512Mi").Build(),
+			newCohortArq("lender", "2Gi", "1Gi").Build(),
+		})
+		aaqjqcInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: AaqjqcName, Namespace: testNs}}})
+		namespaceLister := testsutils.FakeNamespaceLister{Namespaces: map[string]*corev1.Namespace{testNs: {ObjectMeta: metav1.ObjectMeta{Name: testNs}}}}
+		fakek8sCli := k8sfake.NewSimpleClientset(pod)
+		cli.EXPECT().CoreV1().AnyTimes().Return(fakek8sCli.CoreV1())
+		qc := setupAAQGateController(cli, podInformer, arqInformer, aaqjqcInformer, namespaceLister, record.NewFakeRecorder(100))
+
+		reservedOnPatch := false
+		lockedOnPatch := true
+		fakek8sCli.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			reservedOnPatch = qc.reservations.reservations[testNs][pod.UID] != nil
+			if qc.cohortLocks["cohort"].TryLock() {
+				lockedOnPatch = false
+				qc.cohortLocks["cohort"].Unlock()
+			}
+			return false, nil, nil
+		})
+
+		err, _ := qc.execute(testNs)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reservedOnPatch).To(BeTrue())
+		Expect(lockedOnPatch).To(BeFalse())
+	})
+
+	It("execute should cancel the reservation of a pod whose gate fails to be removed", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		cli := client.NewMockAAQClient(ctrl)
+		testNs := "borrower"
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Namespace: testNs, UID: "pod-uid"},
+			Spec: corev1.PodSpec{
+				SchedulingGates: []corev1.PodSchedulingGate{{Name: util.AAQGate}},
+				Containers:      []corev1.Container{{Name: "ctr", Image: "image", Resources: testsutils.GetResourceRequirements(testsutils.GetResourceList("", "1Gi"), testsutils.GetResourceList("", ""))}},
+			},
+		}
+		podInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{pod})
+		arqInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{newCohortArq(testNs, "2Gi", "0").Build()})
+		aaqjqcInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: AaqjqcName, Namespace: testNs}}})
+		namespaceLister := testsutils.FakeNamespaceLister{Namespaces: map[string]*corev1.Namespace{testNs: {ObjectMeta: metav1.ObjectMeta{Name: testNs}}}}
+		fakek8sCli := k8sfake.NewSimpleClientset(pod)
+		fakek8sCli.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("patch failed")
+		})
+		cli.EXPECT().CoreV1().AnyTimes().Return(fakek8sCli.CoreV1())
+		qc := setupAAQGateController(cli, podInformer, arqInformer, aaqjqcInformer, namespaceLister, record.NewFakeRecorder(100))
+
+		err, _ := qc.execute(testNs)
+		Expect(err).To(HaveOccurred())
+		Expect(qc.reservations.reservations[testNs]).To(BeEmpty())
+	})
+})
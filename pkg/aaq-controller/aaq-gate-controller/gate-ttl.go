@@ -0,0 +1,117 @@
+package arq_controller
+
+import (
+	"context"
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	kapierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"time"
+)
+
+const (
+	GateTTLExpiredReason = "GateTTLExpired"
+	// GateTTLExpiredCondition is set on expired pods that keep waiting for quota, so their event is only emitted once
+	GateTTLExpiredCondition v1.PodConditionType = "GateTTLExpired"
+)
+
+// gateTTL returns for how long the pod can stay gated, zero means forever
+func (ctrl *AaqGateController) gateTTL(pod *v1.Pod) time.Duration {
+	if ttl, ok := pod.Annotations[util.GateTTLAnnotation]; ok {
+		duration, err := time.ParseDuration(ttl)
+		if err == nil && duration > 0 {
+			return duration
+		}
+		// the admission rejects these, only pods admitted before can have them
+		klog.Warningf("AaqGateController: ignoring invalid %v annotation %q on pod %v/%v, it must be a positive duration", util.GateTTLAnnotation, ttl, pod.Namespace, pod.Name)
+	}
+	if ctrl.gateTTLConfig.TTL != nil {
+		return ctrl.gateTTLConfig.TTL.Duration
+	}
+	return 0
+}
+
+// expireGatedPods applies the expiry action on pods that stayed gated longer than their ttl.
+// It returns the pods that should still be evaluated against the quotas and the time until the next pod expires,
+// zero if no pod is going to expire
+func (ctrl *AaqGateController) expireGatedPods(pods []gatedPod) ([]gatedPod, time.Duration, error) {
+	var remaining []gatedPod
+	var nextExpiry time.Duration
+	for _, gp := range pods {
+		ttl := ctrl.gateTTL(gp.pod)
+		if ttl <= 0 {
+			remaining = append(remaining, gp)
+			continue
+		}
+		gatedTime := ctrl.clock.Since(gp.pod.CreationTimestamp.Time)
+		if gatedTime < ttl {
+			if nextExpiry == 0 || ttl-gatedTime < nextExpiry {
+				nextExpiry = ttl - gatedTime
+			}
+			remaining = append(remaining, gp)
+			continue
+		}
+		pod, expired, err := ctrl.expire(gp.pod, ttl)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !expired {
+			// the pod may have been updated with the expired condition, later updates need its latest version
+			gp.pod = pod
+			remaining = append(remaining, gp)
+		}
+	}
+	return remaining, nextExpiry, nil
+}
+
+// expire applies the expiry action on the pod and returns true if the pod shouldn't be released anymore,
+// along with the pod once updated
+func (ctrl *AaqGateController) expire(pod *v1.Pod, ttl time.Duration) (*v1.Pod, bool, error) {
+	message := fmt.Sprintf("pod stayed gated by %v longer than %v", util.AAQGate, ttl)
+	switch ctrl.gateTTLConfig.ExpiryAction {
+	case v1alpha12.GateExpiryDelete:
+		err := ctrl.aaqCli.CoreV1().Pods(pod.Namespace).Delete(context.Background(), pod.Name, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &pod.UID}})
+		if err != nil && !kapierrors.IsNotFound(err) {
+			return nil, false, err
+		}
+		ctrl.recorder.Event(pod, v1.EventTypeWarning, GateTTLExpiredReason, message+", deleting it")
+		return nil, true, nil
+	case v1alpha12.GateExpiryFail:
+		podCopy := pod.DeepCopy()
+		podCopy.Status.Phase = v1.PodFailed
+		podCopy.Status.Reason = GateTTLExpiredReason
+		podCopy.Status.Message = message
+		_, err := ctrl.aaqCli.CoreV1().Pods(pod.Namespace).UpdateStatus(context.Background(), podCopy, metav1.UpdateOptions{})
+		if err != nil && !kapierrors.IsNotFound(err) {
+			return nil, false, err
+		}
+		ctrl.recorder.Event(pod, v1.EventTypeWarning, GateTTLExpiredReason, message+", marking it as failed")
+		return nil, true, nil
+	default:
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == GateTTLExpiredCondition {
+				return pod, false, nil
+			}
+		}
+		podCopy := pod.DeepCopy()
+		podCopy.Status.Conditions = append(podCopy.Status.Conditions, v1.PodCondition{
+			Type:               GateTTLExpiredCondition,
+			Status:             v1.ConditionTrue,
+			Reason:             GateTTLExpiredReason,
+			Message:            message,
+			LastTransitionTime: metav1.NewTime(ctrl.clock.Now()),
+		})
+		updated, err := ctrl.aaqCli.CoreV1().Pods(pod.Namespace).UpdateStatus(context.Background(), podCopy, metav1.UpdateOptions{})
+		if kapierrors.IsNotFound(err) {
+			return pod, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		ctrl.recorder.Event(pod, v1.EventTypeWarning, GateTTLExpiredReason, message)
+		return updated, false, nil
+	}
+}
@@ -0,0 +1,100 @@
+package arq_controller
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+	"kubevirt.io/application-aware-quota/pkg/client"
+	testsutils "kubevirt.io/application-aware-quota/pkg/tests-utils"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"time"
+)
+
+var _ = Describe("Test gate ttl", func() {
+	testNs := "test"
+	now := time.Now()
+	newGatedPod := func(name string, age time.Duration, annotations map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNs, CreationTimestamp: metav1.NewTime(now.Add(-age)), Annotations: annotations},
+			Spec:       corev1.PodSpec{SchedulingGates: []corev1.PodSchedulingGate{{Name: util.AAQGate}}},
+		}
+	}
+	setupController := func(gateTTLConfig v1alpha1.GateTTLConfiguration, pods ...*corev1.Pod) (*AaqGateController, *k8sfake.Clientset, *record.FakeRecorder) {
+		ctrl := gomock.NewController(GinkgoT())
+		cli := client.NewMockAAQClient(ctrl)
+		fakek8sCli := k8sfake.NewSimpleClientset()
+		for _, pod := range pods {
+			Expect(fakek8sCli.Tracker().Add(pod)).To(Succeed())
+		}
+		cli.EXPECT().CoreV1().AnyTimes().Return(fakek8sCli.CoreV1())
+		recorder := record.NewFakeRecorder(100)
+		qc := setupAAQGateController(cli, nil, nil, nil, testsutils.FakeNamespaceLister{}, recorder)
+		qc.gateTTLConfig = gateTTLConfig
+		qc.clock = testingclock.NewFakeClock(now)
+		return qc, fakek8sCli, recorder
+	}
+
+	It("gateTTL should prefer a valid pod annotation over the cluster wide ttl", func() {
+		qc, _, _ := setupController(v1alpha1.GateTTLConfiguration{TTL: &metav1.Duration{Duration: time.Hour}})
+		Expect(qc.gateTTL(newGatedPod("pod", 0, nil))).To(Equal(time.Hour))
+		Expect(qc.gateTTL(newGatedPod("pod", 0, map[string]string{util.GateTTLAnnotation: "5m"}))).To(Equal(5 * time.Minute))
+		Expect(qc.gateTTL(newGatedPod("pod", 0, map[string]string{util.GateTTLAnnotation: "soon"}))).To(Equal(time.Hour))
+		Expect(qc.gateTTL(newGatedPod("pod", 0, map[string]string{util.GateTTLAnnotation: "0s"}))).To(Equal(time.Hour))
+
+		qc.gateTTLConfig = v1alpha1.GateTTLConfiguration{}
+		Expect(qc.gateTTL(newGatedPod("pod", 0, nil))).To(BeZero())
+	})
+
+	DescribeTable("expireGatedPods should", func(expiryAction v1alpha1.GateExpiryAction, expectedRemaining []string, expectedVerb, expectedSubresource string, expectedPhase corev1.PodPhase) {
+		expired := newGatedPod("expired", 2*time.Hour, nil)
+		waiting := newGatedPod("waiting", 0, map[string]string{util.GateTTLAnnotation: "10m"})
+		qc, fakek8sCli, recorder := setupController(v1alpha1.GateTTLConfiguration{TTL: &metav1.Duration{Duration: time.Hour}, ExpiryAction: expiryAction}, expired, waiting)
+
+		remaining, nextExpiry, err := qc.expireGatedPods([]gatedPod{{pod: expired}, {pod: waiting}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nextExpiry).To(Equal(10 * time.Minute))
+		var remainingNames []string
+		for _, gp := range remaining {
+			remainingNames = append(remainingNames, gp.pod.Name)
+		}
+		Expect(remainingNames).To(Equal(expectedRemaining))
+		Expect(recorder.Events).To(Receive(ContainSubstring(GateTTLExpiredReason)))
+
+		Expect(fakek8sCli.Actions()).To(HaveLen(1))
+		action := fakek8sCli.Actions()[0]
+		Expect(action.GetVerb()).To(Equal(expectedVerb))
+		Expect(action.GetSubresource()).To(Equal(expectedSubresource))
+		if expectedSubresource == "status" {
+			pod := action.(testingclient.UpdateAction).GetObject().(*corev1.Pod)
+			Expect(pod.Status.Phase).To(Equal(expectedPhase))
+		}
+	},
+		Entry("only mark expired pods by default", v1alpha1.GateExpiryAction(""), []string{"expired", "waiting"}, "update", "status", corev1.PodPhase("")),
+		Entry("delete expired pods", v1alpha1.GateExpiryDelete, []string{"waiting"}, "delete", "", corev1.PodPhase("")),
+		Entry("fail expired pods", v1alpha1.GateExpiryFail, []string{"waiting"}, "update", "status", corev1.PodFailed),
+	)
+
+	It("expireGatedPods should only emit the event once for pods that keep waiting", func() {
+		expired := newGatedPod("expired", 2*time.Hour, nil)
+		qc, fakek8sCli, recorder := setupController(v1alpha1.GateTTLConfiguration{TTL: &metav1.Duration{Duration: time.Hour}, ExpiryAction: v1alpha1.GateExpiryEvent}, expired)
+
+		remaining, _, err := qc.expireGatedPods([]gatedPod{{pod: expired}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(remaining).To(HaveLen(1))
+		Expect(recorder.Events).To(Receive(ContainSubstring(GateTTLExpiredReason)))
+		Expect(remaining[0].pod.Status.Conditions).To(ContainElement(HaveField("Type", GateTTLExpiredCondition)))
+
+		remaining, _, err = qc.expireGatedPods(remaining)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(remaining).To(HaveLen(1))
+		Expect(recorder.Events).ToNot(Receive())
+		Expect(fakek8sCli.Actions()).To(HaveLen(1))
+	})
+})
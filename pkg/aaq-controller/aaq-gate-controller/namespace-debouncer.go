@@ -0,0 +1,101 @@
+package arq_controller
+
+import (
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/clock"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"sync"
+	"time"
+)
+
+// NamespaceDebouncer coalesces the events of a namespace before it is added to a queue. The namespace is added
+// once no event came for the minimum delay, or once the maximum delay passed since the first event, so that a burst
+// of pod or quota events makes the controller evaluate the namespace once rather than once per event
+type NamespaceDebouncer struct {
+	queue    workqueue.Interface
+	minDelay time.Duration
+	maxDelay time.Duration
+	clock    clock.WithDelayedExecution
+
+	lock    sync.Mutex
+	pending map[string]*pendingNamespace
+	stopped bool
+}
+
+type pendingNamespace struct {
+	// first is when the first event of the namespace that wasn't added to the queue yet came
+	first time.Time
+	timer clock.Timer
+}
+
+// NewNamespaceDebouncer returns a debouncer adding the namespaces to the queue, namespaces are added on every
+// event when the minimum delay is unset or zero
+func NewNamespaceDebouncer(queue workqueue.Interface, config v1alpha12.EventCoalescingConfiguration, clock clock.WithDelayedExecution) *NamespaceDebouncer {
+	d := &NamespaceDebouncer{
+		queue:    queue,
+		maxDelay: util.DefaultEventCoalescingMaxDelay,
+		clock:    clock,
+		pending:  make(map[string]*pendingNamespace),
+	}
+	if config.MinDelay != nil {
+		d.minDelay = config.MinDelay.Duration
+	}
+	if config.MaxDelay != nil {
+		d.maxDelay = config.MaxDelay.Duration
+	}
+	if d.maxDelay < d.minDelay {
+		d.maxDelay = d.minDelay
+	}
+	return d
+}
+
+// Enqueue postpones adding the namespace to the queue by the minimum delay, without postponing it past the maximum
+// delay since the first event that wasn't added yet
+func (d *NamespaceDebouncer) Enqueue(namespace string) {
+	if d.minDelay <= 0 {
+		d.queue.Add(namespace)
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.stopped {
+		return
+	}
+	now := d.clock.Now()
+	first := now
+	if p, ok := d.pending[namespace]; ok {
+		first = p.first
+		p.timer.Stop()
+	}
+	deadline := now.Add(d.minDelay)
+	if latest := first.Add(d.maxDelay); deadline.After(latest) {
+		deadline = latest
+	}
+	// a timer that already fired finds another pending namespace and leaves it to its own timer
+	p := &pendingNamespace{first: first}
+	p.timer = d.clock.AfterFunc(deadline.Sub(now), func() { d.fire(namespace, p) })
+	d.pending[namespace] = p
+}
+
+func (d *NamespaceDebouncer) fire(namespace string, p *pendingNamespace) {
+	d.lock.Lock()
+	if d.pending[namespace] != p {
+		d.lock.Unlock()
+		return
+	}
+	delete(d.pending, namespace)
+	d.lock.Unlock()
+	d.queue.Add(namespace)
+}
+
+// Stop drops the pending namespaces, the namespaces enqueued afterwards are dropped as well
+func (d *NamespaceDebouncer) Stop() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.stopped = true
+	for namespace, p := range d.pending {
+		p.timer.Stop()
+		delete(d.pending, namespace)
+	}
+}
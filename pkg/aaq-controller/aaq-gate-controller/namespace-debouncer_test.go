@@ -0,0 +1,71 @@
+package arq_controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+	testingclock "k8s.io/utils/clock/testing"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"time"
+)
+
+var _ = Describe("Namespace debouncer", func() {
+	testNs := "test"
+	var queue workqueue.Interface
+	var fakeClock *testingclock.FakeClock
+	var debouncer *NamespaceDebouncer
+
+	BeforeEach(func() {
+		queue = workqueue.New()
+		fakeClock = testingclock.NewFakeClock(time.Now())
+		debouncer = NewNamespaceDebouncer(queue, v1alpha1.EventCoalescingConfiguration{
+			MinDelay: &metav1.Duration{Duration: 100 * time.Millisecond},
+			MaxDelay: &metav1.Duration{Duration: time.Second},
+		}, fakeClock)
+	})
+
+	AfterEach(func() {
+		debouncer.Stop()
+		queue.ShutDown()
+	})
+
+	It("should add the namespace once its events stop for the minimum delay", func() {
+		debouncer.Enqueue(testNs)
+		fakeClock.Step(50 * time.Millisecond)
+		debouncer.Enqueue(testNs)
+		fakeClock.Step(50 * time.Millisecond)
+		Consistently(queue.Len, 50*time.Millisecond).Should(BeZero())
+
+		fakeClock.Step(50 * time.Millisecond)
+		Eventually(queue.Len).Should(Equal(1))
+		Expect(fakeClock.HasWaiters()).To(BeFalse())
+	})
+
+	It("should not postpone the namespace past the maximum delay", func() {
+		for i := 0; i < 19; i++ {
+			debouncer.Enqueue(testNs)
+			fakeClock.Step(50 * time.Millisecond)
+		}
+		Consistently(queue.Len, 50*time.Millisecond).Should(BeZero())
+
+		debouncer.Enqueue(testNs)
+		fakeClock.Step(50 * time.Millisecond)
+		Eventually(queue.Len).Should(Equal(1))
+
+		// the next burst is postponed from its own first event
+		item, _ := queue.Get()
+		queue.Done(item)
+		debouncer.Enqueue(testNs)
+		Consistently(queue.Len, 50*time.Millisecond).Should(BeZero())
+		fakeClock.Step(100 * time.Millisecond)
+		Eventually(queue.Len).Should(Equal(1))
+	})
+
+	It("should add the namespace on every event without a minimum delay", func() {
+		debouncer = NewNamespaceDebouncer(queue, v1alpha1.EventCoalescingConfiguration{}, fakeClock)
+		debouncer.Enqueue(testNs)
+		Expect(queue.Len()).To(Equal(1))
+		Expect(fakeClock.HasWaiters()).To(BeFalse())
+	})
+})
@@ -0,0 +1,52 @@
+package arq_controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	kapierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"kubevirt.io/application-aware-quota/pkg/util"
+)
+
+const ReleasedOutOfScopeReason = "ReleasedOutOfScope"
+
+// ReleaseOutOfScope releases the pods left gated in a namespace that is no longer gated nor covered by a quota,
+// before the scoped pod watch drops them. No quota applies to them anymore, so they are released without being
+// evaluated, as they would be without scoped watches. Only the controller owning the namespace releases them
+func (ctrl *AaqGateController) ReleaseOutOfScope(ns string) error {
+	namespace, err := ctrl.namespaceLister.Get(ns)
+	if kapierrors.IsNotFound(err) || (err == nil && namespace.Status.Phase == v1.NamespaceTerminating) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !ctrl.shards.OwnsNamespace(ns) {
+		return nil
+	}
+	podObjs, err := ctrl.podInformer.GetIndexer().ByIndex(cache.NamespaceIndex, ns)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	releasedPods := 0
+	for _, podObj := range podObjs {
+		pod := podObj.(*v1.Pod)
+		if len(pod.Spec.SchedulingGates) != 1 || pod.Spec.SchedulingGates[0].Name != util.AAQGate {
+			continue
+		}
+		released, err := ctrl.releasePod(gatedPod{pod: pod})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if released {
+			releasedPods++
+			ctrl.recorder.Event(pod, v1.EventTypeNormal, ReleasedOutOfScopeReason, "released since the namespace is no longer gated nor covered by a quota")
+		}
+	}
+	if releasedPods > 0 {
+		klog.Infof("AaqGateController: released %v pods left gated in namespace %v, which left the scope of the watches", releasedPods, ns)
+	}
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,56 @@
+package arq_controller
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"kubevirt.io/application-aware-quota/pkg/client"
+	testsutils "kubevirt.io/application-aware-quota/pkg/tests-utils"
+	"kubevirt.io/application-aware-quota/pkg/util"
+)
+
+var _ = Describe("Test releasing the pods of namespaces leaving the scope", func() {
+	testNs := "test"
+	newPod := func(name string, gates ...string) *corev1.Pod {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNs}}
+		for _, gate := range gates {
+			pod.Spec.SchedulingGates = append(pod.Spec.SchedulingGates, corev1.PodSchedulingGate{Name: gate})
+		}
+		return pod
+	}
+
+	It("ReleaseOutOfScope should only release the pods gated by AAQ alone", func() {
+		gated := newPod("gated", util.AAQGate)
+		otherGates := newPod("other-gates", util.AAQGate, "other")
+		running := newPod("running")
+		ctrl := gomock.NewController(GinkgoT())
+		cli := client.NewMockAAQClient(ctrl)
+		fakek8sCli := k8sfake.NewSimpleClientset(gated, otherGates, running)
+		cli.EXPECT().CoreV1().AnyTimes().Return(fakek8sCli.CoreV1())
+		podInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{gated, otherGates, running})
+		namespaceLister := testsutils.FakeNamespaceLister{Namespaces: map[string]*corev1.Namespace{testNs: {ObjectMeta: metav1.ObjectMeta{Name: testNs}}}}
+		recorder := record.NewFakeRecorder(10)
+		qc := setupAAQGateController(cli, podInformer, nil, nil, namespaceLister, recorder)
+
+		Expect(qc.ReleaseOutOfScope(testNs)).To(Succeed())
+		released, err := fakek8sCli.CoreV1().Pods(testNs).Get(context.Background(), "gated", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(released.Spec.SchedulingGates).To(BeEmpty())
+		stillGated, err := fakek8sCli.CoreV1().Pods(testNs).Get(context.Background(), "other-gates", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stillGated.Spec.SchedulingGates).To(HaveLen(2))
+		Expect(recorder.Events).To(HaveLen(1))
+		Expect(<-recorder.Events).To(ContainSubstring(ReleasedOutOfScopeReason))
+	})
+
+	It("ReleaseOutOfScope should ignore deleted namespaces", func() {
+		qc := setupAAQGateController(nil, testsutils.NewFakeSharedIndexInformer([]metav1.Object{newPod("gated", util.AAQGate)}),
+			nil, nil, testsutils.FakeNamespaceLister{}, record.NewFakeRecorder(10))
+		Expect(qc.ReleaseOutOfScope(testNs)).To(Succeed())
+	})
+})
@@ -0,0 +1,125 @@
+package arq_controller
+
+import (
+	"context"
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	kapierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	"k8s.io/klog/v2"
+	"sort"
+	"strings"
+)
+
+const (
+	// QuotaAdmittedCondition is set to False on gated pods that can't be released yet
+	QuotaAdmittedCondition v1.PodConditionType = "QuotaAdmitted"
+	ExceedsQuotaReason                         = "ExceedsQuota"
+)
+
+// quotaNotAdmitted is the condition to set on a gated pod once its namespace was evaluated
+type quotaNotAdmitted struct {
+	pod     *v1.Pod
+	reason  string
+	message string
+}
+
+// notAdmitted returns the condition to set on each pod of the group
+func notAdmitted(conditions []quotaNotAdmitted, group *podGroup, reason, message string) []quotaNotAdmitted {
+	for _, gp := range group.pods {
+		conditions = append(conditions, quotaNotAdmitted{pod: gp.pod, reason: reason, message: message})
+	}
+	return conditions
+}
+
+// setQuotaNotAdmittedCondition records on the gated pod why it can't be released yet.
+// The pod is only updated if the condition changed
+func (ctrl *AaqGateController) setQuotaNotAdmittedCondition(pod *v1.Pod, reason, message string) {
+	condition := v1.PodCondition{
+		Type:               QuotaAdmittedCondition,
+		Status:             v1.ConditionFalse,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: metav1.NewTime(ctrl.clock.Now()),
+	}
+	podCopy := pod.DeepCopy()
+	found := false
+	for i, existing := range podCopy.Status.Conditions {
+		if existing.Type != QuotaAdmittedCondition {
+			continue
+		}
+		if existing.Status == condition.Status && existing.Reason == reason && existing.Message == message {
+			return
+		}
+		if existing.Status == condition.Status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+		podCopy.Status.Conditions[i] = condition
+		found = true
+	}
+	if !found {
+		podCopy.Status.Conditions = append(podCopy.Status.Conditions, condition)
+	}
+	_, err := ctrl.aaqCli.CoreV1().Pods(pod.Namespace).UpdateStatus(context.Background(), podCopy, metav1.UpdateOptions{})
+	if err != nil && !kapierrors.IsNotFound(err) {
+		klog.Errorf("AaqGateController: failed to set %v condition on pod %v/%v: %v", QuotaAdmittedCondition, pod.Namespace, pod.Name, err)
+	}
+}
+
+// clearQuotaAdmittedCondition removes the condition from a pod that was released from the gate
+func (ctrl *AaqGateController) clearQuotaAdmittedCondition(pod *v1.Pod) error {
+	var conditions []v1.PodCondition
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type != QuotaAdmittedCondition {
+			conditions = append(conditions, condition)
+		}
+	}
+	if len(conditions) == len(pod.Status.Conditions) {
+		return nil
+	}
+	podCopy := pod.DeepCopy()
+	podCopy.Status.Conditions = conditions
+	_, err := ctrl.aaqCli.CoreV1().Pods(pod.Namespace).UpdateStatus(context.Background(), podCopy, metav1.UpdateOptions{})
+	if kapierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// exceedsQuotaMessage describes every quota the usage doesn't fit in, along with the requested, used and hard values
+// of each exceeded resource. It returns an empty string if the usage fits in all the quotas
+func (ctrl *AaqGateController) exceedsQuotaMessage(rqs []v1.ResourceQuota, usage v1.ResourceList) string {
+	var messages []string
+	for _, rq := range rqs {
+		requested, exceeded := exceededResources(rq, usage)
+		for _, resourceName := range exceeded {
+			used := rq.Status.Used[resourceName]
+			hard := rq.Status.Hard[resourceName]
+			req := requested[resourceName]
+			messages = append(messages, fmt.Sprintf("%v %v: %v requested: %v, used: %v, hard: %v",
+				ctrl.quotaKind(rq), rq.Name, resourceName, req.String(), used.String(), hard.String()))
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+// exceededResources returns the usage the quota tracks and the sorted resources the usage doesn't fit in
+func exceededResources(rq v1.ResourceQuota, usage v1.ResourceList) (v1.ResourceList, []v1.ResourceName) {
+	requested := quota.Mask(usage, quota.ResourceNames(rq.Status.Hard))
+	newUsage := quota.Mask(quota.Add(rq.Status.Used, requested), quota.ResourceNames(requested))
+	allowed, exceeded := quota.LessThanOrEqual(newUsage, rq.Status.Hard)
+	if allowed {
+		return requested, nil
+	}
+	sort.Slice(exceeded, func(i, j int) bool { return exceeded[i] < exceeded[j] })
+	return requested, exceeded
+}
+
+// quotaKind returns the kind of the quota the artificial resource quota was created from
+func (ctrl *AaqGateController) quotaKind(rq v1.ResourceQuota) string {
+	if _, exists, _ := ctrl.arqInformer.GetIndexer().GetByKey(rq.Namespace + "/" + rq.Name); exists {
+		return "ApplicationAwareResourceQuota"
+	}
+	return "ApplicationAwareClusterResourceQuota"
+}
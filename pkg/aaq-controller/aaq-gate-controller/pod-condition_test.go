@@ -0,0 +1,105 @@
+package arq_controller
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"kubevirt.io/application-aware-quota/pkg/client"
+	testsutils "kubevirt.io/application-aware-quota/pkg/tests-utils"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	"kubevirt.io/application-aware-quota/tests/builders"
+)
+
+var _ = Describe("Test QuotaAdmitted pod condition", func() {
+	testNs := "test"
+	var qc *AaqGateController
+	var fakek8sCli *k8sfake.Clientset
+	var pod *corev1.Pod
+
+	BeforeEach(func() {
+		pod = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Namespace: testNs},
+			Spec:       corev1.PodSpec{SchedulingGates: []corev1.PodSchedulingGate{{Name: util.AAQGate}}},
+		}
+		ctrl := gomock.NewController(GinkgoT())
+		cli := client.NewMockAAQClient(ctrl)
+		fakek8sCli = k8sfake.NewSimpleClientset(pod)
+		cli.EXPECT().CoreV1().AnyTimes().Return(fakek8sCli.CoreV1())
+		arqInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{
+			builders.NewArqBuilder().WithNamespace(testNs).WithName("testarq").WithResource(corev1.ResourceRequestsMemory, resource.MustParse("1Gi")).WithSyncStatusHardEmptyStatusUsed().Build(),
+		})
+		qc = setupAAQGateController(cli, nil, arqInformer, nil, testsutils.FakeNamespaceLister{}, record.NewFakeRecorder(100))
+	})
+
+	getCondition := func() *corev1.PodCondition {
+		updated, err := fakek8sCli.CoreV1().Pods(testNs).Get(context.Background(), pod.Name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		for _, condition := range updated.Status.Conditions {
+			if condition.Type == QuotaAdmittedCondition {
+				return &condition
+			}
+		}
+		return nil
+	}
+
+	It("exceedsQuotaMessage should name the blocking quota and resource", func() {
+		rqs := []corev1.ResourceQuota{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "testarq", Namespace: testNs},
+				Status: corev1.ResourceQuotaStatus{
+					Hard: corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("1Gi"), corev1.ResourceRequestsCPU: resource.MustParse("4")},
+					Used: corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("512Mi"), corev1.ResourceRequestsCPU: resource.MustParse("1")},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "testacrq", Namespace: testNs},
+				Status: corev1.ResourceQuotaStatus{
+					Hard: corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("10")},
+				},
+			},
+		}
+		usage := corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("1Gi"), corev1.ResourceRequestsCPU: resource.MustParse("1")}
+		Expect(qc.exceedsQuotaMessage(rqs, usage)).To(Equal("ApplicationAwareResourceQuota testarq: requests.memory requested: 1Gi, used: 512Mi, hard: 1Gi"))
+
+		usage[corev1.ResourceRequestsCPU] = resource.MustParse("12")
+		Expect(qc.exceedsQuotaMessage(rqs, usage)).To(Equal("ApplicationAwareResourceQuota testarq: requests.cpu requested: 12, used: 1, hard: 4; " +
+			"ApplicationAwareResourceQuota testarq: requests.memory requested: 1Gi, used: 512Mi, hard: 1Gi; " +
+			"ApplicationAwareClusterResourceQuota testacrq: requests.cpu requested: 12, used: 0, hard: 10"))
+
+		Expect(qc.exceedsQuotaMessage(rqs, corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("1")})).To(BeEmpty())
+	})
+
+	It("should only update the pod when the condition changes", func() {
+		qc.setQuotaNotAdmittedCondition(pod, ExceedsQuotaReason, "message")
+		condition := getCondition()
+		Expect(condition).ToNot(BeNil())
+		Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(ExceedsQuotaReason))
+		Expect(condition.Message).To(Equal("message"))
+
+		updated, err := fakek8sCli.CoreV1().Pods(testNs).Get(context.Background(), pod.Name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		fakek8sCli.ClearActions()
+		qc.setQuotaNotAdmittedCondition(updated, ExceedsQuotaReason, "message")
+		Expect(fakek8sCli.Actions()).To(BeEmpty())
+
+		qc.setQuotaNotAdmittedCondition(updated, ExceedsQuotaReason, "another message")
+		Expect(getCondition().Message).To(Equal("another message"))
+	})
+
+	It("should clear the condition when the pod is released", func() {
+		qc.setQuotaNotAdmittedCondition(pod, ExceedsQuotaReason, "message")
+		updated, err := fakek8sCli.CoreV1().Pods(testNs).Get(context.Background(), pod.Name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(qc.podInformer.GetIndexer().Add(updated)).To(Succeed())
+
+		Expect(qc.releasePods([]gatedPod{{pod: updated}}, nil)).To(Succeed())
+		Expect(getCondition()).To(BeNil())
+	})
+})
@@ -0,0 +1,76 @@
+package arq_controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	"strconv"
+)
+
+const PodGroupIncompleteReason = "PodGroupIncomplete"
+
+// podGroup is a set of gated pods that are evaluated against the quotas and released together.
+// Pods without a group form a group of their own
+type podGroup struct {
+	name      string
+	pods      []gatedPod
+	minMember int
+	// admitted is the number of group members that are already released
+	admitted int
+	strict   bool
+}
+
+// ready returns true once enough members of the group exist to evaluate it
+func (g *podGroup) ready() bool {
+	return len(g.pods)+g.admitted >= g.minMember
+}
+
+// usage returns the combined usage of the group gated pods
+func (g *podGroup) usage() v1.ResourceList {
+	usage := v1.ResourceList{}
+	for _, gp := range g.pods {
+		usage = quota.Add(usage, gp.usage)
+	}
+	return usage
+}
+
+func podGroupName(pod *v1.Pod) string {
+	if name, ok := pod.Labels[util.PodGroupLabel]; ok {
+		return name
+	}
+	return pod.Annotations[util.PodGroupLabel]
+}
+
+func podGroupMinMember(pod *v1.Pod) int {
+	minMember, err := strconv.Atoi(pod.Annotations[util.PodGroupMinMemberAnnotation])
+	if err != nil || minMember < 1 {
+		return 1
+	}
+	return minMember
+}
+
+// groupGatedPods groups the ordered gated pods, each group takes the place of its first member in the order.
+// admittedMembers holds the number of already released pods of each group
+func groupGatedPods(pods []gatedPod, admittedMembers map[string]int) []*podGroup {
+	var groups []*podGroup
+	groupsByName := map[string]*podGroup{}
+	for _, gp := range pods {
+		name := podGroupName(gp.pod)
+		if name == "" {
+			groups = append(groups, &podGroup{pods: []gatedPod{gp}, minMember: 1, strict: gp.strict})
+			continue
+		}
+		group, exists := groupsByName[name]
+		if !exists {
+			group = &podGroup{name: name, admitted: admittedMembers[name]}
+			groupsByName[name] = group
+			groups = append(groups, group)
+		}
+		group.pods = append(group.pods, gp)
+		if minMember := podGroupMinMember(gp.pod); minMember > group.minMember {
+			group.minMember = minMember
+		}
+		group.strict = group.strict || gp.strict
+	}
+	return groups
+}
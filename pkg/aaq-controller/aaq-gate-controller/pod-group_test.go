@@ -0,0 +1,112 @@
+package arq_controller
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"kubevirt.io/application-aware-quota/pkg/client"
+	testsutils "kubevirt.io/application-aware-quota/pkg/tests-utils"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"kubevirt.io/application-aware-quota/tests/builders"
+)
+
+var _ = Describe("Test pod groups", func() {
+	testNs := "test"
+	newGroupMember := func(name, group, minMember string) *corev1.Pod {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNs},
+			Spec: corev1.PodSpec{
+				SchedulingGates: []corev1.PodSchedulingGate{{Name: util.AAQGate}},
+				Containers:      []corev1.Container{{Name: "ctr", Image: "image", Resources: testsutils.GetResourceRequirements(testsutils.GetResourceList("", "512Mi"), testsutils.GetResourceList("", ""))}},
+			},
+		}
+		if group != "" {
+			pod.Labels = map[string]string{util.PodGroupLabel: group}
+		}
+		if minMember != "" {
+			pod.Annotations = map[string]string{util.PodGroupMinMemberAnnotation: minMember}
+		}
+		return pod
+	}
+
+	It("groupGatedPods should keep the order of the first member of each group", func() {
+		annotated := newGroupMember("annotated", "", "")
+		annotated.Annotations = map[string]string{util.PodGroupLabel: "group-b"}
+		pods := []gatedPod{
+			{pod: newGroupMember("a-1", "group-a", "3")},
+			{pod: newGroupMember("single", "", "")},
+			{pod: annotated, strict: true},
+			{pod: newGroupMember("a-2", "group-a", "")},
+		}
+		groups := groupGatedPods(pods, map[string]int{"group-a": 1})
+		Expect(groups).To(HaveLen(3))
+		Expect(groups[0].name).To(Equal("group-a"))
+		Expect(groups[0].pods).To(HaveLen(2))
+		Expect(groups[0].minMember).To(Equal(3))
+		Expect(groups[0].ready()).To(BeTrue())
+		Expect(groups[1].name).To(BeEmpty())
+		Expect(groups[1].ready()).To(BeTrue())
+		Expect(groups[2].name).To(Equal("group-b"))
+		Expect(groups[2].strict).To(BeTrue())
+	})
+
+	It("podGroupMinMember should default to one on missing or invalid annotation", func() {
+		Expect(podGroupMinMember(newGroupMember("pod", "group", ""))).To(Equal(1))
+		Expect(podGroupMinMember(newGroupMember("pod", "group", "not-a-number"))).To(Equal(1))
+		Expect(podGroupMinMember(newGroupMember("pod", "group", "4"))).To(Equal(4))
+	})
+
+	DescribeTable("execute should release a pod group only as a whole", func(podsState []metav1.Object, expectedReleased []string) {
+		ctrl := gomock.NewController(GinkgoT())
+		cli := client.NewMockAAQClient(ctrl)
+		podInformer := testsutils.NewFakeSharedIndexInformer(podsState)
+		arqInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{
+			builders.NewArqBuilder().WithNamespace(testNs).WithName("testarq").WithResource(corev1.ResourceRequestsMemory, resource.MustParse("1Gi")).WithSyncStatusHardEmptyStatusUsed().Build(),
+		})
+		aaqjqcInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: AaqjqcName, Namespace: testNs}}})
+		namespaceLister := testsutils.FakeNamespaceLister{Namespaces: map[string]*corev1.Namespace{testNs: {ObjectMeta: metav1.ObjectMeta{Name: testNs}}}}
+		fakek8sCli := k8sfake.NewSimpleClientset(metav1ToRuntimePodsObjs(podsState)...)
+		cli.EXPECT().CoreV1().AnyTimes().Return(fakek8sCli.CoreV1())
+		// the status is only written while pods stay gated
+		if len(expectedReleased) < len(podsState) {
+			aaqjqcInterfaceMock := client.NewMockAAQJobQueueConfigInterface(ctrl)
+			aaqjqcInterfaceMock.EXPECT().UpdateStatus(context.Background(), gomock.Any(), metav1.UpdateOptions{}).Times(1).DoAndReturn(
+				func(_ context.Context, aaqjqc *v1alpha1.AAQJobQueueConfig, _ metav1.UpdateOptions) (*v1alpha1.AAQJobQueueConfig, error) {
+					Expect(aaqjqc.Status.GatedPods).To(HaveLen(len(podsState) - len(expectedReleased)))
+					return aaqjqc, nil
+				})
+			cli.EXPECT().AAQJobQueueConfigs(testNs).Return(aaqjqcInterfaceMock).Times(1)
+		}
+		qc := setupAAQGateController(cli, podInformer, arqInformer, aaqjqcInformer, namespaceLister, record.NewFakeRecorder(100))
+		err, es := qc.execute(testNs)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(es).To(Equal(Forget))
+		// pods that are not released get a condition explaining why
+		Expect(fakek8sCli.Actions()).To(HaveLen(len(podsState)))
+		for _, name := range expectedReleased {
+			pod, err := fakek8sCli.CoreV1().Pods(testNs).Get(context.Background(), name, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pod.Spec.SchedulingGates).To(BeEmpty())
+		}
+	},
+		Entry("group that doesn't fit as a whole", []metav1.Object{
+			newGroupMember("member-1", "group", "3"),
+			newGroupMember("member-2", "group", "3"),
+			newGroupMember("member-3", "group", "3"),
+		}, nil),
+		Entry("group that is not complete yet", []metav1.Object{
+			newGroupMember("member-1", "group", "3"),
+		}, nil),
+		Entry("group that fits as a whole", []metav1.Object{
+			newGroupMember("member-1", "group", "2"),
+			newGroupMember("member-2", "group", "2"),
+		}, []string{"member-1", "member-2"}),
+	)
+})
@@ -0,0 +1,339 @@
+package arq_controller
+
+import (
+	"context"
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	"sort"
+	"strings"
+)
+
+const (
+	PreemptingReason      = "Preempting"
+	PreemptedReason       = "Preempted"
+	PreemptionBlockReason = "PreemptionBlocked"
+)
+
+// preemptionCandidate is a running pod that may be evicted to make room for a higher priority gated pod
+type preemptionCandidate struct {
+	pod   *v1.Pod
+	usage v1.ResourceList
+}
+
+// preemptor is a gated pod group victims may be evicted for, along with the quotas as they were when it was evaluated.
+// Single pods are groups of one
+type preemptor struct {
+	group *podGroup
+	rqs   []v1.ResourceQuota
+}
+
+// freedUsage is the usage freed in each namespace
+type freedUsage map[string]v1.ResourceList
+
+// add returns a copy of the freed usage along with the usage of the pod
+func (f freedUsage) add(pod *v1.Pod, usage v1.ResourceList) freedUsage {
+	added := make(freedUsage, len(f)+1)
+	for ns, freed := range f {
+		added[ns] = freed
+	}
+	added[pod.Namespace] = quota.Add(added[pod.Namespace], usage)
+	return added
+}
+
+// subtract returns a copy of the freed usage without the usage of the pod
+func (f freedUsage) subtract(pod *v1.Pod, usage v1.ResourceList) freedUsage {
+	subtracted := make(freedUsage, len(f))
+	for ns, freed := range f {
+		subtracted[ns] = freed
+	}
+	subtracted[pod.Namespace] = quota.SubtractWithNonNegativeResult(subtracted[pod.Namespace], usage)
+	return subtracted
+}
+
+// preempt evicts a minimal set of lower priority pods so that all the gated pods of the group fit in the namespace
+// quotas. Victims must have a lower priority than every pod of the group, and are never members of the group.
+// The victims are picked in the namespaces of the quotas, so pods of the other namespaces of a cluster quota
+// are evicted when only the cluster quota is exceeded.
+// The gated pods themselves are not released here, they are evaluated again once the freed usage is reflected in the quotas.
+// It returns true if pods are being evicted on behalf of the group. Failed evictions are reported as events,
+// only failures to read the cache are returned.
+func (ctrl *AaqGateController) preempt(group *podGroup, rqs []v1.ResourceQuota) (bool, error) {
+	if ctrl.recentlyPreempted(group) {
+		return true, nil
+	}
+	quotaNamespaces := make([][]string, len(rqs))
+	for i, rq := range rqs {
+		quotaNamespaces[i] = ctrl.quotaNamespaces(rq)
+	}
+	candidates, freed, err := ctrl.getPreemptionCandidates(group, quotaNamespaces)
+	if err != nil {
+		return false, err
+	}
+	fits := func(freed freedUsage) bool {
+		_, err := ctrl.checkPodGroup(group, releaseUsage(rqs, quotaNamespaces, freed))
+		return err == nil
+	}
+	victims, ok := selectVictims(candidates, freed, fits)
+	if !ok {
+		return false, nil
+	}
+	if len(victims) == 0 {
+		return true, nil // pods that are already terminating will free enough usage
+	}
+
+	// make sure nothing blocks any of the victims before evicting a partial set. A PodDisruptionBudget may allow
+	// each victim to be evicted on its own but not all of them, so the whole set is checked against it first
+	if err := ctrl.checkDisruptionBudgets(victims); err != nil {
+		ctrl.recordGroupEvent(group, v1.EventTypeWarning, PreemptionBlockReason, fmt.Sprintf("can't preempt pods: %v", err))
+		return false, nil
+	}
+	for _, victim := range victims {
+		err := ctrl.evict(victim.pod, true)
+		if err != nil {
+			ctrl.recordGroupEvent(group, v1.EventTypeWarning, PreemptionBlockReason, fmt.Sprintf("can't preempt pod %v: %v", victim.pod.Name, err))
+			return false, nil
+		}
+	}
+	preemptorName := group.preemptorName()
+	var victimNames []string
+	for _, victim := range victims {
+		if err := ctrl.evict(victim.pod, false); err != nil {
+			// the victims evicted so far still free their usage, so they are not evicted again for nothing
+			ctrl.recordGroupEvent(group, v1.EventTypeWarning, PreemptionBlockReason, fmt.Sprintf("can't preempt pod %v: %v", victim.pod.Name, err))
+			break
+		}
+		victimNames = append(victimNames, victim.pod.Namespace+"/"+victim.pod.Name)
+		ctrl.recorder.Eventf(victim.pod, v1.EventTypeNormal, PreemptedReason, "preempted to admit higher priority %v", preemptorName)
+	}
+	if len(victimNames) == 0 {
+		return false, nil
+	}
+	ctrl.markPreempted(group)
+	ctrl.recordGroupEvent(group, v1.EventTypeNormal, PreemptingReason, fmt.Sprintf("preempting pods %v", strings.Join(victimNames, ", ")))
+	klog.Infof("AaqGateController: preempting pods %v to admit %v", victimNames, preemptorName)
+	return true, nil
+}
+
+// preemptorName describes the group in the preemption events
+func (g *podGroup) preemptorName() string {
+	if g.name == "" {
+		return fmt.Sprintf("pod %v/%v", g.pods[0].pod.Namespace, g.pods[0].pod.Name)
+	}
+	return fmt.Sprintf("pod group %v/%v", g.pods[0].pod.Namespace, g.name)
+}
+
+// priority is the lowest priority of the group pods, victims must have a lower one
+func (g *podGroup) priority() int32 {
+	priority := podPriority(g.pods[0].pod)
+	for _, gp := range g.pods[1:] {
+		if podPriority(gp.pod) < priority {
+			priority = podPriority(gp.pod)
+		}
+	}
+	return priority
+}
+
+func (ctrl *AaqGateController) recordGroupEvent(group *podGroup, eventType, reason, message string) {
+	for _, gp := range group.pods {
+		ctrl.recorder.Event(gp.pod, eventType, reason, message)
+	}
+}
+
+// quotaNamespaces returns the namespaces whose pods count against the quota
+func (ctrl *AaqGateController) quotaNamespaces(rq v1.ResourceQuota) []string {
+	if ctrl.quotaKind(rq) != "ApplicationAwareClusterResourceQuota" {
+		return []string{rq.Namespace}
+	}
+	namespaces, _ := ctrl.clusterQuotaMapper.GetNamespacesFor(rq.Name)
+	return namespaces
+}
+
+// checkDisruptionBudgets returns an error if evicting all the victims would disrupt more pods than a
+// PodDisruptionBudget allows
+func (ctrl *AaqGateController) checkDisruptionBudgets(victims []preemptionCandidate) error {
+	victimsByNamespace := map[string][]*v1.Pod{}
+	var namespaces []string
+	for _, victim := range victims {
+		if _, exists := victimsByNamespace[victim.pod.Namespace]; !exists {
+			namespaces = append(namespaces, victim.pod.Namespace)
+		}
+		victimsByNamespace[victim.pod.Namespace] = append(victimsByNamespace[victim.pod.Namespace], victim.pod)
+	}
+	for _, ns := range namespaces {
+		pdbObjs, err := ctrl.pdbInformer.GetIndexer().ByIndex(cache.NamespaceIndex, ns)
+		if err != nil {
+			return fmt.Errorf("failed to list the PodDisruptionBudgets of namespace %v: %v", ns, err)
+		}
+		for _, pdbObj := range pdbObjs {
+			pdb := pdbObj.(*policyv1.PodDisruptionBudget)
+			selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+			if err != nil {
+				continue
+			}
+			disrupted := int32(0)
+			for _, pod := range victimsByNamespace[ns] {
+				if selector.Matches(labels.Set(pod.Labels)) {
+					disrupted++
+				}
+			}
+			if disrupted > pdb.Status.DisruptionsAllowed {
+				return fmt.Errorf("PodDisruptionBudget %v/%v allows %v disruptions, %v pods would be evicted",
+					ns, pdb.Name, pdb.Status.DisruptionsAllowed, disrupted)
+			}
+		}
+	}
+	return nil
+}
+
+func (ctrl *AaqGateController) evict(pod *v1.Pod, dryRun bool) error {
+	eviction := &policyv1.Eviction{
+		ObjectMeta:    metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		DeleteOptions: &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &pod.UID}},
+	}
+	if dryRun {
+		eviction.DeleteOptions.DryRun = []string{metav1.DryRunAll}
+	}
+	err := ctrl.aaqCli.CoreV1().Pods(pod.Namespace).EvictV1(context.Background(), eviction)
+	if err != nil {
+		return fmt.Errorf("failed to evict pod %v: %v", pod.Name, err)
+	}
+	return nil
+}
+
+// getPreemptionCandidates returns the running pods with lower priority than the group in the namespaces of its quotas,
+// along with the usage of pods that are already terminating and will be freed anyway.
+// Pods whose usage can't be evaluated are left out, they are neither evicted nor counted as freed
+func (ctrl *AaqGateController) getPreemptionCandidates(group *podGroup, quotaNamespaces [][]string) ([]preemptionCandidate, freedUsage, error) {
+	namespaces := sets.New[string](group.pods[0].pod.Namespace)
+	for _, quotaNamespace := range quotaNamespaces {
+		namespaces.Insert(quotaNamespace...)
+	}
+	priority := group.priority()
+	var candidates []preemptionCandidate
+	freed := freedUsage{}
+	for _, ns := range sets.List(namespaces) {
+		podObjs, err := ctrl.podInformer.GetIndexer().ByIndex(cache.NamespaceIndex, ns)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, podObj := range podObjs {
+			pod := podObj.(*v1.Pod)
+			if len(pod.Spec.SchedulingGates) > 0 || pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+				continue
+			}
+			if group.name != "" && pod.Namespace == group.pods[0].pod.Namespace && podGroupName(pod) == group.name {
+				continue // the admitted members of the group
+			}
+			usage, err := ctrl.aaqEvaluator.Usage(pod)
+			if err != nil {
+				klog.Warningf("AaqGateController: skipping preemption candidate %v/%v: %v", pod.Namespace, pod.Name, err)
+				continue
+			}
+			if pod.DeletionTimestamp != nil {
+				freed = freed.add(pod, usage)
+				continue
+			}
+			if podPriority(pod) < priority {
+				candidates = append(candidates, preemptionCandidate{pod: pod, usage: usage})
+			}
+		}
+	}
+	return candidates, freed, nil
+}
+
+// selectVictims picks the lowest priority candidates, youngest first, until the gated pod fits
+// and then drops any victim that turns out not to be needed.
+// It returns false if evicting all the candidates is not enough.
+func selectVictims(candidates []preemptionCandidate, freed freedUsage, fits func(freed freedUsage) bool) ([]preemptionCandidate, bool) {
+	if fits(freed) {
+		return nil, true
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		pi, pj := podPriority(candidates[i].pod), podPriority(candidates[j].pod)
+		if pi != pj {
+			return pi < pj
+		}
+		return olderThan(candidates[j].pod, candidates[i].pod)
+	})
+
+	var victims []preemptionCandidate
+	released := freed
+	found := false
+	for _, candidate := range candidates {
+		victims = append(victims, candidate)
+		released = released.add(candidate.pod, candidate.usage)
+		if fits(released) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, false
+	}
+
+	// try to spare the highest priority victims first
+	for i := len(victims) - 1; i >= 0; i-- {
+		withoutVictim := released.subtract(victims[i].pod, victims[i].usage)
+		if fits(withoutVictim) {
+			released = withoutVictim
+			victims = append(victims[:i], victims[i+1:]...)
+		}
+	}
+	return victims, true
+}
+
+// releaseUsage returns a copy of the quotas as if the usage freed in their namespaces was already reflected in them
+func releaseUsage(rqs []v1.ResourceQuota, quotaNamespaces [][]string, freedByNamespace freedUsage) []v1.ResourceQuota {
+	var released []v1.ResourceQuota
+	for i, rq := range rqs {
+		freed := v1.ResourceList{}
+		for _, ns := range quotaNamespaces[i] {
+			freed = quota.Add(freed, freedByNamespace[ns])
+		}
+		rqCopy := *rq.DeepCopy()
+		used := rqCopy.Status.Used
+		rqCopy.Status.Used = quota.SubtractWithNonNegativeResult(used, quota.Mask(freed, quota.ResourceNames(used)))
+		released = append(released, rqCopy)
+	}
+	return released
+}
+
+// recentlyPreempted returns true if pods were evicted on behalf of any pod of the group within the preemption backoff,
+// so we don't evict more pods before the freed usage is reflected in the quotas
+func (ctrl *AaqGateController) recentlyPreempted(group *podGroup) bool {
+	ctrl.preemptionsLock.Lock()
+	defer ctrl.preemptionsLock.Unlock()
+	for _, gp := range group.pods {
+		preemptionTime, exists := ctrl.preemptions[gp.pod.UID]
+		if !exists {
+			continue
+		}
+		if ctrl.clock.Since(preemptionTime) > util.DefaultPreemptionBackoff {
+			delete(ctrl.preemptions, gp.pod.UID)
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func (ctrl *AaqGateController) markPreempted(group *podGroup) {
+	ctrl.preemptionsLock.Lock()
+	defer ctrl.preemptionsLock.Unlock()
+	for uid, preemptionTime := range ctrl.preemptions {
+		if ctrl.clock.Since(preemptionTime) > util.DefaultPreemptionBackoff {
+			delete(ctrl.preemptions, uid)
+		}
+	}
+	for _, gp := range group.pods {
+		ctrl.preemptions[gp.pod.UID] = ctrl.clock.Now()
+	}
+}
@@ -0,0 +1,356 @@
+package arq_controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	v12 "k8s.io/client-go/listers/core/v1"
+	testingclient "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+	aaq_evaluator "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-evaluator"
+	"kubevirt.io/application-aware-quota/pkg/client"
+	testsutils "kubevirt.io/application-aware-quota/pkg/tests-utils"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"kubevirt.io/application-aware-quota/tests/builders"
+	"time"
+)
+
+var _ = Describe("Test quota preemption", func() {
+	testNs := "test"
+	now := time.Now()
+	newCandidate := func(name string, age time.Duration, priority int32, memory string) preemptionCandidate {
+		return preemptionCandidate{
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNs, CreationTimestamp: metav1.NewTime(now.Add(-age))},
+				Spec:       corev1.PodSpec{Priority: &priority},
+			},
+			usage: corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse(memory)},
+		}
+	}
+	// the gated pod fits once at least the given amount of memory is freed
+	fitsWhenFreed := func(memory string) func(freed freedUsage) bool {
+		needed := resource.MustParse(memory)
+		return func(freed freedUsage) bool {
+			freedMemory := freed[testNs][corev1.ResourceRequestsMemory]
+			return freedMemory.Cmp(needed) >= 0
+		}
+	}
+	victimNames := func(victims []preemptionCandidate) []string {
+		var names []string
+		for _, v := range victims {
+			names = append(names, v.pod.Name)
+		}
+		return names
+	}
+
+	Context("selectVictims", func() {
+		It("should not select victims when terminating pods free enough usage", func() {
+			candidates := []preemptionCandidate{newCandidate("pod", time.Hour, 0, "1Gi")}
+			victims, ok := selectVictims(candidates, freedUsage{testNs: {corev1.ResourceRequestsMemory: resource.MustParse("1Gi")}}, fitsWhenFreed("1Gi"))
+			Expect(ok).To(BeTrue())
+			Expect(victims).To(BeEmpty())
+		})
+
+		It("should fail when evicting all candidates is not enough", func() {
+			candidates := []preemptionCandidate{
+				newCandidate("pod1", time.Hour, 0, "1Gi"),
+				newCandidate("pod2", time.Hour, 0, "1Gi"),
+			}
+			victims, ok := selectVictims(candidates, freedUsage{}, fitsWhenFreed("3Gi"))
+			Expect(ok).To(BeFalse())
+			Expect(victims).To(BeEmpty())
+		})
+
+		It("should prefer the lowest priority and youngest pods", func() {
+			candidates := []preemptionCandidate{
+				newCandidate("high", time.Minute, 100, "1Gi"),
+				newCandidate("low-old", time.Hour, 0, "1Gi"),
+				newCandidate("low-young", time.Minute, 0, "1Gi"),
+			}
+			victims, ok := selectVictims(candidates, freedUsage{}, fitsWhenFreed("1Gi"))
+			Expect(ok).To(BeTrue())
+			Expect(victimNames(victims)).To(Equal([]string{"low-young"}))
+		})
+
+		It("should spare victims that are not needed", func() {
+			candidates := []preemptionCandidate{
+				newCandidate("small", time.Minute, 0, "512Mi"),
+				newCandidate("large", time.Minute, 10, "2Gi"),
+			}
+			victims, ok := selectVictims(candidates, freedUsage{}, fitsWhenFreed("2Gi"))
+			Expect(ok).To(BeTrue())
+			Expect(victimNames(victims)).To(Equal([]string{"large"}))
+		})
+	})
+
+	It("releaseUsage should subtract only the tracked resources", func() {
+		rqs := []corev1.ResourceQuota{
+			{Status: corev1.ResourceQuotaStatus{Used: corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("2Gi")}}},
+		}
+		released := releaseUsage(rqs, [][]string{{testNs}}, freedUsage{testNs: {corev1.ResourceRequestsCPU: resource.MustParse("1"), corev1.ResourceRequestsMemory: resource.MustParse("1536Mi")}})
+		Expect(quota.Equals(released[0].Status.Used, corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("512Mi")})).To(BeTrue())
+		Expect(quota.Equals(rqs[0].Status.Used, corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("2Gi")})).To(BeTrue())
+	})
+
+	It("releaseUsage should only subtract the usage freed in the namespaces of each quota", func() {
+		used := corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("4Gi")}
+		rqs := []corev1.ResourceQuota{
+			{Status: corev1.ResourceQuotaStatus{Used: used}},
+			{Status: corev1.ResourceQuotaStatus{Used: used}},
+		}
+		freed := freedUsage{
+			testNs:  {corev1.ResourceRequestsMemory: resource.MustParse("1Gi")},
+			"other": {corev1.ResourceRequestsMemory: resource.MustParse("2Gi")},
+		}
+		released := releaseUsage(rqs, [][]string{{testNs}, {testNs, "other"}}, freed)
+		Expect(quota.Equals(released[0].Status.Used, corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("3Gi")})).To(BeTrue())
+		Expect(quota.Equals(released[1].Status.Used, corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("1Gi")})).To(BeTrue())
+	})
+
+	It("getPreemptionCandidates should pick lower priority pods in the namespaces of the quotas", func() {
+		lowPriority, highPriority := int32(0), int32(1000)
+		newPod := func(name, ns string, priority *int32) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns},
+				Spec: corev1.PodSpec{
+					Priority:   priority,
+					Containers: []corev1.Container{{Name: "ctr", Image: "image", Resources: testsutils.GetResourceRequirements(testsutils.GetResourceList("", "1Gi"), testsutils.GetResourceList("", ""))}},
+				},
+				Status: corev1.PodStatus{Phase: corev1.PodRunning},
+			}
+		}
+		preemptor := newPod("preemptor", testNs, &highPriority)
+		podInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{
+			newPod("same-namespace", testNs, &lowPriority),
+			newPod("cluster-quota-namespace", "other", &lowPriority),
+			newPod("higher-priority", "other", &highPriority),
+			newPod("unrelated-namespace", "unrelated", &lowPriority),
+		})
+		qc := setupAAQGateController(nil, podInformer, nil, nil, testsutils.FakeNamespaceLister{}, record.NewFakeRecorder(100))
+
+		candidates, _, err := qc.getPreemptionCandidates(&podGroup{pods: []gatedPod{{pod: preemptor}}}, [][]string{{testNs}, {testNs, "other"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(victimNames(candidates)).To(ConsistOf("same-namespace", "cluster-quota-namespace"))
+	})
+
+	It("getPreemptionCandidates should skip the pods that fail to evaluate and the members of the group", func() {
+		lowPriority, highPriority := int32(0), int32(1000)
+		newPod := func(name string, podLabels map[string]string) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNs, Labels: podLabels},
+				Spec: corev1.PodSpec{
+					Priority:   &lowPriority,
+					Containers: []corev1.Container{{Name: "ctr", Image: "image", Resources: testsutils.GetResourceRequirements(testsutils.GetResourceList("", "1Gi"), testsutils.GetResourceList("", ""))}},
+				},
+				Status: corev1.PodStatus{Phase: corev1.PodRunning},
+			}
+		}
+		preemptor := newPod("preemptor", map[string]string{util.PodGroupLabel: "group"})
+		preemptor.Spec.Priority = &highPriority
+		podInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{
+			newPod("candidate", nil),
+			newPod("failed-evaluation", map[string]string{"fail": "true"}),
+			newPod("admitted-member", map[string]string{util.PodGroupLabel: "group"}),
+		})
+		qc := setupAAQGateController(nil, podInformer, nil, nil, testsutils.FakeNamespaceLister{}, record.NewFakeRecorder(100))
+		qc.aaqEvaluator = aaq_evaluator.NewAaqEvaluator(v12.NewPodLister(podInformer.GetIndexer()), failClosedRegistry{}, testingclock.NewFakeClock(now))
+
+		candidates, _, err := qc.getPreemptionCandidates(&podGroup{name: "group", pods: []gatedPod{{pod: preemptor}}}, [][]string{{testNs}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(victimNames(candidates)).To(ConsistOf("candidate"))
+	})
+
+	It("checkDisruptionBudgets should check all the victims against the allowed disruptions", func() {
+		newVictim := func(name string) preemptionCandidate {
+			return preemptionCandidate{pod: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNs, Labels: map[string]string{"app": "db"}}}}
+		}
+		pdb := &policyv1.PodDisruptionBudget{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: testNs},
+			Spec:       policyv1.PodDisruptionBudgetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}}},
+			Status:     policyv1.PodDisruptionBudgetStatus{DisruptionsAllowed: 1},
+		}
+		qc := setupAAQGateController(nil, nil, nil, nil, testsutils.FakeNamespaceLister{}, record.NewFakeRecorder(100))
+		qc.pdbInformer = testsutils.NewFakeSharedIndexInformer([]metav1.Object{pdb})
+
+		Expect(qc.checkDisruptionBudgets([]preemptionCandidate{newVictim("db-1")})).To(Succeed())
+		// each victim may be evicted on its own, but not both of them
+		Expect(qc.checkDisruptionBudgets([]preemptionCandidate{newVictim("db-1"), newVictim("db-2")})).To(MatchError(ContainSubstring("PodDisruptionBudget test/db allows 1 disruptions")))
+	})
+
+	It("execute should evict lower priority pods to admit a higher priority gated pod", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		cli := client.NewMockAAQClient(ctrl)
+		lowPriority, highPriority := int32(0), int32(1000)
+		runningPod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "running-pod", Namespace: testNs, CreationTimestamp: metav1.NewTime(now.Add(-time.Hour))},
+			Spec: corev1.PodSpec{
+				Priority:   &lowPriority,
+				Containers: []corev1.Container{{Name: "ctr", Image: "image", Resources: testsutils.GetResourceRequirements(testsutils.GetResourceList("", "1Gi"), testsutils.GetResourceList("", ""))}},
+			},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+		gatedPod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "gated-pod", Namespace: testNs, CreationTimestamp: metav1.NewTime(now)},
+			Spec: corev1.PodSpec{
+				Priority:        &highPriority,
+				SchedulingGates: []corev1.PodSchedulingGate{{Name: util.AAQGate}},
+				Containers:      []corev1.Container{{Name: "ctr", Image: "image", Resources: testsutils.GetResourceRequirements(testsutils.GetResourceList("", "1Gi"), testsutils.GetResourceList("", ""))}},
+			},
+		}
+		arq := builders.NewArqBuilder().WithNamespace(testNs).WithName("testarq").WithResource(corev1.ResourceRequestsMemory, resource.MustParse("1Gi")).WithSyncStatusHardEmptyStatusUsed().Build()
+		arq.Status.Used = corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("1Gi")}
+
+		podInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{runningPod, gatedPod})
+		arqInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{arq})
+		aaqjqcInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: AaqjqcName, Namespace: testNs}}})
+		namespaceLister := testsutils.FakeNamespaceLister{Namespaces: map[string]*corev1.Namespace{testNs: {ObjectMeta: metav1.ObjectMeta{Name: testNs}}}}
+		fakek8sCli := k8sfake.NewSimpleClientset(runningPod, gatedPod)
+		cli.EXPECT().CoreV1().MinTimes(1).Return(fakek8sCli.CoreV1())
+		aaqjqcInterfaceMock := client.NewMockAAQJobQueueConfigInterface(ctrl)
+		aaqjqcInterfaceMock.EXPECT().UpdateStatus(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+			func(_ context.Context, aaqjqc *v1alpha1.AAQJobQueueConfig, _ metav1.UpdateOptions) (*v1alpha1.AAQJobQueueConfig, error) {
+				Expect(aaqjqc.Status.PodsInJobQueue).To(BeEmpty())
+				return aaqjqc, nil
+			})
+		cli.EXPECT().AAQJobQueueConfigs(testNs).Return(aaqjqcInterfaceMock).AnyTimes()
+		recorder := record.NewFakeRecorder(100)
+		qc := setupAAQGateController(cli, podInformer, arqInformer, aaqjqcInformer, namespaceLister, recorder)
+		qc.enablePreemption = true
+
+		err, es := qc.execute(testNs)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(es).To(Equal(Forget))
+
+		var evictions []testingclient.CreateAction
+		for _, action := range fakek8sCli.Actions() {
+			if action.GetSubresource() == "eviction" {
+				evictions = append(evictions, action.(testingclient.CreateAction))
+			}
+		}
+		Expect(evictions).To(HaveLen(2))
+		Expect(evictions[0].GetObject().(metav1.Object).GetName()).To(Equal("running-pod"))
+		Expect(qc.preemptions).To(HaveKey(gatedPod.UID))
+		Expect(recorder.Events).To(HaveLen(3))
+
+		// the gated pod should not trigger another preemption until the freed usage is reflected
+		fakek8sCli.ClearActions()
+		err, _ = qc.execute(testNs)
+		Expect(err).ToNot(HaveOccurred())
+		for _, action := range fakek8sCli.Actions() {
+			Expect(action.GetSubresource()).ToNot(Equal("eviction"))
+		}
+	})
+
+	Context("execute with a gated pod group", func() {
+		lowPriority, highPriority := int32(0), int32(1000)
+		newPod := func(name string, age time.Duration, priority *int32, podLabels map[string]string) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNs, Labels: podLabels, CreationTimestamp: metav1.NewTime(now.Add(-age))},
+				Spec: corev1.PodSpec{
+					Priority:   priority,
+					Containers: []corev1.Container{{Name: "ctr", Image: "image", Resources: testsutils.GetResourceRequirements(testsutils.GetResourceList("", "1Gi"), testsutils.GetResourceList("", ""))}},
+				},
+				Status: corev1.PodStatus{Phase: corev1.PodRunning},
+			}
+		}
+		newGatedPod := func(name string) *corev1.Pod {
+			pod := newPod(name, 0, &highPriority, map[string]string{util.PodGroupLabel: "group"})
+			pod.Spec.SchedulingGates = []corev1.PodSchedulingGate{{Name: util.AAQGate}}
+			pod.Status = corev1.PodStatus{}
+			return pod
+		}
+
+		// setup runs two low priority pods filling the quota, the gated group needs both of them evicted.
+		// failedEviction names a victim whose real eviction fails
+		setup := func(failedEviction string) (*AaqGateController, *k8sfake.Clientset, *record.FakeRecorder, *podGroup) {
+			gatedPods := []*corev1.Pod{newGatedPod("gated-1"), newGatedPod("gated-2")}
+			olderPod := newPod("older-pod", 2*time.Hour, &lowPriority, nil)
+			youngerPod := newPod("younger-pod", time.Hour, &lowPriority, nil)
+			arq := builders.NewArqBuilder().WithNamespace(testNs).WithName("testarq").WithResource(corev1.ResourceRequestsMemory, resource.MustParse("2Gi")).WithSyncStatusHardEmptyStatusUsed().Build()
+			arq.Status.Used = corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("2Gi")}
+
+			ctrl := gomock.NewController(GinkgoT())
+			cli := client.NewMockAAQClient(ctrl)
+			podInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{olderPod, youngerPod, gatedPods[0], gatedPods[1]})
+			arqInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{arq})
+			aaqjqcInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: AaqjqcName, Namespace: testNs}}})
+			namespaceLister := testsutils.FakeNamespaceLister{Namespaces: map[string]*corev1.Namespace{testNs: {ObjectMeta: metav1.ObjectMeta{Name: testNs}}}}
+			fakek8sCli := k8sfake.NewSimpleClientset(olderPod, youngerPod, gatedPods[0], gatedPods[1])
+			fakek8sCli.PrependReactor("create", "pods", func(action testingclient.Action) (bool, runtime.Object, error) {
+				eviction, ok := action.(testingclient.CreateAction).GetObject().(*policyv1.Eviction)
+				if ok && eviction.Name == failedEviction && len(eviction.DeleteOptions.DryRun) == 0 {
+					return true, nil, fmt.Errorf("eviction failed")
+				}
+				return false, nil, nil
+			})
+			cli.EXPECT().CoreV1().AnyTimes().Return(fakek8sCli.CoreV1())
+			aaqjqcInterfaceMock := client.NewMockAAQJobQueueConfigInterface(ctrl)
+			aaqjqcInterfaceMock.EXPECT().UpdateStatus(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+				func(_ context.Context, aaqjqc *v1alpha1.AAQJobQueueConfig, _ metav1.UpdateOptions) (*v1alpha1.AAQJobQueueConfig, error) {
+					return aaqjqc, nil
+				})
+			cli.EXPECT().AAQJobQueueConfigs(testNs).Return(aaqjqcInterfaceMock).AnyTimes()
+			recorder := record.NewFakeRecorder(100)
+			qc := setupAAQGateController(cli, podInformer, arqInformer, aaqjqcInformer, namespaceLister, recorder)
+			qc.enablePreemption = true
+			return qc, fakek8sCli, recorder, &podGroup{name: "group", pods: []gatedPod{{pod: gatedPods[0]}, {pod: gatedPods[1]}}}
+		}
+		// evictionAttempts returns the pods the real evictions were attempted for, failed ones included
+		evictionAttempts := func(fakek8sCli *k8sfake.Clientset) []string {
+			var attempts []string
+			for _, action := range fakek8sCli.Actions() {
+				if action.GetSubresource() != "eviction" {
+					continue
+				}
+				eviction := action.(testingclient.CreateAction).GetObject().(*policyv1.Eviction)
+				if len(eviction.DeleteOptions.DryRun) == 0 {
+					attempts = append(attempts, eviction.Name)
+				}
+			}
+			return attempts
+		}
+
+		It("should evict enough pods for the whole group", func() {
+			qc, fakek8sCli, _, group := setup("")
+
+			err, es := qc.execute(testNs)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(es).To(Equal(Forget))
+			Expect(evictionAttempts(fakek8sCli)).To(Equal([]string{"younger-pod", "older-pod"}))
+			Expect(qc.recentlyPreempted(&podGroup{pods: group.pods[1:]})).To(BeTrue())
+		})
+
+		It("should wait for the evicted victims when a later eviction fails", func() {
+			qc, fakek8sCli, recorder, group := setup("older-pod")
+
+			err, es := qc.execute(testNs)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(es).To(Equal(Forget))
+			Expect(evictionAttempts(fakek8sCli)).To(Equal([]string{"younger-pod", "older-pod"}))
+			Expect(qc.recentlyPreempted(group)).To(BeTrue())
+			var events []string
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			Expect(events).To(ContainElement(ContainSubstring("can't preempt pod older-pod")))
+			Expect(events).To(ContainElement(ContainSubstring("preempting pods test/younger-pod")))
+
+			// the victim already evicted is not evicted again, nor are more victims picked before its usage is freed
+			fakek8sCli.ClearActions()
+			err, _ = qc.execute(testNs)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(evictionAttempts(fakek8sCli)).To(BeEmpty())
+		})
+	})
+})
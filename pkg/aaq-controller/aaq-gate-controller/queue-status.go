@@ -0,0 +1,56 @@
+package arq_controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+)
+
+const (
+	// WaitingInQueueReason is reported for pods that were not evaluated because an older pod blocks the queue
+	WaitingInQueueReason = "WaitingInQueue"
+	// maxGatedPodsStatus is how many gated pods are listed in the status, so that a namespace with many gated pods
+	// doesn't grow the object past its size limit or rewrite a large object on every pass
+	maxGatedPodsStatus = 100
+)
+
+// blockingQuotas returns the quotas the usage doesn't fit in, along with the missing amount of each exceeded resource
+func (ctrl *AaqGateController) blockingQuotas(rqs []v1.ResourceQuota, usage v1.ResourceList) []v1alpha12.BlockingQuota {
+	var blocking []v1alpha12.BlockingQuota
+	for _, rq := range rqs {
+		requested, exceeded := exceededResources(rq, usage)
+		if len(exceeded) == 0 {
+			continue
+		}
+		shortfall := quota.Subtract(quota.Add(rq.Status.Used, requested), rq.Status.Hard)
+		blocking = append(blocking, v1alpha12.BlockingQuota{
+			Kind:      ctrl.quotaKind(rq),
+			Name:      rq.Name,
+			Shortfall: quota.Mask(shortfall, exceeded),
+		})
+	}
+	return blocking
+}
+
+// appendGatedPodsStatus adds the group pods to the end of the namespace admission queue
+func appendGatedPodsStatus(gatedPodsStatus []v1alpha12.GatedPodStatus, group *podGroup, reason string, blockingQuotas []v1alpha12.BlockingQuota) []v1alpha12.GatedPodStatus {
+	for _, gp := range group.pods {
+		gatedPodsStatus = append(gatedPodsStatus, v1alpha12.GatedPodStatus{
+			Name:           gp.pod.Name,
+			Position:       int32(len(gatedPodsStatus) + 1),
+			GatedTime:      gp.pod.CreationTimestamp,
+			Reason:         reason,
+			BlockingQuotas: blockingQuotas,
+		})
+	}
+	return gatedPodsStatus
+}
+
+// truncateGatedPodsStatus returns the head of the namespace admission queue listed in the status, along with the
+// number of gated pods
+func truncateGatedPodsStatus(gatedPodsStatus []v1alpha12.GatedPodStatus) ([]v1alpha12.GatedPodStatus, int32) {
+	if len(gatedPodsStatus) > maxGatedPodsStatus {
+		return gatedPodsStatus[:maxGatedPodsStatus], int32(len(gatedPodsStatus))
+	}
+	return gatedPodsStatus, int32(len(gatedPodsStatus))
+}
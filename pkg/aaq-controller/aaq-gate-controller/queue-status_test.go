@@ -0,0 +1,105 @@
+package arq_controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"kubevirt.io/application-aware-quota/pkg/client"
+	testsutils "kubevirt.io/application-aware-quota/pkg/tests-utils"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"kubevirt.io/application-aware-quota/tests/builders"
+	"time"
+)
+
+var _ = Describe("Test gated pods queue status", func() {
+	testNs := "test"
+
+	It("blockingQuotas should report the shortfall of each exceeded resource", func() {
+		qc := setupAAQGateController(nil, nil, nil, nil, testsutils.FakeNamespaceLister{}, record.NewFakeRecorder(100))
+		rqs := []corev1.ResourceQuota{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "testacrq", Namespace: testNs},
+				Status: corev1.ResourceQuotaStatus{
+					Hard: corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("1Gi"), corev1.ResourceRequestsCPU: resource.MustParse("4")},
+					Used: corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("512Mi"), corev1.ResourceRequestsCPU: resource.MustParse("1")},
+				},
+			},
+		}
+		usage := corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("1Gi"), corev1.ResourceRequestsCPU: resource.MustParse("1")}
+		blocking := qc.blockingQuotas(rqs, usage)
+		Expect(blocking).To(HaveLen(1))
+		Expect(blocking[0].Name).To(Equal("testacrq"))
+		Expect(blocking[0].Kind).To(Equal("ApplicationAwareClusterResourceQuota"))
+		Expect(quota.Equals(blocking[0].Shortfall, corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("512Mi")})).To(BeTrue())
+
+		Expect(qc.blockingQuotas(rqs, corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("1")})).To(BeEmpty())
+	})
+
+	It("truncateGatedPodsStatus should only list the head of the queue and count all the gated pods", func() {
+		var gatedPodsStatus []v1alpha1.GatedPodStatus
+		for i := 0; i < maxGatedPodsStatus+10; i++ {
+			gatedPodsStatus = append(gatedPodsStatus, v1alpha1.GatedPodStatus{Name: fmt.Sprintf("pod-%v", i), Position: int32(i + 1)})
+		}
+		listed, total := truncateGatedPodsStatus(gatedPodsStatus)
+		Expect(listed).To(HaveLen(maxGatedPodsStatus))
+		Expect(listed[maxGatedPodsStatus-1].Position).To(Equal(int32(maxGatedPodsStatus)))
+		Expect(total).To(Equal(int32(maxGatedPodsStatus + 10)))
+
+		listed, total = truncateGatedPodsStatus(gatedPodsStatus[:2])
+		Expect(listed).To(HaveLen(2))
+		Expect(total).To(Equal(int32(2)))
+	})
+
+	It("execute should only update the queue status when it changes", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		cli := client.NewMockAAQClient(ctrl)
+		gatedTime := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Namespace: testNs, CreationTimestamp: gatedTime},
+			Spec: corev1.PodSpec{
+				SchedulingGates: []corev1.PodSchedulingGate{{Name: util.AAQGate}},
+				Containers:      []corev1.Container{{Name: "ctr", Image: "image", Resources: testsutils.GetResourceRequirements(testsutils.GetResourceList("", "2Gi"), testsutils.GetResourceList("", ""))}},
+			},
+		}
+		podInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{pod})
+		arqInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{
+			builders.NewArqBuilder().WithNamespace(testNs).WithName("testarq").WithResource(corev1.ResourceRequestsMemory, resource.MustParse("1Gi")).WithSyncStatusHardEmptyStatusUsed().Build(),
+		})
+		aaqjqcInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: AaqjqcName, Namespace: testNs}}})
+		namespaceLister := testsutils.FakeNamespaceLister{Namespaces: map[string]*corev1.Namespace{testNs: {ObjectMeta: metav1.ObjectMeta{Name: testNs}}}}
+		cli.EXPECT().CoreV1().AnyTimes().Return(k8sfake.NewSimpleClientset(pod).CoreV1())
+		aaqjqcInterfaceMock := client.NewMockAAQJobQueueConfigInterface(ctrl)
+		aaqjqcInterfaceMock.EXPECT().UpdateStatus(context.Background(), gomock.Any(), metav1.UpdateOptions{}).Times(1).DoAndReturn(
+			func(_ context.Context, aaqjqc *v1alpha1.AAQJobQueueConfig, _ metav1.UpdateOptions) (*v1alpha1.AAQJobQueueConfig, error) {
+				Expect(aaqjqc.Status.GatedPods).To(HaveLen(1))
+				Expect(aaqjqc.Status.TotalGatedPods).To(Equal(int32(1)))
+				gatedPodStatus := aaqjqc.Status.GatedPods[0]
+				Expect(gatedPodStatus.Name).To(Equal("pod-test"))
+				Expect(gatedPodStatus.Position).To(Equal(int32(1)))
+				Expect(gatedPodStatus.GatedTime).To(Equal(gatedTime))
+				Expect(gatedPodStatus.Reason).To(Equal(ExceedsQuotaReason))
+				Expect(gatedPodStatus.BlockingQuotas).To(HaveLen(1))
+				Expect(gatedPodStatus.BlockingQuotas[0].Name).To(Equal("testarq"))
+				Expect(gatedPodStatus.BlockingQuotas[0].Kind).To(Equal("ApplicationAwareResourceQuota"))
+				Expect(quota.Equals(gatedPodStatus.BlockingQuotas[0].Shortfall, corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("1Gi")})).To(BeTrue())
+				Expect(aaqjqcInformer.GetIndexer().Update(aaqjqc)).To(Succeed())
+				return aaqjqc, nil
+			})
+		cli.EXPECT().AAQJobQueueConfigs(testNs).Return(aaqjqcInterfaceMock).Times(1)
+		qc := setupAAQGateController(cli, podInformer, arqInformer, aaqjqcInformer, namespaceLister, record.NewFakeRecorder(100))
+
+		err, _ := qc.execute(testNs)
+		Expect(err).ToNot(HaveOccurred())
+		err, _ = qc.execute(testNs)
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
@@ -0,0 +1,98 @@
+package arq_controller
+
+import (
+	"go.opentelemetry.io/otel/trace"
+	v1 "k8s.io/api/core/v1"
+	aaq_evaluator "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-evaluator"
+	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"sort"
+	"time"
+)
+
+// gatedPod is a pod waiting for quota together with what it will consume once released
+type gatedPod struct {
+	pod   *v1.Pod
+	usage v1.ResourceList
+	// strict pods block every pod queued after them until they are released
+	strict bool
+	// span traces the evaluation pass of the pod, it is nil if the pass is not traced
+	span trace.Span
+	// calculators holds the usage each calculator computed for the pod
+	calculators []aaq_evaluator.CalculatorUsage
+	// calculatorErr is set when a calculator with the FailClosed policy failed to evaluate the pod
+	calculatorErr *aaq_evaluator.CalculatorFailedError
+}
+
+// orderGatedPods sorts gated pods in the order they should be evaluated according to the queueing policy.
+func orderGatedPods(pods []gatedPod, rqs []v1.ResourceQuota, queueingConfig v1alpha12.QueueingConfiguration, agingPeriod time.Duration, now time.Time) []gatedPod {
+	switch queueingConfig.Policy {
+	case v1alpha12.PriorityClass:
+		sort.SliceStable(pods, func(i, j int) bool {
+			pi, pj := podPriority(pods[i].pod), podPriority(pods[j].pod)
+			if pi != pj {
+				return pi > pj
+			}
+			return olderThan(pods[i].pod, pods[j].pod)
+		})
+	case v1alpha12.FIFO:
+		sort.SliceStable(pods, func(i, j int) bool {
+			return olderThan(pods[i].pod, pods[j].pod)
+		})
+		for i := range pods {
+			pods[i].strict = true
+		}
+	case v1alpha12.BestFitWithAging:
+		for i := range pods {
+			pods[i].strict = now.Sub(pods[i].pod.CreationTimestamp.Time) >= agingPeriod
+		}
+		sort.SliceStable(pods, func(i, j int) bool {
+			if pods[i].strict != pods[j].strict {
+				return pods[i].strict
+			}
+			if pods[i].strict {
+				return olderThan(pods[i].pod, pods[j].pod)
+			}
+			si, sj := dominantShare(pods[i].usage, rqs), dominantShare(pods[j].usage, rqs)
+			if si != sj {
+				return si > sj
+			}
+			return olderThan(pods[i].pod, pods[j].pod)
+		})
+	default:
+		sort.SliceStable(pods, func(i, j int) bool {
+			return olderThan(pods[i].pod, pods[j].pod)
+		})
+	}
+	return pods
+}
+
+func olderThan(a, b *v1.Pod) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	return a.Name < b.Name
+}
+
+func podPriority(pod *v1.Pod) int32 {
+	if pod.Spec.Priority != nil {
+		return *pod.Spec.Priority
+	}
+	return 0
+}
+
+// dominantShare returns the largest fraction of any quota hard limit the given usage would consume
+func dominantShare(usage v1.ResourceList, rqs []v1.ResourceQuota) float64 {
+	share := 0.0
+	for _, rq := range rqs {
+		for resourceName, hard := range rq.Status.Hard {
+			used, ok := usage[resourceName]
+			if !ok || hard.IsZero() {
+				continue
+			}
+			if s := used.AsApproximateFloat64() / hard.AsApproximateFloat64(); s > share {
+				share = s
+			}
+		}
+	}
+	return share
+}
@@ -0,0 +1,95 @@
+package arq_controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testsutils "kubevirt.io/application-aware-quota/pkg/tests-utils"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"time"
+)
+
+var _ = Describe("Test gated pods queueing policy", func() {
+	now := time.Now()
+	newGatedPod := func(name string, age time.Duration, priority int32, memory string) gatedPod {
+		return gatedPod{
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(now.Add(-age))},
+				Spec:       corev1.PodSpec{Priority: &priority},
+			},
+			usage: corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse(memory)},
+		}
+	}
+	rqs := []corev1.ResourceQuota{
+		{Status: corev1.ResourceQuotaStatus{Hard: corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("4Gi")}}},
+	}
+	podNames := func(pods []gatedPod) []string {
+		var names []string
+		for _, p := range pods {
+			names = append(names, p.pod.Name)
+		}
+		return names
+	}
+
+	It("should order by creation time when no policy is set", func() {
+		pods := []gatedPod{
+			newGatedPod("young", time.Minute, 0, "1Gi"),
+			newGatedPod("old", time.Hour, 0, "1Gi"),
+		}
+		ordered := orderGatedPods(pods, rqs, v1alpha1.QueueingConfiguration{}, time.Minute, now)
+		Expect(podNames(ordered)).To(Equal([]string{"old", "young"}))
+		Expect(ordered[0].strict).To(BeFalse())
+	})
+
+	It("should order by priority and then by creation time with PriorityClass policy", func() {
+		pods := []gatedPod{
+			newGatedPod("low-old", time.Hour, 10, "1Gi"),
+			newGatedPod("high-young", time.Minute, 1000, "1Gi"),
+			newGatedPod("high-old", time.Hour, 1000, "1Gi"),
+		}
+		ordered := orderGatedPods(pods, rqs, v1alpha1.QueueingConfiguration{Policy: v1alpha1.PriorityClass}, time.Minute, now)
+		Expect(podNames(ordered)).To(Equal([]string{"high-old", "high-young", "low-old"}))
+		for _, p := range ordered {
+			Expect(p.strict).To(BeFalse())
+		}
+	})
+
+	It("should order by creation time and block younger pods with FIFO policy", func() {
+		pods := []gatedPod{
+			newGatedPod("young", time.Minute, 0, "1Gi"),
+			newGatedPod("old", time.Hour, 0, "3Gi"),
+		}
+		ordered := orderGatedPods(pods, rqs, v1alpha1.QueueingConfiguration{Policy: v1alpha1.FIFO}, time.Minute, now)
+		Expect(podNames(ordered)).To(Equal([]string{"old", "young"}))
+		for _, p := range ordered {
+			Expect(p.strict).To(BeTrue())
+		}
+	})
+
+	It("should evaluate aged pods first and the rest by size with BestFitWithAging policy", func() {
+		pods := []gatedPod{
+			newGatedPod("small", time.Minute, 0, "1Gi"),
+			newGatedPod("large", 2*time.Minute, 0, "3Gi"),
+			newGatedPod("aged-small", time.Hour, 0, "512Mi"),
+			newGatedPod("older-aged-small", 2*time.Hour, 0, "512Mi"),
+		}
+		ordered := orderGatedPods(pods, rqs, v1alpha1.QueueingConfiguration{Policy: v1alpha1.BestFitWithAging}, 10*time.Minute, now)
+		Expect(podNames(ordered)).To(Equal([]string{"older-aged-small", "aged-small", "large", "small"}))
+		Expect(ordered[0].strict).To(BeTrue())
+		Expect(ordered[1].strict).To(BeTrue())
+		Expect(ordered[2].strict).To(BeFalse())
+		Expect(ordered[3].strict).To(BeFalse())
+	})
+
+	It("dominantShare should return the largest fraction of any hard limit", func() {
+		usage := testsutils.GetResourceList("1", "1Gi")
+		quotas := []corev1.ResourceQuota{
+			{Status: corev1.ResourceQuotaStatus{Hard: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4")}}},
+			{Status: corev1.ResourceQuotaStatus{Hard: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("2Gi")}}},
+		}
+		Expect(dominantShare(usage, quotas)).To(Equal(0.5))
+		Expect(dominantShare(usage, nil)).To(Equal(0.0))
+	})
+})
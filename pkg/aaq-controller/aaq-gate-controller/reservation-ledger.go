@@ -0,0 +1,270 @@
+package arq_controller
+
+import (
+	"errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	"k8s.io/client-go/tools/cache"
+	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"sync"
+)
+
+// maxPendingObservations bounds the usages a quota can be written with before the informer catches up with them
+const maxPendingObservations = 16
+
+// errQuotaNotSynced is returned while the usage of a quota wasn't calculated since the controller started
+var errQuotaNotSynced = errors.New("quota usage wasn't calculated since the controller started")
+
+// QuotaKey identifies the usage of a quota in a namespace, cluster quotas track the usage of each of their namespaces apart
+type QuotaKey struct {
+	// Cluster is set for ApplicationAwareClusterResourceQuotas
+	Cluster   bool
+	Name      string
+	Namespace string
+}
+
+// ArqKey returns the key of an ApplicationAwareResourceQuota
+func ArqKey(arq *v1alpha12.ApplicationAwareResourceQuota) QuotaKey {
+	return QuotaKey{Name: arq.Name, Namespace: arq.Namespace}
+}
+
+// AcrqKey returns the key of the usage of an ApplicationAwareClusterResourceQuota in one of its namespaces
+func AcrqKey(acrq *v1alpha12.ApplicationAwareClusterResourceQuota, namespace string) QuotaKey {
+	return QuotaKey{Cluster: true, Name: acrq.Name, Namespace: namespace}
+}
+
+// ReservationLedger holds the usage of the pods the gate controller released until the usage of the quotas, as the
+// informers show it, includes them. Pods are admitted against the quotas usage along with the usage reserved for the
+// released pods it doesn't include yet, so that a release doesn't have to wait for the quotas to be updated.
+//
+// The ledger lives in memory only: after a restart the gate controller waits for every quota to be calculated once
+// before admitting pods against it, which covers the pods released by the previous leader.
+type ReservationLedger struct {
+	lock       sync.Mutex
+	podIndexer cache.Indexer
+	// sequence numbers the reservations in the order they are made
+	sequence     uint64
+	reservations map[string]map[types.UID]*reservation
+	observations map[QuotaKey]*quotaObservation
+}
+
+type reservation struct {
+	sequence uint64
+	podName  string
+	usage    v1.ResourceList
+}
+
+type quotaObservation struct {
+	// observed is the sequence of the last reservation the usage of the quota includes
+	observed uint64
+	// synced is set once the informer shows a usage calculated by this controller
+	synced bool
+	// pending are the usages the quota was written with, by resource version, until the informer shows them
+	pending map[string]pendingObservation
+}
+
+type pendingObservation struct {
+	sequence uint64
+	// calculated is unset for the usages carried over from a previous version
+	calculated bool
+}
+
+func NewReservationLedger(podInformer cache.SharedIndexInformer) *ReservationLedger {
+	return &ReservationLedger{
+		podIndexer:   podInformer.GetIndexer(),
+		reservations: make(map[string]map[types.UID]*reservation),
+		observations: make(map[QuotaKey]*quotaObservation),
+	}
+}
+
+// Reserve holds the usage of the pod, which is about to be released
+func (rl *ReservationLedger) Reserve(pod *v1.Pod, usage v1.ResourceList) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	rl.sequence++
+	if rl.reservations[pod.Namespace] == nil {
+		rl.reservations[pod.Namespace] = make(map[types.UID]*reservation)
+	}
+	rl.reservations[pod.Namespace][pod.UID] = &reservation{
+		sequence: rl.sequence,
+		podName:  pod.Name,
+		usage:    quota.Add(v1.ResourceList{}, usage),
+	}
+}
+
+// Cancel drops the reservation of a pod that failed to be released
+func (rl *ReservationLedger) Cancel(pod *v1.Pod) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	delete(rl.reservations[pod.Namespace], pod.UID)
+	if len(rl.reservations[pod.Namespace]) == 0 {
+		delete(rl.reservations, pod.Namespace)
+	}
+}
+
+// VisibleReservations returns the sequence up to which the pods released in the namespace are seen without their gate
+// by the pod informer, along with the names of these pods. A usage calculated from the pod informer afterwards
+// includes all of them, the controllers calculating it report it with Observed
+func (rl *ReservationLedger) VisibleReservations(namespace string) (uint64, []string) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	visibleSequence := rl.sequence
+	var pods []string
+	for uid, r := range rl.reservations[namespace] {
+		if !rl.visible(namespace, uid, r) {
+			if r.sequence <= visibleSequence {
+				visibleSequence = r.sequence - 1
+			}
+			continue
+		}
+		pods = append(pods, r.podName)
+	}
+	return visibleSequence, pods
+}
+
+// Observed records that the usage of the quota at resourceVersion includes the reservations up to sequence,
+// it applies once the informer shows this resource version
+func (rl *ReservationLedger) Observed(key QuotaKey, resourceVersion string, sequence uint64) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	rl.observation(key).add(resourceVersion, pendingObservation{sequence: sequence, calculated: true})
+}
+
+// Carried records that the quota at resourceVersion keeps the usage it was last written with, which happens
+// when a cluster quota is written for some of its namespaces only. Otherwise the informer may skip the version
+// the usage of the other namespaces was observed at
+func (rl *ReservationLedger) Carried(key QuotaKey, resourceVersion string) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	observation := rl.observation(key)
+	carried := pendingObservation{sequence: observation.observed, calculated: observation.synced}
+	for _, pending := range observation.pending {
+		if pending.sequence > carried.sequence {
+			carried.sequence = pending.sequence
+		}
+		carried.calculated = carried.calculated || pending.calculated
+	}
+	observation.add(resourceVersion, carried)
+}
+
+// Reserved returns the usage reserved for the pods released in the namespace that the quota at resourceVersion
+// doesn't include yet. It returns false if the usage of the quota wasn't calculated since the controller started,
+// pods must not be admitted against it meanwhile
+func (rl *ReservationLedger) Reserved(key QuotaKey, resourceVersion string) (v1.ResourceList, bool) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	observation := rl.observation(key)
+	if pending, exists := observation.pending[resourceVersion]; exists {
+		observation.synced = observation.synced || pending.calculated
+		if pending.sequence > observation.observed {
+			observation.observed = pending.sequence
+		}
+		delete(observation.pending, resourceVersion)
+		for rv, p := range observation.pending {
+			// the older versions can't raise the observation anymore, unless they would sync it
+			if p.sequence <= observation.observed && (observation.synced || !p.calculated) {
+				delete(observation.pending, rv)
+			}
+		}
+	}
+	if !observation.synced {
+		return nil, false
+	}
+	reserved := v1.ResourceList{}
+	for _, r := range rl.reservations[key.Namespace] {
+		if r.sequence > observation.observed {
+			reserved = quota.Add(reserved, r.usage)
+		}
+	}
+	return reserved, true
+}
+
+// Prune drops the reservations of the namespace that the usage of all its quotas includes, along with
+// the observations of the quotas that are gone
+func (rl *ReservationLedger) Prune(namespace string, keys []QuotaKey) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	current := make(map[QuotaKey]bool, len(keys))
+	for _, key := range keys {
+		current[key] = true
+	}
+	for key := range rl.observations {
+		if key.Namespace == namespace && !current[key] {
+			delete(rl.observations, key)
+		}
+	}
+	for uid, r := range rl.reservations[namespace] {
+		if !rl.visible(namespace, uid, r) {
+			continue
+		}
+		included := true
+		for _, key := range keys {
+			observation, exists := rl.observations[key]
+			if !exists || !observation.synced || observation.observed < r.sequence {
+				included = false
+				break
+			}
+		}
+		if included {
+			delete(rl.reservations[namespace], uid)
+		}
+	}
+	if len(rl.reservations[namespace]) == 0 {
+		delete(rl.reservations, namespace)
+	}
+}
+
+// ForgetNamespace drops the reservations and observations of a deleted namespace
+func (rl *ReservationLedger) ForgetNamespace(namespace string) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	delete(rl.reservations, namespace)
+	for key := range rl.observations {
+		if key.Namespace == namespace {
+			delete(rl.observations, key)
+		}
+	}
+}
+
+// observation must be called with the lock held
+func (rl *ReservationLedger) observation(key QuotaKey) *quotaObservation {
+	observation, exists := rl.observations[key]
+	if !exists {
+		observation = &quotaObservation{pending: make(map[string]pendingObservation)}
+		rl.observations[key] = observation
+	}
+	return observation
+}
+
+func (qo *quotaObservation) add(resourceVersion string, observation pendingObservation) {
+	if len(qo.pending) >= maxPendingObservations {
+		// the informer moved past the oldest ones, a later observation replaces them
+		var oldest string
+		for rv, pending := range qo.pending {
+			if oldest == "" || pending.sequence < qo.pending[oldest].sequence {
+				oldest = rv
+			}
+		}
+		delete(qo.pending, oldest)
+	}
+	if pending, exists := qo.pending[resourceVersion]; exists {
+		observation.sequence = max(observation.sequence, pending.sequence)
+		observation.calculated = observation.calculated || pending.calculated
+	}
+	qo.pending[resourceVersion] = observation
+}
+
+// visible returns true if the pod informer shows the pod of the reservation without its gate, or that it is gone.
+// It must be called with the lock held
+func (rl *ReservationLedger) visible(namespace string, uid types.UID, r *reservation) bool {
+	obj, exists, err := rl.podIndexer.GetByKey(namespace + "/" + r.podName)
+	if err != nil {
+		return false
+	}
+	if !exists {
+		return true
+	}
+	pod := obj.(*v1.Pod)
+	return pod.UID != uid || len(pod.Spec.SchedulingGates) == 0
+}
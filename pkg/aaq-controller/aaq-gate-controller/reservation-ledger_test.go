@@ -0,0 +1,148 @@
+package arq_controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	"k8s.io/client-go/tools/cache"
+	testsutils "kubevirt.io/application-aware-quota/pkg/tests-utils"
+	"kubevirt.io/application-aware-quota/pkg/util"
+)
+
+var _ = Describe("Reservation ledger", func() {
+	testNs := "test"
+	arqKey := QuotaKey{Name: "arq", Namespace: testNs}
+	var podIndexer cache.Indexer
+	var ledger *ReservationLedger
+
+	newPod := func(name string, gated bool) *corev1.Pod {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNs, UID: types.UID(name + "-uid")}}
+		if gated {
+			pod.Spec.SchedulingGates = []corev1.PodSchedulingGate{{Name: util.AAQGate}}
+		}
+		return pod
+	}
+
+	usage := func(memory string) corev1.ResourceList {
+		return corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse(memory)}
+	}
+
+	expectReserved := func(key QuotaKey, resourceVersion string, memory string) {
+		reserved, synced := ledger.Reserved(key, resourceVersion)
+		ExpectWithOffset(1, synced).To(BeTrue())
+		ExpectWithOffset(1, quota.Equals(quota.RemoveZeros(reserved), quota.RemoveZeros(usage(memory)))).To(BeTrue(), "reserved is %v", reserved)
+	}
+
+	// release removes the gate of the pod, as the pod informer shows it once the update is observed
+	release := func(pod *corev1.Pod) {
+		released := pod.DeepCopy()
+		released.Spec.SchedulingGates = nil
+		ExpectWithOffset(1, podIndexer.Update(released)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		podInformer := testsutils.NewFakeSharedIndexInformer(nil)
+		podIndexer = podInformer.GetIndexer()
+		ledger = NewReservationLedger(podInformer)
+	})
+
+	It("should not report the quotas whose usage wasn't calculated since it started", func() {
+		_, synced := ledger.Reserved(arqKey, "1")
+		Expect(synced).To(BeFalse())
+
+		ledger.Observed(arqKey, "2", 0)
+		_, synced = ledger.Reserved(arqKey, "1")
+		Expect(synced).To(BeFalse())
+		expectReserved(arqKey, "2", "0")
+		// a later version stays synced
+		expectReserved(arqKey, "3", "0")
+	})
+
+	It("should hold the usage of the released pods until the quota usage includes them", func() {
+		ledger.Observed(arqKey, "1", 0)
+		expectReserved(arqKey, "1", "0")
+
+		first, second := newPod("first", true), newPod("second", true)
+		Expect(podIndexer.Add(first)).To(Succeed())
+		Expect(podIndexer.Add(second)).To(Succeed())
+		ledger.Reserve(first, usage("1Gi"))
+		ledger.Reserve(second, usage("2Gi"))
+		expectReserved(arqKey, "1", "3Gi")
+
+		// only the pods the informer shows released can be included in the usage calculated from it
+		release(first)
+		sequence, visible := ledger.VisibleReservations(testNs)
+		Expect(visible).To(ConsistOf("first"))
+		ledger.Observed(arqKey, "2", sequence)
+		expectReserved(arqKey, "1", "3Gi")
+		expectReserved(arqKey, "2", "2Gi")
+
+		release(second)
+		sequence, visible = ledger.VisibleReservations(testNs)
+		Expect(visible).To(ConsistOf("first", "second"))
+		ledger.Observed(arqKey, "3", sequence)
+		expectReserved(arqKey, "3", "0")
+	})
+
+	It("should drop the reservations once all the quotas of the namespace include them", func() {
+		otherKey := QuotaKey{Cluster: true, Name: "acrq", Namespace: testNs}
+		ledger.Observed(arqKey, "1", 0)
+		ledger.Observed(otherKey, "1", 0)
+		pod := newPod("pod", true)
+		Expect(podIndexer.Add(pod)).To(Succeed())
+		ledger.Reserve(pod, usage("1Gi"))
+		release(pod)
+		sequence, _ := ledger.VisibleReservations(testNs)
+
+		ledger.Observed(arqKey, "2", sequence)
+		expectReserved(arqKey, "2", "0")
+		expectReserved(otherKey, "1", "1Gi")
+		ledger.Prune(testNs, []QuotaKey{arqKey, otherKey})
+		_, visible := ledger.VisibleReservations(testNs)
+		Expect(visible).To(ConsistOf("pod"))
+
+		// the observations of the quotas that are gone don't hold the reservations anymore
+		ledger.Prune(testNs, []QuotaKey{arqKey})
+		_, visible = ledger.VisibleReservations(testNs)
+		Expect(visible).To(BeEmpty())
+		_, synced := ledger.Reserved(otherKey, "1")
+		Expect(synced).To(BeFalse())
+	})
+
+	It("should keep the observation of a namespace across the versions a cluster quota is written with for other namespaces", func() {
+		acrqKey := QuotaKey{Cluster: true, Name: "acrq", Namespace: testNs}
+		pod := newPod("pod", false)
+		Expect(podIndexer.Add(pod)).To(Succeed())
+		ledger.Reserve(pod, usage("1Gi"))
+		sequence, _ := ledger.VisibleReservations(testNs)
+		ledger.Observed(acrqKey, "2", sequence)
+		// the informer skips version 2
+		ledger.Carried(acrqKey, "3")
+		expectReserved(acrqKey, "3", "0")
+
+		// versions carried before the usage is calculated don't sync the quota
+		ledger.Carried(QuotaKey{Cluster: true, Name: "acrq", Namespace: "other"}, "3")
+		_, synced := ledger.Reserved(QuotaKey{Cluster: true, Name: "acrq", Namespace: "other"}, "3")
+		Expect(synced).To(BeFalse())
+	})
+
+	It("should drop the reservations that are cancelled or whose namespace is gone", func() {
+		ledger.Observed(arqKey, "1", 0)
+		pod := newPod("pod", true)
+		ledger.Reserve(pod, usage("1Gi"))
+		expectReserved(arqKey, "1", "1Gi")
+		ledger.Cancel(pod)
+		expectReserved(arqKey, "1", "0")
+
+		ledger.Reserve(pod, usage("1Gi"))
+		ledger.ForgetNamespace(testNs)
+		_, synced := ledger.Reserved(arqKey, "1")
+		Expect(synced).To(BeFalse())
+		ledger.Observed(arqKey, "2", 0)
+		expectReserved(arqKey, "2", "0")
+	})
+})
@@ -0,0 +1,46 @@
+package arq_controller
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	v1 "k8s.io/api/core/v1"
+	"kubevirt.io/application-aware-quota/pkg/tracing"
+	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+)
+
+// ReleasedOutcome is the outcome recorded on the evaluation span of a pod that fits in the quotas
+const ReleasedOutcome = "Released"
+
+// startEvaluationSpan starts the span of the pod evaluation pass, continuing the trace started when the pod was gated
+func startEvaluationSpan(pod *v1.Pod) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(tracing.PodContext(context.Background(), pod), "aaq.gate.evaluate", podSpanAttributes(pod))
+}
+
+func podSpanAttributes(pod *v1.Pod) trace.SpanStartEventOption {
+	return trace.WithAttributes(
+		attribute.String("k8s.namespace.name", pod.Namespace),
+		attribute.String("k8s.pod.name", pod.Name),
+	)
+}
+
+// endEvaluationSpans ends the evaluation spans of the pass, recording whether each pod was released
+// or the reason it stays gated
+func endEvaluationSpans(gatedPods []gatedPod, released []gatedPod, gatedPodsStatus []v1alpha12.GatedPodStatus) {
+	outcomes := map[string]string{}
+	for _, gp := range released {
+		outcomes[gp.pod.Name] = ReleasedOutcome
+	}
+	for _, gatedPodStatus := range gatedPodsStatus {
+		outcomes[gatedPodStatus.Name] = gatedPodStatus.Reason
+	}
+	for _, gp := range gatedPods {
+		if gp.span == nil {
+			continue
+		}
+		if outcome, ok := outcomes[gp.pod.Name]; ok {
+			gp.span.SetAttributes(attribute.String("aaq.gate.outcome", outcome))
+		}
+		gp.span.End()
+	}
+}
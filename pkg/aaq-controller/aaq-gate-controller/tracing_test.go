@@ -0,0 +1,112 @@
+package arq_controller
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"kubevirt.io/application-aware-quota/pkg/client"
+	testsutils "kubevirt.io/application-aware-quota/pkg/tests-utils"
+	"kubevirt.io/application-aware-quota/pkg/tracing"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("Test gate controller tracing", func() {
+	testNs := "test"
+	var spanRecorder *tracetest.SpanRecorder
+
+	BeforeEach(func() {
+		spanRecorder = tracetest.NewSpanRecorder()
+		previousProvider := otel.GetTracerProvider()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+		DeferCleanup(otel.SetTracerProvider, previousProvider)
+	})
+
+	// newTracedPod returns a gated pod carrying the trace of its admission
+	newTracedPod := func(name string) (*corev1.Pod, sdktrace.ReadOnlySpan) {
+		ctx, admission := tracing.Tracer().Start(context.Background(), "aaq.admission.gate")
+		admission.End()
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNs},
+			Spec:       corev1.PodSpec{SchedulingGates: []corev1.PodSchedulingGate{{Name: util.AAQGate}}},
+		}
+		tracing.SetPodTraceParent(ctx, pod)
+		return pod, admission.(sdktrace.ReadOnlySpan)
+	}
+
+	endedSpan := func(name string) sdktrace.ReadOnlySpan {
+		for _, span := range spanRecorder.Ended() {
+			if span.Name() == name {
+				return span
+			}
+		}
+		return nil
+	}
+
+	It("evaluation spans should continue the admission trace and record the outcome of the pass", func() {
+		released, releasedAdmission := newTracedPod("released")
+		waiting, waitingAdmission := newTracedPod("waiting")
+		podInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{released, waiting})
+		qc := setupAAQGateController(nil, podInformer, nil, nil, testsutils.FakeNamespaceLister{}, record.NewFakeRecorder(10))
+
+		gatedPods, _, err := qc.getGatedPods(testNs)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gatedPods).To(HaveLen(2))
+		var releasedPods []gatedPod
+		for _, gp := range gatedPods {
+			if gp.pod.Name == "released" {
+				releasedPods = append(releasedPods, gp)
+			}
+		}
+		endEvaluationSpans(gatedPods, releasedPods, []v1alpha1.GatedPodStatus{{Name: "waiting", Reason: ExceedsQuotaReason}})
+
+		outcomes := map[string]attribute.KeyValue{}
+		for _, span := range spanRecorder.Ended() {
+			if span.Name() != "aaq.gate.evaluate" {
+				continue
+			}
+			for _, attr := range span.Attributes() {
+				if attr.Key == "k8s.pod.name" {
+					podName := attr.Value.AsString()
+					if podName == "released" {
+						Expect(span.Parent().SpanID()).To(Equal(releasedAdmission.SpanContext().SpanID()))
+					} else {
+						Expect(span.Parent().SpanID()).To(Equal(waitingAdmission.SpanContext().SpanID()))
+					}
+					for _, outcome := range span.Attributes() {
+						if outcome.Key == "aaq.gate.outcome" {
+							outcomes[podName] = outcome
+						}
+					}
+				}
+			}
+		}
+		Expect(outcomes).To(HaveKeyWithValue("released", attribute.String("aaq.gate.outcome", ReleasedOutcome)))
+		Expect(outcomes).To(HaveKeyWithValue("waiting", attribute.String("aaq.gate.outcome", ExceedsQuotaReason)))
+	})
+
+	It("releasePods should trace the release of the pod in its admission trace", func() {
+		pod, admission := newTracedPod("released")
+		ctrl := gomock.NewController(GinkgoT())
+		cli := client.NewMockAAQClient(ctrl)
+		fakek8sCli := k8sfake.NewSimpleClientset(pod)
+		cli.EXPECT().CoreV1().AnyTimes().Return(fakek8sCli.CoreV1())
+		podInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{pod})
+		qc := setupAAQGateController(cli, podInformer, nil, nil, testsutils.FakeNamespaceLister{}, record.NewFakeRecorder(10))
+
+		Expect(qc.releasePods([]gatedPod{{pod: pod}}, nil)).To(Succeed())
+		release := endedSpan("aaq.gate.release")
+		Expect(release).ToNot(BeNil())
+		Expect(release.SpanContext().TraceID()).To(Equal(admission.SpanContext().TraceID()))
+		Expect(release.Parent().SpanID()).To(Equal(admission.SpanContext().SpanID()))
+	})
+})
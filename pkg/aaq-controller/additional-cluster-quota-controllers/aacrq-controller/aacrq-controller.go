@@ -11,6 +11,7 @@ import (
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 	_ "kubevirt.io/api/core/v1"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/sharding"
 	"kubevirt.io/application-aware-quota/pkg/client"
 	"kubevirt.io/application-aware-quota/pkg/log"
 	"kubevirt.io/application-aware-quota/pkg/util"
@@ -31,12 +32,14 @@ type AacrqController struct {
 	aacrqInformer cache.SharedIndexInformer
 	aacrqQueue    workqueue.RateLimitingInterface
 	aaqCli        client.AAQClient
+	shards        *sharding.Sharder
 	stop          <-chan struct{}
 }
 
 func NewAacrqController(aaqCli client.AAQClient,
 	aacrqInformer cache.SharedIndexInformer,
 	acrqInformer cache.SharedIndexInformer,
+	shards *sharding.Sharder,
 	stop <-chan struct{},
 ) *AacrqController {
 	ctrl := AacrqController{
@@ -44,6 +47,7 @@ func NewAacrqController(aaqCli client.AAQClient,
 		aaqCli:        aaqCli,
 		acrqInformer:  acrqInformer,
 		aacrqQueue:    workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "aacrq-queue-for-aacrq-contorller"),
+		shards:        shards,
 		stop:          stop,
 	}
 
@@ -183,6 +187,9 @@ func (ctrl *AacrqController) Execute() bool {
 
 func (ctrl *AacrqController) execute(key string) (error, enqueueState) {
 	aacrqNamespace, aacrqName, err := cache.SplitMetaNamespaceKey(key)
+	if !ctrl.shards.OwnsClusterQuota(aacrqName) {
+		return nil, Forget
+	}
 	acrqObj, exists, err := ctrl.acrqInformer.GetIndexer().GetByKey(aacrqName)
 	if err != nil {
 		return err, Immediate
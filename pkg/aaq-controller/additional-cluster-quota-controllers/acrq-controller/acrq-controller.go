@@ -19,15 +19,14 @@ import (
 	"k8s.io/apiserver/pkg/quota/v1/generic"
 	v12 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/clock"
 	aaq_evaluator "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-evaluator"
 	arq_controller "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-gate-controller"
 	"kubevirt.io/application-aware-quota/pkg/aaq-controller/additional-cluster-quota-controllers/clusterquotamapping"
 	crq_controller "kubevirt.io/application-aware-quota/pkg/aaq-controller/additional-cluster-quota-controllers/crq-controller"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/sharding"
 	"kubevirt.io/application-aware-quota/pkg/client"
-	"kubevirt.io/application-aware-quota/pkg/log"
 	"kubevirt.io/application-aware-quota/pkg/util"
 
 	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
@@ -36,18 +35,9 @@ import (
 	"time"
 )
 
-type enqueueState string
-
-const (
-	Immediate enqueueState = "Immediate"
-	Forget    enqueueState = "Forget"
-	BackOff   enqueueState = "BackOff"
-)
-
 type AcrqController struct {
-	podInformer    cache.SharedIndexInformer
-	aaqjqcInformer cache.SharedIndexInformer
-	aaqCli         client.AAQClient
+	podInformer cache.SharedIndexInformer
+	aaqCli      client.AAQClient
 
 	AcrqInformer    cache.SharedIndexInformer
 	crqInformer     cache.SharedIndexInformer
@@ -59,17 +49,23 @@ type AcrqController struct {
 	// queue tracks which clusterquotas to update along with a list of namespaces for that clusterquota
 	queue util.BucketingWorkQueue
 
-	// nsQueue tracks changes in Aaqjqcs
-	nsQueue workqueue.RateLimitingInterface
-
 	// knows how to calculate usage
 	registry utilquota.Registry
+	// holds the usage of the pods the gate controller released until the quotas include it
+	reservations *arq_controller.ReservationLedger
+	// only the quotas in the shards of the replica are synced
+	shards *sharding.Sharder
 	// controls the workers that process quotas
 	// this lock is acquired to control write access to the monitors and ensures that all
 	// monitors are synced before the controller can process quotas.
 	workerLock      sync.RWMutex
 	stop            <-chan struct{}
 	collectCrqsData bool
+
+	// windowChanges holds the next time the schedule window of each quota changes, for which a recalculation is pending
+	windowChanges     map[string]time.Time
+	windowChangesLock sync.Mutex
+	clock             clock.WithDelayedExecution
 }
 
 type workItem struct {
@@ -82,8 +78,9 @@ func NewAcrqController(aaqCli client.AAQClient,
 	AcrqInformer cache.SharedIndexInformer,
 	crqInformer cache.SharedIndexInformer,
 	podInformer cache.SharedIndexInformer,
-	aaqjqcInformer cache.SharedIndexInformer,
 	calcRegistry *aaq_evaluator.AaqEvaluatorRegistry,
+	reservations *arq_controller.ReservationLedger,
+	shards *sharding.Sharder,
 	namespaceLister v12.NamespaceLister,
 	stop <-chan struct{},
 	collectCrqsData bool,
@@ -92,16 +89,18 @@ func NewAcrqController(aaqCli client.AAQClient,
 		AcrqInformer:       AcrqInformer,
 		clusterQuotaMapper: clusterQuotaMapper,
 		aaqCli:             aaqCli,
-		aaqjqcInformer:     aaqjqcInformer,
 		crqInformer:        crqInformer,
 		podInformer:        podInformer,
 		resyncPeriod:       metav1.Duration{Duration: 5 * time.Minute}.Duration,
 		namespaceLister:    namespaceLister,
 		registry:           generic.NewRegistry([]quota.Evaluator{aaq_evaluator.NewAaqEvaluator(v12.NewPodLister(podInformer.GetIndexer()), calcRegistry, clock.RealClock{})}),
 		queue:              util.NewBucketingWorkQueue("controller_clusterquotareconcilationcontroller"),
-		nsQueue:            workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ns_queue"),
+		reservations:       reservations,
+		shards:             shards,
 		stop:               stop,
 		collectCrqsData:    collectCrqsData,
+		windowChanges:      map[string]time.Time{},
+		clock:              clock.RealClock{},
 	}
 
 	AcrqInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -117,13 +116,6 @@ func NewAcrqController(aaqCli client.AAQClient,
 	if err != nil {
 		panic("something is wrong")
 	}
-	_, err = ctrl.aaqjqcInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		UpdateFunc: ctrl.updateAaqjqc,
-		AddFunc:    ctrl.addAaqjqc,
-	})
-	if err != nil {
-		panic("something is wrong")
-	}
 	if collectCrqsData {
 		_, err = ctrl.crqInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 			UpdateFunc: ctrl.updateCRQ,
@@ -149,8 +141,6 @@ func (c *AcrqController) Run(ctx context.Context, workers int) {
 	// the workers that chug through the quota calculation backlog
 	for i := 0; i < workers; i++ {
 		go wait.Until(c.worker, time.Second, c.stop)
-		go wait.Until(c.runGateWatcherWorker, time.Second, c.stop)
-
 	}
 
 	// the timer for how often we do a full recalculation across all quotas
@@ -232,6 +222,10 @@ func (c *AcrqController) worker() {
 			c.queue.Forget(uncastKey)
 			return false
 		}
+		if !c.shards.OwnsClusterQuota(quotaName) {
+			c.queue.Forget(uncastKey)
+			return false
+		}
 		if err != nil {
 			utilruntime.HandleError(err)
 			c.queue.AddWithDataRateLimited(uncastKey, uncastData...)
@@ -268,6 +262,12 @@ func (c *AcrqController) worker() {
 // syncResourceQuotaFromKey syncs a quota key
 func (ctrl *AcrqController) syncQuotaForNamespaces(originalQuota *v1alpha1.ApplicationAwareClusterResourceQuota, workItems []workItem) (error, []workItem /* to retry */) {
 	quota := originalQuota.DeepCopy()
+	// the hard limits of the open schedule window replace the spec ones until the window closes
+	now := ctrl.clock.Now()
+	hard, nextWindowChange := util.ScheduledHard(quota.Spec.Quota.Hard, quota.Spec.Schedule, now)
+	if !nextWindowChange.IsZero() {
+		ctrl.recalculateOnWindowChange(quota.Name, nextWindowChange, now)
+	}
 
 	// get the list of namespaces that match this cluster quota
 	matchingNamespaceNamesList, quotaSelector := ctrl.clusterQuotaMapper.GetNamespacesFor(quota.Name)
@@ -279,6 +279,8 @@ func (ctrl *AcrqController) syncQuotaForNamespaces(originalQuota *v1alpha1.Appli
 
 	reconcilationErrors := []error{}
 	retryItems := []workItem{}
+	// reservationSequences are the reservations included in the usage of each namespace that was calculated again
+	reservationSequences := map[string]uint64{}
 	for _, item := range workItems {
 		namespaceName := item.namespaceName
 		namespaceTotals, namespaceLoaded := quotautil.GetResourceQuotasStatusByNamespace(quota.Status.Namespaces, namespaceName)
@@ -292,11 +294,12 @@ func (ctrl *AcrqController) syncQuotaForNamespaces(originalQuota *v1alpha1.Appli
 		}
 
 		// if there's no work for us to do, do nothing
-		if !item.forceRecalculation && namespaceLoaded && equality.Semantic.DeepEqual(namespaceTotals.Hard, quota.Spec.Quota.Hard) {
+		if !item.forceRecalculation && namespaceLoaded && equality.Semantic.DeepEqual(namespaceTotals.Hard, hard) {
 			continue
 		}
 
-		actualUsage, err := quotaUsageCalculationFunc(namespaceName, quota.Spec.Quota.Scopes, quota.Spec.Quota.Hard, ctrl.registry, quota.Spec.Quota.ScopeSelector)
+		reservationSequence, _ := ctrl.reservations.VisibleReservations(namespaceName)
+		actualUsage, err := quotaUsageCalculationFunc(namespaceName, quota.Spec.Quota.Scopes, hard, ctrl.registry, quota.Spec.Quota.ScopeSelector)
 		if err != nil {
 			// tally up errors, but calculate everything you can
 			reconcilationErrors = append(reconcilationErrors, err)
@@ -318,7 +321,7 @@ func (ctrl *AcrqController) syncQuotaForNamespaces(originalQuota *v1alpha1.Appli
 
 		recalculatedStatus := corev1.ResourceQuotaStatus{
 			Used: actualUsage,
-			Hard: quota.Spec.Quota.Hard,
+			Hard: hard,
 		}
 
 		// subtract old usage, add new usage
@@ -328,6 +331,7 @@ func (ctrl *AcrqController) syncQuotaForNamespaces(originalQuota *v1alpha1.Appli
 			Namespace: namespaceName,
 			Status:    recalculatedStatus,
 		})
+		reservationSequences[namespaceName] = reservationSequence
 	}
 
 	// Remove any namespaces from quota.status that no longer match.
@@ -342,20 +346,54 @@ func (ctrl *AcrqController) syncQuotaForNamespaces(originalQuota *v1alpha1.Appli
 		}
 	}
 
-	quota.Status.Total.Hard = quota.Spec.Quota.Hard
+	quota.Status.Total.Hard = hard
 
 	// if there's no change, no update, return early.  NewAggregate returns nil on empty input
 	if equality.Semantic.DeepEqual(quota, originalQuota) {
+		ctrl.observeReservations(originalQuota, originalQuota.ResourceVersion, matchingNamespaceNamesList, reservationSequences)
 		return kutilerrors.NewAggregate(reconcilationErrors), retryItems
 	}
 
-	if _, err := ctrl.aaqCli.ApplicationAwareClusterResourceQuotas().UpdateStatus(context.TODO(), quota, metav1.UpdateOptions{}); err != nil {
+	updated, err := ctrl.aaqCli.ApplicationAwareClusterResourceQuotas().UpdateStatus(context.TODO(), quota, metav1.UpdateOptions{})
+	if err != nil {
 		return kutilerrors.NewAggregate(append(reconcilationErrors, err)), workItems
 	}
+	ctrl.observeReservations(originalQuota, updated.ResourceVersion, matchingNamespaceNamesList, reservationSequences)
 
 	return kutilerrors.NewAggregate(reconcilationErrors), retryItems
 }
 
+// observeReservations lets the gate controller know which released pods the usage of each namespace of the quota
+// includes at resourceVersion, the namespaces that weren't calculated again keep their previous usage
+func (ctrl *AcrqController) observeReservations(acrq *v1alpha1.ApplicationAwareClusterResourceQuota, resourceVersion string, namespaceNames []string, reservationSequences map[string]uint64) {
+	for _, namespaceName := range namespaceNames {
+		if reservationSequence, calculated := reservationSequences[namespaceName]; calculated {
+			ctrl.reservations.Observed(arq_controller.AcrqKey(acrq, namespaceName), resourceVersion, reservationSequence)
+		} else {
+			ctrl.reservations.Carried(arq_controller.AcrqKey(acrq, namespaceName), resourceVersion)
+		}
+	}
+}
+
+// recalculateOnWindowChange forces a recalculation of the quota in all its namespaces once its schedule window changes
+func (ctrl *AcrqController) recalculateOnWindowChange(quotaName string, windowChange time.Time, now time.Time) {
+	ctrl.windowChangesLock.Lock()
+	defer ctrl.windowChangesLock.Unlock()
+	if pending, ok := ctrl.windowChanges[quotaName]; ok && !pending.After(windowChange) {
+		return
+	}
+	ctrl.windowChanges[quotaName] = windowChange
+	ctrl.clock.AfterFunc(windowChange.Sub(now), func() {
+		ctrl.windowChangesLock.Lock()
+		if ctrl.windowChanges[quotaName].Equal(windowChange) {
+			delete(ctrl.windowChanges, quotaName)
+		}
+		ctrl.windowChangesLock.Unlock()
+		namespaces, _ := ctrl.clusterQuotaMapper.GetNamespacesFor(quotaName)
+		ctrl.forceCalculation(quotaName, namespaces...)
+	})
+}
+
 func (ctrl *AcrqController) addAllAcrqsAppliedToNamespace(namespace string) {
 	quotaNames, _ := ctrl.clusterQuotaMapper.GetClusterQuotasFor(namespace)
 	if len(quotaNames) > 0 {
@@ -366,6 +404,15 @@ func (ctrl *AcrqController) addAllAcrqsAppliedToNamespace(namespace string) {
 	}
 }
 
+// OwnershipChanged calculates the usage of the namespaces that moved to the shards of the replica
+func (ctrl *AcrqController) OwnershipChanged(namespaces []string) {
+	for _, namespace := range namespaces {
+		if ctrl.shards.OwnsNamespace(namespace) {
+			ctrl.addAllAcrqsAppliedToNamespace(namespace)
+		}
+	}
+}
+
 func (ctrl *AcrqController) updateCRQ(old, curr interface{}) {
 	crq := curr.(*quotav1.ClusterResourceQuota)
 	acrq := &v1alpha1.ApplicationAwareClusterResourceQuota{
@@ -393,28 +440,11 @@ func (ctrl *AcrqController) addCRQ(obj interface{}) {
 	ctrl.forceCalculation(acrq.Name, namespaces...)
 }
 
-// When a ApplicationAwareResourceQuota.Status.PodsInJobQueuea is updated, enqueue all gated pods for revaluation
-func (ctrl *AcrqController) updateAaqjqc(old, cur interface{}) {
-	aaqjqc := cur.(*v1alpha1.AAQJobQueueConfig)
-	if aaqjqc.Status.ControllerLock[arq_controller.ApplicationAwareClusterResourceQuotaLockName] {
-		ctrl.nsQueue.Add(aaqjqc.Namespace)
-	}
-	return
-}
-
-// When a ApplicationAwareResourceQuota.Status.PodsInJobQueuea is updated, enqueue all gated pods for revaluation
-func (ctrl *AcrqController) addAaqjqc(obj interface{}) {
-	aaqjqc := obj.(*v1alpha1.AAQJobQueueConfig)
-	if aaqjqc.Status.ControllerLock[arq_controller.ApplicationAwareClusterResourceQuotaLockName] {
-		ctrl.nsQueue.Add(aaqjqc.Namespace)
-	}
-	return
-}
-
 func (ctrl *AcrqController) updatePod(old, curr interface{}) {
 	currPod := curr.(*v1.Pod)
 	oldPod := old.(*v1.Pod)
-	if len(oldPod.Spec.SchedulingGates) == 0 && len(currPod.Spec.SchedulingGates) == 0 {
+	// pods released by the gate controller are counted as well, so that the quotas include them
+	if len(oldPod.Spec.SchedulingGates) == 0 || len(currPod.Spec.SchedulingGates) == 0 {
 		ctrl.addAllAcrqsAppliedToNamespace(currPod.Namespace)
 	}
 }
@@ -475,74 +505,3 @@ func includeUsageFromClusterResourceQuota(rl corev1.ResourceList, crq *quotav1.C
 	}
 	return result
 }
-
-func (ctrl *AcrqController) runGateWatcherWorker() {
-	for ctrl.Execute() {
-	}
-}
-
-func (ctrl *AcrqController) Execute() bool {
-	ns, quit := ctrl.nsQueue.Get()
-	if quit {
-		return false
-	}
-	defer ctrl.nsQueue.Done(ns)
-	err, enqueueState := ctrl.execute(ns.(string))
-
-	if err != nil {
-		log.Log.Infof(fmt.Sprintf("ArqController: Error with key: %v err: %v", ns, err))
-	}
-	switch enqueueState {
-	case BackOff:
-		ctrl.nsQueue.AddRateLimited(ns)
-	case Forget:
-		ctrl.nsQueue.Forget(ns)
-	case Immediate:
-		ctrl.nsQueue.Add(ns)
-	}
-
-	return true
-}
-
-func (ctrl *AcrqController) execute(ns string) (error, enqueueState) {
-	var aaqjqc *v1alpha1.AAQJobQueueConfig
-	_, err := ctrl.namespaceLister.Get(ns)
-	if apierrors.IsNotFound(err) {
-		return nil, Forget
-	}
-
-	aaqjqcObj, exists, err := ctrl.aaqjqcInformer.GetIndexer().GetByKey(ns + "/" + arq_controller.AaqjqcName)
-	if err != nil {
-		return err, Immediate
-	} else if exists {
-		aaqjqc = aaqjqcObj.(*v1alpha1.AAQJobQueueConfig).DeepCopy()
-	}
-
-	if aaqjqc != nil && aaqjqc.Status.ControllerLock != nil && aaqjqc.Status.ControllerLock[arq_controller.ApplicationAwareClusterResourceQuotaLockName] {
-		if res, err := util.VerifyPodsWithOutSchedulingGates(ctrl.aaqCli, ctrl.podInformer, ns, aaqjqc.Status.PodsInJobQueue); err != nil || !res {
-			return err, Immediate //wait until gate controller remove the scheduling gates
-		}
-
-	}
-
-	acrqs, _ := ctrl.clusterQuotaMapper.GetClusterQuotasFor(ns)
-	for _, acrq := range acrqs {
-		quotaObj, exists, err := ctrl.AcrqInformer.GetIndexer().GetByKey(acrq)
-		if !exists || err != nil {
-			return err, Immediate
-		}
-		err, retryItems := ctrl.syncQuotaForNamespaces(quotaObj.(*v1alpha1.ApplicationAwareClusterResourceQuota), []workItem{{namespaceName: ns, forceRecalculation: true}})
-		if err != nil || len(retryItems) != 0 {
-			return err, Immediate
-		}
-	}
-
-	if aaqjqc != nil && aaqjqc.Status.ControllerLock != nil && aaqjqc.Status.ControllerLock[arq_controller.ApplicationAwareClusterResourceQuotaLockName] {
-		aaqjqc.Status.ControllerLock[arq_controller.ApplicationAwareClusterResourceQuotaLockName] = false
-		_, err = ctrl.aaqCli.AAQJobQueueConfigs(ns).UpdateStatus(context.Background(), aaqjqc, metav1.UpdateOptions{})
-		if err != nil {
-			return err, Immediate
-		}
-	}
-	return nil, Forget
-}
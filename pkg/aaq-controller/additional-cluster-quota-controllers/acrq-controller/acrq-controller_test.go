@@ -1,21 +1,96 @@
 package acrq_controller
 
 import (
+	"context"
+	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	quotav1 "github.com/openshift/api/quota/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilquota "k8s.io/apiserver/pkg/quota/v1"
+	testingclock "k8s.io/utils/clock/testing"
+	arq_controller "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-gate-controller"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/additional-cluster-quota-controllers/clusterquotamapping"
+	"kubevirt.io/application-aware-quota/pkg/client"
 	testsutils "kubevirt.io/application-aware-quota/pkg/tests-utils"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"time"
 )
 
-var _ = Describe("Test aaq-gate-controller", func() {
+// fakeClusterQuotaMapper maps every cluster quota to the same namespaces
+type fakeClusterQuotaMapper struct {
+	namespaces []string
+}
+
+func (m fakeClusterQuotaMapper) GetClusterQuotasFor(_ string) ([]string, clusterquotamapping.SelectionFields) {
+	return nil, clusterquotamapping.SelectionFields{}
+}
+
+func (m fakeClusterQuotaMapper) GetNamespacesFor(_ string) ([]string, quotav1.ClusterResourceQuotaSelector) {
+	return m.namespaces, quotav1.ClusterResourceQuotaSelector{}
+}
+
+func (m fakeClusterQuotaMapper) AddListener(_ clusterquotamapping.MappingChangeListener) {}
+
+var _ = Describe("Test acrq-controller", func() {
 	var testNs = "test"
 
-	Context("Test execute when ", func() {
-		It("should forget the key if its namespace doesn't exist", func() {
-			qc := AcrqController{namespaceLister: testsutils.FakeNamespaceLister{Namespaces: map[string]*corev1.Namespace{}}}
-			err, es := qc.execute(testNs)
+	Context("Test syncQuotaForNamespaces when ", func() {
+		var originalCalculationFunc = quotaUsageCalculationFunc
+
+		BeforeEach(func() {
+			quotaUsageCalculationFunc = func(_ string, _ []corev1.ResourceQuotaScope, _ corev1.ResourceList, _ utilquota.Registry, _ *corev1.ScopeSelector) (corev1.ResourceList, error) {
+				return corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("1Gi")}, nil
+			}
+		})
+
+		AfterEach(func() {
+			quotaUsageCalculationFunc = originalCalculationFunc
+		})
+
+		It("should report the reservations the usage of the calculated namespaces includes", func() {
+			released := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "released", Namespace: testNs, UID: "released-uid"}}
+			gated := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "gated", Namespace: testNs, UID: "gated-uid"},
+				Spec:       corev1.PodSpec{SchedulingGates: []corev1.PodSchedulingGate{{Name: "ApplicationAwareQuotaGate"}}},
+			}
+			podInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{released, gated})
+			reservations := arq_controller.NewReservationLedger(podInformer)
+			usage := corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("1Gi")}
+			reservations.Reserve(released, usage)
+			// the informer still shows the second pod gated, its release may not be counted yet
+			reservations.Reserve(gated, usage)
+
+			acrq := &v1alpha1.ApplicationAwareClusterResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: "acrq", ResourceVersion: "1"}}
+			acrq.Spec.Quota.Hard = corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("4Gi")}
+			ctrl := gomock.NewController(GinkgoT())
+			cli := client.NewMockAAQClient(ctrl)
+			acrqInterfaceMock := client.NewMockApplicationAwareClusterResourceQuotaInterface(ctrl)
+			acrqInterfaceMock.EXPECT().UpdateStatus(context.TODO(), gomock.Any(), metav1.UpdateOptions{}).Times(1).DoAndReturn(
+				func(_ context.Context, updated *v1alpha1.ApplicationAwareClusterResourceQuota, _ metav1.UpdateOptions) (*v1alpha1.ApplicationAwareClusterResourceQuota, error) {
+					updated = updated.DeepCopy()
+					updated.ResourceVersion = "2"
+					return updated, nil
+				})
+			cli.EXPECT().ApplicationAwareClusterResourceQuotas().Return(acrqInterfaceMock).Times(1)
+			qc := AcrqController{
+				aaqCli:             cli,
+				clusterQuotaMapper: fakeClusterQuotaMapper{namespaces: []string{testNs, "other"}},
+				reservations:       reservations,
+				clock:              testingclock.NewFakeClock(time.Now()),
+			}
+
+			err, retryItems := qc.syncQuotaForNamespaces(acrq, []workItem{{namespaceName: testNs, forceRecalculation: true}})
 			Expect(err).ToNot(HaveOccurred())
-			Expect(es).To(Equal(Forget))
+			Expect(retryItems).To(BeEmpty())
+
+			reserved, synced := reservations.Reserved(arq_controller.AcrqKey(acrq, testNs), "2")
+			Expect(synced).To(BeTrue())
+			Expect(utilquota.Equals(reserved, usage)).To(BeTrue(), "reserved is %v", reserved)
+			_, synced = reservations.Reserved(arq_controller.AcrqKey(acrq, "other"), "2")
+			Expect(synced).To(BeFalse())
 		})
 	})
 })
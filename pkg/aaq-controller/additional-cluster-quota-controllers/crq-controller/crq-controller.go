@@ -15,6 +15,7 @@ import (
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 	_ "kubevirt.io/api/core/v1"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/sharding"
 	"kubevirt.io/application-aware-quota/pkg/client"
 	"kubevirt.io/application-aware-quota/pkg/log"
 	"kubevirt.io/application-aware-quota/pkg/util"
@@ -38,12 +39,14 @@ type CRQController struct {
 	crqInformer  cache.SharedIndexInformer
 	acrqQueue    workqueue.RateLimitingInterface
 	aaqCli       client.AAQClient
+	shards       *sharding.Sharder
 	stop         <-chan struct{}
 }
 
 func NewCRQController(aaqCli client.AAQClient,
 	crqInformer cache.SharedIndexInformer,
 	acrqInformer cache.SharedIndexInformer,
+	shards *sharding.Sharder,
 	stop <-chan struct{},
 ) *CRQController {
 	ctrl := CRQController{
@@ -51,6 +54,7 @@ func NewCRQController(aaqCli client.AAQClient,
 		aaqCli:       aaqCli,
 		acrqInformer: acrqInformer,
 		acrqQueue:    workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "acrq-queue-for-crq-contorller"),
+		shards:       shards,
 		stop:         stop,
 	}
 
@@ -170,6 +174,9 @@ func (ctrl *CRQController) Execute() bool {
 
 func (ctrl *CRQController) execute(key string) (error, enqueueState) {
 	_, arqName, err := cache.SplitMetaNamespaceKey(key)
+	if !ctrl.shards.OwnsClusterQuota(arqName) {
+		return nil, Forget
+	}
 	acrqObj, exists, err := ctrl.acrqInformer.GetIndexer().GetByKey(arqName)
 	if err != nil {
 		return err, Immediate
@@ -20,6 +20,7 @@ package aaq_controller
 
 import (
 	"context"
+	"encoding/json"
 	goflag "flag"
 	"fmt"
 	"github.com/emicklei/go-restful/v3"
@@ -42,13 +43,17 @@ import (
 	"kubevirt.io/application-aware-quota/pkg/aaq-controller/additional-cluster-quota-controllers/clusterquotamapping"
 	crq_controller "kubevirt.io/application-aware-quota/pkg/aaq-controller/additional-cluster-quota-controllers/crq-controller"
 	"kubevirt.io/application-aware-quota/pkg/aaq-controller/arq-controller"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/audit"
 	built_in_usage_calculators "kubevirt.io/application-aware-quota/pkg/aaq-controller/built-in-usage-calculators"
 	"kubevirt.io/application-aware-quota/pkg/aaq-controller/leaderelectionconfig"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/metrics"
 	rq_controller "kubevirt.io/application-aware-quota/pkg/aaq-controller/rq-controller"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/sharding"
 	"kubevirt.io/application-aware-quota/pkg/certificates/bootstrap"
 	"kubevirt.io/application-aware-quota/pkg/client"
 	"kubevirt.io/application-aware-quota/pkg/generated/aaq/listers/core/v1alpha1"
 	"kubevirt.io/application-aware-quota/pkg/informers"
+	"kubevirt.io/application-aware-quota/pkg/tracing"
 	"kubevirt.io/application-aware-quota/pkg/util"
 	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
 	golog "log"
@@ -62,6 +67,11 @@ type AaqControllerApp struct {
 	enableClusterQuota            bool
 	onOpenshift                   bool
 	aaqNs                         string
+	queueingConfig                v1alpha12.QueueingConfiguration
+	enablePreemption              bool
+	gateTTLConfig                 v1alpha12.GateTTLConfiguration
+	eventCoalescingConfig         v1alpha12.EventCoalescingConfiguration
+	auditLogger                   *audit.Logger
 	host                          string
 	LeaderElection                leaderelectionconfig.Configuration
 	aaqCli                        client.AAQClient
@@ -81,8 +91,12 @@ type AaqControllerApp struct {
 	acrqInformer                  cache.SharedIndexInformer
 	aacrqInformer                 cache.SharedIndexInformer
 	nsInformer                    cache.SharedIndexInformer
+	pdbInformer                   cache.SharedIndexInformer
 	recorder                      record.EventRecorder
 	calcRegistry                  *aaq_evaluator.AaqEvaluatorRegistry
+	reservations                  *arq_controller2.ReservationLedger
+	sharder                       *sharding.Sharder
+	watchScope                    *watchScope
 	readyChan                     chan bool
 	leaderElector                 *leaderelection.LeaderElector
 }
@@ -93,6 +107,34 @@ func Execute() {
 	clusterQuotaEnabled := flag.Bool(util.EnableClusterQuota, false, "flag that to let us know if we should enable clusterQuota controllers")
 	launcherConfig := flag.String(util.VMICalculatorConfiguration, "", "flag that to let us know how to allocate resource for virtual machines") //todo: should delete this once sidecar evaluators are in
 	numberOfRequestedEvaluatorsSidecars := flag.Uint(util.SidecarEvaluatorsNumberFlag, 0, "number of requested evaluators sidecars")
+	queueingPolicy := flag.String(util.QueueingPolicyFlag, "", "flag that to let us know in which order gated pods should be evaluated")
+	queueingAgingPeriod := flag.Duration(util.QueueingAgingPeriodFlag, util.DefaultQueueingAgingPeriod, "time a gated pod can wait before it is evaluated ahead of younger pods")
+	gateTTL := flag.Duration(util.GateTTLFlag, 0, "maximum time a pod can stay gated, zero means forever")
+	gateExpiryAction := flag.String(util.GateExpiryActionFlag, string(v1alpha12.GateExpiryEvent), "action applied on pods that stayed gated longer than their ttl")
+	enablePreemption := flag.Bool(util.EnablePreemptionFlag, false, "flag that to let us know if lower priority pods can be evicted to admit higher priority gated pods")
+	tracingEndpoint := flag.String(util.TracingEndpointFlag, "", "OTLP gRPC collector the traces are exported to, tracing is disabled when empty")
+	tracingInsecure := flag.Bool(util.TracingInsecureFlag, false, "flag that to let us know if TLS should be disabled towards the tracing collector")
+	auditLogSink := flag.String(util.AuditLogSinkFlag, "", "sink the gate decisions are recorded to: Stdout, File or HTTP, no decisions are recorded when empty")
+	auditLogPath := flag.String(util.AuditLogPathFlag, util.DefaultAuditLogPath, "file the File audit log sink appends the records to")
+	auditLogURL := flag.String(util.AuditLogURLFlag, "", "endpoint the HTTP audit log sink posts the records to")
+	auditLogRetention := flag.Duration(util.AuditLogRetentionFlag, util.DefaultAuditLogRetention, "how long the File audit log sink keeps records")
+	auditLogSamplingPercentage := flag.Int32(util.AuditLogSamplingPercentageFlag, 100, "percentage of the gate decisions that are recorded")
+	calculatorPolicies := flag.String(util.CalculatorPoliciesFlag, "", "JSON list of the policies applied on the usage calculators, their defaults apply when empty")
+	calculatorComposition := flag.String(util.CalculatorCompositionFlag, string(v1alpha12.SumComposition), "how the usages of the calculators matching the same pod are combined: Sum, FirstMatch or Max")
+	usageCacheTTL := flag.Duration(util.UsageCacheTTLFlag, util.DefaultUsageCacheTTL, "how long the usage calculators computed for a pod is reused, zero disables the cache")
+	usageCacheMaxEntries := flag.Int(util.UsageCacheMaxEntriesFlag, util.DefaultUsageCacheMaxEntries, "maximum number of usages the usage cache holds")
+	remoteEvaluators := flag.String(util.RemoteEvaluatorsFlag, "", "JSON list of the evaluators called over the network with mutual TLS")
+	celCalculators := flag.String(util.CELCalculatorsFlag, "", "JSON list of the usage calculators declared with CEL expressions")
+	wasmCalculators := flag.String(util.WasmCalculatorsFlag, "", "JSON list of the usage calculators compiled to WebAssembly")
+	shards := flag.Int(util.ShardsFlag, 0, "number of shards the namespaces are split into, all the replicas work on the shards they claim. Only the leader works when zero")
+	shardingReplicas := flag.Int(util.ShardingReplicasFlag, util.DefaultControllerReplicas, "number of replicas the shards are split between")
+	stripPodFields := flag.Bool(util.StripPodFieldsFlag, false, "flag that to let us know if the pod fields no calculator requires should be dropped from the cached pods")
+	calculatorPodFields := flag.StringSlice(util.CalculatorPodFieldsFlag, nil, "pod fields the sidecar, remote, CEL and wasm calculators require")
+	scopedWatches := flag.Bool(util.ScopedWatchesFlag, false, "flag that to let us know if pods, resource quotas and job queue configs should only be kept for the gated namespaces and the ones covered by a quota")
+	gatedNamespaceSelector := flag.String(util.GatedNamespaceSelectorFlag, "", "JSON label selector of the namespaces pods are gated in, defaults to the namespaces with the gating label")
+	eventCoalescingMinDelay := flag.Duration(util.EventCoalescingMinDelayFlag, util.DefaultEventCoalescingMinDelay, "time a namespace is evaluated after its last event, zero evaluates it on every event")
+	eventCoalescingMaxDelay := flag.Duration(util.EventCoalescingMaxDelayFlag, util.DefaultEventCoalescingMaxDelay, "maximum time the events of a namespace can postpone its evaluation")
+	releaseParallelism := flag.Int32(util.ReleaseParallelismFlag, util.DefaultReleaseParallelism, "number of gated pods released at once")
 
 	flag.Parse()
 	var err error
@@ -102,14 +144,48 @@ func Execute() {
 	app.readyChan = make(chan bool, 1)
 	app.onOpenshift = *isOnOpenshift
 	app.enableClusterQuota = *clusterQuotaEnabled
+	app.queueingConfig = v1alpha12.QueueingConfiguration{
+		Policy:      v1alpha12.QueueingPolicyName(*queueingPolicy),
+		AgingPeriod: &v1.Duration{Duration: *queueingAgingPeriod},
+	}
+	app.enablePreemption = *enablePreemption
+	app.gateTTLConfig = v1alpha12.GateTTLConfiguration{
+		ExpiryAction: v1alpha12.GateExpiryAction(*gateExpiryAction),
+	}
+	if *gateTTL > 0 {
+		app.gateTTLConfig.TTL = &v1.Duration{Duration: *gateTTL}
+	}
+	app.eventCoalescingConfig = v1alpha12.EventCoalescingConfiguration{
+		MinDelay:           &v1.Duration{Duration: *eventCoalescingMinDelay},
+		MaxDelay:           &v1.Duration{Duration: *eventCoalescingMaxDelay},
+		ReleaseParallelism: releaseParallelism,
+	}
+	app.auditLogger, err = audit.NewLogger(v1alpha12.AuditLogConfiguration{
+		Sink:               v1alpha12.AuditLogSink(*auditLogSink),
+		Path:               *auditLogPath,
+		URL:                *auditLogURL,
+		Retention:          &v1.Duration{Duration: *auditLogRetention},
+		SamplingPercentage: auditLogSamplingPercentage,
+	})
+	if err != nil {
+		golog.Fatalf("unable to setup the audit log: %v", err)
+	}
+	defer app.auditLogger.Close()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	app.ctx = ctx
 
+	shutdownTracing, err := tracing.Setup(ctx, util.ControllerPodName, v1alpha12.TracingConfiguration{Endpoint: *tracingEndpoint, Insecure: *tracingInsecure})
+	if err != nil {
+		golog.Fatalf("unable to setup tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	webService := new(restful.WebService)
 	webService.Path("/").Consumes(restful.MIME_JSON).Produces(restful.MIME_JSON)
 	webService.Route(webService.GET("/leader").To(app.leaderProbe).Doc("Leader endpoint"))
 	restful.Add(webService)
+	http.Handle(metrics.MetricsPath, metrics.Handler())
 
 	nsBytes, err := ioutil.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
 	if err != nil {
@@ -128,23 +204,85 @@ func Execute() {
 		golog.Fatalf("AAQClient: %v", err)
 	}
 	app.arqInformer = informers.GetApplicationAwareResourceQuotaInformer(app.aaqCli)
-	app.rqInformer = informers.GetResourceQuotaInformer(app.aaqCli)
-	app.aaqjqcInformer = informers.GetAAQJobQueueConfig(app.aaqCli)
-	app.podInformer = informers.GetPodInformer(app.aaqCli)
+	var scopedInformers []*informers.ScopedInformer
+	if *scopedWatches {
+		scopedRqInformer := informers.GetScopedResourceQuotaInformer(app.aaqCli)
+		scopedAaqjqcInformer := informers.GetScopedAAQJobQueueConfigInformer(app.aaqCli)
+		scopedPodInformer := informers.GetScopedPodInformer(app.aaqCli)
+		scopedInformers = []*informers.ScopedInformer{scopedRqInformer, scopedAaqjqcInformer, scopedPodInformer}
+		app.rqInformer, app.aaqjqcInformer, app.podInformer = scopedRqInformer, scopedAaqjqcInformer, scopedPodInformer
+	} else {
+		app.rqInformer = informers.GetResourceQuotaInformer(app.aaqCli)
+		app.aaqjqcInformer = informers.GetAAQJobQueueConfig(app.aaqCli)
+		app.podInformer = informers.GetPodInformer(app.aaqCli)
+	}
 	app.aaqInformer = informers.GetAAQInformer(app.aaqCli)
 	app.nsInformer = informers.GetNamespaceInformer(app.aaqCli)
+	if app.enablePreemption {
+		app.pdbInformer = informers.GetPodDisruptionBudgetInformer(app.aaqCli)
+	}
 	// Create event recorder
 	broadcaster := record.NewBroadcaster()
 	broadcaster.StartRecordingToSink(&v14.EventSinkImpl{Interface: app.aaqCli.CoreV1().Events(v1.NamespaceAll)})
 	app.recorder = broadcaster.NewRecorder(scheme.Scheme, k8sv1.EventSource{Component: "aaq-controller"})
 
-	// Block until all requested evaluatorsSidecars are ready
+	// Sidecars are registered and dropped as they come and go, give the requested ones a chance to start first
 	evaluatorsRegistry := aaq_evaluator.GetAaqEvaluatorsRegistry()
 	stop := ctx.Done()
-
-	err = evaluatorsRegistry.Collect(*numberOfRequestedEvaluatorsSidecars, util.DefaultSidecarsEvaluatorsStartTimeout)
-	if err != nil {
-		panic(err)
+	if *calculatorPolicies != "" {
+		var policies []v1alpha12.CalculatorPolicy
+		if err := json.Unmarshal([]byte(*calculatorPolicies), &policies); err != nil {
+			golog.Fatalf("unable to parse the calculator policies: %v", err)
+		}
+		if err := evaluatorsRegistry.SetCalculatorPolicies(policies); err != nil {
+			golog.Fatalf("unable to set the calculator policies: %v", err)
+		}
+	}
+	if err := evaluatorsRegistry.SetCompositionStrategy(v1alpha12.CalculatorCompositionStrategy(*calculatorComposition)); err != nil {
+		golog.Fatalf("unable to set the calculator composition: %v", err)
+	}
+	evaluatorsRegistry.SetEventRecorder(app.recorder)
+	evaluatorsRegistry.SetUsageCache(*usageCacheTTL, *usageCacheMaxEntries)
+	if *remoteEvaluators != "" {
+		var evaluators []v1alpha12.RemoteEvaluator
+		if err := json.Unmarshal([]byte(*remoteEvaluators), &evaluators); err != nil {
+			golog.Fatalf("unable to parse the remote evaluators: %v", err)
+		}
+		if err := evaluatorsRegistry.SetRemoteEvaluators(evaluators, util.EvaluatorClientCertDir, util.EvaluatorCABundleDir); err != nil {
+			golog.Fatalf("unable to set the remote evaluators: %v", err)
+		}
+	}
+	if *celCalculators != "" {
+		var calculators []v1alpha12.CELCalculator
+		if err := json.Unmarshal([]byte(*celCalculators), &calculators); err != nil {
+			golog.Fatalf("unable to parse the CEL calculators: %v", err)
+		}
+		compiled, err := built_in_usage_calculators.NewCELCalculators(calculators)
+		if err != nil {
+			klog.Errorf("skipping the CEL calculators that failed to compile: %v", err)
+		}
+		metrics.SetInvalidCELCalculators(len(calculators) - len(compiled))
+		for _, calculator := range compiled {
+			evaluatorsRegistry.Add(calculator)
+		}
+	}
+	if *wasmCalculators != "" {
+		var calculators []v1alpha12.WasmCalculator
+		if err := json.Unmarshal([]byte(*wasmCalculators), &calculators); err != nil {
+			golog.Fatalf("unable to parse the wasm calculators: %v", err)
+		}
+		loaded, err := aaq_evaluator.LoadWasmCalculators(app.aaqCli.CoreV1(), app.aaqNs, calculators)
+		if err != nil {
+			golog.Fatalf("unable to load the wasm calculators: %v", err)
+		}
+		for _, calculator := range loaded {
+			evaluatorsRegistry.Add(calculator)
+		}
+	}
+	go evaluatorsRegistry.Run(stop)
+	if !evaluatorsRegistry.WaitForSidecars(*numberOfRequestedEvaluatorsSidecars, util.DefaultSidecarsEvaluatorsStartTimeout) {
+		klog.Warningf("Only %d out of %d requested evaluators sidecars are healthy, the rest are used once they register",
+			evaluatorsRegistry.HealthySidecars(), *numberOfRequestedEvaluatorsSidecars)
 	}
 	if v1alpha12.VmiCalcConfigName(*launcherConfig) != v1alpha12.IgnoreVmiCalculator {
 		vmiInformer := informers.GetVMIInformer(app.aaqCli)
@@ -160,7 +298,18 @@ func Execute() {
 		}
 		evaluatorsRegistry.Add(built_in_usage_calculators.NewVirtLauncherCalculator(vmiInformer, migrationInformer, v1alpha12.VmiCalcConfigName(*launcherConfig)))
 	}
+	if *stripPodFields {
+		if err := informers.ValidatePodFields(*calculatorPodFields); err != nil {
+			golog.Fatalf("unable to set the calculator pod fields: %v", err)
+		}
+		// all the in-process calculators are added by now, and the fields of the rest are set
+		evaluatorsRegistry.SetCalculatorPodFields(*calculatorPodFields)
+		if err := app.podInformer.SetTransform(informers.NewPodTransform(evaluatorsRegistry.RequiredPodFields())); err != nil {
+			golog.Fatalf("unable to set the pod transform: %v", err)
+		}
+	}
 	app.calcRegistry = evaluatorsRegistry
+	app.reservations = arq_controller2.NewReservationLedger(app.podInformer)
 	namespaceLister := v12.NewNamespaceLister(app.nsInformer.GetIndexer())
 
 	var clusterQuotaLister v1alpha1.ApplicationAwareClusterResourceQuotaLister
@@ -169,26 +318,47 @@ func Execute() {
 	if app.enableClusterQuota {
 		app.acrqInformer = informers.GetApplicationAwareClusterResourceQuotaInformer(app.aaqCli)
 		app.aacrqInformer = informers.GetApplicationAwareAppliedClusterResourceQuotaInformer(app.aaqCli)
+		app.initClusterQuotaMappingController(stop)
+		clusterQuotaLister = v1alpha1.NewApplicationAwareClusterResourceQuotaLister(app.acrqInformer.GetIndexer())
+		clusterQuotaMapper = app.clusterQuotaMappingController.GetClusterQuotaMapper()
+	}
+	if *shards > 0 {
+		app.initSharder(*shards, *shardingReplicas, namespaceLister, clusterQuotaMapper)
+	}
+	if *scopedWatches {
+		app.initWatchScope(*gatedNamespaceSelector, scopedInformers)
+	}
+	if app.enableClusterQuota {
 		if app.onOpenshift {
 			app.crqInformer = informers.GetClusterResourceQuotaInformer(app.aaqCli)
 			app.initCRQController(stop)
 		}
 		app.initAacrqController(stop)
-		app.initClusterQuotaMappingController(stop)
-		app.initAcrqController(stop, app.clusterQuotaMappingController.GetClusterQuotaMapper(), namespaceLister)
-		app.clusterQuotaMappingController.GetClusterQuotaMapper().AddListener(app.acrqController)
-		clusterQuotaLister = v1alpha1.NewApplicationAwareClusterResourceQuotaLister(app.acrqInformer.GetIndexer())
-		clusterQuotaMapper = app.clusterQuotaMappingController.GetClusterQuotaMapper()
+		app.initAcrqController(stop, clusterQuotaMapper, namespaceLister)
+		clusterQuotaMapper.AddListener(app.acrqController)
 	}
 
 	app.initArqController(stop, namespaceLister)
 	app.initAaqGateController(stop, clusterQuotaLister, namespaceLister, clusterQuotaMapper)
+	if app.watchScope != nil {
+		app.watchScope.releaseGatedPods = app.aaqGateController.ReleaseOutOfScope
+	}
 	app.initRQController(stop)
 
 	if app.enableClusterQuota {
-		app.clusterQuotaMappingController.GetClusterQuotaMapper().AddListener(app.aaqGateController)
+		clusterQuotaMapper.AddListener(app.aaqGateController)
+	}
+	if app.sharder != nil {
+		app.sharder.AddListener(app.arqController)
+		app.sharder.AddListener(app.aaqGateController)
+		app.sharder.AddListener(app.rqController)
+		if app.enableClusterQuota {
+			app.sharder.AddListener(app.acrqController)
+		}
 	}
 
+	metrics.RegisterQuotaCollector(app.arqInformer, app.acrqInformer)
+
 	app.Run(stop)
 
 	klog.V(2).Infoln("AAQ controller exited")
@@ -196,6 +366,14 @@ func Execute() {
 
 func (mca *AaqControllerApp) leaderProbe(_ *restful.Request, response *restful.Response) {
 	res := map[string]interface{}{}
+	// the sidecars state is only reported, readiness doesn't depend on it: the failure policies of the calculators
+	// decide what happens to the pods a sidecar that is down would have evaluated
+	if mca.calcRegistry != nil {
+		res["sidecars"] = mca.calcRegistry.SidecarStatuses()
+	}
+	if mca.sharder != nil {
+		res["shards"] = mca.sharder.OwnedShards()
+	}
 	select {
 	case _, opened := <-mca.readyChan:
 		if !opened {
@@ -221,13 +399,59 @@ func (mca *AaqControllerApp) initArqController(
 		mca.podInformer,
 		mca.arqInformer,
 		mca.rqInformer,
-		mca.aaqjqcInformer,
 		mca.calcRegistry,
+		mca.reservations,
+		mca.sharder,
 		namespaceLister,
+		mca.eventCoalescingConfig,
 		stop,
 	)
 }
 
+// initSharder splits the namespaces in shards claimed through Leases, the sharder places the namespaces that share
+// cluster quotas along with them and is notified of the mapping changes first
+func (mca *AaqControllerApp) initSharder(shards int,
+	replicas int,
+	namespaceLister v12.NamespaceLister,
+	clusterQuotaMapper clusterquotamapping.ClusterQuotaMapper,
+) {
+	mca.sharder = sharding.NewSharder(shards,
+		replicas,
+		mca.host,
+		mca.aaqNs,
+		mca.LeaderElection,
+		mca.aaqCli.CoordinationV1(),
+		namespaceLister,
+		mca.arqInformer,
+		mca.acrqInformer,
+		clusterQuotaMapper,
+	)
+	if clusterQuotaMapper != nil {
+		clusterQuotaMapper.AddListener(mca.sharder)
+	}
+}
+
+// initWatchScope scopes the informers to the namespaces matching the selector of the gating webhook
+// and to the ones covered by a quota
+func (mca *AaqControllerApp) initWatchScope(gatedNamespaceSelector string, scopedInformers []*informers.ScopedInformer) {
+	labelSelector := &v1.LabelSelector{
+		MatchExpressions: []v1.LabelSelectorRequirement{
+			{Key: util.DefaultGatedNamespaceLabel, Operator: v1.LabelSelectorOpExists},
+		},
+	}
+	if gatedNamespaceSelector != "" {
+		labelSelector = &v1.LabelSelector{}
+		if err := json.Unmarshal([]byte(gatedNamespaceSelector), labelSelector); err != nil {
+			golog.Fatalf("unable to parse the gated namespace selector: %v", err)
+		}
+	}
+	selector, err := v1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		golog.Fatalf("unable to parse the gated namespace selector: %v", err)
+	}
+	mca.watchScope = newWatchScope(selector, mca.nsInformer, mca.arqInformer, mca.acrqInformer, scopedInformers...)
+}
+
 func (mca *AaqControllerApp) initAcrqController(
 	stop <-chan struct{},
 	clusterQuotaMapper clusterquotamapping.ClusterQuotaMapper,
@@ -238,8 +462,9 @@ func (mca *AaqControllerApp) initAcrqController(
 		mca.acrqInformer,
 		mca.crqInformer,
 		mca.podInformer,
-		mca.aaqjqcInformer,
 		mca.calcRegistry,
+		mca.reservations,
+		mca.sharder,
 		namespaceLister,
 		stop,
 		mca.onOpenshift,
@@ -250,6 +475,7 @@ func (mca *AaqControllerApp) initAacrqController(stop <-chan struct{}) {
 	mca.aacrqController = aacrq_controller.NewAacrqController(mca.aaqCli,
 		mca.aacrqInformer,
 		mca.acrqInformer,
+		mca.sharder,
 		stop,
 	)
 }
@@ -272,11 +498,19 @@ func (mca *AaqControllerApp) initAaqGateController(stop <-chan struct{},
 		mca.arqInformer,
 		mca.aaqjqcInformer,
 		mca.acrqInformer,
+		mca.pdbInformer,
 		mca.calcRegistry,
+		mca.reservations,
+		mca.sharder,
 		clusterQuotaLister,
 		namespaceLister,
 		clusterQuotaMapper,
 		mca.recorder,
+		mca.queueingConfig,
+		mca.enablePreemption,
+		mca.gateTTLConfig,
+		mca.auditLogger,
+		mca.eventCoalescingConfig,
 		mca.enableClusterQuota,
 		stop,
 	)
@@ -286,6 +520,7 @@ func (mca *AaqControllerApp) initRQController(stop <-chan struct{}) {
 	mca.rqController = rq_controller.NewRQController(mca.aaqCli,
 		mca.rqInformer,
 		mca.arqInformer,
+		mca.sharder,
 		stop,
 	)
 }
@@ -294,6 +529,7 @@ func (mca *AaqControllerApp) initCRQController(stop <-chan struct{}) {
 	mca.crqController = crq_controller.NewCRQController(mca.aaqCli,
 		mca.crqInformer,
 		mca.acrqInformer,
+		mca.sharder,
 		stop,
 	)
 }
@@ -328,6 +564,12 @@ func (mca *AaqControllerApp) Run(stop <-chan struct{}) {
 			golog.Fatal(err)
 		}
 	}()
+	if mca.sharder != nil {
+		// all the replicas work, each on the namespaces of the shards it claims
+		mca.onStartedLeading()(mca.ctx)
+		mca.sharder.Run(mca.ctx)
+		return
+	}
 	if err := mca.setupLeaderElector(); err != nil {
 		golog.Fatal(err)
 	}
@@ -378,6 +620,13 @@ func (mca *AaqControllerApp) onStartedLeading() func(ctx context.Context) {
 		go mca.aaqjqcInformer.Run(stop)
 		go mca.aaqInformer.Run(stop)
 		go mca.nsInformer.Run(stop)
+		if mca.watchScope != nil {
+			// the scoped informers sync once the quotas, cluster quotas included, are
+			if mca.enableClusterQuota {
+				go mca.acrqInformer.Run(stop)
+			}
+			go mca.watchScope.Run(stop)
+		}
 
 		if !cache.WaitForCacheSync(stop,
 			mca.podInformer.HasSynced,
@@ -389,8 +638,18 @@ func (mca *AaqControllerApp) onStartedLeading() func(ctx context.Context) {
 		) {
 			klog.Warningf("failed to wait for caches to sync")
 		}
+		if mca.enablePreemption {
+			go mca.pdbInformer.Run(stop)
+			if !cache.WaitForCacheSync(stop,
+				mca.pdbInformer.HasSynced,
+			) {
+				klog.Warningf("failed to wait for caches to sync")
+			}
+		}
 		if mca.enableClusterQuota {
-			go mca.acrqInformer.Run(stop)
+			if mca.watchScope == nil {
+				go mca.acrqInformer.Run(stop)
+			}
 			go mca.aacrqInformer.Run(stop)
 			if !cache.WaitForCacheSync(stop,
 				mca.acrqInformer.HasSynced,
@@ -429,6 +688,7 @@ func (mca *AaqControllerApp) onStartedLeading() func(ctx context.Context) {
 		go func() {
 			mca.rqController.Run(3)
 		}()
+		go mca.reportSidecarStatuses(stop)
 		close(mca.readyChan)
 	}
 }
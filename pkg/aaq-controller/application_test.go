@@ -24,6 +24,7 @@ import (
 	restful "github.com/emicklei/go-restful/v3"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	aaq_evaluator "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-evaluator"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -65,6 +66,23 @@ var _ = Describe("Application", func() {
 				Expect(x["apiserver"].(map[string]interface{})["leader"]).To(Equal("true"))
 			})
 		})
+		Context("with missing sidecars", func() {
+			AfterEach(func() {
+				app.calcRegistry = nil
+			})
+
+			It("should return 200 and the registered sidecars", func() {
+				close(app.readyChan)
+				app.calcRegistry = aaq_evaluator.GetAaqEvaluatorsRegistry()
+				request.URL, _ = url.Parse("/leader")
+				handler.ServeHTTP(recorder, request)
+				var x map[string]interface{}
+				Expect(json.Unmarshal(recorder.Body.Bytes(), &x)).To(Succeed())
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				Expect(x).To(HaveKey("sidecars"))
+				Expect(x["apiserver"].(map[string]interface{})["leader"]).To(Equal("true"))
+			})
+		})
 		Context("with opened channel", func() {
 			It("should return 200 and that it is not the leader", func() {
 				request.URL, _ = url.Parse("/leader")
@@ -6,6 +6,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
@@ -22,6 +23,7 @@ import (
 	aaq_evaluator "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-evaluator"
 	arq_controller "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-gate-controller"
 	rq_controller "kubevirt.io/application-aware-quota/pkg/aaq-controller/rq-controller"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/sharding"
 	"kubevirt.io/application-aware-quota/pkg/client"
 	"kubevirt.io/application-aware-quota/pkg/log"
 	"kubevirt.io/application-aware-quota/pkg/util"
@@ -38,9 +40,11 @@ const (
 	BackOff   enqueueState = "BackOff"
 )
 
+// UsageCalculatedReason is set on the Degraded condition once the usage of all the pods counted by the quota is calculated again
+const UsageCalculatedReason = "UsageCalculated"
+
 type ArqController struct {
 	podInformer     cache.SharedIndexInformer
-	aaqjqcInformer  cache.SharedIndexInformer
 	aaqCli          client.AAQClient
 	arqInformer     cache.SharedIndexInformer
 	rqInformer      cache.SharedIndexInformer
@@ -49,41 +53,61 @@ type ArqController struct {
 	arqQueue          workqueue.RateLimitingInterface
 	missingUsageQueue workqueue.RateLimitingInterface
 	nsQueue           workqueue.RateLimitingInterface
+	// coalesces the pod events of a namespace, so that a burst of pods syncs its quotas once
+	debouncer *arq_controller.NamespaceDebouncer
 	// Controls full recalculation of quota usage
 	resyncPeriod time.Duration
 	// knows how to calculate usage
 	evalRegistry quota.Registry
-	recorder     record.EventRecorder
-	syncHandler  func(key string) error
-	logger       klog.Logger
-	stop         <-chan struct{}
+	podEvaluator *aaq_evaluator.AaqEvaluator
+	// keeps the usage of the pods, so that pod changes don't require evaluating all the pods again
+	ledger *usageLedger
+	// holds the usage of the pods the gate controller released until the quotas include it
+	reservations *arq_controller.ReservationLedger
+	// only the quotas of the namespaces in the shards of the replica are synced
+	shards *sharding.Sharder
+
+	recorder    record.EventRecorder
+	syncHandler func(key string) error
+	logger      klog.Logger
+	clock       clock.Clock
+	stop        <-chan struct{}
 }
 
 func NewArqController(clientSet client.AAQClient,
 	podInformer cache.SharedIndexInformer,
 	arqInformer cache.SharedIndexInformer,
 	rqInformer cache.SharedIndexInformer,
-	aaqjqcInformer cache.SharedIndexInformer,
 	calcRegistry *aaq_evaluator.AaqEvaluatorRegistry,
+	reservations *arq_controller.ReservationLedger,
+	shards *sharding.Sharder,
 	namespaceLister v12.NamespaceLister,
+	eventCoalescingConfig v1alpha12.EventCoalescingConfiguration,
 	stop <-chan struct{},
 ) *ArqController {
+	podLister := v12.NewPodLister(podInformer.GetIndexer())
+	podEvaluator := aaq_evaluator.NewAaqEvaluator(podLister, calcRegistry, clock.RealClock{})
 	ctrl := &ArqController{
 		aaqCli:            clientSet,
 		arqInformer:       arqInformer,
 		rqInformer:        rqInformer,
 		podInformer:       podInformer,
-		aaqjqcInformer:    aaqjqcInformer,
 		arqQueue:          workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "arq_primary"),
 		missingUsageQueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "arq_priority"),
 		nsQueue:           workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ns_queue"),
 		resyncPeriod:      metav1.Duration{Duration: 5 * time.Minute}.Duration,
-		evalRegistry:      generic.NewRegistry([]quota.Evaluator{aaq_evaluator.NewAaqEvaluator(v12.NewPodLister(podInformer.GetIndexer()), calcRegistry, clock.RealClock{})}),
+		evalRegistry:      generic.NewRegistry([]quota.Evaluator{podEvaluator}),
+		podEvaluator:      podEvaluator,
+		ledger:            newUsageLedger(podLister, podEvaluator),
+		reservations:      reservations,
+		shards:            shards,
 		namespaceLister:   namespaceLister,
 		logger:            klog.FromContext(context.Background()),
+		clock:             clock.RealClock{},
 		stop:              stop,
 	}
 	ctrl.syncHandler = ctrl.syncResourceQuotaFromKey
+	ctrl.debouncer = arq_controller.NewNamespaceDebouncer(ctrl.nsQueue, eventCoalescingConfig, clock.RealClock{})
 
 	arqInformer.AddEventHandlerWithResyncPeriod(
 		cache.ResourceEventHandlerFuncs{
@@ -101,13 +125,6 @@ func NewArqController(clientSet client.AAQClient,
 	if err != nil {
 		panic("something is wrong")
 	}
-	_, err = ctrl.aaqjqcInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		UpdateFunc: ctrl.updateAaqjqc,
-		AddFunc:    ctrl.addAaqjqc,
-	})
-	if err != nil {
-		panic("something is wrong")
-	}
 	_, err = ctrl.rqInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		UpdateFunc: ctrl.updateRQ,
 		AddFunc:    ctrl.addRQ,
@@ -161,26 +178,10 @@ func (ctrl *ArqController) addRQ(obj interface{}) {
 	return
 }
 
-// When a ApplicationAwareResourceQuotAaqjqc.Status.PodsInJobQueuea is updated, enqueue all gated pods for revaluation
-func (ctrl *ArqController) updateAaqjqc(old, cur interface{}) {
-	aaqjqc := cur.(*v1alpha12.AAQJobQueueConfig)
-	if aaqjqc.Status.ControllerLock[arq_controller.ApplicationAwareResourceQuotaLockName] {
-		ctrl.nsQueue.Add(aaqjqc.Namespace)
-	}
-	return
-}
-
-// When a ApplicationAwareResourceQuotAaqjqc.Status.PodsInJobQueuea is updated, enqueue all gated pods for revaluation
-func (ctrl *ArqController) addAaqjqc(obj interface{}) {
-	aaqjqc := obj.(*v1alpha12.AAQJobQueueConfig)
-	if aaqjqc.Status.ControllerLock[arq_controller.ApplicationAwareResourceQuotaLockName] {
-		ctrl.nsQueue.Add(aaqjqc.Namespace)
-	}
-	return
-}
-
-// enqueueAll is called at the fullResyncPeriod interval to force a full recalculation of quota usage statistics
+// enqueueAll is called at the fullResyncPeriod interval to force a full recalculation of quota usage statistics,
+// which corrects the usages the ledger drifted on
 func (ctrl *ArqController) enqueueAll() {
+	ctrl.ledger.recomputeAll()
 	arqObjs := ctrl.arqInformer.GetIndexer().List()
 	for _, arqObj := range arqObjs {
 		arq := arqObj.(*v1alpha12.ApplicationAwareResourceQuota)
@@ -192,6 +193,16 @@ func (ctrl *ArqController) enqueueAll() {
 		ctrl.arqQueue.Add(key)
 	}
 }
+
+// OwnershipChanged syncs the quotas of the namespaces that moved to the shards of the replica
+func (ctrl *ArqController) OwnershipChanged(namespaces []string) {
+	for _, ns := range namespaces {
+		if ctrl.shards.OwnsNamespace(ns) {
+			ctrl.nsQueue.Add(ns)
+		}
+	}
+}
+
 func (ctrl *ArqController) updateArq(_, curr interface{}) {
 	ctrl.addQuota(ctrl.logger, curr.(*v1alpha12.ApplicationAwareResourceQuota))
 }
@@ -201,25 +212,37 @@ func (ctrl *ArqController) addArq(obj interface{}) {
 }
 
 func (ctrl *ArqController) deleteArq(obj interface{}) {
+	if namespace, name, err := cache.SplitMetaNamespaceKey(deletedObjectKey(obj)); err == nil {
+		ctrl.ledger.forgetQuota(namespace, name)
+	}
 	ctrl.enqueueArq(ctrl.logger, obj)
 }
 
+func deletedObjectKey(obj interface{}) string {
+	key, _ := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	return key
+}
+
 func (ctrl *ArqController) updatePod(old, curr interface{}) {
 	currPod := curr.(*v1.Pod)
 	oldPod := old.(*v1.Pod)
-	if len(oldPod.Spec.SchedulingGates) == 0 && len(currPod.Spec.SchedulingGates) == 0 {
-		ctrl.nsQueue.Add(currPod.Namespace)
+	ctrl.ledger.podChanged(currPod.Namespace, currPod.Name)
+	// pods released by the gate controller are enqueued as well, so that the quotas include them
+	if len(oldPod.Spec.SchedulingGates) == 0 || len(currPod.Spec.SchedulingGates) == 0 {
+		ctrl.debouncer.Enqueue(currPod.Namespace)
 	}
 }
 
 func (ctrl *ArqController) addPod(obj interface{}) {
 	pod := obj.(*v1.Pod)
-	ctrl.nsQueue.Add(pod.Namespace)
+	ctrl.ledger.podChanged(pod.Namespace, pod.Name)
+	ctrl.debouncer.Enqueue(pod.Namespace)
 }
 
 func (ctrl *ArqController) deletePod(obj interface{}) {
 	pod := obj.(*v1.Pod)
-	ctrl.nsQueue.Add(pod.Namespace)
+	ctrl.ledger.podChanged(pod.Namespace, pod.Name)
+	ctrl.debouncer.Enqueue(pod.Namespace)
 }
 
 func (ctrl *ArqController) runGateWatcherWorker() {
@@ -251,24 +274,11 @@ func (ctrl *ArqController) Execute() bool {
 }
 
 func (ctrl *ArqController) execute(ns string) (error, enqueueState) {
-	var aaqjqc *v1alpha12.AAQJobQueueConfig
 	_, err := ctrl.namespaceLister.Get(ns)
 	if errors.IsNotFound(err) {
+		ctrl.ledger.forgetNamespace(ns)
 		return nil, Forget
 	}
-	aaqjqcObj, exists, err := ctrl.aaqjqcInformer.GetIndexer().GetByKey(ns + "/" + arq_controller.AaqjqcName)
-	if err != nil {
-		return err, Immediate
-	} else if exists {
-		aaqjqc = aaqjqcObj.(*v1alpha12.AAQJobQueueConfig).DeepCopy()
-	}
-
-	if aaqjqc != nil && aaqjqc.Status.ControllerLock != nil && aaqjqc.Status.ControllerLock[arq_controller.ApplicationAwareResourceQuotaLockName] {
-		if res, err := util.VerifyPodsWithOutSchedulingGates(ctrl.aaqCli, ctrl.podInformer, ns, aaqjqc.Status.PodsInJobQueue); err != nil || !res {
-			return err, Immediate //wait until gate controller remove the scheduling gates
-		}
-	}
-
 	arqObjs, err := ctrl.arqInformer.GetIndexer().ByIndex(cache.NamespaceIndex, ns)
 	if err != nil {
 		return err, Immediate
@@ -281,14 +291,6 @@ func (ctrl *ArqController) execute(ns string) (error, enqueueState) {
 			return err, Immediate
 		}
 	}
-
-	if aaqjqc != nil && aaqjqc.Status.ControllerLock != nil && aaqjqc.Status.ControllerLock[arq_controller.ApplicationAwareResourceQuotaLockName] {
-		aaqjqc.Status.ControllerLock[arq_controller.ApplicationAwareResourceQuotaLockName] = false
-		_, err = ctrl.aaqCli.AAQJobQueueConfigs(ns).UpdateStatus(context.Background(), aaqjqc, metav1.UpdateOptions{})
-		if err != nil {
-			return err, Immediate
-		}
-	}
 	return nil, Forget
 }
 
@@ -296,6 +298,7 @@ func (ctrl *ArqController) Run(ctx context.Context, workers int) {
 	defer utilruntime.HandleCrash()
 	defer ctrl.arqQueue.ShutDown()
 	defer ctrl.missingUsageQueue.ShutDown()
+	defer ctrl.debouncer.Stop()
 	logger := klog.FromContext(ctx)
 	klog.Info("Starting ARQ controller")
 	defer klog.Info("Shutting ARQ Controller")
@@ -362,7 +365,8 @@ func (ctrl *ArqController) addQuota(logger klog.Logger, obj interface{}) {
 	arq := obj.(*v1alpha12.ApplicationAwareResourceQuota)
 
 	// if we declared an intent that is not yet captured in status (prioritize it)
-	if !apiequality.Semantic.DeepEqual(arq.Spec.Hard, arq.Status.Hard) {
+	hard, _ := util.ScheduledHard(arq.Spec.Hard, arq.Spec.Schedule, ctrl.clock.Now())
+	if !apiequality.Semantic.DeepEqual(hard, arq.Status.Hard) {
 		ctrl.missingUsageQueue.Add(key)
 		return
 	}
@@ -424,8 +428,20 @@ func (ctrl *ArqController) syncResourceQuotaFromKey(key string) (err error) {
 
 // syncResourceQuota runs a complete sync of resource quota status across all known kinds
 func (ctrl *ArqController) syncResourceQuota(arq *v1alpha12.ApplicationAwareResourceQuota) (err error) {
+	if !ctrl.shards.OwnsNamespace(arq.Namespace) {
+		return nil
+	}
+	// the hard limits of the open schedule window replace the spec ones until the window closes
+	now := ctrl.clock.Now()
+	scheduledHard, nextWindowChange := util.ScheduledHard(arq.Spec.Hard, arq.Spec.Schedule, now)
+	if !nextWindowChange.IsZero() {
+		if key, err := cache.MetaNamespaceKeyFunc(arq); err == nil {
+			ctrl.arqQueue.AddAfter(key, nextWindowChange.Sub(now))
+		}
+	}
+
 	// quota is dirty if any part of spec hard limits differs from the status hard limits
-	statusLimitsDirty := !apiequality.Semantic.DeepEqual(arq.Spec.Hard, arq.Status.Hard)
+	statusLimitsDirty := !apiequality.Semantic.DeepEqual(scheduledHard, arq.Status.Hard)
 
 	// dirty tracks if the usage status differs from the previous sync,
 	// if so, we send a new usage with latest status
@@ -436,13 +452,20 @@ func (ctrl *ArqController) syncResourceQuota(arq *v1alpha12.ApplicationAwareReso
 	if arq.Status.Used != nil {
 		used = quota.Add(v1.ResourceList{}, arq.Status.Used)
 	}
-	hardLimits := quota.Add(v1.ResourceList{}, arq.Spec.Hard)
+	hardLimits := quota.Add(v1.ResourceList{}, scheduledHard)
+
+	// the usage calculated from the pod informer includes the released pods it shows without their gate,
+	// they may not be marked dirty yet since the informer updates its indexer before notifying the handlers
+	reservationSequence, releasedPods := ctrl.reservations.VisibleReservations(arq.Namespace)
+	for _, podName := range releasedPods {
+		ctrl.ledger.podChanged(arq.Namespace, podName)
+	}
 
 	var errs []error
-	newUsage, err := quota.CalculateUsage(arq.Namespace, arq.Spec.Scopes, hardLimits, ctrl.evalRegistry, arq.Spec.ScopeSelector)
-	if err != nil {
+	newUsage, calculationErr := ctrl.calculateUsage(arq, hardLimits)
+	if calculationErr != nil {
 		// if err is non-nil, remember it to return, but continue updating status with any resources in newUsage
-		errs = append(errs, err)
+		errs = append(errs, calculationErr)
 	}
 
 	var rq *v1.ResourceQuota
@@ -468,22 +491,73 @@ func (ctrl *ArqController) syncResourceQuota(arq *v1alpha12.ApplicationAwareReso
 	// Create a usage object that is based on the quota resource version that will handle updates
 	// by default, we preserve the past usage observation, and set hard to the current spec
 	usage := arq.DeepCopy()
+	conditions := usage.Status.Conditions
 	usage.Status = v1alpha12.ApplicationAwareResourceQuotaStatus{}
 	usage.Status.Hard = hardLimits
 	usage.Status.Used = used
+	usage.Status.Borrowed = borrowedUsage(hardLimits, used)
+	usage.Status.Conditions = conditions
+	conditionsDirty := setDegradedCondition(&usage.Status.Conditions, calculationErr, arq.Generation)
 
-	dirty = dirty || !quota.Equals(usage.Status.Used, arq.Status.Used)
+	dirty = dirty || conditionsDirty || !quota.Equals(usage.Status.Used, arq.Status.Used) || !quota.Equals(usage.Status.Borrowed, arq.Status.Borrowed)
 
 	// there was a change observed by this controller that requires we update quota
+	observedVersion := arq.ResourceVersion
 	if dirty {
-		_, err = ctrl.aaqCli.ApplicationAwareResourceQuotas(usage.Namespace).UpdateStatus(context.Background(), usage, metav1.UpdateOptions{})
+		updated, err := ctrl.aaqCli.ApplicationAwareResourceQuotas(usage.Namespace).UpdateStatus(context.Background(), usage, metav1.UpdateOptions{})
 		if err != nil {
 			errs = append(errs, err)
+		} else {
+			observedVersion = updated.ResourceVersion
 		}
 	}
+	// the gate controller stops holding the usage of the released pods once it sees the quota with them included
+	if len(errs) == 0 {
+		ctrl.reservations.Observed(arq_controller.ArqKey(arq), observedVersion, reservationSequence)
+	}
 	return utilerrors.NewAggregate(errs)
 }
 
+// calculateUsage is quota.CalculateUsage with the usage of the pods taken from the ledger rather than evaluated again
+func (ctrl *ArqController) calculateUsage(arq *v1alpha12.ApplicationAwareResourceQuota, hardLimits v1.ResourceList) (v1.ResourceList, error) {
+	newUsage := v1.ResourceList{}
+	matchedResources := ctrl.podEvaluator.MatchingResources(quota.ResourceNames(hardLimits))
+	if len(matchedResources) == 0 {
+		return newUsage, nil
+	}
+	used, err := ctrl.ledger.usage(arq)
+	if err != nil {
+		return nil, err
+	}
+	for _, resourceName := range matchedResources {
+		newUsage[resourceName] = resource.Quantity{Format: resource.DecimalSI}
+	}
+	return quota.Add(newUsage, quota.Mask(used, matchedResources)), nil
+}
+
+// setDegradedCondition marks the quota as degraded while a calculator with the FailClosed policy fails to evaluate
+// some of its pods, since its usage isn't updated meanwhile. It returns whether the conditions changed
+func setDegradedCondition(conditions *[]metav1.Condition, calculationErr error, generation int64) bool {
+	if calculatorErr, failedClosed := aaq_evaluator.AsCalculatorFailedError(calculationErr); failedClosed {
+		return meta.SetStatusCondition(conditions, metav1.Condition{
+			Type:               v1alpha12.ApplicationAwareResourceQuotaDegraded,
+			Status:             metav1.ConditionTrue,
+			Reason:             arq_controller.CalculatorFailedReason,
+			Message:            calculatorErr.Error(),
+			ObservedGeneration: generation,
+		})
+	}
+	if calculationErr != nil || meta.FindStatusCondition(*conditions, v1alpha12.ApplicationAwareResourceQuotaDegraded) == nil {
+		return false
+	}
+	return meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               v1alpha12.ApplicationAwareResourceQuotaDegraded,
+		Status:             metav1.ConditionFalse,
+		Reason:             UsageCalculatedReason,
+		ObservedGeneration: generation,
+	})
+}
+
 func updateUsageFromResourceQuota(arq *v1alpha12.ApplicationAwareResourceQuota, rq *v1.ResourceQuota, newUsage map[v1.ResourceName]resource.Quantity) {
 	nonSchedulableResourcesHard := util.FilterNonScheduableResources(arq.Status.Hard)
 	if quota.Equals(rq.Spec.Hard, nonSchedulableResourcesHard) && rq.Status.Used != nil {
@@ -492,3 +566,20 @@ func updateUsageFromResourceQuota(arq *v1alpha12.ApplicationAwareResourceQuota,
 		}
 	}
 }
+
+// borrowedUsage returns the usage above the hard limits, which was admitted by borrowing from the quota cohort
+func borrowedUsage(hard, used v1.ResourceList) v1.ResourceList {
+	var borrowed v1.ResourceList
+	for resourceName, usedQuantity := range used {
+		hardQuantity, ok := hard[resourceName]
+		if !ok || usedQuantity.Cmp(hardQuantity) <= 0 {
+			continue
+		}
+		if borrowed == nil {
+			borrowed = v1.ResourceList{}
+		}
+		usedQuantity.Sub(hardQuantity)
+		borrowed[resourceName] = usedQuantity
+	}
+	return borrowed
+}
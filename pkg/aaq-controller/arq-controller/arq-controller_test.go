@@ -11,10 +11,14 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	quota "k8s.io/apiserver/pkg/quota/v1"
 	"k8s.io/client-go/informers"
 	k8sfake "k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
+	testingclock "k8s.io/utils/clock/testing"
 	aaq_evaluator "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-evaluator"
 	arq_controller "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-gate-controller"
 	rq_controller "kubevirt.io/application-aware-quota/pkg/aaq-controller/rq-controller"
@@ -23,6 +27,7 @@ import (
 	"kubevirt.io/application-aware-quota/pkg/generated/aaq/informers/externalversions"
 	testsutils "kubevirt.io/application-aware-quota/pkg/tests-utils"
 	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"time"
 )
 
 var _ = Describe("Test arq-controller", func() {
@@ -35,9 +40,9 @@ var _ = Describe("Test arq-controller", func() {
 		rqInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{&managedRQ})
 		expectedArq := arq.DeepCopy()
 		expectedArq.Status = status
-		arqmock.EXPECT().UpdateStatus(context.Background(), expectedArq, metav1.UpdateOptions{}).Times(1)
+		arqmock.EXPECT().UpdateStatus(context.Background(), expectedArq, metav1.UpdateOptions{}).Times(1).Return(expectedArq, nil)
 		cli.EXPECT().ApplicationAwareResourceQuotas(arq.Namespace).Return(arqmock).Times(1)
-		qc := setupQuotaController(cli, podInformer, rqInformer, testsutils.FakeNamespaceLister{}, nil)
+		qc := setupQuotaController(cli, podInformer, rqInformer, testsutils.FakeNamespaceLister{})
 		err := qc.syncResourceQuota(&arq)
 		Expect(err).ToNot(HaveOccurred())
 	}, Entry("non-matching-best-effort-scoped-quota", v1alpha1.ApplicationAwareResourceQuota{
@@ -54,7 +59,7 @@ var _ = Describe("Test arq-controller", func() {
 		},
 	}, nil,
 		v1alpha1.ApplicationAwareResourceQuotaStatus{
-			corev1.ResourceQuotaStatus{
+			ResourceQuotaStatus: corev1.ResourceQuotaStatus{
 				Hard: corev1.ResourceList{
 					corev1.ResourceCPU:    resource.MustParse("3"),
 					corev1.ResourceMemory: resource.MustParse("100Gi"),
@@ -406,6 +411,34 @@ var _ = Describe("Test arq-controller", func() {
 			},
 		},
 		newTestPods(),
+	), Entry("borrowed-usage", v1alpha1.ApplicationAwareResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: "testing"},
+		Spec: v1alpha1.ApplicationAwareResourceQuotaSpec{
+			ResourceQuotaSpec: corev1.ResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					corev1.ResourceCPU:  resource.MustParse("100m"),
+					corev1.ResourcePods: resource.MustParse("5"),
+				},
+			},
+			Cohort: "cohort",
+		},
+	}, nil,
+		v1alpha1.ApplicationAwareResourceQuotaStatus{
+			ResourceQuotaStatus: corev1.ResourceQuotaStatus{
+				Hard: corev1.ResourceList{
+					corev1.ResourceCPU:  resource.MustParse("100m"),
+					corev1.ResourcePods: resource.MustParse("5"),
+				},
+				Used: corev1.ResourceList{
+					corev1.ResourceCPU:  getUsedQuantityForTest("200m"),
+					corev1.ResourcePods: getUsedQuantityForTest("2"),
+				},
+			},
+			Borrowed: corev1.ResourceList{
+				corev1.ResourceCPU: getUsedQuantityForTest("100m"),
+			},
+		},
+		newTestPods(),
 	), Entry("quota-spec-hard-updated", v1alpha1.ApplicationAwareResourceQuota{
 		ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: "testing"},
 		Spec: v1alpha1.ApplicationAwareResourceQuotaSpec{
@@ -576,70 +609,133 @@ var _ = Describe("Test arq-controller", func() {
 	),
 	)
 
-	Context("Test execute when", func() {
-		var ctrl *gomock.Controller
-		BeforeEach(func() {
-			ctrl = gomock.NewController(GinkgoT())
-		})
-		It(" pods are ungated and aaqjqc queue should become unlocked", func() {
-			aaqjqcInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: arq_controller.AaqjqcName, Namespace: "testNs"}, Status: v1alpha1.AAQJobQueueConfigStatus{PodsInJobQueue: []string{"pod-test", "pod-test2"}, ControllerLock: map[string]bool{arq_controller.ApplicationAwareResourceQuotaLockName: true}}}})
-			cli := client.NewMockAAQClient(ctrl)
-			fakek8sCli := k8sfake.NewSimpleClientset([]runtime.Object{
-				&corev1.Pod{
-					ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Namespace: "testNs"},
-					Status:     corev1.PodStatus{Phase: corev1.PodRunning},
-					Spec: corev1.PodSpec{
-						Containers: []corev1.Container{{Name: "ctr", Image: "image", Resources: testsutils.GetResourceRequirements(testsutils.GetResourceList("500m", "1Gi"), testsutils.GetResourceList("", ""))}},
+	DescribeTable("Test SyncResourceQuota with a schedule when ", func(now time.Time, expectedHard corev1.ResourceList) {
+		arq := v1alpha1.ApplicationAwareResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: "testing"},
+			Spec: v1alpha1.ApplicationAwareResourceQuotaSpec{
+				ResourceQuotaSpec: corev1.ResourceQuotaSpec{
+					Hard: corev1.ResourceList{
+						corev1.ResourceCPU:  resource.MustParse("3"),
+						corev1.ResourcePods: resource.MustParse("5"),
 					},
 				},
-				&corev1.Pod{
-					ObjectMeta: metav1.ObjectMeta{Name: "pod-test2", Namespace: "testNs"},
-					Status:     corev1.PodStatus{Phase: corev1.PodRunning},
-					Spec: corev1.PodSpec{
-						Containers: []corev1.Container{{Name: "ctr", Image: "image", Resources: testsutils.GetResourceRequirements(testsutils.GetResourceList("500m", "1Gi"), testsutils.GetResourceList("", ""))}},
+				Schedule: &v1alpha1.QuotaSchedule{
+					TimeZone: "Asia/Jerusalem",
+					Windows: []v1alpha1.QuotaScheduleWindow{
+						{
+							Name:     "nights",
+							Start:    "0 22 * * *",
+							Duration: metav1.Duration{Duration: 8 * time.Hour},
+							Hard:     corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10")},
+						},
+						{
+							Name:     "weekends",
+							Start:    "0 0 * * 6",
+							Duration: metav1.Duration{Duration: 48 * time.Hour},
+							Hard:     corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("20")},
+						},
 					},
 				},
-			}...)
-			cli.EXPECT().CoreV1().Times(1).Return(fakek8sCli.CoreV1())
-			mockAaaqjqcInterface := client.NewMockAAQJobQueueConfigInterface(ctrl)
-			mockAaaqjqcInterface.EXPECT().UpdateStatus(context.Background(), &v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: arq_controller.AaqjqcName, Namespace: "testNs"}, Status: v1alpha1.AAQJobQueueConfigStatus{PodsInJobQueue: []string{"pod-test", "pod-test2"}, ControllerLock: map[string]bool{arq_controller.ApplicationAwareResourceQuotaLockName: false}}}, metav1.UpdateOptions{})
-			cli.EXPECT().AAQJobQueueConfigs("testNs").Times(1).Return(mockAaaqjqcInterface)
-			qc := setupQuotaController(cli, nil, nil, testsutils.FakeNamespaceLister{Namespaces: map[string]*corev1.Namespace{"testNs": {ObjectMeta: metav1.ObjectMeta{Name: "testNs"}}}}, aaqjqcInformer)
-			err, es := qc.execute("testNs")
-			Expect(err).ToNot(HaveOccurred())
-			Expect(es).To(Equal(Forget))
-		})
+			},
+		}
+		ctrl := gomock.NewController(GinkgoT())
+		cli := client.NewMockAAQClient(ctrl)
+		arqmock := client.NewMockApplicationAwareResourceQuotaInterface(ctrl)
+		arqmock.EXPECT().UpdateStatus(context.Background(), gomock.Any(), metav1.UpdateOptions{}).Times(1).DoAndReturn(
+			func(_ context.Context, updated *v1alpha1.ApplicationAwareResourceQuota, _ metav1.UpdateOptions) (*v1alpha1.ApplicationAwareResourceQuota, error) {
+				Expect(quota.Equals(updated.Status.Hard, expectedHard)).To(BeTrue())
+				return updated, nil
+			})
+		cli.EXPECT().ApplicationAwareResourceQuotas(arq.Namespace).Return(arqmock).Times(1)
+		qc := setupQuotaController(cli, nil, nil, testsutils.FakeNamespaceLister{})
+		qc.clock = testingclock.NewFakeClock(now)
+		Expect(qc.syncResourceQuota(&arq)).To(Succeed())
+	}, Entry("no window is open", time.Date(2024, time.January, 3, 12, 0, 0, 0, time.UTC),
+		corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("3"), corev1.ResourcePods: resource.MustParse("5")},
+	), Entry("a window is open in the schedule time zone", time.Date(2024, time.January, 3, 21, 0, 0, 0, time.UTC),
+		corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10"), corev1.ResourcePods: resource.MustParse("5")},
+	), Entry("a window opened on the previous day", time.Date(2024, time.January, 4, 3, 0, 0, 0, time.UTC),
+		corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10"), corev1.ResourcePods: resource.MustParse("5")},
+	), Entry("the window closed", time.Date(2024, time.January, 4, 4, 0, 0, 0, time.UTC),
+		corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("3"), corev1.ResourcePods: resource.MustParse("5")},
+	), Entry("two windows are open", time.Date(2024, time.January, 6, 1, 0, 0, 0, time.UTC),
+		corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10"), corev1.ResourcePods: resource.MustParse("5")},
+	), Entry("only the second window is open", time.Date(2024, time.January, 6, 12, 0, 0, 0, time.UTC),
+		corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("20"), corev1.ResourcePods: resource.MustParse("5")},
+	),
+	)
 
-		It(" not all pods are ungated and aaqjqc queue should not become unlocked", func() {
-			aaqjqcInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{&v1alpha1.AAQJobQueueConfig{ObjectMeta: metav1.ObjectMeta{Name: arq_controller.AaqjqcName, Namespace: "testNs"}, Status: v1alpha1.AAQJobQueueConfigStatus{PodsInJobQueue: []string{"pod-test", "pod-test2"}, ControllerLock: map[string]bool{arq_controller.ApplicationAwareResourceQuotaLockName: true}}}})
-			cli := client.NewMockAAQClient(ctrl)
-			fakek8sCli := k8sfake.NewSimpleClientset([]runtime.Object{
-				&corev1.Pod{
-					ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Namespace: "testNs"},
-					Status:     corev1.PodStatus{Phase: corev1.PodRunning},
-					Spec: corev1.PodSpec{
-						Containers: []corev1.Container{{Name: "ctr", Image: "image", Resources: testsutils.GetResourceRequirements(testsutils.GetResourceList("500m", "1Gi"), testsutils.GetResourceList("", ""))}},
-					},
-				},
-				&corev1.Pod{
-					ObjectMeta: metav1.ObjectMeta{Name: "pod-test2", Namespace: "testNs"},
-					Status:     corev1.PodStatus{Phase: corev1.PodRunning},
-					Spec: corev1.PodSpec{
-						SchedulingGates: []corev1.PodSchedulingGate{{"someGate"}},
-						Containers:      []corev1.Container{{Name: "ctr", Image: "image", Resources: testsutils.GetResourceRequirements(testsutils.GetResourceList("500m", "1Gi"), testsutils.GetResourceList("", ""))}},
-					},
-				},
-			}...)
-			cli.EXPECT().CoreV1().Times(1).Return(fakek8sCli.CoreV1())
-			qc := setupQuotaController(cli, nil, nil, testsutils.FakeNamespaceLister{Namespaces: map[string]*corev1.Namespace{"testNs": {ObjectMeta: metav1.ObjectMeta{Name: "testNs"}}}}, aaqjqcInformer)
-			err, es := qc.execute("testNs")
-			Expect(err).ToNot(HaveOccurred())
-			Expect(es).To(Equal(Immediate))
+	It("setDegradedCondition should report calculators that fail closed until the usage is calculated again", func() {
+		var conditions []metav1.Condition
+		Expect(setDegradedCondition(&conditions, nil, 1)).To(BeFalse())
+		Expect(conditions).To(BeEmpty())
+
+		calculatorErr := &aaq_evaluator.CalculatorFailedError{Calculator: "sidecar/evaluator", Pod: "testing/pod", Err: "unavailable"}
+		Expect(setDegradedCondition(&conditions, utilerrors.NewAggregate([]error{calculatorErr}), 1)).To(BeTrue())
+		Expect(conditions).To(HaveLen(1))
+		Expect(conditions[0].Type).To(Equal(v1alpha1.ApplicationAwareResourceQuotaDegraded))
+		Expect(conditions[0].Status).To(Equal(metav1.ConditionTrue))
+		Expect(conditions[0].Reason).To(Equal(arq_controller.CalculatorFailedReason))
+		Expect(conditions[0].Message).To(Equal(calculatorErr.Error()))
+		Expect(setDegradedCondition(&conditions, calculatorErr, 1)).To(BeFalse())
+
+		Expect(setDegradedCondition(&conditions, fmt.Errorf("error listing"), 1)).To(BeFalse())
+		Expect(setDegradedCondition(&conditions, nil, 1)).To(BeTrue())
+		Expect(conditions[0].Status).To(Equal(metav1.ConditionFalse))
+		Expect(conditions[0].Reason).To(Equal(UsageCalculatedReason))
+	})
+
+	It("syncResourceQuota should report the released pods its usage includes", func() {
+		newPod := func(name string, gated bool) *corev1.Pod {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "testing", UID: types.UID(name + "-uid")},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "ctr", Image: "image", Resources: testsutils.GetResourceRequirements(testsutils.GetResourceList("", "1Gi"), testsutils.GetResourceList("", ""))}},
+				},
+			}
+			if gated {
+				pod.Spec.SchedulingGates = []corev1.PodSchedulingGate{{Name: "ApplicationAwareQuotaGate"}}
+			}
+			return pod
+		}
+		released, gated := newPod("pod-released", false), newPod("pod-gated", true)
+		arq := &v1alpha1.ApplicationAwareResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: "testing", ResourceVersion: "1"},
+			Spec: v1alpha1.ApplicationAwareResourceQuotaSpec{
+				ResourceQuotaSpec: corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("4Gi")}},
+			},
+		}
+		ctrl := gomock.NewController(GinkgoT())
+		cli := client.NewMockAAQClient(ctrl)
+		arqmock := client.NewMockApplicationAwareResourceQuotaInterface(ctrl)
+		arqmock.EXPECT().UpdateStatus(context.Background(), gomock.Any(), metav1.UpdateOptions{}).Times(1).DoAndReturn(
+			func(_ context.Context, updated *v1alpha1.ApplicationAwareResourceQuota, _ metav1.UpdateOptions) (*v1alpha1.ApplicationAwareResourceQuota, error) {
+				Expect(updated.Status.Used.Name(corev1.ResourceRequestsMemory, resource.BinarySI).Equal(resource.MustParse("1Gi"))).To(BeTrue(), "used is %v", updated.Status.Used)
+				updated = updated.DeepCopy()
+				updated.ResourceVersion = "2"
+				return updated, nil
+			})
+		cli.EXPECT().ApplicationAwareResourceQuotas(arq.Namespace).Return(arqmock).Times(1)
+		qc := setupQuotaController(cli, testsutils.NewFakeSharedIndexInformer([]metav1.Object{released, gated}), nil, testsutils.FakeNamespaceLister{})
+		usage := corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("1Gi")}
+		qc.reservations.Reserve(released, usage)
+		qc.reservations.Reserve(gated, usage)
+
+		Expect(qc.syncResourceQuota(arq)).To(Succeed())
+		reserved, synced := qc.reservations.Reserved(arq_controller.ArqKey(arq), "2")
+		Expect(synced).To(BeTrue())
+		Expect(quota.Equals(reserved, usage)).To(BeTrue(), "reserved is %v", reserved)
+	})
+
+	Context("Test execute when", func() {
+		var ctrl *gomock.Controller
+		BeforeEach(func() {
+			ctrl = gomock.NewController(GinkgoT())
 		})
 		It("should forget the key if its namespace doesn't exist", func() {
 			cli := client.NewMockAAQClient(ctrl)
 			namespaceLister := testsutils.FakeNamespaceLister{Namespaces: map[string]*corev1.Namespace{}}
-			qc := setupQuotaController(cli, nil, nil, namespaceLister, nil)
+			qc := setupQuotaController(cli, nil, nil, namespaceLister)
 			err, es := qc.execute("testNs")
 			Expect(err).ToNot(HaveOccurred())
 			Expect(es).To(Equal(Forget))
@@ -650,7 +746,7 @@ var _ = Describe("Test arq-controller", func() {
 		expectedPriority bool) {
 		ctrl := gomock.NewController(GinkgoT())
 		cli := client.NewMockAAQClient(ctrl)
-		qc := setupQuotaController(cli, nil, nil, testsutils.FakeNamespaceLister{}, nil)
+		qc := setupQuotaController(cli, nil, nil, testsutils.FakeNamespaceLister{})
 		qc.addQuota(klog.FromContext(context.Background()), arq)
 		if expectedPriority {
 			Expect(qc.missingUsageQueue.Len()).To(Equal(1))
@@ -678,7 +774,7 @@ var _ = Describe("Test arq-controller", func() {
 			},
 		},
 		Status: v1alpha1.ApplicationAwareResourceQuotaStatus{
-			corev1.ResourceQuotaStatus{
+			ResourceQuotaStatus: corev1.ResourceQuotaStatus{
 				Hard: corev1.ResourceList{
 					corev1.ResourceCPU: resource.MustParse("4"),
 				},
@@ -694,7 +790,7 @@ var _ = Describe("Test arq-controller", func() {
 			},
 		},
 		Status: v1alpha1.ApplicationAwareResourceQuotaStatus{
-			corev1.ResourceQuotaStatus{
+			ResourceQuotaStatus: corev1.ResourceQuotaStatus{
 				Hard: corev1.ResourceList{
 					"requests.example/foobars.example.com": resource.MustParse("4"),
 				},
@@ -710,7 +806,7 @@ var _ = Describe("Test arq-controller", func() {
 			},
 		},
 		Status: v1alpha1.ApplicationAwareResourceQuotaStatus{
-			corev1.ResourceQuotaStatus{
+			ResourceQuotaStatus: corev1.ResourceQuotaStatus{
 				Hard: corev1.ResourceList{
 					corev1.ResourceCPU: resource.MustParse("6"),
 				},
@@ -729,7 +825,7 @@ var _ = Describe("Test arq-controller", func() {
 			},
 		},
 		Status: v1alpha1.ApplicationAwareResourceQuotaStatus{
-			corev1.ResourceQuotaStatus{
+			ResourceQuotaStatus: corev1.ResourceQuotaStatus{
 				Hard: corev1.ResourceList{
 					"foobars.example.com": resource.MustParse("4"),
 				},
@@ -745,7 +841,7 @@ var _ = Describe("Test arq-controller", func() {
 			},
 		},
 		Status: v1alpha1.ApplicationAwareResourceQuotaStatus{
-			corev1.ResourceQuotaStatus{
+			ResourceQuotaStatus: corev1.ResourceQuotaStatus{
 				Hard: corev1.ResourceList{
 					corev1.ResourceCPU: resource.MustParse("4"),
 				},
@@ -771,7 +867,7 @@ func (errorLister) ByNamespace(namespace string) cache.GenericNamespaceLister {
 	return errorLister{}
 }
 
-func setupQuotaController(clientSet client.AAQClient, podInformer cache.SharedIndexInformer, rqInformer cache.SharedIndexInformer, nsLister testsutils.FakeNamespaceLister, aaqjqcInformer cache.SharedIndexInformer) *ArqController {
+func setupQuotaController(clientSet client.AAQClient, podInformer cache.SharedIndexInformer, rqInformer cache.SharedIndexInformer, nsLister testsutils.FakeNamespaceLister) *ArqController {
 	informerFactory := externalversions.NewSharedInformerFactory(fake.NewSimpleClientset(), 0)
 	kubeInformerFactory := informers.NewSharedInformerFactory(k8sfake.NewSimpleClientset(), 0)
 	if podInformer == nil {
@@ -780,17 +876,16 @@ func setupQuotaController(clientSet client.AAQClient, podInformer cache.SharedIn
 	if rqInformer == nil {
 		rqInformer = kubeInformerFactory.Core().V1().ResourceQuotas().Informer()
 	}
-	if aaqjqcInformer == nil {
-		aaqjqcInformer = informerFactory.Aaq().V1alpha1().AAQJobQueueConfigs().Informer()
-	}
 	stop := make(chan struct{})
 	qc := NewArqController(clientSet,
 		podInformer,
 		informerFactory.Aaq().V1alpha1().ApplicationAwareResourceQuotas().Informer(),
 		rqInformer,
-		aaqjqcInformer,
 		aaq_evaluator.GetAaqEvaluatorsRegistry(),
+		arq_controller.NewReservationLedger(podInformer),
+		nil,
 		nsLister,
+		v1alpha1.EventCoalescingConfiguration{},
 		stop,
 	)
 	informerFactory.Start(stop)
@@ -0,0 +1,348 @@
+package arq_controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	v12 "k8s.io/client-go/listers/core/v1"
+	aaq_evaluator "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-evaluator"
+	"kubevirt.io/application-aware-quota/pkg/log"
+	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"sort"
+	"sync"
+)
+
+// usageLedger keeps the usage each pod is accounted with in the quotas of its namespace. Pod events only mark
+// the pods dirty, they are evaluated again and the difference is applied to the quotas on the next sync of
+// the namespace, so that a sync doesn't evaluate all the pods of the namespace
+type usageLedger struct {
+	lock       sync.Mutex
+	namespaces map[string]*namespaceLedger
+	podLister  v12.PodLister
+	evaluator  *aaq_evaluator.AaqEvaluator
+}
+
+type namespaceLedger struct {
+	// lock is held while pods are evaluated, the pod events only take dirtyLock
+	lock sync.Mutex
+	// loaded is set once all the pods of the namespace are evaluated
+	loaded bool
+	pods   map[string]*podUsage
+	// owners index the pods by the UID of their owners
+	owners map[types.UID]map[string]bool
+	// quotas are keyed by name
+	quotas map[string]*quotaUsage
+
+	dirtyLock sync.Mutex
+	// dirty are the names of the pods that changed since they were evaluated
+	dirty map[string]bool
+	// recompute requests to evaluate all the pods of the namespace again
+	recompute bool
+}
+
+// podUsage is the usage a pod is accounted with, gated pods aren't accounted
+type podUsage struct {
+	pod   *v1.Pod
+	usage v1.ResourceList
+	// err is set when a calculator with the FailClosed policy failed to evaluate the pod
+	err error
+}
+
+type quotaUsage struct {
+	scopes        []v1.ResourceQuotaScope
+	scopeSelector *v1.ScopeSelector
+	used          v1.ResourceList
+	// failed are the pods counted by the quota whose usage is unknown
+	failed map[string]error
+}
+
+func newUsageLedger(podLister v12.PodLister, evaluator *aaq_evaluator.AaqEvaluator) *usageLedger {
+	return &usageLedger{
+		namespaces: make(map[string]*namespaceLedger),
+		podLister:  podLister,
+		evaluator:  evaluator,
+	}
+}
+
+func (ul *usageLedger) namespace(namespace string) *namespaceLedger {
+	ul.lock.Lock()
+	defer ul.lock.Unlock()
+	nl, exists := ul.namespaces[namespace]
+	if !exists {
+		nl = &namespaceLedger{
+			pods:   make(map[string]*podUsage),
+			owners: make(map[types.UID]map[string]bool),
+			quotas: make(map[string]*quotaUsage),
+			dirty:  make(map[string]bool),
+		}
+		ul.namespaces[namespace] = nl
+	}
+	return nl
+}
+
+// podChanged marks the pod to be evaluated again, namespaces that aren't loaded yet evaluate all their pods anyway
+func (ul *usageLedger) podChanged(namespace, name string) {
+	ul.lock.Lock()
+	nl, exists := ul.namespaces[namespace]
+	ul.lock.Unlock()
+	if !exists {
+		return
+	}
+	nl.dirtyLock.Lock()
+	defer nl.dirtyLock.Unlock()
+	nl.dirty[name] = true
+}
+
+// recomputeAll requests to evaluate all the pods again on the next sync of their namespace, to correct the usages
+// that drifted from the pods, for example since a calculator depends on objects the ledger doesn't watch
+func (ul *usageLedger) recomputeAll() {
+	ul.lock.Lock()
+	defer ul.lock.Unlock()
+	for _, nl := range ul.namespaces {
+		nl.dirtyLock.Lock()
+		nl.recompute = true
+		nl.dirtyLock.Unlock()
+	}
+}
+
+func (ul *usageLedger) forgetNamespace(namespace string) {
+	ul.lock.Lock()
+	defer ul.lock.Unlock()
+	delete(ul.namespaces, namespace)
+}
+
+func (ul *usageLedger) forgetQuota(namespace, name string) {
+	ul.lock.Lock()
+	nl, exists := ul.namespaces[namespace]
+	ul.lock.Unlock()
+	if !exists {
+		return
+	}
+	nl.lock.Lock()
+	defer nl.lock.Unlock()
+	delete(nl.quotas, name)
+}
+
+// usage returns the usage of the pods counted by the quota, after applying the changes of the pods of its namespace.
+// It fails with the error of the first pod whose usage is unknown, the quota must then keep its last usage
+func (ul *usageLedger) usage(arq *v1alpha12.ApplicationAwareResourceQuota) (v1.ResourceList, error) {
+	nl := ul.namespace(arq.Namespace)
+	nl.lock.Lock()
+	defer nl.lock.Unlock()
+
+	nl.dirtyLock.Lock()
+	dirty := nl.dirty
+	recompute := nl.recompute || !nl.loaded
+	nl.dirty = make(map[string]bool)
+	nl.recompute = false
+	nl.dirtyLock.Unlock()
+
+	var err error
+	if recompute {
+		err = ul.recompute(arq.Namespace, nl)
+	} else {
+		// pods that failed are evaluated on every sync until they succeed, like with a full recalculation
+		for name, entry := range nl.pods {
+			if entry.err != nil {
+				dirty[name] = true
+			}
+		}
+		err = ul.update(arq.Namespace, nl, dirty)
+	}
+	if err != nil {
+		// the pods are evaluated again on the next sync
+		nl.dirtyLock.Lock()
+		nl.recompute = true
+		nl.dirtyLock.Unlock()
+		return nil, err
+	}
+
+	qu, exists := nl.quotas[arq.Name]
+	if !exists || !apiequality.Semantic.DeepEqual(qu.scopes, arq.Spec.Scopes) || !apiequality.Semantic.DeepEqual(qu.scopeSelector, arq.Spec.ScopeSelector) {
+		qu = nl.buildQuota(arq.Spec.Scopes, arq.Spec.ScopeSelector)
+		nl.quotas[arq.Name] = qu
+	}
+	if len(qu.failed) > 0 {
+		var failedPods []string
+		for name := range qu.failed {
+			failedPods = append(failedPods, name)
+		}
+		sort.Strings(failedPods)
+		return nil, qu.failed[failedPods[0]]
+	}
+	return quota.Add(v1.ResourceList{}, qu.used), nil
+}
+
+// recompute evaluates all the pods of the namespace, and reports the quotas whose usage drifted from their pods
+func (ul *usageLedger) recompute(namespace string, nl *namespaceLedger) error {
+	existingPods, err := ul.podLister.Pods(namespace).List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	previousQuotas := nl.quotas
+	wasLoaded := nl.loaded
+	nl.pods = make(map[string]*podUsage)
+	nl.owners = make(map[types.UID]map[string]bool)
+	nl.quotas = make(map[string]*quotaUsage)
+	// the cached usages may be the ones that drifted
+	ul.evaluate(nl, existingPods, existingPods, true)
+	nl.loaded = true
+
+	for name, previous := range previousQuotas {
+		qu := nl.buildQuota(previous.scopes, previous.scopeSelector)
+		nl.quotas[name] = qu
+		if wasLoaded && len(previous.failed) == 0 && len(qu.failed) == 0 && !sameUsage(previous.used, qu.used) {
+			log.Log.Infof("Usage ledger of quota %s/%s drifted from its pods, correcting %v to %v", namespace, name, previous.used, qu.used)
+		}
+	}
+	return nil
+}
+
+// update evaluates the dirty pods again along with the pods sharing an owner with them, since calculators like
+// the VM one compute the usage of a pod from the other pods of its owner
+func (ul *usageLedger) update(namespace string, nl *namespaceLedger, dirty map[string]bool) error {
+	if len(dirty) == 0 {
+		return nil
+	}
+	existingPods, err := ul.podLister.Pods(namespace).List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	current := make(map[string]*v1.Pod, len(existingPods))
+	for _, pod := range existingPods {
+		current[pod.Name] = pod
+	}
+	toEvaluate := make(map[string]bool)
+	for name := range dirty {
+		toEvaluate[name] = true
+		owners := ownerUIDs(current[name])
+		if entry, exists := nl.pods[name]; exists {
+			owners = append(owners, ownerUIDs(entry.pod)...)
+		}
+		for _, owner := range owners {
+			for sibling := range nl.owners[owner] {
+				toEvaluate[sibling] = true
+			}
+		}
+	}
+
+	var pods []*v1.Pod
+	for name := range toEvaluate {
+		if pod, exists := current[name]; exists {
+			pods = append(pods, pod)
+		} else {
+			nl.set(name, nil)
+		}
+	}
+	ul.evaluate(nl, pods, existingPods, false)
+	return nil
+}
+
+// evaluate accounts the pods with their current usage, gated pods don't use any. Recomputed pods aren't
+// accounted with their cached usages
+func (ul *usageLedger) evaluate(nl *namespaceLedger, pods []*v1.Pod, existingPods []*v1.Pod, recompute bool) {
+	var podsToEvaluate []*v1.Pod
+	for _, pod := range pods {
+		if len(pod.Spec.SchedulingGates) > 0 {
+			nl.set(pod.Name, nil)
+			continue
+		}
+		podsToEvaluate = append(podsToEvaluate, pod)
+	}
+	var usages []v1.ResourceList
+	var errs []error
+	if recompute {
+		usages, errs = ul.evaluator.RecomputePodsUsage(podsToEvaluate, existingPods)
+	} else {
+		usages, errs = ul.evaluator.PodsUsage(podsToEvaluate, existingPods)
+	}
+	for i, pod := range podsToEvaluate {
+		nl.set(pod.Name, &podUsage{pod: pod, usage: usages[i], err: errs[i]})
+	}
+}
+
+// set replaces the usage the pod is accounted with in the quotas, a nil entry removes the pod
+func (nl *namespaceLedger) set(name string, entry *podUsage) {
+	previous := nl.pods[name]
+	for _, qu := range nl.quotas {
+		if previous != nil && qu.counts(previous.pod) {
+			qu.remove(name, previous)
+		}
+		if entry != nil && qu.counts(entry.pod) {
+			qu.add(name, entry)
+		}
+	}
+	if previous != nil {
+		for _, owner := range ownerUIDs(previous.pod) {
+			delete(nl.owners[owner], name)
+			if len(nl.owners[owner]) == 0 {
+				delete(nl.owners, owner)
+			}
+		}
+	}
+	if entry == nil {
+		delete(nl.pods, name)
+		return
+	}
+	nl.pods[name] = entry
+	for _, owner := range ownerUIDs(entry.pod) {
+		if nl.owners[owner] == nil {
+			nl.owners[owner] = make(map[string]bool)
+		}
+		nl.owners[owner][name] = true
+	}
+}
+
+func (nl *namespaceLedger) buildQuota(scopes []v1.ResourceQuotaScope, scopeSelector *v1.ScopeSelector) *quotaUsage {
+	qu := &quotaUsage{
+		scopes:        scopes,
+		scopeSelector: scopeSelector,
+		used:          v1.ResourceList{},
+		failed:        make(map[string]error),
+	}
+	for name, entry := range nl.pods {
+		if qu.counts(entry.pod) {
+			qu.add(name, entry)
+		}
+	}
+	return qu
+}
+
+func (qu *quotaUsage) counts(pod *v1.Pod) bool {
+	matches, err := aaq_evaluator.PodMatchesScopes(pod, qu.scopes, qu.scopeSelector)
+	return err == nil && matches
+}
+
+func (qu *quotaUsage) add(name string, entry *podUsage) {
+	if entry.err != nil {
+		qu.failed[name] = entry.err
+		return
+	}
+	qu.used = quota.Add(qu.used, entry.usage)
+}
+
+func (qu *quotaUsage) remove(name string, entry *podUsage) {
+	if entry.err != nil {
+		delete(qu.failed, name)
+		return
+	}
+	qu.used = quota.Subtract(qu.used, entry.usage)
+}
+
+func ownerUIDs(pod *v1.Pod) []types.UID {
+	if pod == nil {
+		return nil
+	}
+	var uids []types.UID
+	for _, ownerReference := range pod.OwnerReferences {
+		uids = append(uids, ownerReference.UID)
+	}
+	return uids
+}
+
+// sameUsage compares usages ignoring the resources that are zero in one of them and missing in the other
+func sameUsage(a, b v1.ResourceList) bool {
+	return quota.IsZero(quota.SubtractWithNonNegativeResult(a, b)) && quota.IsZero(quota.SubtractWithNonNegativeResult(b, a))
+}
@@ -0,0 +1,168 @@
+package arq_controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	v12 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	testingclock "k8s.io/utils/clock/testing"
+	aaq_evaluator "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-evaluator"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"time"
+)
+
+// ledgerRegistry computes the usage of each pod from its memory annotation and records the pods it evaluated
+type ledgerRegistry struct {
+	evaluated []string
+	// recomputed are the pods evaluated without their cached usages
+	recomputed []string
+	// failing pods fail with the FailClosed policy
+	failing map[string]bool
+}
+
+func (lr *ledgerRegistry) Add(_ aaq_evaluator.AaqCalculator) {}
+
+func (lr *ledgerRegistry) Usage(pod *corev1.Pod, _ []*corev1.Pod) (corev1.ResourceList, error) {
+	lr.evaluated = append(lr.evaluated, pod.Name)
+	if lr.failing[pod.Name] {
+		return nil, &aaq_evaluator.CalculatorFailedError{Calculator: "test", Pod: pod.Namespace + "/" + pod.Name, Err: "unavailable"}
+	}
+	return corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse(pod.Annotations["memory"])}, nil
+}
+
+func (lr *ledgerRegistry) UsageBreakdown(pod *corev1.Pod, existingPods []*corev1.Pod) (corev1.ResourceList, []aaq_evaluator.CalculatorUsage, error) {
+	rl, err := lr.Usage(pod, existingPods)
+	return rl, nil, err
+}
+
+func (lr *ledgerRegistry) UsageBatch(pods []*corev1.Pod, existingPods []*corev1.Pod) ([]corev1.ResourceList, []error) {
+	usages := make([]corev1.ResourceList, len(pods))
+	errs := make([]error, len(pods))
+	for i, pod := range pods {
+		usages[i], errs[i] = lr.Usage(pod, existingPods)
+	}
+	return usages, errs
+}
+
+func (lr *ledgerRegistry) RecomputeUsageBatch(pods []*corev1.Pod, existingPods []*corev1.Pod) ([]corev1.ResourceList, []error) {
+	for _, pod := range pods {
+		lr.recomputed = append(lr.recomputed, pod.Name)
+	}
+	return lr.UsageBatch(pods, existingPods)
+}
+
+var _ = Describe("Usage ledger", func() {
+	var indexer cache.Indexer
+	var registry *ledgerRegistry
+	var ledger *usageLedger
+	var arq *v1alpha1.ApplicationAwareResourceQuota
+
+	newPod := func(name, memory string, owner string) *corev1.Pod {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "test",
+			Annotations: map[string]string{"memory": memory},
+		}}
+		if owner != "" {
+			pod.OwnerReferences = []metav1.OwnerReference{{Name: owner, UID: types.UID("uid-" + owner)}}
+		}
+		return pod
+	}
+
+	updatePod := func(pod *corev1.Pod) {
+		ExpectWithOffset(1, indexer.Update(pod)).To(Succeed())
+		ledger.podChanged(pod.Namespace, pod.Name)
+	}
+
+	expectUsage := func(memory string, evaluated ...string) {
+		registry.evaluated = nil
+		used, err := ledger.usage(arq)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		expected := corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse(memory)}
+		ExpectWithOffset(1, quota.Equals(quota.RemoveZeros(used), quota.RemoveZeros(expected))).To(BeTrue(), "usage is %v", used)
+		ExpectWithOffset(1, registry.evaluated).To(ConsistOf(evaluated))
+	}
+
+	BeforeEach(func() {
+		indexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		for _, pod := range []*corev1.Pod{newPod("a", "1Gi", ""), newPod("b", "1Gi", "vm"), newPod("c", "1Gi", "vm")} {
+			Expect(indexer.Add(pod)).To(Succeed())
+		}
+		registry = &ledgerRegistry{failing: make(map[string]bool)}
+		ledger = newUsageLedger(v12.NewPodLister(indexer), aaq_evaluator.NewAaqEvaluator(v12.NewPodLister(indexer), registry, testingclock.NewFakeClock(time.Now())))
+		arq = &v1alpha1.ApplicationAwareResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: "arq", Namespace: "test"}}
+	})
+
+	It("should only evaluate the pods that changed and the pods sharing an owner with them", func() {
+		expectUsage("3Gi", "a", "b", "c")
+		expectUsage("3Gi")
+
+		updatePod(newPod("a", "2Gi", ""))
+		expectUsage("4Gi", "a")
+		updatePod(newPod("b", "3Gi", "vm"))
+		expectUsage("6Gi", "b", "c")
+	})
+
+	It("should remove the pods that were deleted or gated", func() {
+		expectUsage("3Gi", "a", "b", "c")
+
+		Expect(indexer.Delete(newPod("a", "1Gi", ""))).To(Succeed())
+		ledger.podChanged("test", "a")
+		expectUsage("2Gi")
+
+		gated := newPod("b", "1Gi", "vm")
+		gated.Spec.SchedulingGates = []corev1.PodSchedulingGate{{Name: "test"}}
+		updatePod(gated)
+		expectUsage("1Gi", "c")
+	})
+
+	It("should count the pods again when the scopes of the quota change", func() {
+		pod := newPod("a", "1Gi", "")
+		pod.Spec.PriorityClassName = "high"
+		updatePod(pod)
+		expectUsage("3Gi", "a", "b", "c")
+
+		arq.Spec.ScopeSelector = &corev1.ScopeSelector{MatchExpressions: []corev1.ScopedResourceSelectorRequirement{{
+			ScopeName: corev1.ResourceQuotaScopePriorityClass,
+			Operator:  corev1.ScopeSelectorOpIn,
+			Values:    []string{"high"},
+		}}}
+		expectUsage("1Gi")
+		arq.Spec.ScopeSelector = nil
+		expectUsage("3Gi")
+	})
+
+	It("should correct the usages that drifted on a full recalculation", func() {
+		expectUsage("3Gi", "a", "b", "c")
+
+		Expect(indexer.Update(newPod("a", "5Gi", ""))).To(Succeed())
+		expectUsage("3Gi")
+		updatePod(newPod("b", "1Gi", "vm"))
+		registry.recomputed = nil
+		expectUsage("3Gi", "b", "c")
+		Expect(registry.recomputed).To(BeEmpty())
+		ledger.recomputeAll()
+		expectUsage("7Gi", "a", "b", "c")
+		Expect(registry.recomputed).To(ConsistOf("a", "b", "c"))
+	})
+
+	It("should keep failing while a pod can't be evaluated", func() {
+		registry.failing["a"] = true
+		_, err := ledger.usage(arq)
+		_, failedClosed := aaq_evaluator.AsCalculatorFailedError(err)
+		Expect(failedClosed).To(BeTrue(), "error is %v", err)
+
+		registry.evaluated = nil
+		_, err = ledger.usage(arq)
+		Expect(err).To(HaveOccurred())
+		Expect(registry.evaluated).To(Equal([]string{"a"}))
+
+		registry.failing["a"] = false
+		expectUsage("3Gi", "a")
+	})
+})
@@ -0,0 +1,139 @@
+package audit
+
+import (
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	aaq_evaluator "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-evaluator"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/metrics"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// Released is the decision recorded for pods that fit in all their quotas
+	Released Decision = "Released"
+	// Gated is the decision recorded for pods that stay gated
+	Gated Decision = "Gated"
+	// ReleaseFailed is the decision recorded for pods that fit in all their quotas but whose gate failed to be removed,
+	// they are evaluated again
+	ReleaseFailed Decision = "ReleaseFailed"
+)
+
+type Decision string
+
+// Record describes a single gate decision and what it was based on
+type Record struct {
+	Time      metav1.Time `json:"time"`
+	Namespace string      `json:"namespace"`
+	Pod       string      `json:"pod"`
+	PodUID    types.UID   `json:"podUID"`
+	Decision  Decision    `json:"decision"`
+	// Reason the pod stays gated
+	Reason string `json:"reason,omitempty"`
+	// Message explains why the pod stays gated, or why its release failed
+	Message string `json:"message,omitempty"`
+	// Usage is the usage the pod consumes once released
+	Usage v1.ResourceList `json:"usage,omitempty"`
+	// Calculators holds the usage each calculator computed for the pod
+	Calculators []aaq_evaluator.CalculatorUsage `json:"calculators,omitempty"`
+	// Quotas the pod was checked against, as they were when the decision was made
+	Quotas []QuotaRecord `json:"quotas,omitempty"`
+}
+
+type QuotaRecord struct {
+	Kind string          `json:"kind"`
+	Name string          `json:"name"`
+	Hard v1.ResourceList `json:"hard,omitempty"`
+	Used v1.ResourceList `json:"used,omitempty"`
+}
+
+// Sink persists the audit records
+type Sink interface {
+	Write(record *Record) error
+	Close() error
+}
+
+// Logger writes a sample of the gate decisions to a sink.
+// A nil Logger records nothing
+type Logger struct {
+	sink               Sink
+	samplingPercentage int32
+	randLock           sync.Mutex
+	rand               *rand.Rand
+}
+
+// NewLogger returns a logger for the configuration, or nil if no sink is configured
+func NewLogger(config v1alpha12.AuditLogConfiguration) (*Logger, error) {
+	var sink Sink
+	var err error
+	switch config.Sink {
+	case "":
+		return nil, nil
+	case v1alpha12.AuditLogStdout:
+		sink = NewStdoutSink()
+	case v1alpha12.AuditLogFile:
+		path := config.Path
+		if path == "" {
+			path = util.DefaultAuditLogPath
+		}
+		retention := util.DefaultAuditLogRetention
+		if config.Retention != nil {
+			retention = config.Retention.Duration
+		}
+		sink, err = NewFileSink(path, retention)
+	case v1alpha12.AuditLogHTTP:
+		sink, err = NewHTTPSink(config.URL)
+	default:
+		return nil, fmt.Errorf("unknown audit log sink %v", config.Sink)
+	}
+	if err != nil {
+		return nil, err
+	}
+	samplingPercentage := int32(100)
+	if config.SamplingPercentage != nil {
+		samplingPercentage = *config.SamplingPercentage
+	}
+	return NewLoggerWithSink(sink, samplingPercentage), nil
+}
+
+func NewLoggerWithSink(sink Sink, samplingPercentage int32) *Logger {
+	return &Logger{
+		sink:               sink,
+		samplingPercentage: samplingPercentage,
+		rand:               rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Log writes the record if it is sampled. Failures are logged and counted, they don't affect the gate decision
+func (l *Logger) Log(record *Record) {
+	if l == nil || !l.sampled() {
+		return
+	}
+	if err := l.sink.Write(record); err != nil {
+		metrics.AddAuditRecordsDropped(1)
+		klog.Errorf("Failed to write audit record of pod %v/%v: %v", record.Namespace, record.Pod, err)
+	}
+}
+
+func (l *Logger) sampled() bool {
+	if l.samplingPercentage >= 100 {
+		return true
+	}
+	l.randLock.Lock()
+	defer l.randLock.Unlock()
+	return l.rand.Int31n(100) < l.samplingPercentage
+}
+
+// Close flushes the pending records
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.sink.Close()
+}
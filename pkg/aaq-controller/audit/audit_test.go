@@ -0,0 +1,202 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	aaq_evaluator "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-evaluator"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/metrics"
+	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// fakeSink keeps the records it is given
+type fakeSink struct {
+	records []*Record
+}
+
+func (fs *fakeSink) Write(record *Record) error {
+	fs.records = append(fs.records, record)
+	return nil
+}
+
+func (fs *fakeSink) Close() error {
+	return nil
+}
+
+func readRecords(data []byte) []*Record {
+	var records []*Record
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		record := &Record{}
+		Expect(json.Unmarshal(scanner.Bytes(), record)).To(Succeed())
+		records = append(records, record)
+	}
+	return records
+}
+
+var _ = Describe("Audit log", func() {
+	newRecord := func(pod string) *Record {
+		return &Record{
+			Time:      metav1.NewTime(time.Now().Truncate(time.Second)),
+			Namespace: "test",
+			Pod:       pod,
+			Decision:  Gated,
+			Reason:    "ExceedsQuota",
+			Usage:     v1.ResourceList{v1.ResourceRequestsMemory: resource.MustParse("1Gi")},
+			Calculators: []aaq_evaluator.CalculatorUsage{
+				{Calculator: "sidecar/calc", Usage: v1.ResourceList{v1.ResourceRequestsMemory: resource.MustParse("1Gi")}, Match: true},
+			},
+			Quotas: []QuotaRecord{{
+				Kind: "ApplicationAwareResourceQuota",
+				Name: "arq",
+				Hard: v1.ResourceList{v1.ResourceRequestsMemory: resource.MustParse("1Gi")},
+				Used: v1.ResourceList{v1.ResourceRequestsMemory: resource.MustParse("512Mi")},
+			}},
+		}
+	}
+
+	It("NewLogger should not record anything when no sink is configured", func() {
+		logger, err := NewLogger(v1alpha12.AuditLogConfiguration{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(logger).To(BeNil())
+		logger.Log(newRecord("pod"))
+		Expect(logger.Close()).To(Succeed())
+	})
+
+	It("NewLogger should reject an HTTP sink without a valid url", func() {
+		_, err := NewLogger(v1alpha12.AuditLogConfiguration{Sink: v1alpha12.AuditLogHTTP, URL: "not a url"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	DescribeTable("Log should record a sample of the decisions", func(samplingPercentage int32, minRecords, maxRecords int) {
+		sink := &fakeSink{}
+		logger := NewLoggerWithSink(sink, samplingPercentage)
+		for i := 0; i < 1000; i++ {
+			logger.Log(newRecord("pod"))
+		}
+		Expect(len(sink.records)).To(BeNumerically(">=", minRecords))
+		Expect(len(sink.records)).To(BeNumerically("<=", maxRecords))
+	},
+		Entry("all of them by default", int32(100), 1000, 1000),
+		Entry("none of them", int32(0), 0, 0),
+		Entry("about half of them", int32(50), 350, 650),
+	)
+
+	It("stdout sink should write each record as a JSON line", func() {
+		out := &bytes.Buffer{}
+		sink := &writerSink{writer: out}
+		Expect(sink.Write(newRecord("pod1"))).To(Succeed())
+		Expect(sink.Write(newRecord("pod2"))).To(Succeed())
+		records := readRecords(out.Bytes())
+		Expect(records).To(HaveLen(2))
+		Expect(records[0]).To(Equal(newRecord("pod1")))
+		Expect(records[1].Pod).To(Equal("pod2"))
+	})
+
+	It("file sink should rotate the records once every retention period", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "audit", "audit.log")
+		now := time.Now()
+		sink, err := NewFileSink(path, time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		fs := sink.(*fileSink)
+		fs.now = func() time.Time { return now }
+		fs.openedAt = now
+
+		Expect(sink.Write(newRecord("old"))).To(Succeed())
+		now = now.Add(time.Hour)
+		Expect(sink.Write(newRecord("new"))).To(Succeed())
+		Expect(sink.Close()).To(Succeed())
+
+		data, err := os.ReadFile(path + ".1")
+		Expect(err).ToNot(HaveOccurred())
+		rotated := readRecords(data)
+		Expect(rotated).To(HaveLen(1))
+		Expect(rotated[0].Pod).To(Equal("old"))
+		data, err = os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		current := readRecords(data)
+		Expect(current).To(HaveLen(1))
+		Expect(current[0].Pod).To(Equal("new"))
+	})
+
+	It("HTTP sink should post the records as JSON lines", func() {
+		var lock sync.Mutex
+		var received []*Record
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Method).To(Equal(http.MethodPost))
+			Expect(r.Header.Get("Content-Type")).To(Equal("application/x-ndjson"))
+			body := &bytes.Buffer{}
+			_, err := body.ReadFrom(r.Body)
+			Expect(err).ToNot(HaveOccurred())
+			lock.Lock()
+			received = append(received, readRecords(body.Bytes())...)
+			lock.Unlock()
+		}))
+		defer server.Close()
+
+		sink, err := NewHTTPSink(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sink.Write(newRecord("pod1"))).To(Succeed())
+		Expect(sink.Write(newRecord("pod2"))).To(Succeed())
+		Expect(sink.Close()).To(Succeed())
+
+		lock.Lock()
+		defer lock.Unlock()
+		Expect(received).To(HaveLen(2))
+		Expect(received[0]).To(Equal(newRecord("pod1")))
+	})
+	It("HTTP sink should retry failed posts and count the records it drops", func() {
+		droppedRecords := func() float64 {
+			families, err := metrics.Registry.Gather()
+			Expect(err).ToNot(HaveOccurred())
+			for _, family := range families {
+				if family.GetName() == "aaq_audit_records_dropped_total" {
+					return family.Metric[0].GetCounter().GetValue()
+				}
+			}
+			return 0
+		}
+		var lock sync.Mutex
+		posts := 0
+		failing := false
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			defer lock.Unlock()
+			posts++
+			// the first post fails and is retried
+			if failing || posts == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer server.Close()
+
+		sink, err := newHTTPSink(server.URL, time.Millisecond)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sink.Write(newRecord("pod1"))).To(Succeed())
+		Expect(sink.Close()).To(Succeed())
+		lock.Lock()
+		Expect(posts).To(Equal(2))
+		failing = true
+		lock.Unlock()
+
+		dropped := droppedRecords()
+		sink, err = newHTTPSink(server.URL, time.Millisecond)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sink.Write(newRecord("pod1"))).To(Succeed())
+		Expect(sink.Write(newRecord("pod2"))).To(Succeed())
+		Expect(sink.Close()).To(Succeed())
+		Expect(droppedRecords()).To(Equal(dropped + 2))
+	})
+})
@@ -0,0 +1,227 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"k8s.io/klog/v2"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/metrics"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	httpSinkBufferSize = 1000
+	httpSinkBatchSize  = 100
+	httpSinkFlushEvery = time.Second
+	// httpSinkPostAttempts is how many times a batch is posted before its records are dropped
+	httpSinkPostAttempts = 3
+	httpSinkRetryBackoff = time.Second
+)
+
+// writerSink writes each record as a JSON line
+type writerSink struct {
+	lock   sync.Mutex
+	writer io.Writer
+}
+
+func NewStdoutSink() Sink {
+	return &writerSink{writer: os.Stdout}
+}
+
+func (ws *writerSink) Write(record *Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	_, err = ws.writer.Write(append(line, '\n'))
+	return err
+}
+
+func (ws *writerSink) Close() error {
+	return nil
+}
+
+// fileSink appends the records to a file that is rotated once every retention period.
+// Only the previous file is kept, so records are removed between one and two retention periods after they are written.
+// The operator mounts an EmptyDir at the directory of the file, the records are lost with the controller pod
+type fileSink struct {
+	lock      sync.Mutex
+	path      string
+	retention time.Duration
+	file      *os.File
+	openedAt  time.Time
+	now       func() time.Time
+}
+
+func NewFileSink(path string, retention time.Duration) (Sink, error) {
+	fs := &fileSink{path: path, retention: retention, now: time.Now}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := fs.open(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (fs *fileSink) open() error {
+	file, err := os.OpenFile(fs.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	fs.file = file
+	fs.openedAt = fs.now()
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		fs.openedAt = info.ModTime() // the file was written before a restart, rotate it no later than it would have been
+	}
+	return nil
+}
+
+func (fs *fileSink) rotate() error {
+	if err := fs.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(fs.path, fs.path+".1"); err != nil {
+		return err
+	}
+	return fs.open()
+}
+
+func (fs *fileSink) Write(record *Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	if fs.retention > 0 && fs.now().Sub(fs.openedAt) >= fs.retention {
+		if err := fs.rotate(); err != nil {
+			return err
+		}
+	}
+	_, err = fs.file.Write(append(line, '\n'))
+	return err
+}
+
+func (fs *fileSink) Close() error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	return fs.file.Close()
+}
+
+// httpSink posts the records in batches of JSON lines, so a slow endpoint doesn't hold the gate controller.
+// Failed posts are retried with a backoff, records are dropped and counted when the endpoint can't keep up
+// or keeps failing
+type httpSink struct {
+	url          string
+	client       *http.Client
+	records      chan *Record
+	done         chan struct{}
+	retryBackoff time.Duration
+}
+
+func NewHTTPSink(endpoint string) (Sink, error) {
+	return newHTTPSink(endpoint, httpSinkRetryBackoff)
+}
+
+func newHTTPSink(endpoint string, retryBackoff time.Duration) (Sink, error) {
+	if _, err := url.ParseRequestURI(endpoint); err != nil {
+		return nil, fmt.Errorf("invalid audit log url %q: %v", endpoint, err)
+	}
+	hs := &httpSink{
+		url:          endpoint,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		records:      make(chan *Record, httpSinkBufferSize),
+		done:         make(chan struct{}),
+		retryBackoff: retryBackoff,
+	}
+	go hs.run()
+	return hs, nil
+}
+
+func (hs *httpSink) Write(record *Record) error {
+	select {
+	case hs.records <- record:
+		return nil
+	default:
+		return fmt.Errorf("audit log buffer is full, dropping record")
+	}
+}
+
+func (hs *httpSink) run() {
+	defer close(hs.done)
+	ticker := time.NewTicker(httpSinkFlushEvery)
+	defer ticker.Stop()
+	var batch []*Record
+	for {
+		select {
+		case record, ok := <-hs.records:
+			if !ok {
+				hs.flush(batch)
+				return
+			}
+			batch = append(batch, record)
+			if len(batch) >= httpSinkBatchSize {
+				hs.flush(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			hs.flush(batch)
+			batch = nil
+		}
+	}
+}
+
+func (hs *httpSink) flush(batch []*Record) {
+	if len(batch) == 0 {
+		return
+	}
+	body := &bytes.Buffer{}
+	encoder := json.NewEncoder(body)
+	for _, record := range batch {
+		if err := encoder.Encode(record); err != nil {
+			metrics.AddAuditRecordsDropped(1)
+			klog.Errorf("Failed to encode audit record of pod %v/%v: %v", record.Namespace, record.Pod, err)
+		}
+	}
+	backoff := hs.retryBackoff
+	var err error
+	for attempt := 1; attempt <= httpSinkPostAttempts; attempt++ {
+		if err = hs.post(body.Bytes()); err == nil {
+			return
+		}
+		if attempt < httpSinkPostAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	metrics.AddAuditRecordsDropped(len(batch))
+	klog.Errorf("Dropping %v audit records after %v failed posts: %v", len(batch), httpSinkPostAttempts, err)
+}
+
+func (hs *httpSink) post(body []byte) error {
+	resp, err := hs.client.Post(hs.url, "application/x-ndjson", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%v", resp.Status)
+	}
+	return nil
+}
+
+// Close posts the buffered records
+func (hs *httpSink) Close() error {
+	close(hs.records)
+	<-hs.done
+	return nil
+}
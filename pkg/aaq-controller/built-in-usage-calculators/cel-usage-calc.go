@@ -0,0 +1,186 @@
+package built_in_usage_calculators
+
+import (
+	"fmt"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	apiservercel "k8s.io/apiserver/pkg/cel"
+	"k8s.io/apiserver/pkg/cel/library"
+	v12 "k8s.io/apiserver/pkg/quota/v1"
+	"k8s.io/kubernetes/pkg/quota/v1/evaluator/core"
+	"k8s.io/utils/clock"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+)
+
+const (
+	celPodVariable          = "pod"
+	celDefaultUsageVariable = "defaultUsage"
+	// celCostLimit bounds the cost of a single evaluation so a costly expression can't hold evaluations
+	celCostLimit = 1000000
+)
+
+// CELCalculator evaluates the pods matched by a CEL expression with another CEL expression
+type CELCalculator struct {
+	name         string
+	match        cel.Program
+	usage        cel.Program
+	podEvaluator v12.Evaluator
+}
+
+// NewCELCalculator compiles the expressions of the calculator
+func NewCELCalculator(calculator v1alpha1.CELCalculator) (*CELCalculator, error) {
+	match, usage, err := compileCELCalculator(calculator)
+	if err != nil {
+		return nil, err
+	}
+	return &CELCalculator{
+		name:         calculator.Name,
+		match:        match,
+		usage:        usage,
+		podEvaluator: core.NewPodEvaluator(nil, clock.RealClock{}),
+	}, nil
+}
+
+// NewCELCalculators compiles the calculators, skipping the invalid ones and the ones whose name was already listed.
+// The calculators that compiled are returned along with the errors of the skipped ones
+func NewCELCalculators(calculators []v1alpha1.CELCalculator) ([]*CELCalculator, error) {
+	names := make(map[string]bool)
+	var celCalculators []*CELCalculator
+	var errs []error
+	for _, calculator := range calculators {
+		if names[calculator.Name] {
+			errs = append(errs, fmt.Errorf("CEL calculator %s is listed more than once", calculator.Name))
+			continue
+		}
+		names[calculator.Name] = true
+		celCalculator, err := NewCELCalculator(calculator)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		celCalculators = append(celCalculators, celCalculator)
+	}
+	return celCalculators, utilerrors.NewAggregate(errs)
+}
+
+// ValidateCELCalculators returns an error if any of the calculators doesn't compile or they don't have unique names
+func ValidateCELCalculators(calculators []v1alpha1.CELCalculator) error {
+	_, err := NewCELCalculators(calculators)
+	return err
+}
+
+func newCELEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable(celPodVariable, cel.DynType),
+		cel.Variable(celDefaultUsageVariable, cel.MapType(cel.StringType, apiservercel.QuantityType)),
+		library.Quantity(),
+	)
+}
+
+func compileCELCalculator(calculator v1alpha1.CELCalculator) (cel.Program, cel.Program, error) {
+	if calculator.Name == "" {
+		return nil, nil, fmt.Errorf("CEL calculator has no name")
+	}
+	env, err := newCELEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+	match, err := compileCELExpression(env, calculator.Match, func(t *cel.Type) bool {
+		return t.IsExactType(cel.BoolType) || t.IsExactType(cel.DynType)
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid match expression of CEL calculator %s: %v", calculator.Name, err)
+	}
+	usage, err := compileCELExpression(env, calculator.Usage, func(t *cel.Type) bool {
+		return t.Kind() == types.MapKind || t.IsExactType(cel.DynType)
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid usage expression of CEL calculator %s: %v", calculator.Name, err)
+	}
+	return match, usage, nil
+}
+
+func compileCELExpression(env *cel.Env, expression string, validOutput func(*cel.Type) bool) (cel.Program, error) {
+	if expression == "" {
+		return nil, fmt.Errorf("expression is empty")
+	}
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if !validOutput(ast.OutputType()) {
+		return nil, fmt.Errorf("expression returns %v", ast.OutputType())
+	}
+	return env.Program(ast, cel.CostLimit(celCostLimit))
+}
+
+func (celcalc *CELCalculator) Name() string {
+	return "cel/" + celcalc.name
+}
+
+func (celcalc *CELCalculator) PodUsageFunc(pod *corev1.Pod, _ []*corev1.Pod) (corev1.ResourceList, error, bool) {
+	podData, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pod)
+	if err != nil {
+		return nil, err, false
+	}
+	matched, _, err := celcalc.match.Eval(map[string]interface{}{celPodVariable: podData})
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate the match expression: %v", err), false
+	}
+	if matched != types.True {
+		return nil, nil, false
+	}
+
+	defaultUsage, err := celcalc.podEvaluator.Usage(pod)
+	if err != nil {
+		return nil, err, true
+	}
+	defaultUsageData := make(map[string]ref.Val, len(defaultUsage))
+	for name, quantity := range defaultUsage {
+		q := quantity.DeepCopy()
+		defaultUsageData[string(name)] = apiservercel.Quantity{Quantity: &q}
+	}
+	usage, _, err := celcalc.usage.Eval(map[string]interface{}{celPodVariable: podData, celDefaultUsageVariable: defaultUsageData})
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate the usage expression: %v", err), true
+	}
+	rl, err := toResourceList(usage)
+	return rl, err, true
+}
+
+// toResourceList converts the result of a usage expression, a map of resource names to quantities
+func toResourceList(usage ref.Val) (corev1.ResourceList, error) {
+	usageMap, ok := usage.(traits.Mapper)
+	if !ok {
+		return nil, fmt.Errorf("usage expression returned %v rather than a map of resource names to quantities", usage.Type())
+	}
+	rl := corev1.ResourceList{}
+	for it := usageMap.Iterator(); it.HasNext() == types.True; {
+		key := it.Next()
+		name, ok := key.(types.String)
+		if !ok {
+			return nil, fmt.Errorf("usage expression returned a %v resource name", key.Type())
+		}
+		switch v := usageMap.Get(key).(type) {
+		case apiservercel.Quantity:
+			rl[corev1.ResourceName(name)] = v.Quantity.DeepCopy()
+		case types.String:
+			quantity, err := resource.ParseQuantity(string(v))
+			if err != nil {
+				return nil, fmt.Errorf("usage of %s: %v", name, err)
+			}
+			rl[corev1.ResourceName(name)] = quantity
+		case types.Int:
+			rl[corev1.ResourceName(name)] = *resource.NewQuantity(int64(v), resource.DecimalSI)
+		default:
+			return nil, fmt.Errorf("usage of %s is a %v rather than a quantity", name, v.Type())
+		}
+	}
+	return rl, nil
+}
@@ -0,0 +1,80 @@
+package built_in_usage_calculators
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("Test CEL calculator", func() {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "test", Labels: map[string]string{"app": "db"}},
+		Spec: v1.PodSpec{Containers: []v1.Container{{
+			Name:      "ctr",
+			Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceMemory: resource.MustParse("1Gi")}},
+		}}},
+	}
+	const matchDB = "has(pod.metadata.labels) && pod.metadata.labels['app'] == 'db'"
+
+	DescribeTable("should calculate the usage of matching pods", func(usage string, expectedUsage v1.ResourceList) {
+		calculator, err := NewCELCalculator(v1alpha1.CELCalculator{Name: "db", Match: matchDB, Usage: usage})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(calculator.Name()).To(Equal("cel/db"))
+		rl, err, match := calculator.PodUsageFunc(pod, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(match).To(BeTrue())
+		Expect(quota.Equals(rl, expectedUsage)).To(BeTrue(), "usage is %v", rl)
+	},
+		Entry("doubling the default memory usage",
+			"{'requests.memory': quantity(string(defaultUsage['requests.memory'].asInteger() * 2))}",
+			v1.ResourceList{v1.ResourceRequestsMemory: resource.MustParse("2Gi")}),
+		Entry("with quantities as strings and integers",
+			"{'requests.memory': '512Mi', 'pods': 1}",
+			v1.ResourceList{v1.ResourceRequestsMemory: resource.MustParse("512Mi"), v1.ResourcePods: resource.MustParse("1")}),
+	)
+
+	It("should not match pods the match expression is false for", func() {
+		calculator, err := NewCELCalculator(v1alpha1.CELCalculator{Name: "web", Match: "has(pod.metadata.labels) && pod.metadata.labels['app'] == 'web'", Usage: "defaultUsage"})
+		Expect(err).ToNot(HaveOccurred())
+		rl, err, match := calculator.PodUsageFunc(pod, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(match).To(BeFalse())
+		Expect(rl).To(BeNil())
+	})
+
+	It("should fail to evaluate usages that aren't quantities", func() {
+		calculator, err := NewCELCalculator(v1alpha1.CELCalculator{Name: "db", Match: matchDB, Usage: "{'requests.memory': 'a lot'}"})
+		Expect(err).ToNot(HaveOccurred())
+		_, err, match := calculator.PodUsageFunc(pod, nil)
+		Expect(err).To(HaveOccurred())
+		Expect(match).To(BeTrue())
+	})
+
+	DescribeTable("should reject invalid calculators", func(calculators []v1alpha1.CELCalculator) {
+		Expect(ValidateCELCalculators(calculators)).ToNot(Succeed())
+	},
+		Entry("without a name", []v1alpha1.CELCalculator{{Match: "true", Usage: "defaultUsage"}}),
+		Entry("without a match expression", []v1alpha1.CELCalculator{{Name: "db", Usage: "defaultUsage"}}),
+		Entry("with a usage expression that doesn't compile", []v1alpha1.CELCalculator{{Name: "db", Match: "true", Usage: "defaultUsage["}}),
+		Entry("with a usage expression that doesn't return a map", []v1alpha1.CELCalculator{{Name: "db", Match: "true", Usage: "'1Gi'"}}),
+		Entry("with the same name", []v1alpha1.CELCalculator{
+			{Name: "db", Match: "true", Usage: "defaultUsage"},
+			{Name: "db", Match: "true", Usage: "defaultUsage"},
+		}),
+	)
+	It("should skip the invalid calculators and keep the valid ones", func() {
+		calculators, err := NewCELCalculators([]v1alpha1.CELCalculator{
+			{Name: "db", Match: matchDB, Usage: "defaultUsage"},
+			{Name: "broken", Match: "true", Usage: "defaultUsage["},
+			{Name: "db", Match: "true", Usage: "defaultUsage"},
+		})
+		Expect(err).To(MatchError(ContainSubstring("broken")))
+		Expect(err).To(MatchError(ContainSubstring("listed more than once")))
+		Expect(calculators).To(HaveLen(1))
+		Expect(calculators[0].Name()).To(Equal("cel/db"))
+	})
+})
@@ -75,6 +75,56 @@ func (launchercalc *VirtLauncherCalculator) PodUsageFunc(pod *corev1.Pod, existi
 	return corev1.ResourceList{}, nil, true
 }
 
+// Dependencies returns the VMI owning a launcher pod. The usage of the pod also depends on the migrations of the VMI
+// and on its other launcher pods, which come and go along with the migrations
+func (launchercalc *VirtLauncherCalculator) Dependencies(pod *corev1.Pod) []string {
+	if len(pod.OwnerReferences) == 0 || pod.OwnerReferences[0].Kind != v15.VirtualMachineInstanceGroupVersionKind.Kind {
+		return nil
+	}
+	return []string{vmiDependency(pod.Namespace, pod.OwnerReferences[0].Name)}
+}
+
+// OnDependencyChange reports the changes of the VMIs, and the changes of the migrations as changes of their VMI
+func (launchercalc *VirtLauncherCalculator) OnDependencyChange(invalidate func(key string)) {
+	launchercalc.vmiInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { invalidateVMI(obj, invalidate) },
+		UpdateFunc: func(_, obj interface{}) { invalidateVMI(obj, invalidate) },
+		DeleteFunc: func(obj interface{}) { invalidateVMI(obj, invalidate) },
+	})
+	launchercalc.migrationInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { invalidateMigrationVMI(obj, invalidate) },
+		UpdateFunc: func(_, obj interface{}) { invalidateMigrationVMI(obj, invalidate) },
+		DeleteFunc: func(obj interface{}) { invalidateMigrationVMI(obj, invalidate) },
+	})
+}
+
+// RequiredPodFields returns no field, launcher pods are told apart by their owner and counted by their VMI and their resources
+func (launchercalc *VirtLauncherCalculator) RequiredPodFields() []string {
+	return nil
+}
+
+func vmiDependency(namespace, name string) string {
+	return v15.VirtualMachineInstanceGroupVersionKind.Kind + "/" + namespace + "/" + name
+}
+
+func invalidateVMI(obj interface{}, invalidate func(key string)) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if vmi, ok := obj.(*v15.VirtualMachineInstance); ok {
+		invalidate(vmiDependency(vmi.Namespace, vmi.Name))
+	}
+}
+
+func invalidateMigrationVMI(obj interface{}, invalidate func(key string)) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if migration, ok := obj.(*v15.VirtualMachineInstanceMigration); ok {
+		invalidate(vmiDependency(migration.Namespace, migration.Spec.VMIName))
+	}
+}
+
 func (launchercalc *VirtLauncherCalculator) calculateSourceUsageByConfig(pod *corev1.Pod, vmi *v15.VirtualMachineInstance) (corev1.ResourceList, error) {
 	return launchercalc.CalculateUsageByConfig(pod, vmi, true)
 }
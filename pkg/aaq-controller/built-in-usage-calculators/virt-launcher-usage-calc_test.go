@@ -8,6 +8,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	quota "k8s.io/apiserver/pkg/quota/v1"
+	"k8s.io/client-go/tools/cache"
 	v12 "kubevirt.io/api/core/v1"
 	testsutils "kubevirt.io/application-aware-quota/pkg/tests-utils"
 	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
@@ -328,6 +329,23 @@ var _ = Describe("Test virt-launcher calculator", func() {
 			true,
 			false),
 	)
+
+	It("should depend on the VMI of launcher pods", func() {
+		calculator := NewVirtLauncherCalculator(nil, nil, v1alpha1.VirtualResources)
+		Expect(calculator.Dependencies(podForTests)).To(Equal([]string{vmiDependency(fakeNs, fakeVmiName)}))
+		Expect(calculator.Dependencies(NewPodBuilder().WithName("pod").WithNamespace(fakeNs).Build())).To(BeEmpty())
+
+		var invalidated []string
+		invalidate := func(key string) { invalidated = append(invalidated, key) }
+		invalidateVMI(vmiForTests, invalidate)
+		invalidateMigrationVMI(vmimForTests, invalidate)
+		invalidateVMI(cache.DeletedFinalStateUnknown{Key: fakeNs + "/" + fakeVmiName, Obj: vmiForTests}, invalidate)
+		Expect(invalidated).To(Equal([]string{
+			vmiDependency(fakeNs, fakeVmiName),
+			vmiDependency(fakeNs, fakeVmiName),
+			vmiDependency(fakeNs, fakeVmiName),
+		}))
+	})
 })
 
 func NewPodBuilder() *PodBuilder {
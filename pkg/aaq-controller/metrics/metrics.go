@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"net/http"
+	"time"
+)
+
+const (
+	MetricsPath = "/metrics"
+	namespace   = "aaq"
+)
+
+var (
+	// Registry holds all the metrics the controller exposes
+	Registry = prometheus.NewRegistry()
+
+	gatedPods = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "gated_pods",
+		Help:      "Number of pods waiting in the namespace for quota to be released",
+	}, []string{"namespace"})
+
+	gatedPodReleaseDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "gated_pod_release_duration_seconds",
+		Help:      "Time from gating a pod to releasing it",
+		Buckets:   prometheus.ExponentialBuckets(1, 3, 12),
+	})
+
+	sidecarCalculatorDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sidecar_calculator_duration_seconds",
+		Help:      "Latency of sidecar usage calculator calls",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 8),
+	}, []string{"sidecar"})
+
+	sidecarCalculatorErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sidecar_calculator_errors_total",
+		Help:      "Number of failed sidecar usage calculator calls",
+	}, []string{"sidecar"})
+
+	usageCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "usage_cache_lookups_total",
+		Help:      "Number of lookups of the usages calculators computed for pods, by result",
+	}, []string{"calculator", "result"})
+
+	auditRecordsDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "audit_records_dropped_total",
+		Help:      "Number of gate decision audit records that failed to be written to the audit log sink",
+	})
+
+	invalidCELCalculators = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "invalid_cel_calculators",
+		Help:      "Number of CEL calculators skipped since they failed to compile",
+	})
+
+	quotaHardDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "quota_hard"),
+		"Hard limit of the quota per resource", []string{"kind", "namespace", "name", "resource"}, nil)
+	quotaUsedDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "quota_used"),
+		"Usage of the quota per resource", []string{"kind", "namespace", "name", "resource"}, nil)
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		gatedPods,
+		gatedPodReleaseDuration,
+		sidecarCalculatorDuration,
+		sidecarCalculatorErrors,
+		usageCacheLookups,
+		auditRecordsDropped,
+		invalidCELCalculators,
+	)
+	workqueue.SetProvider(newWorkqueueMetricsProvider(Registry))
+}
+
+// Handler serves the metrics of the registry
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// SetGatedPods records the number of pods that remain gated in the namespace
+func SetGatedPods(ns string, count int) {
+	gatedPods.WithLabelValues(ns).Set(float64(count))
+}
+
+// DeleteGatedPods stops reporting the gated pods of a namespace that is gone
+func DeleteGatedPods(ns string) {
+	gatedPods.DeleteLabelValues(ns)
+}
+
+// ObserveGatedPodRelease records how long a released pod was gated
+func ObserveGatedPodRelease(gated time.Duration) {
+	gatedPodReleaseDuration.Observe(gated.Seconds())
+}
+
+// ObserveSidecarCalculatorCall records the latency and the outcome of a sidecar usage calculator call
+func ObserveSidecarCalculatorCall(sidecar string, duration time.Duration, err error) {
+	sidecarCalculatorDuration.WithLabelValues(sidecar).Observe(duration.Seconds())
+	if err != nil {
+		sidecarCalculatorErrors.WithLabelValues(sidecar).Inc()
+	}
+}
+
+// ObserveUsageCacheLookup records whether the usage a calculator computed for a pod was cached
+func ObserveUsageCacheLookup(calculator string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	usageCacheLookups.WithLabelValues(calculator, result).Inc()
+}
+
+// AddAuditRecordsDropped records audit records that failed to be written
+func AddAuditRecordsDropped(count int) {
+	auditRecordsDropped.Add(float64(count))
+}
+
+// SetInvalidCELCalculators records the number of CEL calculators that were skipped since they failed to compile
+func SetInvalidCELCalculators(count int) {
+	invalidCELCalculators.Set(float64(count))
+}
+
+// RegisterQuotaCollector reports the hard limits and the usage of the quotas in the informers.
+// The cluster quota informer may be nil when cluster quotas are not enabled
+func RegisterQuotaCollector(arqInformer, acrqInformer cache.SharedIndexInformer) {
+	Registry.MustRegister(&quotaCollector{arqInformer: arqInformer, acrqInformer: acrqInformer})
+}
+
+// quotaCollector reads the quotas from the informers on each scrape, so deleted quotas stop being reported
+type quotaCollector struct {
+	arqInformer  cache.SharedIndexInformer
+	acrqInformer cache.SharedIndexInformer
+}
+
+func (qc *quotaCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- quotaHardDesc
+	ch <- quotaUsedDesc
+}
+
+func (qc *quotaCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, obj := range qc.arqInformer.GetIndexer().List() {
+		arq := obj.(*v1alpha12.ApplicationAwareResourceQuota)
+		collectQuota(ch, "ApplicationAwareResourceQuota", arq.Namespace, arq.Name, arq.Status.Hard, arq.Status.Used)
+	}
+	if qc.acrqInformer == nil {
+		return
+	}
+	for _, obj := range qc.acrqInformer.GetIndexer().List() {
+		acrq := obj.(*v1alpha12.ApplicationAwareClusterResourceQuota)
+		collectQuota(ch, "ApplicationAwareClusterResourceQuota", "", acrq.Name, acrq.Status.Total.Hard, acrq.Status.Total.Used)
+	}
+}
+
+func collectQuota(ch chan<- prometheus.Metric, kind, ns, name string, hard, used v1.ResourceList) {
+	for resourceName, quantity := range hard {
+		ch <- prometheus.MustNewConstMetric(quotaHardDesc, prometheus.GaugeValue, quantity.AsApproximateFloat64(), kind, ns, name, string(resourceName))
+	}
+	for resourceName, quantity := range used {
+		ch <- prometheus.MustNewConstMetric(quotaUsedDesc, prometheus.GaugeValue, quantity.AsApproximateFloat64(), kind, ns, name, string(resourceName))
+	}
+}
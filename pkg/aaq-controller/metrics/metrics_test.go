@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"fmt"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+	testsutils "kubevirt.io/application-aware-quota/pkg/tests-utils"
+	"kubevirt.io/application-aware-quota/tests/builders"
+)
+
+func gatherMetric(name string, labels map[string]string) *dto.Metric {
+	families, err := Registry.Gather()
+	Expect(err).ToNot(HaveOccurred())
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metricsLoop:
+		for _, metric := range family.Metric {
+			for _, label := range metric.Label {
+				if value, ok := labels[label.GetName()]; ok && value != label.GetValue() {
+					continue metricsLoop
+				}
+			}
+			return metric
+		}
+	}
+	return nil
+}
+
+var _ = Describe("Test controller metrics", func() {
+	It("should report the hard limits and the usage of the quotas", func() {
+		arqInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{
+			builders.NewArqBuilder().WithNamespace("test").WithName("testarq").
+				WithResource(corev1.ResourceRequestsMemory, resource.MustParse("1Gi")).WithSyncStatusHardEmptyStatusUsed().
+				WithStatusUsed(corev1.ResourceRequestsMemory, resource.MustParse("512Mi")).Build(),
+		})
+		RegisterQuotaCollector(arqInformer, nil)
+
+		labels := map[string]string{"kind": "ApplicationAwareResourceQuota", "namespace": "test", "name": "testarq", "resource": "requests.memory"}
+		hard := gatherMetric("aaq_quota_hard", labels)
+		Expect(hard).ToNot(BeNil())
+		Expect(hard.GetGauge().GetValue()).To(Equal(float64(1 << 30)))
+		used := gatherMetric("aaq_quota_used", labels)
+		Expect(used).ToNot(BeNil())
+		Expect(used.GetGauge().GetValue()).To(Equal(float64(512 << 20)))
+	})
+
+	It("should report the depth of named workqueues", func() {
+		queue := workqueue.NewNamed("test-queue")
+		defer queue.ShutDown()
+		queue.Add("a")
+		queue.Add("b")
+
+		depth := gatherMetric("workqueue_depth", map[string]string{"name": "test-queue"})
+		Expect(depth).ToNot(BeNil())
+		Expect(depth.GetGauge().GetValue()).To(Equal(float64(2)))
+	})
+
+	It("should only count failed sidecar calculator calls as errors", func() {
+		ObserveSidecarCalculatorCall("sidecar.sock", 0, nil)
+		Expect(gatherMetric("aaq_sidecar_calculator_errors_total", map[string]string{"sidecar": "sidecar.sock"})).To(BeNil())
+		ObserveSidecarCalculatorCall("sidecar.sock", 0, fmt.Errorf("sidecar failed"))
+		errors := gatherMetric("aaq_sidecar_calculator_errors_total", map[string]string{"sidecar": "sidecar.sock"})
+		Expect(errors).ToNot(BeNil())
+		Expect(errors.GetCounter().GetValue()).To(Equal(float64(1)))
+	})
+})
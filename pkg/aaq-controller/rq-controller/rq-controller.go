@@ -14,6 +14,7 @@ import (
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 	_ "kubevirt.io/api/core/v1"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/sharding"
 	"kubevirt.io/application-aware-quota/pkg/client"
 	"kubevirt.io/application-aware-quota/pkg/log"
 	"kubevirt.io/application-aware-quota/pkg/util"
@@ -37,12 +38,14 @@ type RQController struct {
 	rqInformer  cache.SharedIndexInformer
 	arqQueue    workqueue.RateLimitingInterface
 	aaqCli      client.AAQClient
+	shards      *sharding.Sharder
 	stop        <-chan struct{}
 }
 
 func NewRQController(aaqCli client.AAQClient,
 	rqInformer cache.SharedIndexInformer,
 	arqInformer cache.SharedIndexInformer,
+	shards *sharding.Sharder,
 	stop <-chan struct{},
 ) *RQController {
 	ctrl := RQController{
@@ -50,6 +53,7 @@ func NewRQController(aaqCli client.AAQClient,
 		aaqCli:      aaqCli,
 		arqInformer: arqInformer,
 		arqQueue:    workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "arq-queue-for-rq-contorller"),
+		shards:      shards,
 		stop:        stop,
 	}
 
@@ -71,6 +75,26 @@ func NewRQController(aaqCli client.AAQClient,
 	return &ctrl
 }
 
+// OwnershipChanged syncs the managed ResourceQuotas of the namespaces that moved to the shards of the replica
+func (ctrl *RQController) OwnershipChanged(namespaces []string) {
+	for _, ns := range namespaces {
+		if !ctrl.shards.OwnsNamespace(ns) {
+			continue
+		}
+		arqObjs, err := ctrl.arqInformer.GetIndexer().ByIndex(cache.NamespaceIndex, ns)
+		if err != nil {
+			continue
+		}
+		for _, arqObj := range arqObjs {
+			key, err := cache.MetaNamespaceKeyFunc(arqObj)
+			if err != nil {
+				continue
+			}
+			ctrl.arqQueue.Add(key)
+		}
+	}
+}
+
 // When a ApplicationAwareResourceQuota is deleted, enqueue all gated pods for revaluation
 func (ctrl *RQController) deleteArq(obj interface{}) {
 	arq := obj.(*v1alpha12.ApplicationAwareResourceQuota)
@@ -162,6 +186,9 @@ func (ctrl *RQController) Execute() bool {
 
 func (ctrl *RQController) execute(key string) (error, enqueueState) {
 	arqNS, arqName, err := cache.SplitMetaNamespaceKey(key)
+	if !ctrl.shards.OwnsNamespace(arqNS) {
+		return nil, Forget
+	}
 	arqObj, exists, err := ctrl.arqInformer.GetIndexer().GetByKey(arqNS + "/" + arqName)
 	if err != nil {
 		return err, Immediate
@@ -121,6 +121,7 @@ func setupRQController(clientSet client.AAQClient, arqInformer cache.SharedIndex
 	qc := NewRQController(clientSet,
 		rqInformer,
 		arqInformer,
+		nil,
 		stop,
 	)
 	informerFactory.Start(stop)
@@ -0,0 +1,74 @@
+package sharding
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+const (
+	clusterQuotaLinkPrefix = "clusterquota/"
+	cohortLinkPrefix       = "cohort/"
+)
+
+// shardOf hashes the name of a namespace, or of the group it belongs to, into a shard
+func shardOf(name string, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return int(h.Sum32() % uint32(shards))
+}
+
+// placementGroups groups the links that share namespaces, directly or through other links. A link is a cluster
+// quota or a cohort of quotas, along with the namespaces it spans. Each group is named after its first link and the
+// namespaces it spans are placed along with it, so that the pods counted against a cluster quota or a cohort are
+// released by a single replica.
+// It returns the group of each namespace spanned by a link, and the group of each link
+func placementGroups(links map[string][]string) (map[string]string, map[string]string) {
+	names := make([]string, 0, len(links))
+	for name := range links {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parent := make(map[string]string, len(names))
+	for _, name := range names {
+		parent[name] = name
+	}
+	find := func(name string) string {
+		for parent[name] != name {
+			parent[name] = parent[parent[name]]
+			name = parent[name]
+		}
+		return name
+	}
+	// the group keeps the smallest name, so that it doesn't depend on the order the links are joined in
+	union := func(a, b string) {
+		rootA, rootB := find(a), find(b)
+		if rootA == rootB {
+			return
+		}
+		if rootB < rootA {
+			rootA, rootB = rootB, rootA
+		}
+		parent[rootB] = rootA
+	}
+
+	namespaceLink := map[string]string{}
+	for _, name := range names {
+		for _, namespace := range links[name] {
+			if other, ok := namespaceLink[namespace]; ok {
+				union(name, other)
+				continue
+			}
+			namespaceLink[namespace] = name
+		}
+	}
+
+	namespaceGroups := make(map[string]string, len(namespaceLink))
+	for namespace, name := range namespaceLink {
+		namespaceGroups[namespace] = find(name)
+	}
+	linkGroups := make(map[string]string, len(names))
+	for _, name := range names {
+		linkGroups[name] = find(name)
+	}
+	return namespaceGroups, linkGroups
+}
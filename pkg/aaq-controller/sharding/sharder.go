@@ -0,0 +1,515 @@
+package sharding
+
+import (
+	"context"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	v12 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/additional-cluster-quota-controllers/clusterquotamapping"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/leaderelectionconfig"
+	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ShardLeasePrefix prefixes the names of the Leases the shards are claimed with
+	ShardLeasePrefix = "aaq-controller-shard-"
+	// settlePeriod is how long a replica waits after claiming a shard before working on it, so that the pod
+	// releases of its previous owner reach the informers and are counted by the quotas it calculates
+	settlePeriod = 5 * time.Second
+	// placementDelay batches the cluster quota mapping changes into a single placement update
+	placementDelay = time.Second
+	placementKey   = "placement"
+)
+
+// OwnershipListener is notified of the namespaces that may have moved to or away from the shards of the replica.
+// It must not block.
+type OwnershipListener interface {
+	OwnershipChanged(namespaces []string)
+}
+
+// claim is a shard the replica runs a leader election for
+type claim struct {
+	cancel  context.CancelFunc
+	started time.Time
+	// owned is set once the replica holds the Lease of the shard and the settle period passed
+	owned bool
+}
+
+// Sharder splits the namespaces in shards and claims an even part of them, along with the shards of the replicas
+// that are gone. The controllers only work on the namespaces and cluster quotas the Sharder owns.
+// A nil Sharder owns everything.
+type Sharder struct {
+	shards          int
+	replicas        int
+	identity        string
+	leaseNamespace  string
+	leaderElection  leaderelectionconfig.Configuration
+	leaseClient     coordinationv1client.LeasesGetter
+	namespaceLister v12.NamespaceLister
+	arqInformer     cache.SharedIndexInformer
+	// acrqInformer and clusterQuotaMapper are nil when cluster quotas are disabled
+	acrqInformer       cache.SharedIndexInformer
+	clusterQuotaMapper clusterquotamapping.ClusterQuotaMapper
+	placementQueue     workqueue.RateLimitingInterface
+
+	lock   sync.RWMutex
+	claims map[int]*claim
+	// orphanedSince holds when each shard was first seen without a holder
+	orphanedSince   map[int]time.Time
+	namespaceGroups map[string]string
+	linkGroups      map[string]string
+	// settling holds until when the namespaces that moved to another shard wait for their previous owner
+	settling  map[string]time.Time
+	listeners []OwnershipListener
+	clock     clock.WithDelayedExecution
+}
+
+func NewSharder(shards int,
+	replicas int,
+	identity string,
+	leaseNamespace string,
+	leaderElection leaderelectionconfig.Configuration,
+	leaseClient coordinationv1client.LeasesGetter,
+	namespaceLister v12.NamespaceLister,
+	arqInformer cache.SharedIndexInformer,
+	acrqInformer cache.SharedIndexInformer,
+	clusterQuotaMapper clusterquotamapping.ClusterQuotaMapper,
+) *Sharder {
+	if replicas < 1 {
+		replicas = 1
+	}
+	s := &Sharder{
+		shards:             shards,
+		replicas:           replicas,
+		identity:           identity,
+		leaseNamespace:     leaseNamespace,
+		leaderElection:     leaderElection,
+		leaseClient:        leaseClient,
+		namespaceLister:    namespaceLister,
+		arqInformer:        arqInformer,
+		acrqInformer:       acrqInformer,
+		clusterQuotaMapper: clusterQuotaMapper,
+		placementQueue:     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "shard-placement"),
+		claims:             map[int]*claim{},
+		orphanedSince:      map[int]time.Time{},
+		namespaceGroups:    map[string]string{},
+		linkGroups:         map[string]string{},
+		settling:           map[string]time.Time{},
+		clock:              clock.RealClock{},
+	}
+
+	_, err := arqInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    s.addArq,
+		UpdateFunc: s.updateArq,
+		DeleteFunc: s.deleteArq,
+	})
+	if err != nil {
+		panic("something is wrong")
+	}
+	return s
+}
+
+func (s *Sharder) AddListener(listener OwnershipListener) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.listeners = append(s.listeners, listener)
+}
+
+// OwnsNamespace returns true if the namespace is in one of the shards of the replica
+func (s *Sharder) OwnsNamespace(namespace string) bool {
+	if s == nil {
+		return true
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if until, ok := s.settling[namespace]; ok && s.clock.Now().Before(until) {
+		return false
+	}
+	return s.owns(s.namespaceShard(namespace))
+}
+
+// OwnsClusterQuota returns true if the cluster quota, along with all the namespaces it selects, is in one of the
+// shards of the replica
+func (s *Sharder) OwnsClusterQuota(name string) bool {
+	if s == nil {
+		return true
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	group, ok := s.linkGroups[clusterQuotaLinkPrefix+name]
+	if !ok {
+		group = clusterQuotaLinkPrefix + name
+	}
+	if s.groupSettling(group) {
+		return false
+	}
+	return s.owns(shardOf(group, s.shards))
+}
+
+// OwnsShard returns true if the replica works on the shard. The work that isn't split in shards is done by the
+// owner of shard 0
+func (s *Sharder) OwnsShard(shard int) bool {
+	if s == nil {
+		return true
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.owns(shard)
+}
+
+// groupSettling returns true if some namespace of the group still waits for its previous owner. Must be called
+// with the lock held
+func (s *Sharder) groupSettling(group string) bool {
+	now := s.clock.Now()
+	for namespace, until := range s.settling {
+		if now.Before(until) && s.namespaceGroups[namespace] == group {
+			return true
+		}
+	}
+	return false
+}
+
+// OwnedShards returns the shards the replica works on
+func (s *Sharder) OwnedShards() []int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var shards []int
+	for shard, c := range s.claims {
+		if c.owned {
+			shards = append(shards, shard)
+		}
+	}
+	sort.Ints(shards)
+	return shards
+}
+
+func (s *Sharder) owns(shard int) bool {
+	c, ok := s.claims[shard]
+	return ok && c.owned
+}
+
+func (s *Sharder) namespaceShard(namespace string) int {
+	if group, ok := s.namespaceGroups[namespace]; ok {
+		return shardOf(group, s.shards)
+	}
+	return shardOf(namespace, s.shards)
+}
+
+// AddMapping and RemoveMapping update the placement of the namespaces once the mapping settles
+func (s *Sharder) AddMapping(_, _ string) {
+	s.placementQueue.AddAfter(placementKey, placementDelay)
+}
+
+func (s *Sharder) RemoveMapping(_, _ string) {
+	s.placementQueue.AddAfter(placementKey, placementDelay)
+}
+
+func (s *Sharder) addArq(obj interface{}) {
+	if obj.(*v1alpha12.ApplicationAwareResourceQuota).Spec.Cohort != "" {
+		s.placementQueue.AddAfter(placementKey, placementDelay)
+	}
+}
+
+func (s *Sharder) updateArq(old, cur interface{}) {
+	if old.(*v1alpha12.ApplicationAwareResourceQuota).Spec.Cohort != cur.(*v1alpha12.ApplicationAwareResourceQuota).Spec.Cohort {
+		s.placementQueue.AddAfter(placementKey, placementDelay)
+	}
+}
+
+func (s *Sharder) deleteArq(obj interface{}) {
+	if arq, ok := obj.(*v1alpha12.ApplicationAwareResourceQuota); ok && arq.Spec.Cohort == "" {
+		return
+	}
+	s.placementQueue.AddAfter(placementKey, placementDelay)
+}
+
+// Run claims shards until the context is done, the Leases of the claimed shards are released then
+func (s *Sharder) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+	defer s.placementQueue.ShutDown()
+	klog.Infof("Starting sharder with %d shards for %d replicas", s.shards, s.replicas)
+	defer klog.Info("Shutting down sharder")
+
+	s.updatePlacement()
+	go wait.Until(s.placementWorker, time.Second, ctx.Done())
+	wait.Until(func() { s.reconcile(ctx) }, s.leaderElection.RetryPeriod.Duration, ctx.Done())
+}
+
+func (s *Sharder) placementWorker() {
+	for {
+		key, quit := s.placementQueue.Get()
+		if quit {
+			return
+		}
+		s.updatePlacement()
+		s.placementQueue.Done(key)
+	}
+}
+
+// updatePlacement regroups the namespaces that share cluster quotas or cohorts and notifies the listeners of
+// the namespaces whose shard changed
+func (s *Sharder) updatePlacement() {
+	links := map[string][]string{}
+	for _, arqObj := range s.arqInformer.GetIndexer().List() {
+		arq := arqObj.(*v1alpha12.ApplicationAwareResourceQuota)
+		if arq.Spec.Cohort != "" {
+			links[cohortLinkPrefix+arq.Spec.Cohort] = append(links[cohortLinkPrefix+arq.Spec.Cohort], arq.Namespace)
+		}
+	}
+	if s.clusterQuotaMapper != nil {
+		for _, quotaName := range s.acrqInformer.GetIndexer().ListKeys() {
+			links[clusterQuotaLinkPrefix+quotaName], _ = s.clusterQuotaMapper.GetNamespacesFor(quotaName)
+		}
+	}
+	namespaceGroups, linkGroups := placementGroups(links)
+
+	s.lock.Lock()
+	var moved []string
+	for namespace, group := range namespaceGroups {
+		if shardOf(group, s.shards) != s.namespaceShard(namespace) {
+			moved = append(moved, namespace)
+		}
+	}
+	for namespace, group := range s.namespaceGroups {
+		if _, ok := namespaceGroups[namespace]; !ok && shardOf(group, s.shards) != shardOf(namespace, s.shards) {
+			moved = append(moved, namespace)
+		}
+	}
+	s.namespaceGroups, s.linkGroups = namespaceGroups, linkGroups
+	now := s.clock.Now()
+	for namespace, until := range s.settling {
+		if !now.Before(until) {
+			delete(s.settling, namespace)
+		}
+	}
+	for _, namespace := range moved {
+		s.settling[namespace] = now.Add(settlePeriod)
+	}
+	listeners := s.listeners
+	s.lock.Unlock()
+
+	// the previous owners stop working on the moved namespaces right away, the new ones once they settled
+	notify(listeners, moved)
+	if len(moved) > 0 {
+		s.clock.AfterFunc(settlePeriod, func() { notify(listeners, moved) })
+	}
+}
+
+// reconcile claims the shards that are free while the replica holds less than its part of them, and the shards
+// that stayed orphaned for a lease duration. It gives back a shard when some replica holds none of them.
+func (s *Sharder) reconcile(ctx context.Context) {
+	leases, err := s.leaseClient.Leases(s.leaseNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		klog.Errorf("unable to list the shard leases: %v", err)
+		return
+	}
+	now := s.clock.Now()
+	heldByOthers := map[int]bool{}
+	holders := map[string]bool{}
+	for i := range leases.Items {
+		shard, ok := leaseShard(leases.Items[i].Name, s.shards)
+		if !ok || !s.heldByOther(&leases.Items[i], now) {
+			continue
+		}
+		heldByOthers[shard] = true
+		holders[*leases.Items[i].Spec.HolderIdentity] = true
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// claims that didn't get their Lease within a lease duration would take the shard over as soon as its holder
+	// is gone, ahead of the replicas it is meant for
+	for shard, c := range s.claims {
+		if !c.owned && now.Sub(c.started) > s.leaderElection.LeaseDuration.Duration+settlePeriod {
+			c.cancel()
+			delete(s.claims, shard)
+		}
+	}
+
+	fairShare := (s.shards + s.replicas - 1) / s.replicas
+	claimed := len(s.claims)
+	free := 0
+	for _, shard := range s.preferredShards() {
+		if _, ok := s.claims[shard]; ok {
+			delete(s.orphanedSince, shard)
+			continue
+		}
+		if heldByOthers[shard] {
+			delete(s.orphanedSince, shard)
+			continue
+		}
+		free++
+		if claimed < fairShare {
+			s.claim(ctx, shard, now)
+			claimed++
+			continue
+		}
+		orphanedSince, ok := s.orphanedSince[shard]
+		if !ok {
+			s.orphanedSince[shard] = now
+			continue
+		}
+		if now.Sub(orphanedSince) > s.leaderElection.LeaseDuration.Duration {
+			klog.Infof("taking over orphaned shard %d", shard)
+			s.claim(ctx, shard, now)
+			claimed++
+		}
+	}
+
+	// a replica that holds no shard is short of the other replicas' extra ones
+	if free == 0 && claimed > fairShare && len(holders)+1 < s.replicas {
+		preferred := s.preferredShards()
+		for i := len(preferred) - 1; i >= 0; i-- {
+			if c, ok := s.claims[preferred[i]]; ok {
+				klog.Infof("giving back shard %d", preferred[i])
+				s.release(preferred[i], c)
+				break
+			}
+		}
+	}
+}
+
+func (s *Sharder) heldByOther(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" || *lease.Spec.HolderIdentity == s.identity {
+		return false
+	}
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return false
+	}
+	return lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second).After(now)
+}
+
+// preferredShards orders the shards differently for each replica, so that the replicas claim different shards
+func (s *Sharder) preferredShards() []int {
+	shards := make([]int, s.shards)
+	ranks := make(map[int]int, s.shards)
+	for shard := range shards {
+		shards[shard] = shard
+		ranks[shard] = shardOf(s.identity+"/"+strconv.Itoa(shard), 1<<30)
+	}
+	sort.Slice(shards, func(i, j int) bool {
+		if ranks[shards[i]] != ranks[shards[j]] {
+			return ranks[shards[i]] < ranks[shards[j]]
+		}
+		return shards[i] < shards[j]
+	})
+	return shards
+}
+
+// claim runs the leader election of the shard. Must be called with the lock held
+func (s *Sharder) claim(ctx context.Context, shard int, now time.Time) {
+	claimCtx, cancel := context.WithCancel(ctx)
+	c := &claim{cancel: cancel, started: now}
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Name: ShardLeasePrefix + strconv.Itoa(shard), Namespace: s.leaseNamespace},
+			Client:     s.leaseClient,
+			LockConfig: resourcelock.ResourceLockConfig{Identity: s.identity},
+		},
+		LeaseDuration:   s.leaderElection.LeaseDuration.Duration,
+		RenewDeadline:   s.leaderElection.RenewDeadline.Duration,
+		RetryPeriod:     s.leaderElection.RetryPeriod.Duration,
+		ReleaseOnCancel: true,
+		Name:            ShardLeasePrefix + strconv.Itoa(shard),
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				select {
+				case <-s.clock.After(settlePeriod):
+					s.acquired(shard, c)
+				case <-ctx.Done():
+				}
+			},
+			OnStoppedLeading: func() {
+				s.lock.Lock()
+				if s.claims[shard] == c {
+					s.release(shard, c)
+				}
+				s.lock.Unlock()
+			},
+		},
+	})
+	if err != nil {
+		cancel()
+		klog.Errorf("unable to claim shard %d: %v", shard, err)
+		return
+	}
+	s.claims[shard] = c
+	go elector.Run(claimCtx)
+}
+
+func (s *Sharder) acquired(shard int, c *claim) {
+	s.lock.Lock()
+	if s.claims[shard] != c {
+		s.lock.Unlock()
+		return
+	}
+	c.owned = true
+	listeners := s.listeners
+	namespaces := s.shardNamespaces(shard)
+	s.lock.Unlock()
+	klog.Infof("working on shard %d", shard)
+	notify(listeners, namespaces)
+}
+
+// release stops working on the shard before its Lease is given back. Must be called with the lock held
+func (s *Sharder) release(shard int, c *claim) {
+	delete(s.claims, shard)
+	if c.owned {
+		klog.Infof("stopped working on shard %d", shard)
+		// the listeners don't block, and only check the ownership once the lock is released
+		go notify(s.listeners, s.shardNamespaces(shard))
+	}
+	c.owned = false
+	c.cancel()
+}
+
+// shardNamespaces returns the namespaces of the shard. Must be called with the lock held
+func (s *Sharder) shardNamespaces(shard int) []string {
+	namespaces, err := s.namespaceLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("unable to list namespaces: %v", err)
+		return nil
+	}
+	var names []string
+	for _, namespace := range namespaces {
+		if s.namespaceShard(namespace.Name) == shard {
+			names = append(names, namespace.Name)
+		}
+	}
+	return names
+}
+
+func notify(listeners []OwnershipListener, namespaces []string) {
+	if len(namespaces) == 0 {
+		return
+	}
+	for _, listener := range listeners {
+		listener.OwnershipChanged(namespaces)
+	}
+}
+
+func leaseShard(name string, shards int) (int, bool) {
+	if !strings.HasPrefix(name, ShardLeasePrefix) {
+		return 0, false
+	}
+	shard, err := strconv.Atoi(strings.TrimPrefix(name, ShardLeasePrefix))
+	if err != nil || shard < 0 || shard >= shards {
+		return 0, false
+	}
+	return shard, true
+}
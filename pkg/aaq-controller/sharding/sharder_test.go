@@ -0,0 +1,194 @@
+package sharding
+
+import (
+	"context"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	v12 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	testingclock "k8s.io/utils/clock/testing"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/leaderelectionconfig"
+	testsutils "kubevirt.io/application-aware-quota/pkg/tests-utils"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// fakeListener keeps the namespaces it is notified of
+type fakeListener struct {
+	lock       sync.Mutex
+	namespaces []string
+}
+
+func (l *fakeListener) OwnershipChanged(namespaces []string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.namespaces = append(l.namespaces, namespaces...)
+}
+
+func (l *fakeListener) notified() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return append([]string(nil), l.namespaces...)
+}
+
+var _ = Describe("Sharder", func() {
+	const shards = 4
+	var leaseClient *fake.Clientset
+	var fakeClock *testingclock.FakeClock
+	var listener *fakeListener
+	var ctx context.Context
+	var cancel context.CancelFunc
+
+	newSharder := func(replicas int, namespaces ...string) *Sharder {
+		nsIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		for _, ns := range namespaces {
+			Expect(nsIndexer.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}})).To(Succeed())
+		}
+		sharder := NewSharder(shards,
+			replicas,
+			"replica",
+			"aaq",
+			leaderelectionconfig.DefaultLeaderElectionConfiguration(),
+			leaseClient.CoordinationV1(),
+			v12.NewNamespaceLister(nsIndexer),
+			testsutils.NewFakeSharedIndexInformer(nil),
+			nil,
+			nil,
+		)
+		sharder.clock = fakeClock
+		sharder.AddListener(listener)
+		return sharder
+	}
+
+	// settle lets the claimed shards settle once their Leases are acquired
+	settle := func(sharder *Sharder, expected int) {
+		Eventually(func() int {
+			leases, err := leaseClient.CoordinationV1().Leases("aaq").List(ctx, metav1.ListOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			held := 0
+			for _, lease := range leases.Items {
+				if lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity == "replica" {
+					held++
+				}
+			}
+			return held
+		}).WithTimeout(10 * time.Second).Should(Equal(expected))
+		Eventually(func() []int {
+			if fakeClock.HasWaiters() {
+				fakeClock.Step(settlePeriod)
+			}
+			return sharder.OwnedShards()
+		}).WithTimeout(5 * time.Second).Should(HaveLen(expected))
+	}
+
+	holdLease := func(shard int, holder string) {
+		leaseDuration := int32(15)
+		_, err := leaseClient.CoordinationV1().Leases("aaq").Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: ShardLeasePrefix + strconv.Itoa(shard), Namespace: "aaq"},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &holder,
+				LeaseDurationSeconds: &leaseDuration,
+				RenewTime:            &metav1.MicroTime{Time: fakeClock.Now()},
+			},
+		}, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		leaseClient = fake.NewSimpleClientset()
+		fakeClock = testingclock.NewFakeClock(time.Now())
+		listener = &fakeListener{}
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should own everything when sharding is disabled", func() {
+		var sharder *Sharder
+		Expect(sharder.OwnsNamespace("test")).To(BeTrue())
+		Expect(sharder.OwnsClusterQuota("acrq")).To(BeTrue())
+		Expect(sharder.OwnsShard(0)).To(BeTrue())
+	})
+
+	It("should not work on a cluster quota while its namespaces settle", func() {
+		sharder := newSharder(1)
+		for shard := 0; shard < shards; shard++ {
+			sharder.claims[shard] = &claim{owned: true}
+		}
+		sharder.namespaceGroups = map[string]string{"ns1": clusterQuotaLinkPrefix + "acrq", "ns2": clusterQuotaLinkPrefix + "acrq"}
+		sharder.linkGroups = map[string]string{clusterQuotaLinkPrefix + "acrq": clusterQuotaLinkPrefix + "acrq"}
+		sharder.settling["ns2"] = fakeClock.Now().Add(settlePeriod)
+		Expect(sharder.OwnsNamespace("ns1")).To(BeTrue())
+		Expect(sharder.OwnsNamespace("ns2")).To(BeFalse())
+		Expect(sharder.OwnsClusterQuota("acrq")).To(BeFalse())
+		Expect(sharder.OwnsClusterQuota("other")).To(BeTrue())
+
+		fakeClock.Step(settlePeriod)
+		Expect(sharder.OwnsNamespace("ns2")).To(BeTrue())
+		Expect(sharder.OwnsClusterQuota("acrq")).To(BeTrue())
+	})
+
+	It("should claim its part of the shards and notify the namespaces it works on once they settle", func() {
+		namespaces := []string{"ns-a", "ns-b", "ns-c", "ns-d", "ns-e", "ns-f"}
+		sharder := newSharder(2, namespaces...)
+
+		sharder.reconcile(ctx)
+		settle(sharder, 2)
+		var owned []string
+		for _, ns := range namespaces {
+			if sharder.OwnsNamespace(ns) {
+				owned = append(owned, ns)
+			}
+		}
+		Expect(listener.notified()).To(ConsistOf(owned))
+
+		// the part of the replica is claimed already
+		sharder.reconcile(ctx)
+		Expect(sharder.claims).To(HaveLen(2))
+	})
+
+	It("should take over the shards of a replica that is gone only after a lease duration", func() {
+		sharder := newSharder(shards)
+		holdLease(0, "gone")
+		holdLease(1, "other")
+
+		start := fakeClock.Now()
+		sharder.reconcile(ctx)
+		settle(sharder, 1)
+		Expect(sharder.OwnedShards()).ToNot(ContainElement(0))
+		Expect(sharder.OwnedShards()).ToNot(ContainElement(1))
+
+		// the shard nobody claimed is taken over first
+		fakeClock.SetTime(start.Add(sharder.leaderElection.LeaseDuration.Duration))
+		sharder.reconcile(ctx)
+		Expect(sharder.claims).To(HaveLen(1))
+		fakeClock.Step(time.Second)
+		sharder.reconcile(ctx)
+		Expect(sharder.claims).To(HaveLen(2))
+	})
+
+	It("should keep the namespaces that share cluster quotas or cohorts in the same group", func() {
+		namespaceGroups, linkGroups := placementGroups(map[string][]string{
+			clusterQuotaLinkPrefix + "b": {"ns1", "ns2"},
+			clusterQuotaLinkPrefix + "c": {"ns2", "ns3"},
+			cohortLinkPrefix + "a":       {"ns3", "ns4"},
+			cohortLinkPrefix + "d":       {"ns5"},
+		})
+		Expect(namespaceGroups).To(Equal(map[string]string{
+			"ns1": clusterQuotaLinkPrefix + "b",
+			"ns2": clusterQuotaLinkPrefix + "b",
+			"ns3": clusterQuotaLinkPrefix + "b",
+			"ns4": clusterQuotaLinkPrefix + "b",
+			"ns5": cohortLinkPrefix + "d",
+		}))
+		Expect(linkGroups).To(HaveKeyWithValue(cohortLinkPrefix+"a", clusterQuotaLinkPrefix+"b"))
+		Expect(linkGroups).To(HaveKeyWithValue(cohortLinkPrefix+"d", cohortLinkPrefix+"d"))
+	})
+})
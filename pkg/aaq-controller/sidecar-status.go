@@ -0,0 +1,44 @@
+package aaq_controller
+
+import (
+	"context"
+	"k8s.io/apimachinery/pkg/api/equality"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	sdkapi "kubevirt.io/controller-lifecycle-operator-sdk/api"
+	"time"
+)
+
+// sidecarStatusReportPeriod is how often the sidecar evaluators state is compared with the one on the AAQ CR
+const sidecarStatusReportPeriod = 10 * time.Second
+
+// reportSidecarStatuses keeps the sidecar evaluators state on the AAQ CR status up to date until stop is closed
+func (mca *AaqControllerApp) reportSidecarStatuses(stop <-chan struct{}) {
+	wait.Until(func() {
+		if err := mca.updateSidecarStatuses(); err != nil {
+			klog.Errorf("Failed to report the sidecar evaluators state: %v", err)
+		}
+	}, sidecarStatusReportPeriod, stop)
+}
+
+func (mca *AaqControllerApp) updateSidecarStatuses() error {
+	// every replica runs the reporter, only one of them updates the AAQ CR
+	if !mca.sharder.OwnsShard(0) {
+		return nil
+	}
+	statuses := mca.calcRegistry.SidecarStatuses()
+	for _, obj := range mca.aaqInformer.GetIndexer().List() {
+		aaq := obj.(*v1alpha12.AAQ)
+		if aaq.Status.Phase == sdkapi.PhaseError || equality.Semantic.DeepEqual(aaq.Status.SidecarEvaluators, statuses) {
+			continue
+		}
+		aaqCopy := aaq.DeepCopy()
+		aaqCopy.Status.SidecarEvaluators = statuses
+		if _, err := mca.aaqCli.AAQ().UpdateStatus(context.Background(), aaqCopy, v1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
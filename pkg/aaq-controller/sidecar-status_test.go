@@ -0,0 +1,78 @@
+package aaq_controller
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	v12 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	aaq_evaluator "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-evaluator"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/leaderelectionconfig"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/sharding"
+	"kubevirt.io/application-aware-quota/pkg/client"
+	testsutils "kubevirt.io/application-aware-quota/pkg/tests-utils"
+	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	sdkapi "kubevirt.io/controller-lifecycle-operator-sdk/api"
+)
+
+var _ = Describe("Sidecar evaluators status", func() {
+	newAAQ := func(name string, phase sdkapi.Phase, sidecars []v1alpha12.SidecarEvaluatorStatus) *v1alpha12.AAQ {
+		aaq := &v1alpha12.AAQ{ObjectMeta: v1.ObjectMeta{Name: name}}
+		aaq.Status.Phase = phase
+		aaq.Status.SidecarEvaluators = sidecars
+		return aaq
+	}
+
+	It("should only update the active AAQ when its reported sidecars are outdated", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		cli := client.NewMockAAQClient(ctrl)
+		aaqInterface := client.NewMockAAQInterface(ctrl)
+		cli.EXPECT().AAQ().Return(aaqInterface).AnyTimes()
+		stale := []v1alpha12.SidecarEvaluatorStatus{{Socket: "sidecar-old.sock", Healthy: true}}
+		aaqInterface.EXPECT().UpdateStatus(context.Background(), gomock.Any(), v1.UpdateOptions{}).Times(1).DoAndReturn(
+			func(_ context.Context, aaq *v1alpha12.AAQ, _ v1.UpdateOptions) (*v1alpha12.AAQ, error) {
+				Expect(aaq.Name).To(Equal("aaq"))
+				Expect(aaq.Status.SidecarEvaluators).To(BeEmpty())
+				return aaq, nil
+			})
+		app := AaqControllerApp{
+			aaqCli:       cli,
+			calcRegistry: aaq_evaluator.GetAaqEvaluatorsRegistry(),
+			aaqInformer: testsutils.NewFakeSharedIndexInformer([]v1.Object{
+				newAAQ("aaq", sdkapi.PhaseDeployed, stale),
+				newAAQ("failed-aaq", sdkapi.PhaseError, stale),
+			}),
+		}
+		Expect(app.updateSidecarStatuses()).To(Succeed())
+	})
+
+	It("should not update an AAQ whose reported sidecars are up to date", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		cli := client.NewMockAAQClient(ctrl)
+		app := AaqControllerApp{
+			aaqCli:       cli,
+			calcRegistry: aaq_evaluator.GetAaqEvaluatorsRegistry(),
+			aaqInformer:  testsutils.NewFakeSharedIndexInformer([]v1.Object{newAAQ("aaq", sdkapi.PhaseDeployed, nil)}),
+		}
+		Expect(app.updateSidecarStatuses()).To(Succeed())
+	})
+
+	It("should leave the AAQ to the replica that works on shard 0", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		cli := client.NewMockAAQClient(ctrl)
+		nsIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		app := AaqControllerApp{
+			aaqCli:       cli,
+			calcRegistry: aaq_evaluator.GetAaqEvaluatorsRegistry(),
+			aaqInformer: testsutils.NewFakeSharedIndexInformer([]v1.Object{
+				newAAQ("aaq", sdkapi.PhaseDeployed, []v1alpha12.SidecarEvaluatorStatus{{Socket: "sidecar-old.sock", Healthy: true}}),
+			}),
+			sharder: sharding.NewSharder(4, 2, "replica", "aaq", leaderelectionconfig.DefaultLeaderElectionConfiguration(),
+				fake.NewSimpleClientset().CoordinationV1(), v12.NewNamespaceLister(nsIndexer), testsutils.NewFakeSharedIndexInformer(nil), nil, nil),
+		}
+		Expect(app.updateSidecarStatuses()).To(Succeed())
+	})
+})
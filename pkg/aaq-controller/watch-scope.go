@@ -0,0 +1,188 @@
+package aaq_controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"kubevirt.io/application-aware-quota/pkg/aaq-controller/additional-cluster-quota-controllers/clusterquotamapping"
+	"kubevirt.io/application-aware-quota/pkg/informers"
+	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// watchScopeKey is the only key of the watch scope queue, the scope is computed as a whole
+const watchScopeKey = "scope"
+
+// watchScope scopes the pod, ResourceQuota and AAQJobQueueConfig informers to the namespaces the controllers work on:
+// the namespaces pods are gated in and the ones covered by an ApplicationAwareResourceQuota or an
+// ApplicationAwareClusterResourceQuota. Cluster quotas are matched against the namespaces directly rather than
+// through the cluster quota mapping, which only runs once the scoped informers synced
+type watchScope struct {
+	gatedNamespaceSelector labels.Selector
+	nsInformer             cache.SharedIndexInformer
+	arqInformer            cache.SharedIndexInformer
+	acrqInformer           cache.SharedIndexInformer
+	scopedInformers        []*informers.ScopedInformer
+	queue                  workqueue.RateLimitingInterface
+	// releaseGatedPods releases the pods left gated in a namespace leaving the scope, it may be nil
+	releaseGatedPods func(namespace string) error
+	// scope is the last scope of the informers
+	scope []string
+}
+
+func newWatchScope(gatedNamespaceSelector labels.Selector,
+	nsInformer cache.SharedIndexInformer,
+	arqInformer cache.SharedIndexInformer,
+	acrqInformer cache.SharedIndexInformer,
+	scopedInformers ...*informers.ScopedInformer,
+) *watchScope {
+	ws := &watchScope{
+		gatedNamespaceSelector: gatedNamespaceSelector,
+		nsInformer:             nsInformer,
+		arqInformer:            arqInformer,
+		acrqInformer:           acrqInformer,
+		scopedInformers:        scopedInformers,
+		queue:                  workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "watch-scope"),
+	}
+	enqueue := func(interface{}) { ws.queue.Add(watchScopeKey) }
+	_, err := ws.nsInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: enqueue,
+		UpdateFunc: func(old, cur interface{}) {
+			oldNs, curNs := old.(*v1.Namespace), cur.(*v1.Namespace)
+			if !reflect.DeepEqual(oldNs.Labels, curNs.Labels) || !reflect.DeepEqual(oldNs.Annotations, curNs.Annotations) {
+				ws.queue.Add(watchScopeKey)
+			}
+		},
+		DeleteFunc: enqueue,
+	})
+	if err != nil {
+		panic("something is wrong")
+	}
+	quotaHandler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    enqueue,
+		UpdateFunc: func(_, _ interface{}) { ws.queue.Add(watchScopeKey) },
+		DeleteFunc: enqueue,
+	}
+	if _, err := ws.arqInformer.AddEventHandler(quotaHandler); err != nil {
+		panic("something is wrong")
+	}
+	if ws.acrqInformer != nil {
+		if _, err := ws.acrqInformer.AddEventHandler(quotaHandler); err != nil {
+			panic("something is wrong")
+		}
+	}
+	return ws
+}
+
+// Run scopes the informers once the namespaces and quotas are synced, and then as they change until stop is closed
+func (ws *watchScope) Run(stop <-chan struct{}) {
+	defer ws.queue.ShutDown()
+	synced := []cache.InformerSynced{ws.nsInformer.HasSynced, ws.arqInformer.HasSynced}
+	if ws.acrqInformer != nil {
+		synced = append(synced, ws.acrqInformer.HasSynced)
+	}
+	if !cache.WaitForCacheSync(stop, synced...) {
+		klog.Warningf("failed to wait for caches to sync")
+		return
+	}
+	ws.queue.Add(watchScopeKey)
+	go wait.Until(ws.worker, time.Second, stop)
+	<-stop
+}
+
+func (ws *watchScope) worker() {
+	for ws.processNext() {
+	}
+}
+
+func (ws *watchScope) processNext() bool {
+	key, quit := ws.queue.Get()
+	if quit {
+		return false
+	}
+	defer ws.queue.Done(key)
+	namespaces := ws.namespaces()
+	// the pods left gated in the namespaces that leave the scope are released while the pod watch still holds them,
+	// the namespaces they fail to be released in stay in the scope until they are
+	unreleased := ws.releaseLeavingNamespaces(namespaces)
+	if len(unreleased) > 0 {
+		namespaces = append(namespaces, unreleased...)
+		sort.Strings(namespaces)
+		ws.queue.AddRateLimited(key)
+	} else {
+		ws.queue.Forget(key)
+	}
+	for _, informer := range ws.scopedInformers {
+		informer.SetNamespaces(namespaces)
+	}
+	ws.scope = namespaces
+	return true
+}
+
+// releaseLeavingNamespaces releases the pods left gated in the namespaces of the scope missing from namespaces,
+// and returns the namespaces some of them failed to be released in
+func (ws *watchScope) releaseLeavingNamespaces(namespaces []string) []string {
+	if ws.releaseGatedPods == nil {
+		return nil
+	}
+	scoped := make(map[string]bool, len(namespaces))
+	for _, namespace := range namespaces {
+		scoped[namespace] = true
+	}
+	var unreleased []string
+	for _, namespace := range ws.scope {
+		if scoped[namespace] {
+			continue
+		}
+		if err := ws.releaseGatedPods(namespace); err != nil {
+			klog.Errorf("watchScope: failed to release the pods left gated in namespace %s: %v", namespace, err)
+			unreleased = append(unreleased, namespace)
+		}
+	}
+	return unreleased
+}
+
+// namespaces returns the gated namespaces and the ones covered by a quota, sorted
+func (ws *watchScope) namespaces() []string {
+	scoped := map[string]bool{}
+	for _, obj := range ws.arqInformer.GetIndexer().List() {
+		scoped[obj.(*v1alpha12.ApplicationAwareResourceQuota).Namespace] = true
+	}
+	var matchers []func(obj metav1.Object) (bool, error)
+	if ws.acrqInformer != nil {
+		for _, obj := range ws.acrqInformer.GetIndexer().List() {
+			acrq := obj.(*v1alpha12.ApplicationAwareClusterResourceQuota)
+			matcher, err := clusterquotamapping.GetObjectMatcher(acrq.Spec.Selector)
+			if err != nil {
+				klog.Errorf("watchScope: failed to match the namespaces of %s: %v", acrq.Name, err)
+				continue
+			}
+			matchers = append(matchers, matcher)
+		}
+	}
+	for _, obj := range ws.nsInformer.GetIndexer().List() {
+		ns := obj.(*v1.Namespace)
+		if ws.gatedNamespaceSelector.Matches(labels.Set(ns.Labels)) {
+			scoped[ns.Name] = true
+			continue
+		}
+		for _, matches := range matchers {
+			if match, err := matches(ns); err == nil && match {
+				scoped[ns.Name] = true
+				break
+			}
+		}
+	}
+	namespaces := make([]string, 0, len(scoped))
+	for namespace := range scoped {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
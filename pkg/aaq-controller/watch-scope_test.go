@@ -0,0 +1,75 @@
+package aaq_controller
+
+import (
+	"fmt"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	quotav1 "github.com/openshift/api/quota/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"kubevirt.io/application-aware-quota/pkg/informers"
+	testsutils "kubevirt.io/application-aware-quota/pkg/tests-utils"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("Watch scope", func() {
+	newNamespace := func(name string, nsLabels map[string]string) *v1.Namespace {
+		return &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: nsLabels}}
+	}
+
+	It("should scope the informers to the gated namespaces and the ones covered by a quota", func() {
+		nsInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{
+			newNamespace("gated", map[string]string{util.DefaultGatedNamespaceLabel: ""}),
+			newNamespace("with-arq", nil),
+			newNamespace("with-acrq", map[string]string{"team": "a"}),
+			newNamespace("ignored", map[string]string{"team": "b"}),
+		})
+		arqInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{
+			&v1alpha12.ApplicationAwareResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: "arq", Namespace: "with-arq"}},
+		})
+		acrq := &v1alpha12.ApplicationAwareClusterResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: "acrq"}}
+		acrq.Spec.Selector = quotav1.ClusterResourceQuotaSelector{LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}}
+		acrqInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{acrq})
+		podInformer := informers.NewScopedInformer(&cache.ListWatch{}, &v1.Pod{}, 0)
+		selector, err := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{{Key: util.DefaultGatedNamespaceLabel, Operator: metav1.LabelSelectorOpExists}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		ws := newWatchScope(selector, nsInformer, arqInformer, acrqInformer, podInformer)
+		ws.queue.Add(watchScopeKey)
+		Expect(ws.processNext()).To(BeTrue())
+		Expect(podInformer.Namespaces()).To(ConsistOf("gated", "with-arq", "with-acrq"))
+
+		// without cluster quotas, only the namespaces with an arq are covered
+		ws = newWatchScope(selector, nsInformer, arqInformer, nil, podInformer)
+		Expect(ws.namespaces()).To(Equal([]string{"gated", "with-arq"}))
+	})
+
+	It("should release the pods left gated in the namespaces leaving the scope before dropping them", func() {
+		nsInformer := testsutils.NewFakeSharedIndexInformer([]metav1.Object{newNamespace("leaving", nil), newNamespace("failing", nil)})
+		arqInformer := testsutils.NewFakeSharedIndexInformer(nil)
+		podInformer := informers.NewScopedInformer(&cache.ListWatch{}, &v1.Pod{}, 0)
+		ws := newWatchScope(labels.Nothing(), nsInformer, arqInformer, nil, podInformer)
+		ws.scope = []string{"failing", "leaving"}
+		podInformer.SetNamespaces(ws.scope)
+		var released []string
+		ws.releaseGatedPods = func(namespace string) error {
+			released = append(released, namespace)
+			if namespace == "failing" {
+				return fmt.Errorf("failed to release")
+			}
+			return nil
+		}
+
+		ws.queue.Add(watchScopeKey)
+		Expect(ws.processNext()).To(BeTrue())
+		Expect(released).To(ConsistOf("failing", "leaving"))
+		// the namespace the pods failed to be released in stays in the scope until they are
+		Expect(podInformer.Namespaces()).To(ConsistOf("failing"))
+		Expect(ws.queue.NumRequeues(watchScopeKey)).To(Equal(1))
+	})
+})
@@ -16,6 +16,7 @@ const (
 
 func addReconcileCallbacks(r *ReconcileAAQ) {
 	r.reconciler.AddCallback(&corev1.ServiceAccount{}, reconcileSCC)
+	r.reconciler.AddCallback(&corev1.Service{}, reconcileMonitoring)
 }
 
 func reconcileSCC(args *callbacks.ReconcileCallbackArgs) error {
@@ -10,11 +10,13 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/openshift/library-go/pkg/operator/certrotation"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 	"kubevirt.io/application-aware-quota/pkg/aaq-operator/resources/cert"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
 )
 
 func newCertManagerForTest(client kubernetes.Interface, namespace string) CertManager {
@@ -108,6 +110,31 @@ var _ = Describe("Cert rotation tests", func() {
 			cancel()
 		})
 
+		It("should create the remote evaluators certificates", func() {
+			client := fake.NewSimpleClientset()
+			cm := newCertManagerForTest(client, namespace)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+
+			args := &cert.FactoryArgs{
+				Namespace: namespace,
+				RemoteEvaluators: []v1alpha1.RemoteEvaluator{
+					{Name: "deployed", Container: &corev1.Container{Name: "evaluator", Image: "evaluator"}},
+					{Name: "external", Address: "evaluator.other.svc:9443"},
+				},
+			}
+			Expect(cm.Sync(cert.CreateCertificateDefinitions(args))).To(Succeed())
+
+			checkCerts(client, namespace, true)
+			checkSecret(client, namespace, util.EvaluatorSignerSecretName, true)
+			checkConfigMap(client, namespace, util.EvaluatorSignerBundleName, true)
+			checkSecret(client, namespace, util.EvaluatorClientCertSecretName, true)
+			checkSecret(client, namespace, util.RemoteEvaluatorCertSecretName("deployed"), true)
+			checkSecret(client, namespace, util.RemoteEvaluatorCertSecretName("external"), false)
+		})
+
 		It("should update certs", func() {
 			client := fake.NewSimpleClientset()
 			cm := newCertManagerForTest(client, namespace)
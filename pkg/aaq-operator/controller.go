@@ -224,6 +224,9 @@ func (r *ReconcileAAQ) getConfigMap() (*corev1.ConfigMap, error) {
 
 func (r *ReconcileAAQ) getCertificateDefinitions(aaq *v1alpha1.AAQ) []aaqcerts.CertificateDefinition {
 	args := &aaqcerts.FactoryArgs{Namespace: r.namespace}
+	if aaq != nil {
+		args.RemoteEvaluators = aaq.Spec.Configuration.RemoteEvaluators
+	}
 
 	if aaq != nil && aaq.Spec.CertConfig != nil {
 		if aaq.Spec.CertConfig.CA != nil {
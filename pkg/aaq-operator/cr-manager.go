@@ -110,13 +110,16 @@ func (r *ReconcileAAQ) GetAllResources(crObject client.Object) ([]client.Object,
 	resources = append(resources, drs...)
 
 	certs := r.getCertificateDefinitions(cr)
+	// certificates issued by the same signer share its secret and bundle
+	signers := make(map[string]bool)
 	for _, cert := range certs {
-		if cert.SignerSecret != nil {
+		if cert.SignerSecret != nil && !signers[cert.SignerSecret.Name] {
+			signers[cert.SignerSecret.Name] = true
 			resources = append(resources, cert.SignerSecret)
-		}
 
-		if cert.CertBundleConfigmap != nil {
-			resources = append(resources, cert.CertBundleConfigmap)
+			if cert.CertBundleConfigmap != nil {
+				resources = append(resources, cert.CertBundleConfigmap)
+			}
 		}
 
 		if cert.TargetSecret != nil {
@@ -0,0 +1,165 @@
+package aaq_operator
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	"kubevirt.io/controller-lifecycle-operator-sdk/pkg/sdk/callbacks"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	serviceMonitorName = "aaq-controller"
+	prometheusRuleName = "aaq-prometheus-rules"
+)
+
+var (
+	serviceMonitorGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "ServiceMonitor"}
+	prometheusRuleGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "PrometheusRule"}
+)
+
+func reconcileMonitoring(args *callbacks.ReconcileCallbackArgs) error {
+	switch args.State {
+	case callbacks.ReconcileStatePreCreate, callbacks.ReconcileStatePostRead:
+	default:
+		return nil
+	}
+
+	service := args.DesiredObject.(*corev1.Service)
+	if service.Name != util.ControllerMetricsServiceName {
+		return nil
+	}
+
+	cr := args.Resource.(runtime.Object)
+	if err := ensureMonitoringExists(context.TODO(), args.Logger, args.Client, args.Namespace); err != nil {
+		args.Recorder.Event(cr, corev1.EventTypeWarning, createResourceFailed, fmt.Sprintf("Failed to ensure monitoring resources exist, %v", err))
+		return err
+	}
+	return nil
+}
+
+// ensureMonitoringExists creates the ServiceMonitor that scrapes the controller and its default alerts,
+// if the prometheus operator is installed
+func ensureMonitoringExists(ctx context.Context, logger logr.Logger, c client.Client, namespace string) error {
+	for _, desired := range []*unstructured.Unstructured{newServiceMonitor(namespace), newPrometheusRule(namespace)} {
+		if err := ensureUnstructuredExists(ctx, c, desired); meta.IsNoMatchError(err) {
+			logger.V(3).Info("No match error for monitoring resources, prometheus operator must not be installed")
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ensureUnstructuredExists(ctx context.Context, c client.Client, desired *unstructured.Unstructured) error {
+	cr, err := util.GetActiveAAQ(c)
+	if err != nil {
+		return err
+	}
+	if cr != nil {
+		util.SetRecommendedLabels(desired, util.GetRecommendedInstallerLabelsFromCr(cr), "aaq-operator")
+	}
+
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(desired.GroupVersionKind())
+	err = c.Get(ctx, client.ObjectKey{Namespace: desired.GetNamespace(), Name: desired.GetName()}, current)
+	if errors.IsNotFound(err) {
+		if err := SetOwnerRuntime(c, desired); err != nil {
+			return err
+		}
+		return c.Create(ctx, desired)
+	} else if err != nil {
+		return err
+	}
+
+	if apiequality.Semantic.DeepEqual(current.Object["spec"], desired.Object["spec"]) {
+		return nil
+	}
+	current.Object["spec"] = desired.Object["spec"]
+	return c.Update(ctx, current)
+}
+
+func newServiceMonitor(namespace string) *unstructured.Unstructured {
+	serviceMonitor := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"selector": map[string]interface{}{
+				"matchLabels": map[string]interface{}{
+					util.AAQLabel: util.ControllerResourceName,
+				},
+			},
+			"namespaceSelector": map[string]interface{}{
+				"matchNames": []interface{}{namespace},
+			},
+			"endpoints": []interface{}{
+				map[string]interface{}{
+					"port":   "metrics",
+					"path":   "/metrics",
+					"scheme": "https",
+					"tlsConfig": map[string]interface{}{
+						"insecureSkipVerify": true,
+					},
+				},
+			},
+		},
+	}}
+	serviceMonitor.SetGroupVersionKind(serviceMonitorGVK)
+	serviceMonitor.SetNamespace(namespace)
+	serviceMonitor.SetName(serviceMonitorName)
+	return serviceMonitor
+}
+
+func newPrometheusRule(namespace string) *unstructured.Unstructured {
+	controllerJob := fmt.Sprintf(`job="%s"`, util.ControllerMetricsServiceName)
+	prometheusRule := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"groups": []interface{}{
+				map[string]interface{}{
+					"name": "aaq.rules",
+					"rules": []interface{}{
+						alertRule("AAQControllerDown", fmt.Sprintf("absent(up{%s} == 1)", controllerJob), "10m", "critical",
+							"No AAQ controller is up, gated pods are not released"),
+						alertRule("AAQAuditRecordsDropped", "rate(aaq_audit_records_dropped_total[5m]) > 0", "10m", "warning",
+							"AAQ controller fails to write gate decisions to its audit log sink"),
+						alertRule("AAQInvalidCELCalculators", "aaq_invalid_cel_calculators > 0", "5m", "warning",
+							"Some CEL calculators of the AAQ CR failed to compile and are skipped"),
+						alertRule("AAQPodsGatedTooLong", "histogram_quantile(0.9, sum(rate(aaq_gated_pod_release_duration_seconds_bucket[30m])) by (le)) > 1800", "30m", "warning",
+							"Most pods released by AAQ in the last 30 minutes were gated for more than 30 minutes"),
+						alertRule("AAQQuotaNearlyExhausted", "aaq_quota_used / (aaq_quota_hard > 0) > 0.9", "15m", "warning",
+							"{{ $labels.kind }} {{ $labels.namespace }}/{{ $labels.name }} uses more than 90% of its {{ $labels.resource }} hard limit"),
+						alertRule("AAQSidecarCalculatorErrors", "rate(aaq_sidecar_calculator_errors_total[5m]) > 0", "10m", "warning",
+							"Usage calculator sidecar {{ $labels.sidecar }} is failing, the pod evaluator is used instead"),
+						alertRule("AAQWorkqueueBacklog", fmt.Sprintf("workqueue_depth{%s} > 100", controllerJob), "15m", "warning",
+							"AAQ controller workqueue {{ $labels.name }} is not keeping up"),
+					},
+				},
+			},
+		},
+	}}
+	prometheusRule.SetGroupVersionKind(prometheusRuleGVK)
+	prometheusRule.SetNamespace(namespace)
+	prometheusRule.SetName(prometheusRuleName)
+	return prometheusRule
+}
+
+func alertRule(name, expr, forDuration, severity, summary string) map[string]interface{} {
+	return map[string]interface{}{
+		"alert": name,
+		"expr":  expr,
+		"for":   forDuration,
+		"labels": map[string]interface{}{
+			"severity": severity,
+		},
+		"annotations": map[string]interface{}{
+			"summary": summary,
+		},
+	}
+}
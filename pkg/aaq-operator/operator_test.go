@@ -1379,6 +1379,7 @@ func createNotReadyEventValidationMap() map[string]bool {
 	match[normalCreateSuccess+" *v1.ServiceAccount aaq-controller"] = false
 	match[normalCreateSuccess+" *v1.ServiceAccount aaq-server"] = false
 	match[normalCreateSuccess+" *v1.Service aaq-server"] = false
+	match[normalCreateSuccess+" *v1.Service aaq-controller-metrics"] = false
 	match[normalCreateSuccess+" *v1.Deployment aaq-server"] = false
 	match[normalCreateSuccess+" *v1.Deployment aaq-controller"] = false
 	match[normalCreateSuccess+" *v1.MutatingWebhookConfiguration gating-mutator"] = false
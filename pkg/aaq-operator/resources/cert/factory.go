@@ -5,6 +5,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"kubevirt.io/application-aware-quota/pkg/aaq-operator/resources/cluster"
 	"kubevirt.io/application-aware-quota/pkg/util"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
 	"time"
 )
 
@@ -19,6 +20,10 @@ type FactoryArgs struct {
 	TargetDuration *time.Duration
 	// Duration to subtract from cert NotAfter value
 	TargetRenewBefore *time.Duration
+
+	// RemoteEvaluators get a client certificate for the controller to call them with,
+	// and the ones deployed by the operator a serving certificate
+	RemoteEvaluators []v1alpha1.RemoteEvaluator
 }
 
 // CertificateConfig contains cert configuration data
@@ -53,6 +58,9 @@ type CertificateDefinition struct {
 // CreateCertificateDefinitions creates certificate definitions
 func CreateCertificateDefinitions(args *FactoryArgs) []CertificateDefinition {
 	defs := createCertificateDefinitions()
+	if len(args.RemoteEvaluators) > 0 {
+		defs = append(defs, createEvaluatorCertificateDefinitions(args.RemoteEvaluators)...)
+	}
 	for i := range defs {
 		def := &defs[i]
 
@@ -118,6 +126,45 @@ func createCertificateDefinitions() []CertificateDefinition {
 	}
 }
 
+// createEvaluatorCertificateDefinitions issues the certificates of the remote evaluators from a CA of their own,
+// so evaluators owned by other teams can trust the controller client certificate without trusting the aaq-server
+func createEvaluatorCertificateDefinitions(evaluators []v1alpha1.RemoteEvaluator) []CertificateDefinition {
+	signerConfig := CertificateConfig{
+		Lifetime: 48 * time.Hour,
+		Refresh:  24 * time.Hour,
+	}
+	targetConfig := CertificateConfig{
+		Lifetime: 24 * time.Hour,
+		Refresh:  12 * time.Hour,
+	}
+	defs := []CertificateDefinition{
+		{
+			Configurable:        true,
+			SignerSecret:        createSecret(util.EvaluatorSignerSecretName),
+			SignerConfig:        signerConfig,
+			CertBundleConfigmap: createConfigMap(util.EvaluatorSignerBundleName),
+			TargetSecret:        createSecret(util.EvaluatorClientCertSecretName),
+			TargetConfig:        targetConfig,
+			TargetUser:          &[]string{util.ControllerServiceAccountName}[0],
+		},
+	}
+	for _, evaluator := range evaluators {
+		if evaluator.Container == nil {
+			continue
+		}
+		defs = append(defs, CertificateDefinition{
+			Configurable:        true,
+			SignerSecret:        createSecret(util.EvaluatorSignerSecretName),
+			SignerConfig:        signerConfig,
+			CertBundleConfigmap: createConfigMap(util.EvaluatorSignerBundleName),
+			TargetSecret:        createSecret(util.RemoteEvaluatorCertSecretName(evaluator.Name)),
+			TargetConfig:        targetConfig,
+			TargetService:       &[]string{util.RemoteEvaluatorResourceName(evaluator.Name)}[0],
+		})
+	}
+	return defs
+}
+
 func createSecret(name string) *corev1.Secret {
 	return &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
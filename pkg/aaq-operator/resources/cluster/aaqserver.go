@@ -17,9 +17,14 @@ const (
 	MutatingWebhookConfigurationName   = "gating-mutator"
 	validatingWebhookConfigurationName = "aaq-validator"
 	AaqServerServiceName               = "aaq-server"
-	DefaultNamespaceSelectorLabel      = "application-aware-quota/enable-gating"
+	DefaultNamespaceSelectorLabel      = util.DefaultGatedNamespaceLabel
 )
 
+// celCalculatorsChangedExpression matches the AAQ updates setting CEL calculators that differ from the old ones
+const celCalculatorsChangedExpression = `has(object.spec.configuration) && has(object.spec.configuration.celCalculators) &&
+!(has(oldObject.spec.configuration) && has(oldObject.spec.configuration.celCalculators) &&
+oldObject.spec.configuration.celCalculators == object.spec.configuration.celCalculators)`
+
 func createStaticAAQLockResources(args *FactoryArgs) []client.Object {
 	return []client.Object{
 		createAPIServerClusterRole(),
@@ -60,6 +65,67 @@ func getAaqServerClusterPolicyRules() []rbacv1.PolicyRule {
 				"create",
 			},
 		},
+		{
+			APIGroups: []string{
+				"",
+			},
+			Resources: []string{
+				"pods",
+			},
+			Verbs: []string{
+				"list",
+				"watch",
+			},
+		},
+		{
+			APIGroups: []string{
+				"aaq.kubevirt.io",
+			},
+			Resources: []string{
+				"applicationawareresourcequotas",
+				"applicationawareclusterresourcequotas",
+			},
+			Verbs: []string{
+				"list",
+				"watch",
+			},
+		},
+		{
+			APIGroups: []string{
+				"kubevirt.io",
+			},
+			Resources: []string{
+				"virtualmachineinstances",
+				"virtualmachineinstancemigrations",
+			},
+			Verbs: []string{
+				"watch",
+				"list",
+				"get",
+			},
+		},
+		{
+			APIGroups: []string{
+				"authentication.k8s.io",
+			},
+			Resources: []string{
+				"tokenreviews",
+			},
+			Verbs: []string{
+				"create",
+			},
+		},
+		{
+			APIGroups: []string{
+				"authorization.k8s.io",
+			},
+			Resources: []string{
+				"subjectaccessreviews",
+			},
+			Verbs: []string{
+				"create",
+			},
+		},
 	}
 }
 
@@ -295,6 +361,46 @@ func createGatingValidatingWebhook(namespace string, c client.Client, l logr.Log
 		},
 	})
 
+	// CEL calculators are compiled on the updates that change them, other updates such as the operator removing
+	// the finalizer of the CR don't go through the webhook so they don't fail while the aaq-server is down.
+	// The CR is created before the aaq-server runs, the CRD schema validates the calculators on creation
+	mhc.Webhooks = append(mhc.Webhooks, admissionregistrationv1.ValidatingWebhook{
+		Name:                    "aaq.cr.update.validator",
+		AdmissionReviewVersions: []string{"v1", "v1beta1"},
+		FailurePolicy:           &failurePolicy,
+		SideEffects:             &sideEffect,
+		MatchPolicy:             &exactPolicy,
+		MatchConditions: []admissionregistrationv1.MatchCondition{
+			{
+				Name:       "cel-calculators-changed",
+				Expression: celCalculatorsChangedExpression,
+			},
+		},
+		Rules: []admissionregistrationv1.RuleWithOperations{
+			{
+				Operations: []admissionregistrationv1.OperationType{
+					admissionregistrationv1.Update,
+				},
+				Rule: admissionregistrationv1.Rule{
+					APIGroups:   []string{"*"},
+					APIVersions: []string{"*"},
+					Scope:       &clusterScope,
+					Resources:   []string{"aaqs"},
+				},
+			},
+		},
+
+		ClientConfig: admissionregistrationv1.WebhookClientConfig{
+			Service: &admissionregistrationv1.ServiceReference{
+				Namespace: namespace,
+				Name:      AaqServerServiceName,
+				Path:      &path,
+				Port:      &defaultServicePort,
+			},
+			CABundle: bundle,
+		},
+	})
+
 	if !cr.Spec.Configuration.AllowApplicationAwareClusterResourceQuota {
 		return mhc
 	}
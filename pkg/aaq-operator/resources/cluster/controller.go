@@ -43,6 +43,41 @@ func getControllerClusterPolicyRules() []rbacv1.PolicyRule {
 				"list",
 				"watch",
 				"get",
+				"delete",
+			},
+		},
+		{
+			APIGroups: []string{
+				"",
+			},
+			Resources: []string{
+				"pods/status",
+			},
+			Verbs: []string{
+				"update",
+			},
+		},
+		{
+			APIGroups: []string{
+				"",
+			},
+			Resources: []string{
+				"pods/eviction",
+			},
+			Verbs: []string{
+				"create",
+			},
+		},
+		{
+			APIGroups: []string{
+				"policy",
+			},
+			Resources: []string{
+				"poddisruptionbudgets",
+			},
+			Verbs: []string{
+				"list",
+				"watch",
 			},
 		},
 		{
@@ -278,6 +313,18 @@ func getControllerClusterPolicyRules() []rbacv1.PolicyRule {
 				"watch",
 			},
 		},
+		{
+			APIGroups: []string{
+				"aaq.kubevirt.io",
+			},
+			Resources: []string{
+				"aaqs/status",
+			},
+			Verbs: []string{
+				"update",
+				"patch",
+			},
+		},
 	}
 }
 
@@ -5,24 +5,63 @@ import (
 	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utils2 "kubevirt.io/application-aware-quota/pkg/util"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
 
 	sdkapi "kubevirt.io/controller-lifecycle-operator-sdk/api"
 )
 
 func createAAQServerResources(args *FactoryArgs) []client.Object {
+	var configName v1alpha1.VmiCalcConfigName
+	var tracingConfig v1alpha1.TracingConfiguration
+	var celCalculators []v1alpha1.CELCalculator
+	var wasmCalculators []v1alpha1.WasmCalculator
+	var calculatorPolicies []v1alpha1.CalculatorPolicy
+	var composition v1alpha1.CalculatorCompositionStrategy
+	var usageCacheConfig v1alpha1.UsageCacheConfiguration
+	var controllerCalculators []string
+	var informerConfig v1alpha1.InformerConfiguration
+	var clusterQuotaEnabled bool
+	if args.Client != nil {
+		if cr, _ := utils2.GetActiveAAQ(args.Client); cr != nil {
+			configName = cr.Spec.Configuration.VmiCalculatorConfiguration.ConfigName
+			tracingConfig = cr.Spec.Configuration.TracingConfiguration
+			celCalculators = cr.Spec.Configuration.CELCalculators
+			wasmCalculators = cr.Spec.Configuration.WasmCalculators
+			calculatorPolicies = cr.Spec.Configuration.CalculatorPolicies
+			composition = cr.Spec.Configuration.CalculatorComposition
+			usageCacheConfig = cr.Spec.Configuration.UsageCacheConfiguration
+			controllerCalculators = controllerCalculatorNames(cr.Spec.Configuration.SidecarEvaluators, cr.Spec.Configuration.RemoteEvaluators)
+			informerConfig = cr.Spec.Configuration.InformerConfiguration
+			clusterQuotaEnabled = cr.Spec.Configuration.AllowApplicationAwareClusterResourceQuota
+		}
+	}
 	return []client.Object{
 		createAAQServerRole(),
 		createAAQServerRoleBinding(),
 		createAAQServerServiceAccount(),
 		createAAQServerService(),
-		createAAQServerDeployment(args.AaqServerImage, args.PullPolicy, args.ImagePullSecrets, args.PriorityClassName, args.Verbosity, args.InfraNodePlacement, args.OnOpenshift),
+		createAAQServerDeployment(args.AaqServerImage, args.PullPolicy, args.ImagePullSecrets, args.PriorityClassName, args.Verbosity, args.InfraNodePlacement, args.OnOpenshift, configName, tracingConfig, celCalculators, wasmCalculators, calculatorPolicies, composition, usageCacheConfig, controllerCalculators, informerConfig, clusterQuotaEnabled),
+	}
+}
+
+// controllerCalculatorNames names the calculators that only run alongside the aaq-controller, dry runs can't evaluate them.
+// Sidecars serve on a socket named after their container and the aaq-controller names them after it as well
+func controllerCalculatorNames(sidecarEvaluators []corev1.Container, remoteEvaluators []v1alpha1.RemoteEvaluator) []string {
+	var names []string
+	for _, sidecar := range sidecarEvaluators {
+		names = append(names, "sidecar/"+sidecar.Name)
 	}
+	for _, remote := range remoteEvaluators {
+		names = append(names, "remote/"+remote.Name)
+	}
+	return names
 }
 
 func createAAQServerServiceAccount() *corev1.ServiceAccount {
@@ -45,7 +84,7 @@ func createAAQServerService() *corev1.Service {
 	return service
 }
 
-func createAAQServerDeployment(image, pullPolicy string, imagePullSecrets []corev1.LocalObjectReference, priorityClassName string, verbosity string, infraNodePlacement *sdkapi.NodePlacement, onOpenshift bool) *appsv1.Deployment {
+func createAAQServerDeployment(image, pullPolicy string, imagePullSecrets []corev1.LocalObjectReference, priorityClassName string, verbosity string, infraNodePlacement *sdkapi.NodePlacement, onOpenshift bool, configName v1alpha1.VmiCalcConfigName, tracingConfig v1alpha1.TracingConfiguration, celCalculators []v1alpha1.CELCalculator, wasmCalculators []v1alpha1.WasmCalculator, calculatorPolicies []v1alpha1.CalculatorPolicy, composition v1alpha1.CalculatorCompositionStrategy, usageCacheConfig v1alpha1.UsageCacheConfiguration, controllerCalculators []string, informerConfig v1alpha1.InformerConfiguration, clusterQuotaEnabled bool) *appsv1.Deployment {
 	defaultMode := corev1.ConfigMapVolumeSourceDefaultMode
 	deployment := utils2.CreateDeployment(utils2.AaqServerResourceName, utils2.AAQLabel, utils2.AaqServerResourceName, utils2.AaqServerResourceName, imagePullSecrets, 2, infraNodePlacement)
 	if priorityClassName != "" {
@@ -63,6 +102,22 @@ func createAAQServerDeployment(image, pullPolicy string, imagePullSecrets []core
 	if onOpenshift {
 		container.Args = append(container.Args, []string{"--" + utils2.IsOnOpenshift, "true"}...)
 	}
+	if configName != "" {
+		container.Args = append(container.Args, []string{"--" + utils2.VMICalculatorConfiguration, string(configName)}...)
+	}
+	container.Args = append(container.Args, tracingConfigurationArgs(tracingConfig)...)
+	container.Args = append(container.Args, celCalculatorsArgs(celCalculators)...)
+	container.Args = append(container.Args, wasmCalculatorsArgs(wasmCalculators)...)
+	container.Args = append(container.Args, calculatorPoliciesArgs(calculatorPolicies)...)
+	container.Args = append(container.Args, calculatorCompositionArgs(composition)...)
+	container.Args = append(container.Args, usageCacheConfigurationArgs(usageCacheConfig)...)
+	container.Args = append(container.Args, stripPodFieldsArgs(informerConfig)...)
+	if clusterQuotaEnabled {
+		container.Args = append(container.Args, []string{"--" + utils2.EnableClusterQuota, "true"}...)
+	}
+	if len(controllerCalculators) > 0 {
+		container.Args = append(container.Args, []string{"--" + utils2.ControllerCalculatorsFlag, strings.Join(controllerCalculators, ",")}...)
+	}
 	container.Env = []corev1.EnvVar{
 		{
 			Name: utils2.InstallerPartOfLabel,
@@ -177,6 +232,17 @@ func createAAQServerRole() *rbacv1.Role {
 				"watch",
 			},
 		},
+		{
+			APIGroups: []string{
+				"",
+			},
+			Resources: []string{
+				"configmaps",
+			},
+			Verbs: []string{
+				"get",
+			},
+		},
 	}
 	return utils2.ResourceBuilder.CreateRole(utils2.AaqServerResourceName, rules)
 }
@@ -1,6 +1,7 @@
 package namespaced
 
 import (
+	"encoding/json"
 	"fmt"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -11,8 +12,10 @@ import (
 	utils2 "kubevirt.io/application-aware-quota/pkg/util"
 	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
 	sdkapi "kubevirt.io/controller-lifecycle-operator-sdk/api"
+	"path/filepath"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"strconv"
+	"strings"
 )
 
 func createAAQControllerResources(args *FactoryArgs) []client.Object {
@@ -24,7 +27,8 @@ func createAAQControllerResources(args *FactoryArgs) []client.Object {
 		createAAQControllerServiceAccount(),
 		createControllerRoleBinding(),
 		createControllerRole(),
-		createAAQControllerDeployment(args.ControllerImage, args.Verbosity, args.PullPolicy, args.ImagePullSecrets, args.PriorityClassName, args.InfraNodePlacement, cr.Spec.Configuration.AllowApplicationAwareClusterResourceQuota, args.OnOpenshift, cr.Spec.Configuration.VmiCalculatorConfiguration.ConfigName, args.Client),
+		createAAQControllerMetricsService(),
+		createAAQControllerDeployment(args.ControllerImage, args.Verbosity, args.PullPolicy, args.ImagePullSecrets, args.PriorityClassName, args.InfraNodePlacement, cr.Spec.Configuration.AllowApplicationAwareClusterResourceQuota, args.OnOpenshift, cr.Spec.Configuration.VmiCalculatorConfiguration.ConfigName, args.Namespace, args.Client),
 	}
 }
 func createControllerRoleBinding() *rbacv1.RoleBinding {
@@ -98,9 +102,9 @@ func createAAQControllerServiceAccount() *corev1.ServiceAccount {
 	return utils2.ResourceBuilder.CreateServiceAccount(utils2.ControllerResourceName)
 }
 
-func createAAQControllerDeployment(image, verbosity, pullPolicy string, imagePullSecrets []corev1.LocalObjectReference, priorityClassName string, infraNodePlacement *sdkapi.NodePlacement, enableClusterQuota bool, onOpenshift bool, configName v1alpha1.VmiCalcConfigName, c client.Client) *appsv1.Deployment {
+func createAAQControllerDeployment(image, verbosity, pullPolicy string, imagePullSecrets []corev1.LocalObjectReference, priorityClassName string, infraNodePlacement *sdkapi.NodePlacement, enableClusterQuota bool, onOpenshift bool, configName v1alpha1.VmiCalcConfigName, namespace string, c client.Client) *appsv1.Deployment {
 	defaultMode := corev1.ConfigMapVolumeSourceDefaultMode
-	deployment := utils2.CreateDeployment(utils2.ControllerResourceName, utils2.AAQLabel, utils2.ControllerResourceName, utils2.ControllerResourceName, imagePullSecrets, 2, infraNodePlacement)
+	deployment := utils2.CreateDeployment(utils2.ControllerResourceName, utils2.AAQLabel, utils2.ControllerResourceName, utils2.ControllerResourceName, imagePullSecrets, utils2.DefaultControllerReplicas, infraNodePlacement)
 	if priorityClassName != "" {
 		deployment.Spec.Template.Spec.PriorityClassName = priorityClassName
 	}
@@ -171,9 +175,60 @@ func createAAQControllerDeployment(image, verbosity, pullPolicy string, imagePul
 
 	cr, _ := utils2.GetActiveAAQ(c)
 	var Containers []corev1.Container
+	auditLogDir := ""
+	remoteEvaluatorsEnabled := false
 	if cr != nil {
 		container.Args = append(container.Args, []string{"--" + utils2.SidecarEvaluatorsNumberFlag, strconv.Itoa(len(cr.Spec.Configuration.SidecarEvaluators))}...)
-		Containers = cr.Spec.Configuration.SidecarEvaluators
+		container.Args = append(container.Args, queueingConfigurationArgs(cr.Spec.Configuration.QueueingConfiguration)...)
+		container.Args = append(container.Args, gateTTLConfigurationArgs(cr.Spec.Configuration.GateTTLConfiguration)...)
+		container.Args = append(container.Args, tracingConfigurationArgs(cr.Spec.Configuration.TracingConfiguration)...)
+		container.Args = append(container.Args, auditLogConfigurationArgs(cr.Spec.Configuration.AuditLogConfiguration)...)
+		container.Args = append(container.Args, calculatorPoliciesArgs(cr.Spec.Configuration.CalculatorPolicies)...)
+		container.Args = append(container.Args, calculatorCompositionArgs(cr.Spec.Configuration.CalculatorComposition)...)
+		container.Args = append(container.Args, usageCacheConfigurationArgs(cr.Spec.Configuration.UsageCacheConfiguration)...)
+		container.Args = append(container.Args, remoteEvaluatorsArgs(cr.Spec.Configuration.RemoteEvaluators, namespace)...)
+		container.Args = append(container.Args, celCalculatorsArgs(cr.Spec.Configuration.CELCalculators)...)
+		container.Args = append(container.Args, wasmCalculatorsArgs(cr.Spec.Configuration.WasmCalculators)...)
+		container.Args = append(container.Args, shardingConfigurationArgs(cr.Spec.Configuration.ShardingConfiguration)...)
+		container.Args = append(container.Args, informerConfigurationArgs(cr.Spec.Configuration.InformerConfiguration, cr.Spec.NamespaceSelector)...)
+		container.Args = append(container.Args, eventCoalescingConfigurationArgs(cr.Spec.Configuration.EventCoalescingConfiguration)...)
+		if cr.Spec.Configuration.ShardingConfiguration.Shards > 0 && cr.Spec.Configuration.ShardingConfiguration.Replicas != nil {
+			deployment.Spec.Replicas = cr.Spec.Configuration.ShardingConfiguration.Replicas
+		}
+		if len(cr.Spec.Configuration.RemoteEvaluators) > 0 {
+			remoteEvaluatorsEnabled = true
+			container.VolumeMounts = append(container.VolumeMounts,
+				corev1.VolumeMount{
+					Name:      evaluatorClientCertVolumeName,
+					MountPath: utils2.EvaluatorClientCertDir,
+					ReadOnly:  true,
+				},
+				corev1.VolumeMount{
+					Name:      evaluatorCABundleVolumeName,
+					MountPath: utils2.EvaluatorCABundleDir,
+					ReadOnly:  true,
+				},
+			)
+		}
+		if cr.Spec.Configuration.AuditLogConfiguration.Sink == v1alpha1.AuditLogFile {
+			auditLogDir = filepath.Dir(utils2.DefaultAuditLogPath)
+			if cr.Spec.Configuration.AuditLogConfiguration.Path != "" {
+				auditLogDir = filepath.Dir(cr.Spec.Configuration.AuditLogConfiguration.Path)
+			}
+			container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+				Name:      utils2.AuditLogVolumeName,
+				MountPath: auditLogDir,
+			})
+		}
+		if cr.Spec.Configuration.EnablePreemption {
+			container.Args = append(container.Args, []string{"--" + utils2.EnablePreemptionFlag, "true"}...)
+		}
+		for _, sidecar := range cr.Spec.Configuration.SidecarEvaluators {
+			// the sidecars serve on a socket named after their container, so a restarted sidecar keeps its identity
+			sidecarCopy := sidecar.DeepCopy()
+			sidecarCopy.Env = append(sidecarCopy.Env, corev1.EnvVar{Name: utils2.SidecarNameEnvVar, Value: sidecar.Name})
+			Containers = append(Containers, *sidecarCopy)
+		}
 	}
 	Containers = append(Containers, container)
 	deployment.Spec.Template.Spec.Containers = Containers
@@ -204,6 +259,29 @@ func createAAQControllerDeployment(image, verbosity, pullPolicy string, imagePul
 			},
 		},
 	}
+	// the File sink is ephemeral, records meant to be kept go to the Stdout or the HTTP sink
+	if auditLogDir != "" {
+		deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes, corev1.Volume{
+			Name: utils2.AuditLogVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+	}
+	if remoteEvaluatorsEnabled {
+		deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes,
+			corev1.Volume{
+				Name: evaluatorClientCertVolumeName,
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{
+						SecretName:  utils2.EvaluatorClientCertSecretName,
+						DefaultMode: &defaultMode,
+					},
+				},
+			},
+			evaluatorCABundleVolume(),
+		)
+	}
 	if infraNodePlacement == nil {
 		deployment.Spec.Template.Spec.Affinity = &corev1.Affinity{
 			PodAntiAffinity: &corev1.PodAntiAffinity{
@@ -224,6 +302,22 @@ func createAAQControllerDeployment(image, verbosity, pullPolicy string, imagePul
 	return deployment
 }
 
+func createAAQControllerMetricsService() *corev1.Service {
+	service := utils2.ResourceBuilder.CreateService(utils2.ControllerMetricsServiceName, utils2.AAQLabel, utils2.ControllerResourceName, nil)
+	service.Spec.Ports = []corev1.ServicePort{
+		{
+			Name: "metrics",
+			Port: 8443,
+			TargetPort: intstr.IntOrString{
+				Type:   intstr.Int,
+				IntVal: 8443,
+			},
+			Protocol: corev1.ProtocolTCP,
+		},
+	}
+	return service
+}
+
 func createAAQControllerPorts() []corev1.ContainerPort {
 	return []corev1.ContainerPort{
 		{
@@ -232,3 +326,168 @@ func createAAQControllerPorts() []corev1.ContainerPort {
 		},
 	}
 }
+
+func queueingConfigurationArgs(queueingConfig v1alpha1.QueueingConfiguration) []string {
+	var args []string
+	if queueingConfig.Policy != "" {
+		args = append(args, []string{"--" + utils2.QueueingPolicyFlag, string(queueingConfig.Policy)}...)
+	}
+	if queueingConfig.AgingPeriod != nil {
+		args = append(args, []string{"--" + utils2.QueueingAgingPeriodFlag, queueingConfig.AgingPeriod.Duration.String()}...)
+	}
+	return args
+}
+
+func gateTTLConfigurationArgs(gateTTLConfig v1alpha1.GateTTLConfiguration) []string {
+	var args []string
+	if gateTTLConfig.TTL != nil {
+		args = append(args, []string{"--" + utils2.GateTTLFlag, gateTTLConfig.TTL.Duration.String()}...)
+	}
+	if gateTTLConfig.ExpiryAction != "" {
+		args = append(args, []string{"--" + utils2.GateExpiryActionFlag, string(gateTTLConfig.ExpiryAction)}...)
+	}
+	return args
+}
+
+func tracingConfigurationArgs(tracingConfig v1alpha1.TracingConfiguration) []string {
+	var args []string
+	if tracingConfig.Endpoint != "" {
+		args = append(args, []string{"--" + utils2.TracingEndpointFlag, tracingConfig.Endpoint}...)
+	}
+	if tracingConfig.Insecure {
+		args = append(args, []string{"--" + utils2.TracingInsecureFlag, "true"}...)
+	}
+	return args
+}
+
+func auditLogConfigurationArgs(auditLogConfig v1alpha1.AuditLogConfiguration) []string {
+	var args []string
+	if auditLogConfig.Sink != "" {
+		args = append(args, []string{"--" + utils2.AuditLogSinkFlag, string(auditLogConfig.Sink)}...)
+	}
+	if auditLogConfig.Path != "" {
+		args = append(args, []string{"--" + utils2.AuditLogPathFlag, auditLogConfig.Path}...)
+	}
+	if auditLogConfig.URL != "" {
+		args = append(args, []string{"--" + utils2.AuditLogURLFlag, auditLogConfig.URL}...)
+	}
+	if auditLogConfig.Retention != nil {
+		args = append(args, []string{"--" + utils2.AuditLogRetentionFlag, auditLogConfig.Retention.Duration.String()}...)
+	}
+	if auditLogConfig.SamplingPercentage != nil {
+		args = append(args, []string{"--" + utils2.AuditLogSamplingPercentageFlag, strconv.Itoa(int(*auditLogConfig.SamplingPercentage))}...)
+	}
+	return args
+}
+
+// calculatorPoliciesArgs passes the policies as JSON since they are a list of structs
+func calculatorPoliciesArgs(calculatorPolicies []v1alpha1.CalculatorPolicy) []string {
+	if len(calculatorPolicies) == 0 {
+		return nil
+	}
+	policies, err := json.Marshal(calculatorPolicies)
+	if err != nil {
+		return nil
+	}
+	return []string{"--" + utils2.CalculatorPoliciesFlag, string(policies)}
+}
+
+// calculatorCompositionArgs passes the strategy to both the controller and the aaq-server, so that admission
+// computes the same usages as the controller
+func calculatorCompositionArgs(composition v1alpha1.CalculatorCompositionStrategy) []string {
+	if composition == "" {
+		return nil
+	}
+	return []string{"--" + utils2.CalculatorCompositionFlag, string(composition)}
+}
+
+func usageCacheConfigurationArgs(usageCacheConfig v1alpha1.UsageCacheConfiguration) []string {
+	var args []string
+	if usageCacheConfig.TTL != nil {
+		args = append(args, []string{"--" + utils2.UsageCacheTTLFlag, usageCacheConfig.TTL.Duration.String()}...)
+	}
+	if usageCacheConfig.MaxEntries != nil {
+		args = append(args, []string{"--" + utils2.UsageCacheMaxEntriesFlag, strconv.Itoa(int(*usageCacheConfig.MaxEntries))}...)
+	}
+	return args
+}
+
+// celCalculatorsArgs passes the calculators as JSON, they are compiled by both the controller and the aaq-server
+func celCalculatorsArgs(celCalculators []v1alpha1.CELCalculator) []string {
+	if len(celCalculators) == 0 {
+		return nil
+	}
+	calculators, err := json.Marshal(celCalculators)
+	if err != nil {
+		return nil
+	}
+	return []string{"--" + utils2.CELCalculatorsFlag, string(calculators)}
+}
+
+// wasmCalculatorsArgs passes the calculators as JSON, their modules are fetched by both the controller and the aaq-server
+func wasmCalculatorsArgs(wasmCalculators []v1alpha1.WasmCalculator) []string {
+	if len(wasmCalculators) == 0 {
+		return nil
+	}
+	calculators, err := json.Marshal(wasmCalculators)
+	if err != nil {
+		return nil
+	}
+	return []string{"--" + utils2.WasmCalculatorsFlag, string(calculators)}
+}
+
+// shardingConfigurationArgs passes the number of replicas along with the shards, since each replica claims an even part of them
+func shardingConfigurationArgs(shardingConfig v1alpha1.ShardingConfiguration) []string {
+	if shardingConfig.Shards <= 0 {
+		return nil
+	}
+	replicas := int32(utils2.DefaultControllerReplicas)
+	if shardingConfig.Replicas != nil {
+		replicas = *shardingConfig.Replicas
+	}
+	return []string{"--" + utils2.ShardsFlag, strconv.Itoa(int(shardingConfig.Shards)), "--" + utils2.ShardingReplicasFlag, strconv.Itoa(int(replicas))}
+}
+
+// stripPodFieldsArgs passes the pod fields the calculators require when the others are dropped from the cached pods,
+// the aaq-server caches pods for dry runs as well
+func stripPodFieldsArgs(informerConfig v1alpha1.InformerConfiguration) []string {
+	if !informerConfig.StripPodFields {
+		return nil
+	}
+	args := []string{"--" + utils2.StripPodFieldsFlag, "true"}
+	if len(informerConfig.CalculatorPodFields) > 0 {
+		args = append(args, []string{"--" + utils2.CalculatorPodFieldsFlag, strings.Join(informerConfig.CalculatorPodFields, ",")}...)
+	}
+	return args
+}
+
+// informerConfigurationArgs passes the namespace selector of the gating webhook along with scoped watches,
+// since the gated namespaces are watched
+func informerConfigurationArgs(informerConfig v1alpha1.InformerConfiguration, namespaceSelector *metav1.LabelSelector) []string {
+	args := stripPodFieldsArgs(informerConfig)
+	if informerConfig.ScopedWatches {
+		args = append(args, []string{"--" + utils2.ScopedWatchesFlag, "true"}...)
+		if namespaceSelector != nil {
+			selector, err := json.Marshal(namespaceSelector)
+			if err != nil {
+				return nil
+			}
+			args = append(args, []string{"--" + utils2.GatedNamespaceSelectorFlag, string(selector)}...)
+		}
+	}
+	return args
+}
+
+func eventCoalescingConfigurationArgs(eventCoalescingConfig v1alpha1.EventCoalescingConfiguration) []string {
+	var args []string
+	if eventCoalescingConfig.MinDelay != nil {
+		args = append(args, []string{"--" + utils2.EventCoalescingMinDelayFlag, eventCoalescingConfig.MinDelay.Duration.String()}...)
+	}
+	if eventCoalescingConfig.MaxDelay != nil {
+		args = append(args, []string{"--" + utils2.EventCoalescingMaxDelayFlag, eventCoalescingConfig.MaxDelay.Duration.String()}...)
+	}
+	if eventCoalescingConfig.ReleaseParallelism != nil {
+		args = append(args, []string{"--" + utils2.ReleaseParallelismFlag, strconv.Itoa(int(*eventCoalescingConfig.ReleaseParallelism))}...)
+	}
+	return args
+}
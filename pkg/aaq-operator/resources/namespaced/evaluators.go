@@ -0,0 +1,145 @@
+package namespaced
+
+import (
+	"encoding/json"
+	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	utils2 "kubevirt.io/application-aware-quota/pkg/util"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	sdkapi "kubevirt.io/controller-lifecycle-operator-sdk/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	evaluatorCertVolumeName       = "evaluator-cert"
+	evaluatorClientCertVolumeName = "evaluator-client-cert"
+	evaluatorCABundleVolumeName   = "evaluator-ca"
+)
+
+// createRemoteEvaluatorsResources deploys the remote evaluators that have a container, the rest are deployed by their owners
+func createRemoteEvaluatorsResources(args *FactoryArgs) []client.Object {
+	if args.Client == nil {
+		return nil
+	}
+	cr, _ := utils2.GetActiveAAQ(args.Client)
+	if cr == nil {
+		return nil
+	}
+	var resources []client.Object
+	for _, evaluator := range cr.Spec.Configuration.RemoteEvaluators {
+		if evaluator.Container == nil {
+			continue
+		}
+		resources = append(resources,
+			createRemoteEvaluatorService(evaluator.Name),
+			createRemoteEvaluatorDeployment(evaluator, args.ImagePullSecrets, args.PriorityClassName, args.InfraNodePlacement),
+		)
+	}
+	return resources
+}
+
+func createRemoteEvaluatorService(evaluatorName string) *corev1.Service {
+	name := utils2.RemoteEvaluatorResourceName(evaluatorName)
+	service := utils2.ResourceBuilder.CreateService(name, utils2.AAQLabel, name, nil)
+	service.Spec.Ports = []corev1.ServicePort{
+		{
+			Name: "grpc",
+			Port: utils2.RemoteEvaluatorPort,
+			TargetPort: intstr.IntOrString{
+				Type:   intstr.Int,
+				IntVal: utils2.RemoteEvaluatorPort,
+			},
+			Protocol: corev1.ProtocolTCP,
+		},
+	}
+	return service
+}
+
+// createRemoteEvaluatorDeployment runs the evaluator container with its serving certificate and the CA bundle
+// the controller client certificate is verified against mounted
+func createRemoteEvaluatorDeployment(evaluator v1alpha1.RemoteEvaluator, imagePullSecrets []corev1.LocalObjectReference, priorityClassName string, infraNodePlacement *sdkapi.NodePlacement) *appsv1.Deployment {
+	defaultMode := corev1.ConfigMapVolumeSourceDefaultMode
+	name := utils2.RemoteEvaluatorResourceName(evaluator.Name)
+	replicas := int32(1)
+	if evaluator.Replicas != nil {
+		replicas = *evaluator.Replicas
+	}
+	deployment := utils2.CreateDeployment(name, utils2.AAQLabel, name, "", imagePullSecrets, replicas, infraNodePlacement)
+	if priorityClassName != "" {
+		deployment.Spec.Template.Spec.PriorityClassName = priorityClassName
+	}
+	container := *evaluator.Container.DeepCopy()
+	if len(container.Ports) == 0 {
+		container.Ports = []corev1.ContainerPort{
+			{
+				Name:          "grpc",
+				ContainerPort: utils2.RemoteEvaluatorPort,
+				Protocol:      corev1.ProtocolTCP,
+			},
+		}
+	}
+	container.VolumeMounts = append(container.VolumeMounts,
+		corev1.VolumeMount{
+			Name:      evaluatorCertVolumeName,
+			MountPath: utils2.EvaluatorServerCertDir,
+			ReadOnly:  true,
+		},
+		corev1.VolumeMount{
+			Name:      evaluatorCABundleVolumeName,
+			MountPath: utils2.EvaluatorCABundleDir,
+			ReadOnly:  true,
+		},
+	)
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{container}
+	deployment.Spec.Template.Spec.Volumes = []corev1.Volume{
+		{
+			Name: evaluatorCertVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName:  utils2.RemoteEvaluatorCertSecretName(evaluator.Name),
+					DefaultMode: &defaultMode,
+				},
+			},
+		},
+		evaluatorCABundleVolume(),
+	}
+	return deployment
+}
+
+// evaluatorCABundleVolume holds the bundle of the CA the remote evaluators certificates are issued by
+func evaluatorCABundleVolume() corev1.Volume {
+	defaultMode := corev1.ConfigMapVolumeSourceDefaultMode
+	return corev1.Volume{
+		Name: evaluatorCABundleVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: utils2.EvaluatorSignerBundleName},
+				DefaultMode:          &defaultMode,
+			},
+		},
+	}
+}
+
+// remoteEvaluatorsArgs passes the evaluators as JSON, with the address of the ones deployed by the operator resolved
+// to their Service. Their container is only needed by the operator so it isn't passed
+func remoteEvaluatorsArgs(remoteEvaluators []v1alpha1.RemoteEvaluator, namespace string) []string {
+	if len(remoteEvaluators) == 0 {
+		return nil
+	}
+	var evaluators []v1alpha1.RemoteEvaluator
+	for _, evaluator := range remoteEvaluators {
+		if evaluator.Address == "" && evaluator.Container != nil {
+			evaluator.Address = fmt.Sprintf("%s.%s.svc:%d", utils2.RemoteEvaluatorResourceName(evaluator.Name), namespace, utils2.RemoteEvaluatorPort)
+		}
+		evaluator.Container = nil
+		evaluator.Replicas = nil
+		evaluators = append(evaluators, evaluator)
+	}
+	evaluatorsData, err := json.Marshal(evaluators)
+	if err != nil {
+		return nil
+	}
+	return []string{"--" + utils2.RemoteEvaluatorsFlag, string(evaluatorsData)}
+}
@@ -33,8 +33,9 @@ type namespaceHaver interface {
 }
 
 var factoryFunctions = map[string]factoryFunc{
-	"aaqServer":  createAAQServerResources,
-	"controller": createAAQControllerResources,
+	"aaqServer":        createAAQServerResources,
+	"controller":       createAAQControllerResources,
+	"remoteEvaluators": createRemoteEvaluatorsResources,
 }
 
 // CreateAllResources creates all namespaced resources
@@ -157,6 +157,23 @@ func createClusterRBAC(args *FactoryArgs) []client.Object {
 
 func getNamespacedPolicyRules() []rbacv1.PolicyRule {
 	rules := []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{
+				"monitoring.coreos.com",
+			},
+			Resources: []string{
+				"servicemonitors",
+				"prometheusrules",
+			},
+			Verbs: []string{
+				"create",
+				"get",
+				"list",
+				"watch",
+				"delete",
+				"update",
+			},
+		},
 		{
 			APIGroups: []string{
 				"",
@@ -6,14 +6,16 @@ import (
 	"io"
 	"k8s.io/client-go/util/certificate"
 	"k8s.io/klog/v2"
+	aaq_evaluator "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-evaluator"
 	"kubevirt.io/application-aware-quota/pkg/client"
 	"kubevirt.io/application-aware-quota/pkg/util"
 	"net/http"
 )
 
 const (
-	healthzPath = "/healthz"
-	ServePath   = "/serve-path"
+	healthzPath     = "/healthz"
+	ServePath       = "/serve-path"
+	DryRunAdmitPath = "/dry-run-admit"
 )
 
 // Server is the public interface to the upload proxy
@@ -29,6 +31,10 @@ type AAQServer struct {
 	handler           http.Handler
 	aaqNS             string
 	isOnOpenshift     bool
+	calcRegistry      aaq_evaluator.Registry
+	dryRunCache       *DryRunCache
+	// controllerCalculators are the calculators dry runs can't evaluate
+	controllerCalculators []string
 }
 
 // AaqServer returns an initialized uploadProxyApp
@@ -38,13 +44,19 @@ func AaqServer(aaqNS string,
 	secretCertManager certificate.Manager,
 	aaqCli client.AAQClient,
 	isOnOpenshift bool,
+	calcRegistry aaq_evaluator.Registry,
+	dryRunCache *DryRunCache,
+	controllerCalculators []string,
 ) (Server, error) {
 	app := &AAQServer{
-		secretCertManager: secretCertManager,
-		bindAddress:       bindAddress,
-		bindPort:          bindPort,
-		aaqNS:             aaqNS,
-		isOnOpenshift:     isOnOpenshift,
+		secretCertManager:     secretCertManager,
+		bindAddress:           bindAddress,
+		bindPort:              bindPort,
+		aaqNS:                 aaqNS,
+		isOnOpenshift:         isOnOpenshift,
+		calcRegistry:          calcRegistry,
+		dryRunCache:           dryRunCache,
+		controllerCalculators: controllerCalculators,
 	}
 	app.initHandler(aaqCli)
 
@@ -59,6 +71,7 @@ func (app *AAQServer) initHandler(aaqCli client.AAQClient) {
 	mux := http.NewServeMux()
 	mux.HandleFunc(healthzPath, app.handleHealthzRequest)
 	mux.Handle(ServePath, NewAaqServerHandler(app.aaqNS, aaqCli, app.isOnOpenshift))
+	mux.Handle(DryRunAdmitPath, NewDryRunAdmitHandler(aaqCli, app.calcRegistry, app.dryRunCache, app.controllerCalculators))
 	app.handler = cors.AllowAll().Handler(mux)
 
 }
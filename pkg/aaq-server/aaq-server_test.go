@@ -12,6 +12,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	k8sfake "k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/tools/cache"
+	aaq_evaluator "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-evaluator"
 	"kubevirt.io/application-aware-quota/pkg/certificates/bootstrap"
 	"kubevirt.io/application-aware-quota/pkg/client"
 	"kubevirt.io/application-aware-quota/pkg/util"
@@ -37,6 +38,9 @@ var _ = Describe("Test aaq serve functions", func() {
 			secretCertManager,
 			cli,
 			false,
+			aaq_evaluator.GetAaqEvaluatorsRegistry(),
+			nil,
+			nil,
 		)
 		req, err := http.NewRequest("GET", healthzPath, nil)
 		Expect(err).ToNot(HaveOccurred())
@@ -67,6 +71,9 @@ var _ = Describe("Test aaq serve functions", func() {
 			secretCertManager,
 			cli,
 			false,
+			aaq_evaluator.GetAaqEvaluatorsRegistry(),
+			nil,
+			nil,
 		)
 
 		// Create a new ApplicationAwareResourceQuota create request
@@ -0,0 +1,48 @@
+package aaq_server
+
+import (
+	"k8s.io/client-go/tools/cache"
+	"sync"
+)
+
+// DryRunCache holds the informers dry runs are evaluated from. They are only started by the first dry run, so that
+// the aaq-server doesn't cache the pods of the cluster unless dry runs are used, and admissions never wait for them
+type DryRunCache struct {
+	podInformer cache.SharedIndexInformer
+	arqInformer cache.SharedIndexInformer
+	// acrqInformer is nil when cluster quotas are disabled
+	acrqInformer cache.SharedIndexInformer
+	// calculatorInformers are the informers the in-process calculators read from
+	calculatorInformers []cache.SharedIndexInformer
+	stop                <-chan struct{}
+	start               sync.Once
+}
+
+func NewDryRunCache(podInformer, arqInformer, acrqInformer cache.SharedIndexInformer, calculatorInformers []cache.SharedIndexInformer, stop <-chan struct{}) *DryRunCache {
+	return &DryRunCache{
+		podInformer:         podInformer,
+		arqInformer:         arqInformer,
+		acrqInformer:        acrqInformer,
+		calculatorInformers: calculatorInformers,
+		stop:                stop,
+	}
+}
+
+// synced starts the informers on the first call, and returns true once all of them synced
+func (c *DryRunCache) synced() bool {
+	informers := append([]cache.SharedIndexInformer{c.podInformer, c.arqInformer}, c.calculatorInformers...)
+	if c.acrqInformer != nil {
+		informers = append(informers, c.acrqInformer)
+	}
+	c.start.Do(func() {
+		for _, informer := range informers {
+			go informer.Run(c.stop)
+		}
+	})
+	for _, informer := range informers {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
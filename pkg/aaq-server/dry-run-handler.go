@@ -0,0 +1,273 @@
+package aaq_server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	kapierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sadmission "k8s.io/apiserver/pkg/admission"
+	resourcequota2 "k8s.io/apiserver/pkg/admission/plugin/resourcequota"
+	"k8s.io/apiserver/pkg/admission/plugin/resourcequota/apis/resourcequota"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	v12 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+	aaq_evaluator "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-evaluator"
+	"kubevirt.io/application-aware-quota/pkg/client"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"net/http"
+	"strings"
+)
+
+// DryRunAdmitResponse reports whether the gate controller would admit the pod right now
+type DryRunAdmitResponse struct {
+	// Allowed is true if the pod fits in all the quotas of its namespace. The usage the gate controller reserved for
+	// the pods it is releasing isn't reported by the quotas yet, so such pods may still be kept gated
+	Allowed bool `json:"allowed"`
+	// Message explains why the pod would stay gated, or what the dry run doesn't account for when it is allowed
+	Message string `json:"message,omitempty"`
+	// Usage is the usage the pod would consume once admitted
+	Usage v1.ResourceList `json:"usage,omitempty"`
+	// Quotas are the quotas the pod is checked against
+	Quotas []QuotaHeadroom `json:"quotas,omitempty"`
+	// Partial is true when some calculators couldn't evaluate the pod, the gate controller may compute a higher usage
+	Partial bool `json:"partial,omitempty"`
+	// UnevaluatedCalculators are the calculators that couldn't evaluate the pod
+	UnevaluatedCalculators []string `json:"unevaluatedCalculators,omitempty"`
+}
+
+// QuotaHeadroom describes what would be left of a quota after admitting the pod
+type QuotaHeadroom struct {
+	Kind string          `json:"kind"`
+	Name string          `json:"name"`
+	Hard v1.ResourceList `json:"hard,omitempty"`
+	Used v1.ResourceList `json:"used,omitempty"`
+	// Headroom is hard minus used minus the pod usage, negative resources don't fit in the quota
+	Headroom v1.ResourceList `json:"headroom,omitempty"`
+}
+
+const (
+	// dryRunRetryAfter is the number of seconds to wait before retrying a dry run while its cache syncs
+	dryRunRetryAfter = "5"
+	// reservationsNotCounted is the message of admitted dry runs
+	reservationsNotCounted = "the pod fits in the quotas, the usage the gate controller reserved for the pods it is releasing isn't counted"
+)
+
+type DryRunAdmitHandler struct {
+	aaqCli       client.AAQClient
+	calcRegistry aaq_evaluator.Registry
+	dryRunCache  *DryRunCache
+	// controllerCalculators only run alongside the gate controller, dry runs never evaluate them
+	controllerCalculators []string
+}
+
+func NewDryRunAdmitHandler(aaqCli client.AAQClient, calcRegistry aaq_evaluator.Registry, dryRunCache *DryRunCache, controllerCalculators []string) *DryRunAdmitHandler {
+	return &DryRunAdmitHandler{aaqCli, calcRegistry, dryRunCache, controllerCalculators}
+}
+
+func (drh *DryRunAdmitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, fmt.Sprintf("method %v is not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	pod := &v1.Pod{}
+	if err := json.NewDecoder(r.Body).Decode(pod); err != nil {
+		http.Error(w, fmt.Sprintf("could not parse pod: %v", err), http.StatusBadRequest)
+		return
+	}
+	if pod.Namespace == "" {
+		http.Error(w, "pod namespace must be set", http.StatusBadRequest)
+		return
+	}
+	if httpCode, err := drh.authorize(r, pod.Namespace); err != nil {
+		http.Error(w, err.Error(), httpCode)
+		return
+	}
+	if !drh.dryRunCache.synced() {
+		w.Header().Set("Retry-After", dryRunRetryAfter)
+		http.Error(w, "the dry run cache is still syncing, retry later", http.StatusServiceUnavailable)
+		return
+	}
+
+	out, err := drh.dryRunAdmit(pod)
+	if err != nil {
+		klog.Error(err.Error())
+		http.Error(w, fmt.Sprintf("could not evaluate pod admission: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	jout, err := json.Marshal(out)
+	if err != nil {
+		e := fmt.Sprintf("could not parse dry run response: %v", err)
+		klog.Error(err.Error())
+		http.Error(w, e, http.StatusInternalServerError)
+		return
+	}
+	_, err = fmt.Fprintf(w, "%s", jout)
+	if err != nil {
+		klog.Error(err.Error())
+	}
+}
+
+// authorize verifies the request bearer token belongs to a user that may create pods in the namespace
+func (drh *DryRunAdmitHandler) authorize(r *http.Request, ns string) (int, error) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == r.Header.Get("Authorization") {
+		return http.StatusUnauthorized, fmt.Errorf("a bearer token is required")
+	}
+	tokenReview, err := drh.aaqCli.AuthenticationV1().TokenReviews().Create(context.Background(),
+		&authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: token}}, metav1.CreateOptions{})
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("could not review token: %v", err)
+	}
+	if !tokenReview.Status.Authenticated {
+		return http.StatusUnauthorized, fmt.Errorf("invalid bearer token")
+	}
+
+	user := tokenReview.Status.User
+	extra := map[string]authorizationv1.ExtraValue{}
+	for key, value := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(value)
+	}
+	sar, err := drh.aaqCli.AuthorizationV1().SubjectAccessReviews().Create(context.Background(), &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			Groups: user.Groups,
+			UID:    user.UID,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: ns,
+				Verb:      "create",
+				Resource:  "pods",
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("could not review access: %v", err)
+	}
+	if !sar.Status.Allowed {
+		return http.StatusForbidden, fmt.Errorf("%v can't create pods in namespace %v", user.Username, ns)
+	}
+	return http.StatusOK, nil
+}
+
+// dryRunAdmit checks the pod against the quotas of its namespace the way the gate controller does
+// when releasing it, without persisting anything
+func (drh *DryRunAdmitHandler) dryRunAdmit(pod *v1.Pod) (*DryRunAdmitResponse, error) {
+	evaluator := aaq_evaluator.NewAaqEvaluator(v12.NewPodLister(drh.dryRunCache.podInformer.GetIndexer()), drh.calcRegistry, clock.RealClock{})
+
+	podCopy := pod.DeepCopy()
+	podCopy.Spec.SchedulingGates = []v1.PodSchedulingGate{}
+	usage, breakdown, err := evaluator.UsageBreakdown(podCopy)
+	if err != nil {
+		return nil, err
+	}
+
+	rqs, kinds, err := drh.artificialRqs(pod.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	out := &DryRunAdmitResponse{Allowed: true, Usage: usage}
+	for _, calculatorUsage := range breakdown {
+		// calculators that fail open are skipped by the gate controller as well, but the pod may be charged once they recover
+		if calculatorUsage.Error != "" {
+			out.UnevaluatedCalculators = append(out.UnevaluatedCalculators, calculatorUsage.Calculator)
+		}
+	}
+	out.UnevaluatedCalculators = append(out.UnevaluatedCalculators, drh.controllerCalculators...)
+	out.Partial = len(out.UnevaluatedCalculators) > 0
+	for i, rq := range rqs {
+		requested := quota.Mask(usage, quota.ResourceNames(rq.Status.Hard))
+		out.Quotas = append(out.Quotas, QuotaHeadroom{
+			Kind:     kinds[i],
+			Name:     rq.Name,
+			Hard:     rq.Status.Hard,
+			Used:     rq.Status.Used,
+			Headroom: quota.Subtract(rq.Status.Hard, quota.Add(quota.Mask(rq.Status.Used, quota.ResourceNames(rq.Status.Hard)), requested)),
+		})
+	}
+
+	// same attributes the gate controller checks the pod with when releasing it
+	attributes := k8sadmission.NewAttributesRecord(podCopy, nil,
+		apiextensions.Kind("Pod").WithVersion("version"), podCopy.Namespace, podCopy.Name,
+		v1alpha12.Resource("pods").WithVersion("version"), "", k8sadmission.Create,
+		&metav1.CreateOptions{}, true, nil)
+	limitedResource := resourcequota.LimitedResource{Resource: "pods", MatchContains: []string{}}
+	for resourceName := range usage {
+		limitedResource.MatchContains = append(limitedResource.MatchContains, string(resourceName))
+	}
+	_, err = resourcequota2.CheckRequest(rqs, attributes, evaluator, []resourcequota.LimitedResource{limitedResource})
+	if kapierrors.IsForbidden(err) {
+		out.Allowed = false
+		out.Message = err.Error()
+	} else if err != nil {
+		return nil, err
+	} else {
+		out.Message = reservationsNotCounted
+	}
+	return out, nil
+}
+
+// artificialRqs converts the quotas that apply to the namespace to resource quotas, along with the kind of each quota
+func (drh *DryRunAdmitHandler) artificialRqs(ns string) ([]v1.ResourceQuota, []string, error) {
+	arqObjs, err := drh.dryRunCache.arqInformer.GetIndexer().ByIndex(cache.NamespaceIndex, ns)
+	if err != nil {
+		return nil, nil, err
+	}
+	var rqs []v1.ResourceQuota
+	var kinds []string
+	for _, arqObj := range arqObjs {
+		arq := arqObj.(*v1alpha12.ApplicationAwareResourceQuota)
+		hard := arq.Status.Hard
+		if arq.Spec.Cohort != "" {
+			var lenders []*v1alpha12.ApplicationAwareResourceQuota
+			for _, memberObj := range drh.dryRunCache.arqInformer.GetIndexer().List() {
+				member := memberObj.(*v1alpha12.ApplicationAwareResourceQuota)
+				if member.Spec.Cohort == arq.Spec.Cohort && (member.Namespace != arq.Namespace || member.Name != arq.Name) {
+					lenders = append(lenders, member)
+				}
+			}
+			hard = quota.Add(hard, util.CohortBorrowable(arq, lenders))
+		}
+		rqs = append(rqs, v1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: arq.Name, Namespace: ns},
+			Spec:   v1.ResourceQuotaSpec{Hard: arq.Spec.Hard},
+			Status: v1.ResourceQuotaStatus{Hard: hard, Used: arq.Status.Used},
+		})
+		kinds = append(kinds, "ApplicationAwareResourceQuota")
+	}
+
+	if drh.dryRunCache.acrqInformer == nil {
+		// cluster quotas are not enabled
+		return rqs, kinds, nil
+	}
+	for _, acrqObj := range drh.dryRunCache.acrqInformer.GetIndexer().List() {
+		acrq := acrqObj.(*v1alpha12.ApplicationAwareClusterResourceQuota)
+		if !clusterQuotaSelectsNamespace(acrq, ns) {
+			continue
+		}
+		convertedQuota := v1.ResourceQuota{}
+		convertedQuota.ObjectMeta = acrq.ObjectMeta
+		convertedQuota.Namespace = ns
+		convertedQuota.Spec = acrq.Spec.Quota
+		convertedQuota.Status = acrq.Status.Total
+		rqs = append(rqs, convertedQuota)
+		kinds = append(kinds, "ApplicationAwareClusterResourceQuota")
+	}
+	return rqs, kinds, nil
+}
+
+func clusterQuotaSelectsNamespace(acrq *v1alpha12.ApplicationAwareClusterResourceQuota, ns string) bool {
+	for _, namespaceStatus := range acrq.Status.Namespaces {
+		if namespaceStatus.Namespace == ns {
+			return true
+		}
+	}
+	return false
+}
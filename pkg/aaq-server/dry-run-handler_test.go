@@ -0,0 +1,141 @@
+package aaq_server
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	aaq_evaluator "kubevirt.io/application-aware-quota/pkg/aaq-controller/aaq-evaluator"
+	"kubevirt.io/application-aware-quota/pkg/client"
+	testsutils "kubevirt.io/application-aware-quota/pkg/tests-utils"
+	"kubevirt.io/application-aware-quota/tests/builders"
+	"net/http"
+	"net/http/httptest"
+)
+
+// unsyncedInformer never syncs
+type unsyncedInformer struct {
+	testsutils.FakeSharedIndexInformer
+}
+
+func (unsyncedInformer) HasSynced() bool { return false }
+
+var _ = Describe("Test dry run admit", func() {
+	testNs := "test"
+
+	newDryRunRequest := func(memory string) *http.Request {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Namespace: testNs},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "ctr", Image: "image", Resources: testsutils.GetResourceRequirements(testsutils.GetResourceList("", memory), testsutils.GetResourceList("", ""))}},
+			},
+		}
+		body, err := json.Marshal(pod)
+		Expect(err).ToNot(HaveOccurred())
+		req, err := http.NewRequest(http.MethodPost, DryRunAdmitPath, bytes.NewBuffer(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer token")
+		return req
+	}
+
+	newDryRunHandler := func(authenticated, allowed bool, controllerCalculators ...string) *DryRunAdmitHandler {
+		ctrl := gomock.NewController(GinkgoT())
+		cli := client.NewMockAAQClient(ctrl)
+		fakek8sCli := k8sfake.NewSimpleClientset()
+		fakek8sCli.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			tokenReview := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+			Expect(tokenReview.Spec.Token).To(Equal("token"))
+			tokenReview.Status.Authenticated = authenticated
+			tokenReview.Status.User = authenticationv1.UserInfo{Username: "user"}
+			return true, tokenReview, nil
+		})
+		fakek8sCli.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			sar := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+			Expect(sar.Spec.User).To(Equal("user"))
+			Expect(*sar.Spec.ResourceAttributes).To(Equal(authorizationv1.ResourceAttributes{Namespace: testNs, Verb: "create", Resource: "pods"}))
+			sar.Status.Allowed = allowed
+			return true, sar, nil
+		})
+		cli.EXPECT().AuthenticationV1().AnyTimes().Return(fakek8sCli.AuthenticationV1())
+		cli.EXPECT().AuthorizationV1().AnyTimes().Return(fakek8sCli.AuthorizationV1())
+
+		arq := builders.NewArqBuilder().WithNamespace(testNs).WithName("testarq").
+			WithResource(corev1.ResourceRequestsMemory, resource.MustParse("1Gi")).WithSyncStatusHardEmptyStatusUsed().
+			WithStatusUsed(corev1.ResourceRequestsMemory, resource.MustParse("512Mi")).Build()
+		dryRunCache := NewDryRunCache(testsutils.NewFakeSharedIndexInformer(nil), testsutils.NewFakeSharedIndexInformer([]metav1.Object{arq}), nil, nil, nil)
+		return NewDryRunAdmitHandler(cli, aaq_evaluator.GetAaqEvaluatorsRegistry(), dryRunCache, controllerCalculators)
+	}
+
+	DescribeTable("should report whether the pod fits in the namespace quotas", func(memory string, expectedAllowed bool, expectedHeadroom string) {
+		rr := httptest.NewRecorder()
+		newDryRunHandler(true, true).ServeHTTP(rr, newDryRunRequest(memory))
+		Expect(rr.Code).To(Equal(http.StatusOK))
+
+		out := &DryRunAdmitResponse{}
+		Expect(json.Unmarshal(rr.Body.Bytes(), out)).To(Succeed())
+		Expect(out.Allowed).To(Equal(expectedAllowed))
+		if expectedAllowed {
+			Expect(out.Message).To(Equal(reservationsNotCounted))
+		} else {
+			Expect(out.Message).To(ContainSubstring("exceeded quota"))
+		}
+		Expect(out.Usage).To(HaveKeyWithValue(corev1.ResourceRequestsMemory, resource.MustParse(memory)))
+		Expect(out.Quotas).To(HaveLen(1))
+		Expect(out.Quotas[0].Name).To(Equal("testarq"))
+		Expect(out.Quotas[0].Kind).To(Equal("ApplicationAwareResourceQuota"))
+		Expect(quota.Equals(out.Quotas[0].Headroom, corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse(expectedHeadroom)})).To(BeTrue())
+		Expect(out.Partial).To(BeFalse())
+		Expect(out.UnevaluatedCalculators).To(BeEmpty())
+	},
+		Entry("pod that fits", "256Mi", true, "256Mi"),
+		Entry("pod that exceeds the quota", "1Gi", false, "-512Mi"),
+	)
+
+	It("should report the calculators that only run alongside the controller as unevaluated", func() {
+		rr := httptest.NewRecorder()
+		newDryRunHandler(true, true, "sidecar/evaluator", "remote/evaluator").ServeHTTP(rr, newDryRunRequest("256Mi"))
+		Expect(rr.Code).To(Equal(http.StatusOK))
+
+		out := &DryRunAdmitResponse{}
+		Expect(json.Unmarshal(rr.Body.Bytes(), out)).To(Succeed())
+		Expect(out.Allowed).To(BeTrue())
+		Expect(out.Partial).To(BeTrue())
+		Expect(out.UnevaluatedCalculators).To(Equal([]string{"sidecar/evaluator", "remote/evaluator"}))
+	})
+
+	It("should ask to retry while the dry run cache syncs", func() {
+		drh := newDryRunHandler(true, true)
+		drh.dryRunCache = NewDryRunCache(unsyncedInformer{testsutils.NewFakeSharedIndexInformer(nil)}, testsutils.NewFakeSharedIndexInformer(nil), nil, nil, nil)
+		rr := httptest.NewRecorder()
+		drh.ServeHTTP(rr, newDryRunRequest("256Mi"))
+		Expect(rr.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(rr.Header().Get("Retry-After")).To(Equal(dryRunRetryAfter))
+	})
+
+	DescribeTable("should reject requests that are not authorized", func(authenticated, allowed bool, expectedCode int) {
+		rr := httptest.NewRecorder()
+		newDryRunHandler(authenticated, allowed).ServeHTTP(rr, newDryRunRequest("256Mi"))
+		Expect(rr.Code).To(Equal(expectedCode))
+	},
+		Entry("invalid token", false, true, http.StatusUnauthorized),
+		Entry("user that can't create pods", true, false, http.StatusForbidden),
+	)
+
+	It("should reject requests without a bearer token", func() {
+		req := newDryRunRequest("256Mi")
+		req.Header.Del("Authorization")
+		rr := httptest.NewRecorder()
+		NewDryRunAdmitHandler(nil, nil, nil, nil).ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+	})
+})
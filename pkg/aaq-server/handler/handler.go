@@ -5,25 +5,34 @@ import (
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	admissionv1 "k8s.io/api/admission/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	built_in_usage_calculators "kubevirt.io/application-aware-quota/pkg/aaq-controller/built-in-usage-calculators"
 	"kubevirt.io/application-aware-quota/pkg/client"
+	"kubevirt.io/application-aware-quota/pkg/tracing"
 	"kubevirt.io/application-aware-quota/pkg/util"
 	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
 	"net/http"
+	"strings"
+	"time"
 )
 
 const (
 	allowPodRequest               = "Pod has successfully gated"
 	allowArqRequest               = "ApplicationAwareResourceQuota request is valid"
 	allowAcrqRequest              = "ApplicationAwareClusterResourceQuota request is valid"
+	allowAAQUpdate                = "AAQ update is valid"
 	validatingResourceQuotaPrefix = "aaq-validating-rq-"
 	validPodUpdate                = "Pod update did not remove AAQGate"
 	aaqControllerPodUpdate        = "AAQ controller has permission to remove gate from pods"
 	invalidPodUpdate              = "Only AAQ controller has permission to remove " + util.AAQGate + " gate from pods"
 	onlySingleAAQInstaceIsAllowed = "only a single AAQ CR instance is allowed"
+	cohortLimitsWithoutCohort     = "borrowingLimit and lendingLimit can only be set on an ApplicationAwareResourceQuota with a cohort"
+	invalidGateTTL                = "the " + util.GateTTLAnnotation + " annotation must be a positive duration, for example 30m"
 )
 
 type Handler struct {
@@ -55,6 +64,9 @@ func (v Handler) Handle() (*admissionv1.AdmissionReview, error) {
 	case "ApplicationAwareClusterResourceQuota":
 		return v.validateApplicationAwareClusterResourceQuota()
 	case "AAQ":
+		if v.request.Operation == admissionv1.Update {
+			return v.validateAAQUpdate()
+		}
 		return reviewResponse(v.request.UID, false, http.StatusForbidden, onlySingleAAQInstaceIsAllowed), nil
 	}
 	return nil, fmt.Errorf("AAQ webhook doesn't recongnize request: %+v", v.request)
@@ -69,6 +81,11 @@ func (v Handler) mutatePod() (*admissionv1.AdmissionReview, error) {
 	if err := json.Unmarshal(v.request.Object.Raw, &pod); err != nil {
 		return nil, err
 	}
+	if ttl, ok := pod.Annotations[util.GateTTLAnnotation]; ok {
+		if duration, err := time.ParseDuration(ttl); err != nil || duration <= 0 {
+			return reviewResponse(v.request.UID, false, http.StatusForbidden, invalidGateTTL), nil
+		}
+	}
 	schedulingGates := pod.Spec.SchedulingGates
 	if schedulingGates == nil {
 		schedulingGates = []v1.PodSchedulingGate{}
@@ -80,7 +97,25 @@ func (v Handler) mutatePod() (*admissionv1.AdmissionReview, error) {
 		return nil, err
 	}
 
-	patch := fmt.Sprintf(`[{"op": "add", "path": "/spec/schedulingGates", "value": %s}]`, string(schedulingGatesBytes))
+	patch := fmt.Sprintf(`[{"op": "add", "path": "/spec/schedulingGates", "value": %s}`, string(schedulingGatesBytes))
+	// the trace of the pod starts when it is gated, the gate controller continues it from the annotation
+	ctx, span := tracing.Tracer().Start(context.Background(), "aaq.admission.gate", trace.WithAttributes(
+		attribute.String("k8s.namespace.name", v.request.Namespace),
+		attribute.String("k8s.pod.name", pod.Name+pod.GenerateName),
+	))
+	defer span.End()
+	if traceParent := tracing.TraceParent(ctx); traceParent != "" {
+		traceParentBytes, err := json.Marshal(traceParent)
+		if err != nil {
+			return nil, err
+		}
+		if pod.Annotations == nil {
+			patch += fmt.Sprintf(`, {"op": "add", "path": "/metadata/annotations", "value": {%q: %s}}`, util.TraceParentAnnotation, string(traceParentBytes))
+		} else {
+			patch += fmt.Sprintf(`, {"op": "add", "path": "/metadata/annotations/%s", "value": %s}`, strings.ReplaceAll(util.TraceParentAnnotation, "/", "~1"), string(traceParentBytes))
+		}
+	}
+	patch += "]"
 	return reviewResponseWithPatch(v.request.UID, true, http.StatusAccepted, allowPodRequest, []byte(patch)), nil
 }
 
@@ -126,6 +161,12 @@ func (v Handler) validateApplicationAwareResourceQuota() (*admissionv1.Admission
 	if err != nil {
 		return reviewResponse(v.request.UID, false, http.StatusForbidden, util.IgnoreRqErr(err.Error())), nil
 	}
+	if errMsg := validateCohortLimits(arq); errMsg != "" {
+		return reviewResponse(v.request.UID, false, http.StatusForbidden, errMsg), nil
+	}
+	if err := util.ValidateQuotaSchedule(arq.Spec.Schedule); err != nil {
+		return reviewResponse(v.request.UID, false, http.StatusForbidden, err.Error()), nil
+	}
 	return reviewResponse(v.request.UID, true, http.StatusAccepted, allowArqRequest), nil
 
 }
@@ -149,9 +190,23 @@ func (v Handler) validateApplicationAwareClusterResourceQuota() (*admissionv1.Ad
 		errMsg := fmt.Sprintf("ApplicationAwareClusterResourceQuota without clusterResourceQuota support, operator cannot handle non scheduable resources :%v", getResourcesNames(nonSchedulableResourcesHard))
 		return reviewResponse(v.request.UID, false, http.StatusForbidden, errMsg), nil
 	}
+	if err := util.ValidateQuotaSchedule(acrq.Spec.Schedule); err != nil {
+		return reviewResponse(v.request.UID, false, http.StatusForbidden, err.Error()), nil
+	}
 	return reviewResponse(v.request.UID, true, http.StatusAccepted, allowAcrqRequest), nil
 }
 
+func (v Handler) validateAAQUpdate() (*admissionv1.AdmissionReview, error) {
+	aaq := v1alpha1.AAQ{}
+	if err := json.Unmarshal(v.request.Object.Raw, &aaq); err != nil {
+		return nil, err
+	}
+	if err := built_in_usage_calculators.ValidateCELCalculators(aaq.Spec.Configuration.CELCalculators); err != nil {
+		return reviewResponse(v.request.UID, false, http.StatusForbidden, err.Error()), nil
+	}
+	return reviewResponse(v.request.UID, true, http.StatusAccepted, allowAAQUpdate), nil
+}
+
 func (v Handler) validatePodUpdate() (*admissionv1.AdmissionReview, error) {
 	oldPod := v1.Pod{}
 	if err := json.Unmarshal(v.request.OldObject.Raw, &oldPod); err != nil {
@@ -209,3 +264,21 @@ func getResourcesNames(resourceList v1.ResourceList) []v1.ResourceName {
 	}
 	return keys
 }
+
+// validateCohortLimits returns an error message if the borrowing or lending limits of the quota are invalid
+func validateCohortLimits(arq v1alpha1.ApplicationAwareResourceQuota) string {
+	if arq.Spec.Cohort == "" && (len(arq.Spec.BorrowingLimit) > 0 || len(arq.Spec.LendingLimit) > 0) {
+		return cohortLimitsWithoutCohort
+	}
+	for field, limits := range map[string]v1.ResourceList{"borrowingLimit": arq.Spec.BorrowingLimit, "lendingLimit": arq.Spec.LendingLimit} {
+		if nonSchedulableResources := util.FilterNonScheduableResources(limits); len(nonSchedulableResources) > 0 {
+			return fmt.Sprintf("%v can't be set for non scheduable resources: %v", field, getResourcesNames(nonSchedulableResources))
+		}
+		for resourceName, limit := range limits {
+			if limit.Sign() < 0 {
+				return fmt.Sprintf("%v of %v must not be negative", field, resourceName)
+			}
+		}
+	}
+	return ""
+}
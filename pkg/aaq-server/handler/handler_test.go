@@ -3,9 +3,12 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
+	jsonpatch "github.com/evanphx/json-patch"
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	admissionv1 "k8s.io/api/admission/v1"
 	authenticationv1 "k8s.io/api/authentication/v1"
 	v1 "k8s.io/api/core/v1"
@@ -15,8 +18,10 @@ import (
 	"k8s.io/client-go/kubernetes/fake"
 	"kubevirt.io/application-aware-quota/pkg/client"
 	"kubevirt.io/application-aware-quota/pkg/util"
+	"kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
 	"kubevirt.io/application-aware-quota/tests/builders"
 	"net/http"
+	"time"
 )
 
 var _ = Describe("Test handler of aaq server", func() {
@@ -44,6 +49,78 @@ var _ = Describe("Test handler of aaq server", func() {
 		Expect(admissionReview.Response.Result.Message).To(Equal(allowPodRequest))
 	})
 
+	DescribeTable("Pod gate ttl annotation", func(ttl string, allowed bool) {
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Annotations: map[string]string{util.GateTTLAnnotation: ttl}}}
+		podBytes, err := json.Marshal(pod)
+		Expect(err).ToNot(HaveOccurred())
+
+		v := Handler{
+			request: &admissionv1.AdmissionRequest{
+				Kind: metav1.GroupVersionKind{
+					Kind: "Pod",
+				},
+				Object: runtime.RawExtension{
+					Raw:    podBytes,
+					Object: pod,
+				},
+				Operation: admissionv1.Create,
+			},
+		}
+		admissionReview, err := v.Handle()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(admissionReview.Response.Allowed).To(Equal(allowed))
+		if !allowed {
+			Expect(admissionReview.Response.Result.Code).To(Equal(int32(http.StatusForbidden)))
+			Expect(admissionReview.Response.Result.Message).To(Equal(invalidGateTTL))
+		}
+	},
+		Entry(" should be allowed with a positive duration", "30m", true),
+		Entry(" should be rejected with a zero duration", "0s", false),
+		Entry(" should be rejected with a negative duration", "-5m", false),
+		Entry(" should be rejected when it is not a duration", "forever", false),
+	)
+
+	DescribeTable("Pod should be gated with the trace parent of the admission when tracing is enabled", func(annotations map[string]string) {
+		previousProvider := otel.GetTracerProvider()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider())
+		DeferCleanup(otel.SetTracerProvider, previousProvider)
+
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-test", Annotations: annotations}}
+		podBytes, err := json.Marshal(pod)
+		Expect(err).ToNot(HaveOccurred())
+
+		v := Handler{
+			request: &admissionv1.AdmissionRequest{
+				Kind: metav1.GroupVersionKind{
+					Kind: "Pod",
+				},
+				Object: runtime.RawExtension{
+					Raw:    podBytes,
+					Object: pod,
+				},
+				Operation: admissionv1.Create,
+			},
+		}
+		admissionReview, err := v.Handle()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(admissionReview.Response.Allowed).To(BeTrue())
+
+		patch, err := jsonpatch.DecodePatch(admissionReview.Response.Patch)
+		Expect(err).ToNot(HaveOccurred())
+		patchedBytes, err := patch.Apply(podBytes)
+		Expect(err).ToNot(HaveOccurred())
+		patchedPod := &v1.Pod{}
+		Expect(json.Unmarshal(patchedBytes, patchedPod)).To(Succeed())
+		Expect(patchedPod.Spec.SchedulingGates).To(Equal([]v1.PodSchedulingGate{{Name: util.AAQGate}}))
+		Expect(patchedPod.Annotations).To(HaveKeyWithValue(util.TraceParentAnnotation, MatchRegexp("^00-[0-9a-f]{32}-[0-9a-f]{16}-01$")))
+		for key, value := range annotations {
+			Expect(patchedPod.Annotations).To(HaveKeyWithValue(key, value))
+		}
+	},
+		Entry("on a pod without annotations", nil),
+		Entry("on a pod with annotations", map[string]string{"some": "annotation"}),
+	)
+
 	DescribeTable("Pod Ungating should", func(ourController bool) {
 		pod := &v1.Pod{
 			Spec: v1.PodSpec{},
@@ -192,4 +269,117 @@ var _ = Describe("Test handler of aaq server", func() {
 		Entry(" valid Update should be allowed", admissionv1.Update),
 		Entry(" valid Creation should be allowed", admissionv1.Create),
 	)
+
+	DescribeTable("ARQ spec validation", func(arq *v1alpha1.ApplicationAwareResourceQuota, expectedMessage string) {
+		arqBytes, err := json.Marshal(arq)
+		Expect(err).ToNot(HaveOccurred())
+		ctrl := gomock.NewController(GinkgoT())
+		cli := client.NewMockAAQClient(ctrl)
+		cli.EXPECT().CoreV1().Times(1).Return(fake.NewSimpleClientset().CoreV1())
+		v := Handler{
+			request: &admissionv1.AdmissionRequest{
+				Kind: metav1.GroupVersionKind{
+					Kind: "ApplicationAwareResourceQuota",
+				},
+				Object: runtime.RawExtension{
+					Raw:    arqBytes,
+					Object: arq,
+				},
+				Operation: admissionv1.Create,
+			},
+			aaqNS:  util.DefaultAaqNs,
+			aaqCli: cli,
+		}
+		admissionReview, err := v.Handle()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(admissionReview.Response.Allowed).To(Equal(expectedMessage == allowArqRequest))
+		Expect(admissionReview.Response.Result.Message).To(Equal(expectedMessage))
+	},
+		Entry(" should allow limits of a quota in a cohort",
+			builders.NewArqBuilder().WithNamespace("testNS").WithResource(v1.ResourceRequestsMemory, resource.MustParse("4Gi")).
+				WithCohort("cohort").WithBorrowingLimit(v1.ResourceRequestsMemory, resource.MustParse("2Gi")).WithLendingLimit(v1.ResourceRequestsMemory, resource.MustParse("1Gi")).Build(),
+			allowArqRequest),
+		Entry(" should reject limits of a quota without a cohort",
+			builders.NewArqBuilder().WithNamespace("testNS").WithResource(v1.ResourceRequestsMemory, resource.MustParse("4Gi")).
+				WithBorrowingLimit(v1.ResourceRequestsMemory, resource.MustParse("2Gi")).Build(),
+			cohortLimitsWithoutCohort),
+		Entry(" should reject limits of non scheduable resources",
+			builders.NewArqBuilder().WithNamespace("testNS").WithResource(v1.ResourceRequestsMemory, resource.MustParse("4Gi")).
+				WithCohort("cohort").WithLendingLimit(v1.ResourceServices, resource.MustParse("2")).Build(),
+			"lendingLimit can't be set for non scheduable resources: [services]"),
+		Entry(" should reject negative limits",
+			builders.NewArqBuilder().WithNamespace("testNS").WithResource(v1.ResourceRequestsMemory, resource.MustParse("4Gi")).
+				WithCohort("cohort").WithBorrowingLimit(v1.ResourceRequestsMemory, resource.MustParse("-1Gi")).Build(),
+			"borrowingLimit of requests.memory must not be negative"),
+		Entry(" should reject a schedule window with an invalid start",
+			withSchedule(builders.NewArqBuilder().WithNamespace("testNS").WithResource(v1.ResourceRequestsMemory, resource.MustParse("4Gi")).Build(),
+				v1alpha1.QuotaScheduleWindow{Name: "nights", Start: "0 25 * * *", Duration: metav1.Duration{Duration: time.Hour}}),
+			"invalid start of schedule window nights: End of range (25) above maximum (23): 25"),
+		Entry(" should reject a schedule window of non scheduable resources",
+			withSchedule(builders.NewArqBuilder().WithNamespace("testNS").WithResource(v1.ResourceRequestsMemory, resource.MustParse("4Gi")).Build(),
+				v1alpha1.QuotaScheduleWindow{Name: "nights", Start: "0 22 * * *", Duration: metav1.Duration{Duration: time.Hour}, Hard: v1.ResourceList{v1.ResourceServices: resource.MustParse("2")}}),
+			"schedule window nights can't set non scheduable resources: [services]"),
+		Entry(" should allow a valid schedule",
+			withSchedule(builders.NewArqBuilder().WithNamespace("testNS").WithResource(v1.ResourceRequestsMemory, resource.MustParse("4Gi")).Build(),
+				v1alpha1.QuotaScheduleWindow{Name: "nights", Start: "0 22 * * *", Duration: metav1.Duration{Duration: 8 * time.Hour}, Hard: v1.ResourceList{v1.ResourceRequestsMemory: resource.MustParse("8Gi")}}),
+			allowArqRequest),
+	)
+
+	DescribeTable("AAQ update", func(celCalculators []v1alpha1.CELCalculator, allowed bool) {
+		aaq := &v1alpha1.AAQ{Spec: v1alpha1.AAQSpec{Configuration: v1alpha1.AAQConfiguration{CELCalculators: celCalculators}}}
+		aaqBytes, err := json.Marshal(aaq)
+		Expect(err).ToNot(HaveOccurred())
+		v := Handler{
+			request: &admissionv1.AdmissionRequest{
+				Kind: metav1.GroupVersionKind{
+					Kind: "AAQ",
+				},
+				Object: runtime.RawExtension{
+					Raw:    aaqBytes,
+					Object: aaq,
+				},
+				Operation: admissionv1.Update,
+			},
+		}
+		admissionReview, err := v.Handle()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(admissionReview.Response.Allowed).To(Equal(allowed))
+		if allowed {
+			Expect(admissionReview.Response.Result.Message).To(Equal(allowAAQUpdate))
+		}
+	},
+		Entry(" should allow valid CEL calculators", []v1alpha1.CELCalculator{
+			{Name: "gpu", Match: "has(pod.metadata.labels) && 'gpu' in pod.metadata.labels", Usage: "{'requests.nvidia.com/gpu': 1}"},
+		}, true),
+		Entry(" should reject a CEL calculator that doesn't compile", []v1alpha1.CELCalculator{
+			{Name: "gpu", Match: "pod.metadata.labels[", Usage: "{'requests.nvidia.com/gpu': 1}"},
+		}, false),
+		Entry(" should reject a match expression that doesn't return a bool", []v1alpha1.CELCalculator{
+			{Name: "gpu", Match: "1", Usage: "{'requests.nvidia.com/gpu': 1}"},
+		}, false),
+		Entry(" should reject CEL calculators with the same name", []v1alpha1.CELCalculator{
+			{Name: "gpu", Match: "true", Usage: "defaultUsage"},
+			{Name: "gpu", Match: "true", Usage: "defaultUsage"},
+		}, false),
+	)
+
+	It("AAQ creation should be denied", func() {
+		v := Handler{
+			request: &admissionv1.AdmissionRequest{
+				Kind: metav1.GroupVersionKind{
+					Kind: "AAQ",
+				},
+				Operation: admissionv1.Create,
+			},
+		}
+		admissionReview, err := v.Handle()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(admissionReview.Response.Allowed).To(BeFalse())
+		Expect(admissionReview.Response.Result.Message).To(Equal(onlySingleAAQInstaceIsAllowed))
+	})
 })
+
+func withSchedule(arq *v1alpha1.ApplicationAwareResourceQuota, windows ...v1alpha1.QuotaScheduleWindow) *v1alpha1.ApplicationAwareResourceQuota {
+	arq.Spec.Schedule = &v1alpha1.QuotaSchedule{Windows: windows}
+	return arq
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	v12 "github.com/openshift/api/quota/v1"
 	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
@@ -19,52 +20,57 @@ import (
 
 func GetMigrationInformer(aaqCli client.AAQClient) cache.SharedIndexInformer {
 	listWatcher := NewListWatchFromClient(aaqCli.KubevirtClient().KubevirtV1().RESTClient(), "virtualmachineinstancemigrations", metav1.NamespaceAll, fields.Everything(), labels.Everything())
-	return cache.NewSharedIndexInformer(listWatcher, &k6tv1.VirtualMachineInstanceMigration{}, 1*time.Hour, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	return newSharedIndexInformer(listWatcher, &k6tv1.VirtualMachineInstanceMigration{})
 }
 
 func GetApplicationAwareResourceQuotaInformer(aaqCli client.AAQClient) cache.SharedIndexInformer {
 	listWatcher := NewListWatchFromClient(aaqCli.RestClient(), "applicationawareresourcequotas", metav1.NamespaceAll, fields.Everything(), labels.Everything())
-	return cache.NewSharedIndexInformer(listWatcher, &v1alpha13.ApplicationAwareResourceQuota{}, 1*time.Hour, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	return newSharedIndexInformer(listWatcher, &v1alpha13.ApplicationAwareResourceQuota{})
 }
 
 func GetApplicationAwareClusterResourceQuotaInformer(aaqCli client.AAQClient) cache.SharedIndexInformer {
 	listWatcher := NewListWatchFromClient(aaqCli.RestClient(), "applicationawareclusterresourcequotas", metav1.NamespaceAll, fields.Everything(), labels.Everything())
-	return cache.NewSharedIndexInformer(listWatcher, &v1alpha13.ApplicationAwareClusterResourceQuota{}, 1*time.Hour, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	return newSharedIndexInformer(listWatcher, &v1alpha13.ApplicationAwareClusterResourceQuota{})
 }
 
 func GetApplicationAwareAppliedClusterResourceQuotaInformer(aaqCli client.AAQClient) cache.SharedIndexInformer {
 	listWatcher := NewListWatchFromClient(aaqCli.RestClient(), "applicationawareappliedclusterresourcequotas", metav1.NamespaceAll, fields.Everything(), labels.Everything())
-	return cache.NewSharedIndexInformer(listWatcher, &v1alpha13.ApplicationAwareAppliedClusterResourceQuota{}, 1*time.Hour, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	return newSharedIndexInformer(listWatcher, &v1alpha13.ApplicationAwareAppliedClusterResourceQuota{})
 }
 
 func GetAAQJobQueueConfig(aaqCli client.AAQClient) cache.SharedIndexInformer {
 	listWatcher := NewListWatchFromClient(aaqCli.RestClient(), "aaqjobqueueconfigs", metav1.NamespaceAll, fields.Everything(), labels.Everything())
-	return cache.NewSharedIndexInformer(listWatcher, &v1alpha13.AAQJobQueueConfig{}, 1*time.Hour, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	return newSharedIndexInformer(listWatcher, &v1alpha13.AAQJobQueueConfig{})
 }
 
 func GetAAQInformer(aaqCli client.AAQClient) cache.SharedIndexInformer {
 	listWatcher := NewListWatchFromClient(aaqCli.RestClient(), "aaqs", metav1.NamespaceAll, fields.Everything(), labels.Everything())
-	return cache.NewSharedIndexInformer(listWatcher, &v1alpha13.AAQ{}, 1*time.Hour, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	return newSharedIndexInformer(listWatcher, &v1alpha13.AAQ{})
 }
 
 func GetPodInformer(aaqCli client.AAQClient) cache.SharedIndexInformer {
 	listWatcher := NewListWatchFromClient(aaqCli.CoreV1().RESTClient(), "pods", metav1.NamespaceAll, fields.Everything(), labels.Everything())
-	return cache.NewSharedIndexInformer(listWatcher, &v1.Pod{}, 1*time.Hour, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	return newSharedIndexInformer(listWatcher, &v1.Pod{})
 }
 
 func GetNamespaceInformer(aaqCli client.AAQClient) cache.SharedIndexInformer {
 	listWatcher := NewListWatchFromClient(aaqCli.CoreV1().RESTClient(), "namespaces", metav1.NamespaceAll, fields.Everything(), labels.Everything())
-	return cache.NewSharedIndexInformer(listWatcher, &v1.Namespace{}, 1*time.Hour, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	return newSharedIndexInformer(listWatcher, &v1.Namespace{})
 }
 
 func GetSecretInformer(aaqCli client.AAQClient, ns string) cache.SharedIndexInformer {
 	listWatcher := NewListWatchFromClient(aaqCli.CoreV1().RESTClient(), "secrets", ns, fields.Everything(), labels.Everything())
-	return cache.NewSharedIndexInformer(listWatcher, &v1.Secret{}, 1*time.Hour, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	return newSharedIndexInformer(listWatcher, &v1.Secret{})
+}
+
+func GetPodDisruptionBudgetInformer(aaqCli client.AAQClient) cache.SharedIndexInformer {
+	listWatcher := NewListWatchFromClient(aaqCli.PolicyV1().RESTClient(), "poddisruptionbudgets", metav1.NamespaceAll, fields.Everything(), labels.Everything())
+	return newSharedIndexInformer(listWatcher, &policyv1.PodDisruptionBudget{})
 }
 
 func GetVMIInformer(aaqCli client.AAQClient) cache.SharedIndexInformer {
 	listWatcher := NewListWatchFromClient(aaqCli.KubevirtClient().KubevirtV1().RESTClient(), "virtualmachineinstances", metav1.NamespaceAll, fields.Everything(), labels.Everything())
-	return cache.NewSharedIndexInformer(listWatcher, &k6tv1.VirtualMachineInstance{}, 1*time.Hour, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	return newSharedIndexInformer(listWatcher, &k6tv1.VirtualMachineInstance{})
 }
 
 func GetResourceQuotaInformer(aaqCli client.AAQClient) cache.SharedIndexInformer {
@@ -73,7 +79,7 @@ func GetResourceQuotaInformer(aaqCli client.AAQClient) cache.SharedIndexInformer
 		panic(err)
 	}
 	listWatcher := NewListWatchFromClient(aaqCli.CoreV1().RESTClient(), "resourcequotas", metav1.NamespaceAll, fields.Everything(), labelSelector)
-	return cache.NewSharedIndexInformer(listWatcher, &v1.ResourceQuota{}, 1*time.Hour, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	return newSharedIndexInformer(listWatcher, &v1.ResourceQuota{})
 }
 
 func GetClusterResourceQuotaInformer(aaqCli client.AAQClient) cache.SharedIndexInformer {
@@ -82,7 +88,38 @@ func GetClusterResourceQuotaInformer(aaqCli client.AAQClient) cache.SharedIndexI
 		panic(err)
 	}
 	listWatcher := NewListWatchFromClient(aaqCli.CRQClient().QuotaV1().RESTClient(), "clusterresourcequotas", metav1.NamespaceAll, fields.Everything(), labelSelector)
-	return cache.NewSharedIndexInformer(listWatcher, &v12.ClusterResourceQuota{}, 1*time.Hour, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	return newSharedIndexInformer(listWatcher, &v12.ClusterResourceQuota{})
+}
+
+// GetScopedAAQJobQueueConfigInformer is like GetAAQJobQueueConfig, but only holds the namespaces it is scoped to
+func GetScopedAAQJobQueueConfigInformer(aaqCli client.AAQClient) *ScopedInformer {
+	listWatcher := NewListWatchFromClient(aaqCli.RestClient(), "aaqjobqueueconfigs", metav1.NamespaceAll, fields.Everything(), labels.Everything())
+	return NewScopedInformer(listWatcher, &v1alpha13.AAQJobQueueConfig{}, 1*time.Hour)
+}
+
+// GetScopedPodInformer is like GetPodInformer, but only holds the namespaces it is scoped to
+func GetScopedPodInformer(aaqCli client.AAQClient) *ScopedInformer {
+	listWatcher := NewListWatchFromClient(aaqCli.CoreV1().RESTClient(), "pods", metav1.NamespaceAll, fields.Everything(), labels.Everything())
+	return NewScopedInformer(listWatcher, &v1.Pod{}, 1*time.Hour)
+}
+
+// GetScopedResourceQuotaInformer is like GetResourceQuotaInformer, but only holds the namespaces it is scoped to
+func GetScopedResourceQuotaInformer(aaqCli client.AAQClient) *ScopedInformer {
+	labelSelector, err := labels.Parse(util.AAQLabel)
+	if err != nil {
+		panic(err)
+	}
+	listWatcher := NewListWatchFromClient(aaqCli.CoreV1().RESTClient(), "resourcequotas", metav1.NamespaceAll, fields.Everything(), labelSelector)
+	return NewScopedInformer(listWatcher, &v1.ResourceQuota{}, 1*time.Hour)
+}
+
+// newSharedIndexInformer drops the managed fields of the objects, none of the AAQ components reads them
+func newSharedIndexInformer(listWatcher cache.ListerWatcher, exampleObject runtime.Object) cache.SharedIndexInformer {
+	informer := cache.NewSharedIndexInformer(listWatcher, exampleObject, 1*time.Hour, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	if err := informer.SetTransform(StripManagedFields); err != nil {
+		panic(err)
+	}
+	return informer
 }
 
 // NewListWatchFromClient creates a new ListWatch from the specified client, resource, kubevirtNamespace and field selector.
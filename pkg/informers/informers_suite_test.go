@@ -0,0 +1,12 @@
+package informers_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"testing"
+)
+
+func TestInformers(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Informers Suite")
+}
@@ -0,0 +1,526 @@
+package informers
+
+import (
+	"fmt"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"sync"
+	"time"
+)
+
+// ScopedInformer is a SharedIndexInformer that only holds the objects of the namespaces it is scoped to. All the
+// namespaces are listed and watched through a single watch, and the objects of the namespaces out of the scope are
+// dropped as they are received. The namespaces that enter the scope are listed by ending the watch so that the
+// objects are listed again, the namespaces entering meanwhile are listed together.
+// Its handlers are called one at a time. The objects of a namespace that leaves the scope are dropped and reported as deleted
+type ScopedInformer struct {
+	listWatch     cache.ListerWatcher
+	exampleObject runtime.Object
+	resyncPeriod  time.Duration
+	indexer       cache.Indexer
+
+	lock      sync.Mutex
+	transform cache.TransformFunc
+	// scoped is closed once SetNamespaces is called, nothing is listed and the informer doesn't sync before
+	scoped     chan struct{}
+	namespaces map[string]bool
+	// generation is incremented as namespaces enter the scope. listingGeneration is the generation of the list
+	// in progress, and listedGeneration the one of the last list the handlers were notified of
+	generation        int64
+	listingGeneration int64
+	listedGeneration  int64
+	// watch follows the last list, it is ended once namespaces enter the scope
+	watch     *relistingWatch
+	reflector *cache.Reflector
+	stop      <-chan struct{}
+
+	// handlersLock serializes the updates of the indexer with the calls to the handlers
+	handlersLock sync.Mutex
+	handlers     []*scopedHandler
+}
+
+type scopedHandler struct {
+	handler  cache.ResourceEventHandler
+	informer *ScopedInformer
+}
+
+func (h *scopedHandler) HasSynced() bool {
+	return h.informer.HasSynced()
+}
+
+var _ = cache.SharedIndexInformer(&ScopedInformer{})
+
+// NewScopedInformer returns an informer holding the objects listWatch lists and watches in all the namespaces,
+// for the namespaces it is scoped to
+func NewScopedInformer(listWatch cache.ListerWatcher, exampleObject runtime.Object, resyncPeriod time.Duration) *ScopedInformer {
+	return &ScopedInformer{
+		listWatch:     listWatch,
+		exampleObject: exampleObject,
+		resyncPeriod:  resyncPeriod,
+		indexer:       cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}),
+		transform:     StripManagedFields,
+		scoped:        make(chan struct{}),
+		namespaces:    make(map[string]bool),
+	}
+}
+
+// SetNamespaces scopes the informer to the namespaces. The namespaces that enter the scope are listed right away
+// if the informer runs, and the objects of the ones that leave it are dropped
+func (si *ScopedInformer) SetNamespaces(namespaces []string) {
+	// the objects of the namespaces that left are dropped without the lock held, since handlers may check HasSynced
+	for _, namespace := range si.scope(namespaces) {
+		si.dropNamespace(namespace)
+	}
+}
+
+// scope returns the namespaces that left the scope
+func (si *ScopedInformer) scope(namespaces []string) []string {
+	si.lock.Lock()
+	defer si.lock.Unlock()
+	entered := false
+	select {
+	case <-si.scoped:
+	default:
+		close(si.scoped)
+		entered = true
+	}
+	desired := make(map[string]bool, len(namespaces))
+	for _, namespace := range namespaces {
+		desired[namespace] = true
+		if !si.namespaces[namespace] {
+			si.namespaces[namespace] = true
+			entered = true
+		}
+	}
+	var left []string
+	for namespace := range si.namespaces {
+		if !desired[namespace] {
+			delete(si.namespaces, namespace)
+			left = append(left, namespace)
+		}
+	}
+	if entered {
+		si.generation++
+		if si.watch != nil {
+			si.watch.relist()
+		}
+	}
+	return left
+}
+
+// Namespaces returns the namespaces the informer is scoped to
+func (si *ScopedInformer) Namespaces() []string {
+	si.lock.Lock()
+	defer si.lock.Unlock()
+	var namespaces []string
+	for namespace := range si.namespaces {
+		namespaces = append(namespaces, namespace)
+	}
+	return namespaces
+}
+
+func (si *ScopedInformer) inScope(namespace string) bool {
+	si.lock.Lock()
+	defer si.lock.Unlock()
+	return si.namespaces[namespace]
+}
+
+// list lists a page of the objects of all the namespaces and drops the ones out of the scope, so that only a page
+// of them is held at a time. It waits for the informer to be scoped
+func (si *ScopedInformer) list(options metav1.ListOptions) (runtime.Object, error) {
+	select {
+	case <-si.scoped:
+	case <-si.stop:
+		return nil, fmt.Errorf("informer stopped before it was scoped")
+	}
+	if options.Continue == "" {
+		si.lock.Lock()
+		si.listingGeneration = si.generation
+		si.lock.Unlock()
+	}
+	list, err := si.listWatch.List(options)
+	if err != nil {
+		return nil, err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	var scoped []runtime.Object
+	for _, item := range items {
+		if obj, err := meta.Accessor(item); err == nil && si.inScope(obj.GetNamespace()) {
+			scoped = append(scoped, item)
+		}
+	}
+	if err := meta.SetList(list, scoped); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (si *ScopedInformer) watchAll(options metav1.ListOptions) (watch.Interface, error) {
+	w, err := si.listWatch.Watch(options)
+	if err != nil {
+		return nil, err
+	}
+	rw := newRelistingWatch(w)
+	si.lock.Lock()
+	defer si.lock.Unlock()
+	si.watch = rw
+	if si.listingGeneration < si.generation {
+		// namespaces entered the scope while the objects were listed
+		rw.relist()
+	}
+	return rw, nil
+}
+
+// scopedStore is the store the reflector of the informer updates, it keeps the objects of the scope in the indexer
+// of the informer and notifies the handlers
+type scopedStore struct {
+	informer *ScopedInformer
+}
+
+var _ = cache.Store(&scopedStore{})
+
+func (s *scopedStore) Add(obj interface{}) error {
+	return s.informer.upsert(obj, false)
+}
+
+func (s *scopedStore) Update(obj interface{}) error {
+	return s.informer.upsert(obj, false)
+}
+
+func (s *scopedStore) Delete(obj interface{}) error {
+	si := s.informer
+	si.handlersLock.Lock()
+	defer si.handlersLock.Unlock()
+	old, exists, err := si.indexer.Get(obj)
+	if err != nil || !exists {
+		return err
+	}
+	if err := si.indexer.Delete(old); err != nil {
+		return err
+	}
+	for _, h := range si.handlers {
+		h.handler.OnDelete(old)
+	}
+	return nil
+}
+
+func (s *scopedStore) List() []interface{} {
+	return s.informer.indexer.List()
+}
+
+func (s *scopedStore) ListKeys() []string {
+	return s.informer.indexer.ListKeys()
+}
+
+func (s *scopedStore) Get(obj interface{}) (interface{}, bool, error) {
+	return s.informer.indexer.Get(obj)
+}
+
+func (s *scopedStore) GetByKey(key string) (interface{}, bool, error) {
+	return s.informer.indexer.GetByKey(key)
+}
+
+// Replace notifies the handlers of the listed objects, and of the deletion of the objects that weren't listed
+func (s *scopedStore) Replace(list []interface{}, _ string) error {
+	si := s.informer
+	si.lock.Lock()
+	generation := si.listingGeneration
+	si.lock.Unlock()
+	listed := make(map[string]bool, len(list))
+	for _, obj := range list {
+		key, err := cache.MetaNamespaceKeyFunc(obj)
+		if err != nil {
+			return err
+		}
+		listed[key] = true
+		if err := si.upsert(obj, true); err != nil {
+			return err
+		}
+	}
+	si.handlersLock.Lock()
+	for _, old := range si.indexer.List() {
+		key, err := cache.MetaNamespaceKeyFunc(old)
+		if err != nil || listed[key] {
+			continue
+		}
+		if err := si.indexer.Delete(old); err != nil {
+			klog.Errorf("ScopedInformer: failed to delete %s: %v", key, err)
+			continue
+		}
+		for _, h := range si.handlers {
+			h.handler.OnDelete(cache.DeletedFinalStateUnknown{Key: key, Obj: old})
+		}
+	}
+	si.handlersLock.Unlock()
+
+	si.lock.Lock()
+	defer si.lock.Unlock()
+	si.listedGeneration = generation
+	return nil
+}
+
+// Resync notifies the handlers of all the objects again
+func (s *scopedStore) Resync() error {
+	si := s.informer
+	si.handlersLock.Lock()
+	defer si.handlersLock.Unlock()
+	for _, obj := range si.indexer.List() {
+		for _, h := range si.handlers {
+			h.handler.OnUpdate(obj, obj)
+		}
+	}
+	return nil
+}
+
+// upsert adds or updates the object if its namespace is in the scope
+func (si *ScopedInformer) upsert(obj interface{}, isInInitialList bool) error {
+	si.lock.Lock()
+	transform := si.transform
+	si.lock.Unlock()
+	if transform != nil {
+		var err error
+		if obj, err = transform(obj); err != nil {
+			return err
+		}
+	}
+	metaObj, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	si.handlersLock.Lock()
+	defer si.handlersLock.Unlock()
+	// the scope is checked with the handlersLock held, so the objects of a namespace that left are not added back
+	if !si.inScope(metaObj.GetNamespace()) {
+		return nil
+	}
+	old, exists, err := si.indexer.Get(obj)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if err := si.indexer.Update(obj); err != nil {
+			return err
+		}
+		for _, h := range si.handlers {
+			h.handler.OnUpdate(old, obj)
+		}
+		return nil
+	}
+	if err := si.indexer.Add(obj); err != nil {
+		return err
+	}
+	for _, h := range si.handlers {
+		h.handler.OnAdd(obj, isInInitialList)
+	}
+	return nil
+}
+
+// dropNamespace reports the objects of the namespace as deleted
+func (si *ScopedInformer) dropNamespace(namespace string) {
+	si.handlersLock.Lock()
+	defer si.handlersLock.Unlock()
+	objs, err := si.indexer.ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil {
+		klog.Errorf("ScopedInformer: failed to list the objects of namespace %s: %v", namespace, err)
+		return
+	}
+	for _, obj := range objs {
+		if err := si.indexer.Delete(obj); err != nil {
+			klog.Errorf("ScopedInformer: failed to delete an object of namespace %s: %v", namespace, err)
+		}
+		for _, h := range si.handlers {
+			h.handler.OnDelete(obj)
+		}
+	}
+}
+
+// relistingWatch passes the events of a watch through until relist is called, and then ends with an expired error
+// so that the reflector lists the objects again
+type relistingWatch struct {
+	watch      watch.Interface
+	result     chan watch.Event
+	relisting  chan struct{}
+	done       chan struct{}
+	relistOnce sync.Once
+	stopOnce   sync.Once
+}
+
+func newRelistingWatch(w watch.Interface) *relistingWatch {
+	rw := &relistingWatch{
+		watch:     w,
+		result:    make(chan watch.Event),
+		relisting: make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go rw.run()
+	return rw
+}
+
+func (rw *relistingWatch) run() {
+	defer close(rw.result)
+	for {
+		select {
+		case event, ok := <-rw.watch.ResultChan():
+			if !ok {
+				return
+			}
+			select {
+			case rw.result <- event:
+			case <-rw.relisting:
+				rw.sendExpired()
+				return
+			case <-rw.done:
+				return
+			}
+		case <-rw.relisting:
+			rw.sendExpired()
+			return
+		case <-rw.done:
+			return
+		}
+	}
+}
+
+func (rw *relistingWatch) sendExpired() {
+	expired := apierrors.NewResourceExpired("namespaces entered the scope of the informer")
+	select {
+	case rw.result <- watch.Event{Type: watch.Error, Object: &expired.ErrStatus}:
+	case <-rw.done:
+	}
+}
+
+func (rw *relistingWatch) relist() {
+	rw.relistOnce.Do(func() { close(rw.relisting) })
+}
+
+func (rw *relistingWatch) Stop() {
+	rw.stopOnce.Do(func() {
+		close(rw.done)
+		rw.watch.Stop()
+	})
+}
+
+func (rw *relistingWatch) ResultChan() <-chan watch.Event {
+	return rw.result
+}
+
+// Run lists and watches the objects of the scope until stopCh is closed
+func (si *ScopedInformer) Run(stopCh <-chan struct{}) {
+	si.lock.Lock()
+	if si.stop != nil {
+		si.lock.Unlock()
+		klog.Warningf("ScopedInformer: informer already runs")
+		return
+	}
+	si.stop = stopCh
+	si.reflector = cache.NewReflectorWithOptions(&cache.ListWatch{ListFunc: si.list, WatchFunc: si.watchAll},
+		si.exampleObject, &scopedStore{informer: si}, cache.ReflectorOptions{ResyncPeriod: si.resyncPeriod})
+	si.lock.Unlock()
+	si.reflector.Run(stopCh)
+}
+
+// HasSynced returns true once the informer is scoped and the namespaces of the scope are listed. It returns false
+// again while namespaces that enter the scope are listed
+func (si *ScopedInformer) HasSynced() bool {
+	si.lock.Lock()
+	defer si.lock.Unlock()
+	select {
+	case <-si.scoped:
+	default:
+		return false
+	}
+	return si.listedGeneration == si.generation
+}
+
+// AddEventHandler calls the handler with the objects already in the indexer, and then with the changes of all the
+// namespaces of the scope
+func (si *ScopedInformer) AddEventHandler(handler cache.ResourceEventHandler) (cache.ResourceEventHandlerRegistration, error) {
+	si.handlersLock.Lock()
+	defer si.handlersLock.Unlock()
+	for _, obj := range si.indexer.List() {
+		handler.OnAdd(obj, true)
+	}
+	registration := &scopedHandler{handler: handler, informer: si}
+	si.handlers = append(si.handlers, registration)
+	return registration, nil
+}
+
+// AddEventHandlerWithResyncPeriod is like AddEventHandler, the objects are resynced with the period of the informer
+func (si *ScopedInformer) AddEventHandlerWithResyncPeriod(handler cache.ResourceEventHandler, _ time.Duration) (cache.ResourceEventHandlerRegistration, error) {
+	return si.AddEventHandler(handler)
+}
+
+func (si *ScopedInformer) RemoveEventHandler(handle cache.ResourceEventHandlerRegistration) error {
+	si.handlersLock.Lock()
+	defer si.handlersLock.Unlock()
+	for i, h := range si.handlers {
+		if h == handle {
+			si.handlers = append(si.handlers[:i], si.handlers[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (si *ScopedInformer) GetStore() cache.Store {
+	return si.indexer
+}
+
+func (si *ScopedInformer) GetIndexer() cache.Indexer {
+	return si.indexer
+}
+
+// GetController returns nil, the objects are listed and watched by a reflector of the informer's own
+func (si *ScopedInformer) GetController() cache.Controller {
+	return nil
+}
+
+func (si *ScopedInformer) LastSyncResourceVersion() string {
+	si.lock.Lock()
+	defer si.lock.Unlock()
+	if si.reflector == nil {
+		return ""
+	}
+	return si.reflector.LastSyncResourceVersion()
+}
+
+// SetWatchErrorHandler returns an error, the watch errors are handled by the reflector of the informer
+func (si *ScopedInformer) SetWatchErrorHandler(_ cache.WatchErrorHandler) error {
+	return fmt.Errorf("the scoped informer doesn't support watch error handlers")
+}
+
+func (si *ScopedInformer) SetTransform(handler cache.TransformFunc) error {
+	si.lock.Lock()
+	defer si.lock.Unlock()
+	if si.stop != nil {
+		return fmt.Errorf("informer has already started")
+	}
+	si.transform = handler
+	return nil
+}
+
+func (si *ScopedInformer) IsStopped() bool {
+	si.lock.Lock()
+	defer si.lock.Unlock()
+	if si.stop == nil {
+		return false
+	}
+	select {
+	case <-si.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (si *ScopedInformer) AddIndexers(indexers cache.Indexers) error {
+	return si.indexer.AddIndexers(indexers)
+}
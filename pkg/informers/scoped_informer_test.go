@@ -0,0 +1,128 @@
+package informers
+
+import (
+	"context"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"sync"
+	"time"
+)
+
+// podEvents keeps the names of the pods the handler is notified of
+type podEvents struct {
+	lock    sync.Mutex
+	added   []string
+	deleted []string
+}
+
+func (e *podEvents) handler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			e.lock.Lock()
+			defer e.lock.Unlock()
+			e.added = append(e.added, obj.(*v1.Pod).Name)
+		},
+		DeleteFunc: func(obj interface{}) {
+			e.lock.Lock()
+			defer e.lock.Unlock()
+			e.deleted = append(e.deleted, obj.(*v1.Pod).Name)
+		},
+	}
+}
+
+func (e *podEvents) get() ([]string, []string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return append([]string(nil), e.added...), append([]string(nil), e.deleted...)
+}
+
+var _ = Describe("ScopedInformer", func() {
+	newPod := func(namespace, name string) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:          name,
+			Namespace:     namespace,
+			ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "kubectl"}},
+		}}
+	}
+
+	newInformer := func(objects ...runtime.Object) (*ScopedInformer, *fake.Clientset) {
+		client := fake.NewSimpleClientset(objects...)
+		return NewScopedInformer(&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return client.CoreV1().Pods(metav1.NamespaceAll).List(context.Background(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return client.CoreV1().Pods(metav1.NamespaceAll).Watch(context.Background(), options)
+			},
+		}, &v1.Pod{}, 0), client
+	}
+	// namespaces entering the scope are listed once the reflector backs off from the ended watch
+	const relistTimeout = 10 * time.Second
+
+	podNames := func(informer *ScopedInformer) []string {
+		var names []string
+		for _, obj := range informer.GetIndexer().List() {
+			names = append(names, obj.(*v1.Pod).Name)
+		}
+		return names
+	}
+
+	It("should only sync once it is scoped", func() {
+		informer, _ := newInformer(newPod("ns-a", "pod-a"))
+		stop := make(chan struct{})
+		defer close(stop)
+		go informer.Run(stop)
+		Consistently(informer.HasSynced).Should(BeFalse())
+
+		informer.SetNamespaces(nil)
+		Eventually(informer.HasSynced).Should(BeTrue())
+		Expect(informer.GetIndexer().List()).To(BeEmpty())
+	})
+
+	It("should only hold the objects of the namespaces of the scope, without their managed fields", func() {
+		informer, client := newInformer(newPod("ns-a", "pod-a"), newPod("ns-b", "pod-b"), newPod("ns-c", "pod-c"))
+		events := &podEvents{}
+		_, err := informer.AddEventHandler(events.handler())
+		Expect(err).ToNot(HaveOccurred())
+		informer.SetNamespaces([]string{"ns-a", "ns-b"})
+		stop := make(chan struct{})
+		defer close(stop)
+		go informer.Run(stop)
+
+		Eventually(informer.HasSynced).Should(BeTrue())
+		Expect(podNames(informer)).To(ConsistOf("pod-a", "pod-b"))
+		for _, obj := range informer.GetIndexer().List() {
+			Expect(obj.(*v1.Pod).ManagedFields).To(BeNil())
+		}
+
+		// the watched objects of the namespaces out of the scope are dropped too
+		_, err = client.CoreV1().Pods("ns-c").Create(context.Background(), newPod("ns-c", "pod-c2"), metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = client.CoreV1().Pods("ns-b").Create(context.Background(), newPod("ns-b", "pod-b2"), metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(func() []string { return podNames(informer) }).Should(ConsistOf("pod-a", "pod-b", "pod-b2"))
+
+		// the namespace that entered is listed, and the objects of the namespace that left are reported as deleted
+		informer.SetNamespaces([]string{"ns-b", "ns-c"})
+		Expect(informer.HasSynced()).To(BeFalse())
+		Eventually(informer.HasSynced).WithTimeout(relistTimeout).Should(BeTrue())
+		Expect(podNames(informer)).To(ConsistOf("pod-b", "pod-b2", "pod-c", "pod-c2"))
+		Expect(informer.Namespaces()).To(ConsistOf("ns-b", "ns-c"))
+		added, deleted := events.get()
+		Expect(added).To(ConsistOf("pod-a", "pod-b", "pod-b2", "pod-c", "pod-c2"))
+		Expect(deleted).To(ConsistOf("pod-a"))
+
+		// handlers added late are notified of the objects already held
+		late := &podEvents{}
+		_, err = informer.AddEventHandler(late.handler())
+		Expect(err).ToNot(HaveOccurred())
+		added, _ = late.get()
+		Expect(added).To(ConsistOf("pod-b", "pod-b2", "pod-c", "pod-c2"))
+	})
+})
@@ -0,0 +1,106 @@
+package informers
+
+import (
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// PodVolumesField is the volumes of the pod
+	PodVolumesField = "spec.volumes"
+	// PodContainerEnvField is the env and envFrom of all the containers of the pod
+	PodContainerEnvField = "spec.containers.env"
+	// PodContainerCommandField is the command and args of all the containers of the pod
+	PodContainerCommandField = "spec.containers.command"
+	// PodContainerProbesField is the probes and lifecycle hooks of all the containers of the pod
+	PodContainerProbesField = "spec.containers.probes"
+	// PodContainerVolumeMountsField is the volume mounts and devices of all the containers of the pod
+	PodContainerVolumeMountsField = "spec.containers.volumeMounts"
+)
+
+// PodFields are the pod fields the pod transform strips unless a calculator requires them. The fields quota scopes,
+// the kubernetes pod evaluator and the controllers read are always kept
+var PodFields = []string{
+	PodVolumesField,
+	PodContainerEnvField,
+	PodContainerCommandField,
+	PodContainerProbesField,
+	PodContainerVolumeMountsField,
+}
+
+// ValidatePodFields fails on fields that aren't PodFields
+func ValidatePodFields(fields []string) error {
+	for _, field := range fields {
+		if !containsField(PodFields, field) {
+			return fmt.Errorf("unknown pod field %q, allowed fields are %v", field, PodFields)
+		}
+	}
+	return nil
+}
+
+// StripManagedFields drops the managed fields of the object. The API server keeps the managed fields of objects
+// updated without them, so the cached objects can still be written back
+func StripManagedFields(obj interface{}) (interface{}, error) {
+	if accessor, err := meta.Accessor(obj); err == nil {
+		accessor.SetManagedFields(nil)
+	}
+	return obj, nil
+}
+
+// NewPodTransform returns a transform dropping the managed fields of the pods, and the PodFields that aren't in requiredFields
+func NewPodTransform(requiredFields []string) cache.TransformFunc {
+	strip := func(field string) bool {
+		return !containsField(requiredFields, field)
+	}
+	return func(obj interface{}) (interface{}, error) {
+		pod, ok := obj.(*v1.Pod)
+		if !ok {
+			return StripManagedFields(obj)
+		}
+		pod.ManagedFields = nil
+		if strip(PodVolumesField) {
+			pod.Spec.Volumes = nil
+		}
+		stripContainer := func(container *v1.Container) {
+			if strip(PodContainerEnvField) {
+				container.Env = nil
+				container.EnvFrom = nil
+			}
+			if strip(PodContainerCommandField) {
+				container.Command = nil
+				container.Args = nil
+			}
+			if strip(PodContainerProbesField) {
+				container.LivenessProbe = nil
+				container.ReadinessProbe = nil
+				container.StartupProbe = nil
+				container.Lifecycle = nil
+			}
+			if strip(PodContainerVolumeMountsField) {
+				container.VolumeMounts = nil
+				container.VolumeDevices = nil
+			}
+		}
+		for i := range pod.Spec.InitContainers {
+			stripContainer(&pod.Spec.InitContainers[i])
+		}
+		for i := range pod.Spec.Containers {
+			stripContainer(&pod.Spec.Containers[i])
+		}
+		for i := range pod.Spec.EphemeralContainers {
+			stripContainer((*v1.Container)(&pod.Spec.EphemeralContainers[i].EphemeralContainerCommon))
+		}
+		return pod, nil
+	}
+}
+
+func containsField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package informers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Pod transform", func() {
+	newPod := func() *v1.Pod {
+		container := v1.Container{
+			Name:           "ctr",
+			Command:        []string{"run"},
+			Env:            []v1.EnvVar{{Name: "KEY", Value: "value"}},
+			VolumeMounts:   []v1.VolumeMount{{Name: "data", MountPath: "/data"}},
+			LivenessProbe:  &v1.Probe{},
+			ReadinessProbe: &v1.Probe{},
+		}
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:          "pod",
+				Namespace:     "ns",
+				Labels:        map[string]string{"app": "test"},
+				ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "kubectl"}},
+			},
+			Spec: v1.PodSpec{
+				Volumes:             []v1.Volume{{Name: "data"}},
+				InitContainers:      []v1.Container{container},
+				Containers:          []v1.Container{container},
+				EphemeralContainers: []v1.EphemeralContainer{{EphemeralContainerCommon: v1.EphemeralContainerCommon(container)}},
+				SchedulingGates:     []v1.PodSchedulingGate{{Name: "gate"}},
+				Affinity:            &v1.Affinity{},
+			},
+		}
+	}
+
+	It("should only keep the fields the calculators require", func() {
+		obj, err := NewPodTransform([]string{PodContainerEnvField})(newPod())
+		Expect(err).ToNot(HaveOccurred())
+		pod := obj.(*v1.Pod)
+		Expect(pod.ManagedFields).To(BeNil())
+		Expect(pod.Labels).To(HaveKeyWithValue("app", "test"))
+		Expect(pod.Spec.Volumes).To(BeNil())
+		Expect(pod.Spec.SchedulingGates).To(HaveLen(1))
+		Expect(pod.Spec.Affinity).ToNot(BeNil())
+		for _, container := range []v1.Container{pod.Spec.InitContainers[0], pod.Spec.Containers[0], v1.Container(pod.Spec.EphemeralContainers[0].EphemeralContainerCommon)} {
+			Expect(container.Name).To(Equal("ctr"))
+			Expect(container.Env).To(HaveLen(1))
+			Expect(container.Command).To(BeNil())
+			Expect(container.VolumeMounts).To(BeNil())
+			Expect(container.LivenessProbe).To(BeNil())
+			Expect(container.ReadinessProbe).To(BeNil())
+		}
+	})
+
+	It("should only strip the managed fields of objects that aren't pods", func() {
+		ns := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns", ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "kubectl"}}}}
+		obj, err := NewPodTransform(nil)(ns)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(obj.(*v1.Namespace).ManagedFields).To(BeNil())
+	})
+
+	It("should reject unknown fields", func() {
+		Expect(ValidatePodFields([]string{PodVolumesField, PodContainerProbesField})).To(Succeed())
+		Expect(ValidatePodFields([]string{"spec.nodeName"})).ToNot(Succeed())
+	})
+})
@@ -45,7 +45,7 @@ func (i FakeSharedIndexInformer) AddEventHandlerWithResyncPeriod(handler cache.R
 func (i FakeSharedIndexInformer) GetStore() cache.Store           { return nil }
 func (i FakeSharedIndexInformer) GetController() cache.Controller { return nil }
 func (i FakeSharedIndexInformer) Run(stopCh <-chan struct{})      {}
-func (i FakeSharedIndexInformer) HasSynced() bool                 { panic("implement me") }
+func (i FakeSharedIndexInformer) HasSynced() bool                 { return true }
 func (i FakeSharedIndexInformer) LastSyncResourceVersion() string { return "" }
 func (i FakeSharedIndexInformer) SetWatchErrorHandler(handler cache.WatchErrorHandler) error {
 	return nil
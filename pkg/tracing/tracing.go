@@ -0,0 +1,123 @@
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+	v1 "k8s.io/api/core/v1"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+)
+
+const tracerName = "kubevirt.io/application-aware-quota"
+
+var propagator = propagation.TraceContext{}
+
+// Setup exports the traces of the component to the OTLP collector of the configuration.
+// When no endpoint is configured the spans are not recorded.
+// The returned function flushes the pending spans and must be called before exiting
+func Setup(ctx context.Context, serviceName string, config v1alpha12.TracingConfiguration) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+	if config.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(config.Endpoint)}
+	if config.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of the AAQ components
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// PodContext returns a context that continues the trace recorded on the pod, if any
+func PodContext(ctx context.Context, pod *v1.Pod) context.Context {
+	traceParent, ok := pod.Annotations[util.TraceParentAnnotation]
+	if !ok {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier{"traceparent": traceParent})
+}
+
+// TraceParent returns the W3C traceparent of the span in the context, or an empty string
+// if the span is not sampled
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// SetPodTraceParent records the span of the context on the pod, so the steps that handle the pod next
+// are part of the same trace
+func SetPodTraceParent(ctx context.Context, pod *v1.Pod) {
+	traceParent := TraceParent(ctx)
+	if traceParent == "" {
+		return
+	}
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[util.TraceParentAnnotation] = traceParent
+}
+
+// OutgoingGRPCContext propagates the span of the context to the server of a gRPC call
+func OutgoingGRPCContext(ctx context.Context) context.Context {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !ok {
+		md = metadata.MD{}
+	} else {
+		md = md.Copy()
+	}
+	propagator.Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// IncomingGRPCContext continues the trace propagated by the client of a gRPC call
+func IncomingGRPCContext(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	return propagator.Extract(ctx, metadataCarrier(md))
+}
+
+// metadataCarrier adapts gRPC metadata to the otel propagators
+type metadataCarrier metadata.MD
+
+func (mc metadataCarrier) Get(key string) string {
+	values := metadata.MD(mc).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (mc metadataCarrier) Set(key, value string) {
+	metadata.MD(mc).Set(key, value)
+}
+
+func (mc metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(mc))
+	for key := range mc {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,142 @@
+package tracing
+
+import (
+	"context"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	collectortracev1 "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracev1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubevirt.io/application-aware-quota/pkg/util"
+	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"net"
+	"sync"
+)
+
+// fakeCollector stands in for an OTLP collector and keeps the spans it receives
+type fakeCollector struct {
+	collectortracev1.UnimplementedTraceServiceServer
+	lock  sync.Mutex
+	spans []*tracev1.Span
+	// services holds the service name of the resource each span was exported from
+	services []string
+}
+
+func (fc *fakeCollector) Export(_ context.Context, req *collectortracev1.ExportTraceServiceRequest) (*collectortracev1.ExportTraceServiceResponse, error) {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	for _, resourceSpans := range req.ResourceSpans {
+		var service string
+		for _, attr := range resourceSpans.Resource.GetAttributes() {
+			if attr.Key == "service.name" {
+				service = attr.Value.GetStringValue()
+			}
+		}
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			for _, span := range scopeSpans.Spans {
+				fc.spans = append(fc.spans, span)
+				fc.services = append(fc.services, service)
+			}
+		}
+	}
+	return &collectortracev1.ExportTraceServiceResponse{}, nil
+}
+
+func (fc *fakeCollector) spanNames() []string {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	var names []string
+	for _, span := range fc.spans {
+		names = append(names, span.Name)
+	}
+	return names
+}
+
+func startFakeCollector() (*fakeCollector, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).ToNot(HaveOccurred())
+	server := grpc.NewServer()
+	collector := &fakeCollector{}
+	collectortracev1.RegisterTraceServiceServer(server, collector)
+	go func() {
+		defer GinkgoRecover()
+		Expect(server.Serve(listener)).To(Succeed())
+	}()
+	DeferCleanup(server.Stop)
+	return collector, listener.Addr().String()
+}
+
+var _ = Describe("Tracing", func() {
+	BeforeEach(func() {
+		previousProvider := otel.GetTracerProvider()
+		DeferCleanup(otel.SetTracerProvider, previousProvider)
+	})
+
+	It("should export the spans to the configured collector", func() {
+		collector, endpoint := startFakeCollector()
+		shutdown, err := Setup(context.Background(), "aaq-test", v1alpha12.TracingConfiguration{Endpoint: endpoint, Insecure: true})
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx, parent := Tracer().Start(context.Background(), "parent")
+		_, child := Tracer().Start(ctx, "child")
+		child.End()
+		parent.End()
+		Expect(shutdown(context.Background())).To(Succeed())
+
+		Expect(collector.spanNames()).To(ConsistOf("parent", "child"))
+		Expect(collector.services).To(HaveEach("aaq-test"))
+		Expect(collector.spans[0].TraceId).To(Equal(collector.spans[1].TraceId))
+	})
+
+	It("should not record spans when no endpoint is configured", func() {
+		shutdown, err := Setup(context.Background(), "aaq-test", v1alpha12.TracingConfiguration{})
+		Expect(err).ToNot(HaveOccurred())
+		ctx, span := Tracer().Start(context.Background(), "span")
+		defer span.End()
+		Expect(span.IsRecording()).To(BeFalse())
+		Expect(TraceParent(ctx)).To(BeEmpty())
+		Expect(shutdown(context.Background())).To(Succeed())
+	})
+
+	Context("with a recording tracer", func() {
+		BeforeEach(func() {
+			_, endpoint := startFakeCollector()
+			shutdown, err := Setup(context.Background(), "aaq-test", v1alpha12.TracingConfiguration{Endpoint: endpoint, Insecure: true})
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(shutdown, context.Background())
+		})
+
+		It("should continue the trace recorded on the pod", func() {
+			ctx, span := Tracer().Start(context.Background(), "admission")
+			defer span.End()
+			pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod"}}
+			SetPodTraceParent(ctx, pod)
+			Expect(pod.Annotations).To(HaveKeyWithValue(util.TraceParentAnnotation, TraceParent(ctx)))
+
+			_, evaluation := Tracer().Start(PodContext(context.Background(), pod), "evaluation")
+			defer evaluation.End()
+			Expect(evaluation.SpanContext().TraceID()).To(Equal(span.SpanContext().TraceID()))
+		})
+
+		It("should start a new trace for pods without a trace parent", func() {
+			ctx := PodContext(context.Background(), &v1.Pod{})
+			Expect(TraceParent(ctx)).To(BeEmpty())
+		})
+
+		It("should propagate the span over gRPC metadata", func() {
+			ctx, span := Tracer().Start(context.Background(), "client")
+			defer span.End()
+			outgoing := OutgoingGRPCContext(metadata.AppendToOutgoingContext(ctx, "key", "value"))
+			md, ok := metadata.FromOutgoingContext(outgoing)
+			Expect(ok).To(BeTrue())
+			Expect(md.Get("key")).To(Equal([]string{"value"}))
+
+			incoming := IncomingGRPCContext(metadata.NewIncomingContext(context.Background(), md))
+			Expect(TraceParent(incoming)).To(Equal(TraceParent(ctx)))
+		})
+	})
+})
@@ -0,0 +1,61 @@
+package util
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	v1alpha12 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+)
+
+// CohortBorrowable returns the amount of each resource the quota can borrow from the idle capacity of the lenders.
+// The idle capacity is what the lenders lend, minus what they use of it themselves or already borrowed
+func CohortBorrowable(arq *v1alpha12.ApplicationAwareResourceQuota, lenders []*v1alpha12.ApplicationAwareResourceQuota) v1.ResourceList {
+	// resources that are not schedulable are enforced by a ResourceQuota and can't be borrowed
+	nonSchedulableResources := FilterNonScheduableResources(arq.Status.Hard)
+	borrowable := v1.ResourceList{}
+	for resourceName := range arq.Status.Hard {
+		if _, ok := nonSchedulableResources[resourceName]; ok {
+			continue
+		}
+		idle := resource.Quantity{}
+		for _, lender := range lenders {
+			idle.Add(lendable(lender, resourceName))
+			idle.Sub(lendableUsed(lender, resourceName))
+		}
+		if limit, ok := arq.Spec.BorrowingLimit[resourceName]; ok && limit.Cmp(idle) < 0 {
+			idle = limit.DeepCopy()
+		}
+		if idle.Sign() > 0 {
+			borrowable[resourceName] = idle
+		}
+	}
+	return borrowable
+}
+
+// lendable returns the part of the quota hard limit the other cohort members can borrow
+func lendable(arq *v1alpha12.ApplicationAwareResourceQuota, resourceName v1.ResourceName) resource.Quantity {
+	hard, ok := arq.Status.Hard[resourceName]
+	if !ok {
+		return resource.Quantity{}
+	}
+	if limit, ok := arq.Spec.LendingLimit[resourceName]; ok && limit.Cmp(hard) < 0 {
+		return limit.DeepCopy()
+	}
+	return hard.DeepCopy()
+}
+
+// lendableUsed returns how much of the lendable part of the quota is used by the quota itself,
+// including the usage it borrowed from the cohort
+func lendableUsed(arq *v1alpha12.ApplicationAwareResourceQuota, resourceName v1.ResourceName) resource.Quantity {
+	hard, ok := arq.Status.Hard[resourceName]
+	if !ok {
+		return resource.Quantity{}
+	}
+	used := arq.Status.Used[resourceName].DeepCopy()
+	reserved := hard.DeepCopy()
+	reserved.Sub(lendable(arq, resourceName))
+	used.Sub(reserved)
+	if used.Sign() < 0 {
+		return resource.Quantity{}
+	}
+	return used
+}
@@ -0,0 +1,183 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: staging/src/kubevirt.io/application-aware-quota-api/libsidecar/evaluator-server-com/v2/evaluate.proto
+
+package aaq_sidecar_evaluate_v2
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	PodUsage_PodUsageFunc_FullMethodName = "/evaluate.v2.PodUsage/PodUsageFunc"
+	PodUsage_PodsUsage_FullMethodName    = "/evaluate.v2.PodUsage/PodsUsage"
+	PodUsage_HealthCheck_FullMethodName  = "/evaluate.v2.PodUsage/HealthCheck"
+)
+
+// PodUsageClient is the client API for PodUsage service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type PodUsageClient interface {
+	PodUsageFunc(ctx context.Context, in *PodUsageRequest, opts ...grpc.CallOption) (*PodUsageResponse, error)
+	PodsUsage(ctx context.Context, in *PodsUsageRequest, opts ...grpc.CallOption) (*PodsUsageResponse, error)
+	HealthCheck(ctx context.Context, in *HealthCheckRequest, opts ...grpc.CallOption) (*HealthCheckResponse, error)
+}
+
+type podUsageClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPodUsageClient(cc grpc.ClientConnInterface) PodUsageClient {
+	return &podUsageClient{cc}
+}
+
+func (c *podUsageClient) PodUsageFunc(ctx context.Context, in *PodUsageRequest, opts ...grpc.CallOption) (*PodUsageResponse, error) {
+	out := new(PodUsageResponse)
+	err := c.cc.Invoke(ctx, PodUsage_PodUsageFunc_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *podUsageClient) PodsUsage(ctx context.Context, in *PodsUsageRequest, opts ...grpc.CallOption) (*PodsUsageResponse, error) {
+	out := new(PodsUsageResponse)
+	err := c.cc.Invoke(ctx, PodUsage_PodsUsage_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *podUsageClient) HealthCheck(ctx context.Context, in *HealthCheckRequest, opts ...grpc.CallOption) (*HealthCheckResponse, error) {
+	out := new(HealthCheckResponse)
+	err := c.cc.Invoke(ctx, PodUsage_HealthCheck_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PodUsageServer is the server API for PodUsage service.
+// All implementations must embed UnimplementedPodUsageServer
+// for forward compatibility
+type PodUsageServer interface {
+	PodUsageFunc(context.Context, *PodUsageRequest) (*PodUsageResponse, error)
+	PodsUsage(context.Context, *PodsUsageRequest) (*PodsUsageResponse, error)
+	HealthCheck(context.Context, *HealthCheckRequest) (*HealthCheckResponse, error)
+	mustEmbedUnimplementedPodUsageServer()
+}
+
+// UnimplementedPodUsageServer must be embedded to have forward compatible implementations.
+type UnimplementedPodUsageServer struct {
+}
+
+func (UnimplementedPodUsageServer) PodUsageFunc(context.Context, *PodUsageRequest) (*PodUsageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PodUsageFunc not implemented")
+}
+func (UnimplementedPodUsageServer) PodsUsage(context.Context, *PodsUsageRequest) (*PodsUsageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PodsUsage not implemented")
+}
+func (UnimplementedPodUsageServer) HealthCheck(context.Context, *HealthCheckRequest) (*HealthCheckResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HealthCheck not implemented")
+}
+func (UnimplementedPodUsageServer) mustEmbedUnimplementedPodUsageServer() {}
+
+// UnsafePodUsageServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PodUsageServer will
+// result in compilation errors.
+type UnsafePodUsageServer interface {
+	mustEmbedUnimplementedPodUsageServer()
+}
+
+func RegisterPodUsageServer(s grpc.ServiceRegistrar, srv PodUsageServer) {
+	s.RegisterService(&PodUsage_ServiceDesc, srv)
+}
+
+func _PodUsage_PodUsageFunc_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PodUsageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PodUsageServer).PodUsageFunc(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PodUsage_PodUsageFunc_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PodUsageServer).PodUsageFunc(ctx, req.(*PodUsageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PodUsage_PodsUsage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PodsUsageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PodUsageServer).PodsUsage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PodUsage_PodsUsage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PodUsageServer).PodsUsage(ctx, req.(*PodsUsageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PodUsage_HealthCheck_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HealthCheckRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PodUsageServer).HealthCheck(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PodUsage_HealthCheck_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PodUsageServer).HealthCheck(ctx, req.(*HealthCheckRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// PodUsage_ServiceDesc is the grpc.ServiceDesc for PodUsage service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PodUsage_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "evaluate.v2.PodUsage",
+	HandlerType: (*PodUsageServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "PodUsageFunc",
+			Handler:    _PodUsage_PodUsageFunc_Handler,
+		},
+		{
+			MethodName: "PodsUsage",
+			Handler:    _PodUsage_PodsUsage_Handler,
+		},
+		{
+			MethodName: "HealthCheck",
+			Handler:    _PodUsage_HealthCheck_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "staging/src/kubevirt.io/application-aware-quota-api/libsidecar/evaluator-server-com/v2/evaluate.proto",
+}
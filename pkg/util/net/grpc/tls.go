@@ -0,0 +1,84 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// CABundleFile is the key the CA bundle configmaps hold their certificates under
+	CABundleFile = "ca-bundle.crt"
+	// CertFile and KeyFile are the keys TLS secrets hold their key pair under
+	CertFile = "tls.crt"
+	KeyFile  = "tls.key"
+)
+
+// MutualTLSConfig returns a client TLS config presenting the key pair in certDir and verifying the server against
+// the bundle in caDir and the additional PEM caBundle. Both are read on every handshake so rotated
+// certificates are picked up by new connections
+func MutualTLSConfig(certDir, caDir string, caBundle []byte) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(filepath.Join(certDir, CertFile), filepath.Join(certDir, KeyFile))
+			if err != nil {
+				return nil, err
+			}
+			return &cert, nil
+		},
+		// the default verification is replaced by VerifyConnection, which verifies against the current bundle
+		// rather than the one at the time the config was created
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			roots, err := loadCertPool(filepath.Join(caDir, CABundleFile), caBundle)
+			if err != nil {
+				return err
+			}
+			if len(state.PeerCertificates) == 0 {
+				return fmt.Errorf("server presented no certificate")
+			}
+			intermediates := x509.NewCertPool()
+			for _, cert := range state.PeerCertificates[1:] {
+				intermediates.AddCert(cert)
+			}
+			_, err = state.PeerCertificates[0].Verify(x509.VerifyOptions{
+				DNSName:       state.ServerName,
+				Roots:         roots,
+				Intermediates: intermediates,
+			})
+			return err
+		},
+	}
+}
+
+func loadCertPool(bundlePath string, caBundle []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	bundle, err := os.ReadFile(bundlePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	bundle = append(bundle, caBundle...)
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("no CA certificates found in %s or the CA bundle of the evaluator", bundlePath)
+	}
+	return pool, nil
+}
+
+// DialTLS returns a connection to address secured by tlsConfig. It doesn't block, the connection is
+// established by the first call and reestablished whenever it breaks
+func DialTLS(address string, tlsConfig *tls.Config) (*grpc.ClientConn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	config := tlsConfig.Clone()
+	config.ServerName = host
+	return grpc.DialContext(context.Background(), address, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+}
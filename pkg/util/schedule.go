@@ -0,0 +1,94 @@
+package util
+
+import (
+	"fmt"
+	"github.com/robfig/cron"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	aaqv1alpha1 "kubevirt.io/application-aware-quota/staging/src/kubevirt.io/application-aware-quota-api/pkg/apis/core/v1alpha1"
+	"time"
+	// the controller images don't ship the time zone database
+	_ "time/tzdata"
+)
+
+// ScheduledHard returns the hard limits enforced at the given time according to the quota schedule,
+// along with the next time the enforced hard limits may change. The next time is zero if the quota has no schedule
+func ScheduledHard(hard corev1.ResourceList, schedule *aaqv1alpha1.QuotaSchedule, now time.Time) (corev1.ResourceList, time.Time) {
+	if schedule == nil || len(schedule.Windows) == 0 {
+		return hard, time.Time{}
+	}
+	location, err := time.LoadLocation(schedule.TimeZone)
+	if err != nil {
+		klog.Errorf("invalid quota schedule time zone %v: %v", schedule.TimeZone, err)
+		location = time.UTC
+	}
+	now = now.In(location)
+
+	var next time.Time
+	var activeWindow *aaqv1alpha1.QuotaScheduleWindow
+	for i, window := range schedule.Windows {
+		windowSchedule, err := cron.ParseStandard(window.Start)
+		if err != nil || window.Duration.Duration <= 0 {
+			klog.Errorf("ignoring invalid quota schedule window %v", window.Name)
+			continue
+		}
+		next = earliest(next, windowSchedule.Next(now))
+		// the first start after now-duration is the start of the open occurrence, if there is one
+		start := windowSchedule.Next(now.Add(-window.Duration.Duration))
+		if start.IsZero() || start.After(now) {
+			continue
+		}
+		for nextStart := windowSchedule.Next(start); !nextStart.IsZero() && !nextStart.After(now); nextStart = windowSchedule.Next(nextStart) {
+			start = nextStart
+		}
+		next = earliest(next, start.Add(window.Duration.Duration))
+		if activeWindow == nil {
+			activeWindow = &schedule.Windows[i]
+		}
+	}
+	if activeWindow == nil {
+		return hard, next
+	}
+
+	scheduledHard := hard.DeepCopy()
+	if scheduledHard == nil {
+		scheduledHard = corev1.ResourceList{}
+	}
+	for resourceName, quantity := range activeWindow.Hard {
+		scheduledHard[resourceName] = quantity
+	}
+	return scheduledHard, next
+}
+
+// ValidateQuotaSchedule returns an error if the quota schedule can't be enforced
+func ValidateQuotaSchedule(schedule *aaqv1alpha1.QuotaSchedule) error {
+	if schedule == nil {
+		return nil
+	}
+	if _, err := time.LoadLocation(schedule.TimeZone); err != nil {
+		return fmt.Errorf("invalid schedule time zone %v: %v", schedule.TimeZone, err)
+	}
+	for _, window := range schedule.Windows {
+		if _, err := cron.ParseStandard(window.Start); err != nil {
+			return fmt.Errorf("invalid start of schedule window %v: %v", window.Name, err)
+		}
+		if window.Duration.Duration <= 0 {
+			return fmt.Errorf("duration of schedule window %v must be positive", window.Name)
+		}
+		if nonSchedulableResources := FilterNonScheduableResources(window.Hard); len(nonSchedulableResources) > 0 {
+			var resourceNames []corev1.ResourceName
+			for resourceName := range nonSchedulableResources {
+				resourceNames = append(resourceNames, resourceName)
+			}
+			return fmt.Errorf("schedule window %v can't set non scheduable resources: %v", window.Name, resourceNames)
+		}
+	}
+	return nil
+}
+
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
@@ -11,7 +11,6 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8sruntime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/discovery"
-	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/certificate"
 	"k8s.io/klog/v2"
 	api "k8s.io/kubernetes/pkg/apis/core"
@@ -46,6 +45,17 @@ const (
 const (
 	// AAQLabel is the labe applied to all non operator resources
 	AAQLabel = "aaq.kubevirt.io"
+	// PodGroupLabel groups pods in the same namespace that must be released from the AAQ gate together.
+	// It can also be set as an annotation
+	PodGroupLabel = "aaq.kubevirt.io/pod-group"
+	// PodGroupMinMemberAnnotation is the number of pods a pod group needs before any of them is released
+	PodGroupMinMemberAnnotation = "aaq.kubevirt.io/pod-group-min-member"
+	// GateTTLAnnotation overrides for how long a pod can stay gated, for example "30m". It must be a positive duration
+	GateTTLAnnotation = "aaq.kubevirt.io/gate-ttl"
+	// TraceParentAnnotation holds the W3C traceparent of the trace started when the pod was gated
+	TraceParentAnnotation = "aaq.kubevirt.io/traceparent"
+	// SidecarNameEnvVar names each sidecar evaluator after its container, libsidecar serves on sidecar-<name>.sock
+	SidecarNameEnvVar = "AAQ_SIDECAR_NAME"
 	// AAQPriorityClass is the priority class for all AAQ pods.
 	AAQPriorityClass = "kubevirt-cluster-critical"
 	// AppKubernetesManagedByLabel is the Kubernetes recommended managed-by label
@@ -86,6 +96,7 @@ const (
 	ControllerResourceName                                              = ControllerPodName
 	SecretResourceName                                                  = "aaq-server-cert"
 	AaqServerResourceName                                               = "aaq-server"
+	ControllerMetricsServiceName                                        = ControllerPodName + "-metrics"
 	ControllerClusterRoleName                                           = ControllerPodName
 	DefaultLauncherConfig                 aaqv1alpha1.VmiCalcConfigName = aaqv1alpha1.VmiPodUsage
 	LauncherConfig                                                      = "launcherConfig"
@@ -93,6 +104,54 @@ const (
 	SidecarEvaluatorsNumberFlag                                         = "evaluators-sidecars"
 	DefaultSidecarsEvaluatorsStartTimeout                               = 2 * time.Minute
 	VolumeMountName                                                     = "sockets-dir"
+	QueueingPolicyFlag                                                  = "queueing-policy"
+	QueueingAgingPeriodFlag                                             = "queueing-aging-period"
+	DefaultQueueingAgingPeriod                                          = 10 * time.Minute
+	EnablePreemptionFlag                                                = "enable-preemption"
+	DefaultPreemptionBackoff                                            = 30 * time.Second
+	GateTTLFlag                                                         = "gate-ttl"
+	GateExpiryActionFlag                                                = "gate-expiry-action"
+	TracingEndpointFlag                                                 = "tracing-endpoint"
+	TracingInsecureFlag                                                 = "tracing-insecure"
+	AuditLogSinkFlag                                                    = "audit-log-sink"
+	AuditLogPathFlag                                                    = "audit-log-path"
+	AuditLogURLFlag                                                     = "audit-log-url"
+	AuditLogRetentionFlag                                               = "audit-log-retention"
+	AuditLogSamplingPercentageFlag                                      = "audit-log-sampling-percentage"
+	DefaultAuditLogPath                                                 = "/var/log/aaq/audit.log"
+	DefaultAuditLogRetention                                            = 24 * time.Hour
+	AuditLogVolumeName                                                  = "audit-log"
+	CalculatorPoliciesFlag                                              = "calculator-policies"
+	CalculatorCompositionFlag                                           = "calculator-composition"
+	UsageCacheTTLFlag                                                   = "usage-cache-ttl"
+	UsageCacheMaxEntriesFlag                                            = "usage-cache-max-entries"
+	DefaultUsageCacheTTL                                                = 10 * time.Minute
+	DefaultUsageCacheMaxEntries                                         = 100000
+	RemoteEvaluatorsFlag                                                = "remote-evaluators"
+	CELCalculatorsFlag                                                  = "cel-calculators"
+	WasmCalculatorsFlag                                                 = "wasm-calculators"
+	ControllerCalculatorsFlag                                           = "controller-calculators"
+	RemoteEvaluatorPort                                                 = 9443
+	EvaluatorSignerSecretName                                           = "aaq-evaluator-signer"
+	EvaluatorSignerBundleName                                           = "aaq-evaluator-signer-bundle"
+	EvaluatorClientCertSecretName                                       = "aaq-evaluator-client-cert"
+	EvaluatorClientCertDir                                              = "/etc/aaq/evaluator-client-cert"
+	EvaluatorCABundleDir                                                = "/etc/aaq/evaluator-ca"
+	EvaluatorServerCertDir                                              = "/etc/aaq/evaluator-cert"
+	ShardsFlag                                                          = "shards"
+	ShardingReplicasFlag                                                = "sharding-replicas"
+	DefaultControllerReplicas                                           = 2
+	StripPodFieldsFlag                                                  = "strip-pod-fields"
+	CalculatorPodFieldsFlag                                             = "calculator-pod-fields"
+	ScopedWatchesFlag                                                   = "scoped-watches"
+	GatedNamespaceSelectorFlag                                          = "gated-namespace-selector"
+	DefaultGatedNamespaceLabel                                          = "application-aware-quota/enable-gating"
+	EventCoalescingMinDelayFlag                                         = "event-coalescing-min-delay"
+	EventCoalescingMaxDelayFlag                                         = "event-coalescing-max-delay"
+	ReleaseParallelismFlag                                              = "release-parallelism"
+	DefaultEventCoalescingMinDelay                                      = 100 * time.Millisecond
+	DefaultEventCoalescingMaxDelay                                      = time.Second
+	DefaultReleaseParallelism                                           = 16
 )
 
 var commonLabels = map[string]string{
@@ -172,6 +231,16 @@ func MergeLabels(src, dest map[string]string) map[string]string {
 	return dest
 }
 
+// RemoteEvaluatorResourceName is the name of the Deployment and Service the operator deploys for a remote evaluator
+func RemoteEvaluatorResourceName(evaluatorName string) string {
+	return "aaq-evaluator-" + evaluatorName
+}
+
+// RemoteEvaluatorCertSecretName is the name of the secret holding the serving certificate of a remote evaluator
+func RemoteEvaluatorCertSecretName(evaluatorName string) string {
+	return RemoteEvaluatorResourceName(evaluatorName) + "-cert"
+}
+
 // GetActiveAAQ returns the active AAQ CR
 func GetActiveAAQ(c client.Client) (*aaqv1alpha1.AAQ, error) {
 	crList := &aaqv1alpha1.AAQList{}
@@ -417,58 +486,6 @@ func isSchedulableResource(resourceName corev1.ResourceName) bool {
 	return false
 }
 
-// VerifyPodsWithOutSchedulingGates checks that all pods in the specified namespace
-// with the specified names do not have scheduling gates.
-func VerifyPodsWithOutSchedulingGates(aaqCli client2.AAQClient, podInformer cache.SharedIndexInformer, namespace string, podNames []string) (bool, error) {
-	podObjs, err := podInformer.GetIndexer().ByIndex(cache.NamespaceIndex, namespace)
-	if err != nil {
-		return false, err
-	}
-
-	// Create a map to store pod names and their scheduling gate status
-	podStatusMap := make(map[string]bool)
-
-	// Iterate through all pods and check for scheduling gates.
-	for _, podObj := range podObjs {
-		pod := podObj.(*corev1.Pod)
-		podStatusMap[pod.Name] = len(pod.Spec.SchedulingGates) > 0
-	}
-
-	// Check if all specified pods are found and are not gated
-	for _, name := range podNames {
-		if gated, exists := podStatusMap[name]; exists {
-			if gated {
-				return false, nil
-			}
-		} else {
-			// If one of the pods is not found, make an API call
-			return verifyPodsWithOutSchedulingGatesWithApiCall(aaqCli, namespace, podNames)
-		}
-	}
-
-	return true, nil
-}
-
-// verifyPodsWithOutSchedulingGatesWithApiCall checks that all pods in the specified namespace
-// with the specified names do not have scheduling gates.
-func verifyPodsWithOutSchedulingGatesWithApiCall(aaqCli client2.AAQClient, namespace string, podNames []string) (bool, error) {
-	podList, err := aaqCli.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		return false, err
-	}
-
-	// Iterate through all pods and check for scheduling gates.
-	for _, pod := range podList.Items {
-		for _, name := range podNames {
-			if pod.Name == name && len(pod.Spec.SchedulingGates) > 0 {
-				return false, nil
-			}
-		}
-	}
-
-	return true, nil
-}
-
 func IgnoreRqErr(err string) string {
 	return strings.TrimPrefix(err, strings.Split(err, ":")[0]+": ")
 }
@@ -0,0 +1,555 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.33.0
+// 	protoc        (unknown)
+// source: staging/src/kubevirt.io/application-aware-quota-api/libsidecar/evaluator-server-com/v2/evaluate.proto
+
+package aaq_sidecar_evaluate_v2
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	v1 "k8s.io/api/core/v1"
+	resource "k8s.io/apimachinery/pkg/api/resource"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type PodUsageRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Pod       *v1.Pod   `protobuf:"bytes,1,opt,name=pod,proto3" json:"pod,omitempty"`
+	PodsState []*v1.Pod `protobuf:"bytes,2,rep,name=podsState,proto3" json:"podsState,omitempty"`
+}
+
+func (x *PodUsageRequest) Reset() {
+	*x = PodUsageRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PodUsageRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PodUsageRequest) ProtoMessage() {}
+
+func (x *PodUsageRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PodUsageRequest.ProtoReflect.Descriptor instead.
+func (*PodUsageRequest) Descriptor() ([]byte, []int) {
+	return file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *PodUsageRequest) GetPod() *v1.Pod {
+	if x != nil {
+		return x.Pod
+	}
+	return nil
+}
+
+func (x *PodUsageRequest) GetPodsState() []*v1.Pod {
+	if x != nil {
+		return x.PodsState
+	}
+	return nil
+}
+
+type PodUsageResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ResourceList map[string]*resource.Quantity `protobuf:"bytes,1,rep,name=resourceList,proto3" json:"resourceList,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Match        bool                          `protobuf:"varint,2,opt,name=match,proto3" json:"match,omitempty"`
+	Error        string                        `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+}
+
+func (x *PodUsageResponse) Reset() {
+	*x = PodUsageResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PodUsageResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PodUsageResponse) ProtoMessage() {}
+
+func (x *PodUsageResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PodUsageResponse.ProtoReflect.Descriptor instead.
+func (*PodUsageResponse) Descriptor() ([]byte, []int) {
+	return file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PodUsageResponse) GetResourceList() map[string]*resource.Quantity {
+	if x != nil {
+		return x.ResourceList
+	}
+	return nil
+}
+
+func (x *PodUsageResponse) GetMatch() bool {
+	if x != nil {
+		return x.Match
+	}
+	return false
+}
+
+func (x *PodUsageResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type PodsUsageRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Pods      []*v1.Pod `protobuf:"bytes,1,rep,name=pods,proto3" json:"pods,omitempty"`
+	PodsState []*v1.Pod `protobuf:"bytes,2,rep,name=podsState,proto3" json:"podsState,omitempty"`
+}
+
+func (x *PodsUsageRequest) Reset() {
+	*x = PodsUsageRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PodsUsageRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PodsUsageRequest) ProtoMessage() {}
+
+func (x *PodsUsageRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PodsUsageRequest.ProtoReflect.Descriptor instead.
+func (*PodsUsageRequest) Descriptor() ([]byte, []int) {
+	return file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *PodsUsageRequest) GetPods() []*v1.Pod {
+	if x != nil {
+		return x.Pods
+	}
+	return nil
+}
+
+func (x *PodsUsageRequest) GetPodsState() []*v1.Pod {
+	if x != nil {
+		return x.PodsState
+	}
+	return nil
+}
+
+type PodsUsageResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Usages []*PodUsageResponse `protobuf:"bytes,1,rep,name=usages,proto3" json:"usages,omitempty"`
+}
+
+func (x *PodsUsageResponse) Reset() {
+	*x = PodsUsageResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PodsUsageResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PodsUsageResponse) ProtoMessage() {}
+
+func (x *PodsUsageResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PodsUsageResponse.ProtoReflect.Descriptor instead.
+func (*PodsUsageResponse) Descriptor() ([]byte, []int) {
+	return file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PodsUsageResponse) GetUsages() []*PodUsageResponse {
+	if x != nil {
+		return x.Usages
+	}
+	return nil
+}
+
+type HealthCheckRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *HealthCheckRequest) Reset() {
+	*x = HealthCheckRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *HealthCheckRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HealthCheckRequest) ProtoMessage() {}
+
+func (x *HealthCheckRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HealthCheckRequest.ProtoReflect.Descriptor instead.
+func (*HealthCheckRequest) Descriptor() ([]byte, []int) {
+	return file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_rawDescGZIP(), []int{4}
+}
+
+type HealthCheckResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Healthy bool `protobuf:"varint,1,opt,name=healthy,proto3" json:"healthy,omitempty"`
+}
+
+func (x *HealthCheckResponse) Reset() {
+	*x = HealthCheckResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *HealthCheckResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HealthCheckResponse) ProtoMessage() {}
+
+func (x *HealthCheckResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HealthCheckResponse.ProtoReflect.Descriptor instead.
+func (*HealthCheckResponse) Descriptor() ([]byte, []int) {
+	return file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *HealthCheckResponse) GetHealthy() bool {
+	if x != nil {
+		return x.Healthy
+	}
+	return false
+}
+
+var File_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto protoreflect.FileDescriptor
+
+var file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_rawDesc = []byte{
+	0x0a, 0x65, 0x73, 0x74, 0x61, 0x67, 0x69, 0x6e, 0x67, 0x2f, 0x73, 0x72, 0x63, 0x2f, 0x6b, 0x75,
+	0x62, 0x65, 0x76, 0x69, 0x72, 0x74, 0x2e, 0x69, 0x6f, 0x2f, 0x61, 0x70, 0x70, 0x6c, 0x69, 0x63,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2d, 0x61, 0x77, 0x61, 0x72, 0x65, 0x2d, 0x71, 0x75, 0x6f, 0x74,
+	0x61, 0x2d, 0x61, 0x70, 0x69, 0x2f, 0x6c, 0x69, 0x62, 0x73, 0x69, 0x64, 0x65, 0x63, 0x61, 0x72,
+	0x2f, 0x65, 0x76, 0x61, 0x6c, 0x75, 0x61, 0x74, 0x6f, 0x72, 0x2d, 0x73, 0x65, 0x72, 0x76, 0x65,
+	0x72, 0x2d, 0x63, 0x6f, 0x6d, 0x2f, 0x76, 0x32, 0x2f, 0x65, 0x76, 0x61, 0x6c, 0x75, 0x61, 0x74,
+	0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0b, 0x65, 0x76, 0x61, 0x6c, 0x75, 0x61, 0x74,
+	0x65, 0x2e, 0x76, 0x32, 0x1a, 0x22, 0x6b, 0x38, 0x73, 0x2e, 0x69, 0x6f, 0x2f, 0x61, 0x70, 0x69,
+	0x2f, 0x63, 0x6f, 0x72, 0x65, 0x2f, 0x76, 0x31, 0x2f, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74,
+	0x65, 0x64, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x34, 0x6b, 0x38, 0x73, 0x2e, 0x69, 0x6f,
+	0x2f, 0x61, 0x70, 0x69, 0x6d, 0x61, 0x63, 0x68, 0x69, 0x6e, 0x65, 0x72, 0x79, 0x2f, 0x70, 0x6b,
+	0x67, 0x2f, 0x61, 0x70, 0x69, 0x2f, 0x72, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x2f, 0x67,
+	0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x64, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x73,
+	0x0a, 0x0f, 0x50, 0x6f, 0x64, 0x55, 0x73, 0x61, 0x67, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x12, 0x29, 0x0a, 0x03, 0x70, 0x6f, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x17,
+	0x2e, 0x6b, 0x38, 0x73, 0x2e, 0x69, 0x6f, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x63, 0x6f, 0x72, 0x65,
+	0x2e, 0x76, 0x31, 0x2e, 0x50, 0x6f, 0x64, 0x52, 0x03, 0x70, 0x6f, 0x64, 0x12, 0x35, 0x0a, 0x09,
+	0x70, 0x6f, 0x64, 0x73, 0x53, 0x74, 0x61, 0x74, 0x65, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32,
+	0x17, 0x2e, 0x6b, 0x38, 0x73, 0x2e, 0x69, 0x6f, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x63, 0x6f, 0x72,
+	0x65, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x6f, 0x64, 0x52, 0x09, 0x70, 0x6f, 0x64, 0x73, 0x53, 0x74,
+	0x61, 0x74, 0x65, 0x22, 0x84, 0x02, 0x0a, 0x10, 0x50, 0x6f, 0x64, 0x55, 0x73, 0x61, 0x67, 0x65,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x53, 0x0a, 0x0c, 0x72, 0x65, 0x73, 0x6f,
+	0x75, 0x72, 0x63, 0x65, 0x4c, 0x69, 0x73, 0x74, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x2f,
+	0x2e, 0x65, 0x76, 0x61, 0x6c, 0x75, 0x61, 0x74, 0x65, 0x2e, 0x76, 0x32, 0x2e, 0x50, 0x6f, 0x64,
+	0x55, 0x73, 0x61, 0x67, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x2e, 0x52, 0x65,
+	0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x4c, 0x69, 0x73, 0x74, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52,
+	0x0c, 0x72, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x4c, 0x69, 0x73, 0x74, 0x12, 0x14, 0x0a,
+	0x05, 0x6d, 0x61, 0x74, 0x63, 0x68, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x6d, 0x61,
+	0x74, 0x63, 0x68, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x1a, 0x6f, 0x0a, 0x11, 0x52, 0x65, 0x73,
+	0x6f, 0x75, 0x72, 0x63, 0x65, 0x4c, 0x69, 0x73, 0x74, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10,
+	0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79,
+	0x12, 0x44, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x2e, 0x2e, 0x6b, 0x38, 0x73, 0x2e, 0x69, 0x6f, 0x2e, 0x61, 0x70, 0x69, 0x6d, 0x61, 0x63, 0x68,
+	0x69, 0x6e, 0x65, 0x72, 0x79, 0x2e, 0x70, 0x6b, 0x67, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x72, 0x65,
+	0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x2e, 0x51, 0x75, 0x61, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x52,
+	0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x76, 0x0a, 0x10, 0x50, 0x6f,
+	0x64, 0x73, 0x55, 0x73, 0x61, 0x67, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x2b,
+	0x0a, 0x04, 0x70, 0x6f, 0x64, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x6b,
+	0x38, 0x73, 0x2e, 0x69, 0x6f, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x63, 0x6f, 0x72, 0x65, 0x2e, 0x76,
+	0x31, 0x2e, 0x50, 0x6f, 0x64, 0x52, 0x04, 0x70, 0x6f, 0x64, 0x73, 0x12, 0x35, 0x0a, 0x09, 0x70,
+	0x6f, 0x64, 0x73, 0x53, 0x74, 0x61, 0x74, 0x65, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x17,
+	0x2e, 0x6b, 0x38, 0x73, 0x2e, 0x69, 0x6f, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x63, 0x6f, 0x72, 0x65,
+	0x2e, 0x76, 0x31, 0x2e, 0x50, 0x6f, 0x64, 0x52, 0x09, 0x70, 0x6f, 0x64, 0x73, 0x53, 0x74, 0x61,
+	0x74, 0x65, 0x22, 0x4a, 0x0a, 0x11, 0x50, 0x6f, 0x64, 0x73, 0x55, 0x73, 0x61, 0x67, 0x65, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x35, 0x0a, 0x06, 0x75, 0x73, 0x61, 0x67, 0x65,
+	0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1d, 0x2e, 0x65, 0x76, 0x61, 0x6c, 0x75, 0x61,
+	0x74, 0x65, 0x2e, 0x76, 0x32, 0x2e, 0x50, 0x6f, 0x64, 0x55, 0x73, 0x61, 0x67, 0x65, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x06, 0x75, 0x73, 0x61, 0x67, 0x65, 0x73, 0x22, 0x14,
+	0x0a, 0x12, 0x48, 0x65, 0x61, 0x6c, 0x74, 0x68, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x22, 0x2f, 0x0a, 0x13, 0x48, 0x65, 0x61, 0x6c, 0x74, 0x68, 0x43, 0x68,
+	0x65, 0x63, 0x6b, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x68,
+	0x65, 0x61, 0x6c, 0x74, 0x68, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x68, 0x65,
+	0x61, 0x6c, 0x74, 0x68, 0x79, 0x32, 0xf5, 0x01, 0x0a, 0x08, 0x50, 0x6f, 0x64, 0x55, 0x73, 0x61,
+	0x67, 0x65, 0x12, 0x4b, 0x0a, 0x0c, 0x50, 0x6f, 0x64, 0x55, 0x73, 0x61, 0x67, 0x65, 0x46, 0x75,
+	0x6e, 0x63, 0x12, 0x1c, 0x2e, 0x65, 0x76, 0x61, 0x6c, 0x75, 0x61, 0x74, 0x65, 0x2e, 0x76, 0x32,
+	0x2e, 0x50, 0x6f, 0x64, 0x55, 0x73, 0x61, 0x67, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x1a, 0x1d, 0x2e, 0x65, 0x76, 0x61, 0x6c, 0x75, 0x61, 0x74, 0x65, 0x2e, 0x76, 0x32, 0x2e, 0x50,
+	0x6f, 0x64, 0x55, 0x73, 0x61, 0x67, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12,
+	0x4a, 0x0a, 0x09, 0x50, 0x6f, 0x64, 0x73, 0x55, 0x73, 0x61, 0x67, 0x65, 0x12, 0x1d, 0x2e, 0x65,
+	0x76, 0x61, 0x6c, 0x75, 0x61, 0x74, 0x65, 0x2e, 0x76, 0x32, 0x2e, 0x50, 0x6f, 0x64, 0x73, 0x55,
+	0x73, 0x61, 0x67, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1e, 0x2e, 0x65, 0x76,
+	0x61, 0x6c, 0x75, 0x61, 0x74, 0x65, 0x2e, 0x76, 0x32, 0x2e, 0x50, 0x6f, 0x64, 0x73, 0x55, 0x73,
+	0x61, 0x67, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x50, 0x0a, 0x0b, 0x48,
+	0x65, 0x61, 0x6c, 0x74, 0x68, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x12, 0x1f, 0x2e, 0x65, 0x76, 0x61,
+	0x6c, 0x75, 0x61, 0x74, 0x65, 0x2e, 0x76, 0x32, 0x2e, 0x48, 0x65, 0x61, 0x6c, 0x74, 0x68, 0x43,
+	0x68, 0x65, 0x63, 0x6b, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x20, 0x2e, 0x65, 0x76,
+	0x61, 0x6c, 0x75, 0x61, 0x74, 0x65, 0x2e, 0x76, 0x32, 0x2e, 0x48, 0x65, 0x61, 0x6c, 0x74, 0x68,
+	0x43, 0x68, 0x65, 0x63, 0x6b, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42, 0x64, 0x5a,
+	0x62, 0x6b, 0x75, 0x62, 0x65, 0x76, 0x69, 0x72, 0x74, 0x2e, 0x69, 0x6f, 0x2f, 0x61, 0x70, 0x70,
+	0x6c, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2d, 0x61, 0x77, 0x61, 0x72, 0x65, 0x2d, 0x71,
+	0x75, 0x6f, 0x74, 0x61, 0x2d, 0x61, 0x70, 0x69, 0x2f, 0x6c, 0x69, 0x62, 0x73, 0x69, 0x64, 0x65,
+	0x63, 0x61, 0x72, 0x2f, 0x65, 0x76, 0x61, 0x6c, 0x75, 0x61, 0x74, 0x6f, 0x72, 0x2d, 0x73, 0x65,
+	0x72, 0x76, 0x65, 0x72, 0x2d, 0x63, 0x6f, 0x6d, 0x2f, 0x76, 0x32, 0x3b, 0x61, 0x61, 0x71, 0x5f,
+	0x73, 0x69, 0x64, 0x65, 0x63, 0x61, 0x72, 0x5f, 0x65, 0x76, 0x61, 0x6c, 0x75, 0x61, 0x74, 0x65,
+	0x5f, 0x76, 0x32, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_rawDescOnce sync.Once
+	file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_rawDescData = file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_rawDesc
+)
+
+func file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_rawDescGZIP() []byte {
+	file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_rawDescOnce.Do(func() {
+		file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_rawDescData = protoimpl.X.CompressGZIP(file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_rawDescData)
+	})
+	return file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_rawDescData
+}
+
+var file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_goTypes = []interface{}{
+	(*PodUsageRequest)(nil),     // 0: evaluate.v2.PodUsageRequest
+	(*PodUsageResponse)(nil),    // 1: evaluate.v2.PodUsageResponse
+	(*PodsUsageRequest)(nil),    // 2: evaluate.v2.PodsUsageRequest
+	(*PodsUsageResponse)(nil),   // 3: evaluate.v2.PodsUsageResponse
+	(*HealthCheckRequest)(nil),  // 4: evaluate.v2.HealthCheckRequest
+	(*HealthCheckResponse)(nil), // 5: evaluate.v2.HealthCheckResponse
+	nil,                         // 6: evaluate.v2.PodUsageResponse.ResourceListEntry
+	(*v1.Pod)(nil),              // 7: k8s.io.api.core.v1.Pod
+	(*resource.Quantity)(nil),   // 8: k8s.io.apimachinery.pkg.api.resource.Quantity
+}
+var file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_depIdxs = []int32{
+	7,  // 0: evaluate.v2.PodUsageRequest.pod:type_name -> k8s.io.api.core.v1.Pod
+	7,  // 1: evaluate.v2.PodUsageRequest.podsState:type_name -> k8s.io.api.core.v1.Pod
+	6,  // 2: evaluate.v2.PodUsageResponse.resourceList:type_name -> evaluate.v2.PodUsageResponse.ResourceListEntry
+	7,  // 3: evaluate.v2.PodsUsageRequest.pods:type_name -> k8s.io.api.core.v1.Pod
+	7,  // 4: evaluate.v2.PodsUsageRequest.podsState:type_name -> k8s.io.api.core.v1.Pod
+	1,  // 5: evaluate.v2.PodsUsageResponse.usages:type_name -> evaluate.v2.PodUsageResponse
+	8,  // 6: evaluate.v2.PodUsageResponse.ResourceListEntry.value:type_name -> k8s.io.apimachinery.pkg.api.resource.Quantity
+	0,  // 7: evaluate.v2.PodUsage.PodUsageFunc:input_type -> evaluate.v2.PodUsageRequest
+	2,  // 8: evaluate.v2.PodUsage.PodsUsage:input_type -> evaluate.v2.PodsUsageRequest
+	4,  // 9: evaluate.v2.PodUsage.HealthCheck:input_type -> evaluate.v2.HealthCheckRequest
+	1,  // 10: evaluate.v2.PodUsage.PodUsageFunc:output_type -> evaluate.v2.PodUsageResponse
+	3,  // 11: evaluate.v2.PodUsage.PodsUsage:output_type -> evaluate.v2.PodsUsageResponse
+	5,  // 12: evaluate.v2.PodUsage.HealthCheck:output_type -> evaluate.v2.HealthCheckResponse
+	10, // [10:13] is the sub-list for method output_type
+	7,  // [7:10] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
+}
+
+func init() {
+	file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_init()
+}
+func file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_init() {
+	if File_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PodUsageRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PodUsageResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PodsUsageRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PodsUsageResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*HealthCheckRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*HealthCheckResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_goTypes,
+		DependencyIndexes: file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_depIdxs,
+		MessageInfos:      file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_msgTypes,
+	}.Build()
+	File_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto = out.File
+	file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_rawDesc = nil
+	file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_goTypes = nil
+	file_staging_src_kubevirt_io_application_aware_quota_api_libsidecar_evaluator_server_com_v2_evaluate_proto_depIdxs = nil
+}
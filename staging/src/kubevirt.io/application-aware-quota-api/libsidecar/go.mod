@@ -1,12 +1,13 @@
 module kubevirt.io/application-aware-quota-api/libsidecar
 
-go 1.20
+go 1.21
 
 require google.golang.org/grpc v1.63.2
 
 require (
 	github.com/golang/protobuf v1.5.4
 	golang.org/x/net v0.23.0
+	google.golang.org/protobuf v1.33.0
 	k8s.io/api v0.29.3
 	k8s.io/apimachinery v0.29.3
 	k8s.io/klog v1.0.0
@@ -22,7 +23,6 @@ require (
 	golang.org/x/sys v0.18.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240227224415-6ceb2ff114de // indirect
-	google.golang.org/protobuf v1.33.0 // indirect
 	gopkg.in/inf.v0 v0.9.1 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 	k8s.io/klog/v2 v2.110.1 // indirect
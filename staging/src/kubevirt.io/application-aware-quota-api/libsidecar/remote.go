@@ -0,0 +1,66 @@
+package libsidecar
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"k8s.io/klog"
+	aaqsidecarevaluate "kubevirt.io/application-aware-quota-api/libsidecar/evaluator-server-com"
+	aaqsidecarevaluatev2 "kubevirt.io/application-aware-quota-api/libsidecar/evaluator-server-com/v2"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// RemoteEvaluatorPort is the port the operator exposes remote evaluators on
+	RemoteEvaluatorPort = 9443
+	// RemoteEvaluatorCertDir holds the serving certificate the operator issues to the remote evaluators it deploys
+	RemoteEvaluatorCertDir = "/etc/aaq/evaluator-cert"
+	// RemoteEvaluatorCABundleDir holds the bundle of the CA the aaq-controller client certificate is issued by
+	RemoteEvaluatorCABundleDir = "/etc/aaq/evaluator-ca"
+)
+
+// RunRemoteServer serves the evaluator over TCP on RemoteEvaluatorPort, only to clients presenting a certificate
+// issued by the CA of RemoteEvaluatorCABundleDir. Certificates are read on every handshake so rotated ones are picked up
+func RunRemoteServer(scc SidecarCalculator) {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", RemoteEvaluatorPort))
+	if err != nil {
+		klog.Fatalf("Failed to listen on port %d: %v", RemoteEvaluatorPort, err)
+	}
+	grpcServer := grpc.NewServer(grpc.Creds(credentials.NewTLS(remoteServerTLSConfig(RemoteEvaluatorCertDir, RemoteEvaluatorCABundleDir))))
+	aaqsidecarevaluate.RegisterPodUsageServer(grpcServer, &Server{scc})
+	aaqsidecarevaluatev2.RegisterPodUsageServer(grpcServer, &ServerV2{sidecarCalculator: scc})
+
+	if err := grpcServer.Serve(listener); err != nil {
+		klog.Fatalf("Failed to serve gRPC server over port %d: %v", RemoteEvaluatorPort, err)
+	}
+}
+
+func remoteServerTLSConfig(certDir, caDir string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(_ *tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, err := tls.LoadX509KeyPair(filepath.Join(certDir, "tls.crt"), filepath.Join(certDir, "tls.key"))
+			if err != nil {
+				return nil, err
+			}
+			bundle, err := os.ReadFile(filepath.Join(caDir, "ca-bundle.crt"))
+			if err != nil {
+				return nil, err
+			}
+			clientCAs := x509.NewCertPool()
+			if !clientCAs.AppendCertsFromPEM(bundle) {
+				return nil, fmt.Errorf("no CA certificates found in %s", caDir)
+			}
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{cert},
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				ClientCAs:    clientCAs,
+			}, nil
+		},
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"fmt"
 	"google.golang.org/grpc"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/klog"
 	aaqsidecarevaluate "kubevirt.io/application-aware-quota-api/libsidecar/evaluator-server-com"
+	aaqsidecarevaluatev2 "kubevirt.io/application-aware-quota-api/libsidecar/evaluator-server-com/v2"
 	"net"
 	"os"
 	"path/filepath"
@@ -17,12 +19,30 @@ import (
 
 const (
 	SocketsSharedDirectory = "/var/run/aaq-sockets"
+	// SidecarNameEnvVar is set by the AAQ operator to the name of the sidecar container. The sidecar serves on a socket
+	// named after it, so that the aaq-controller recognizes the sidecar when it restarts
+	SidecarNameEnvVar = "AAQ_SIDECAR_NAME"
 )
 
 type SidecarCalculator interface {
 	PodUsageFunc(podToEvaluate *corev1.Pod, existingPods []*corev1.Pod) (corev1.ResourceList, bool, error)
 }
 
+// BatchSidecarCalculator can be implemented by calculators that evaluate many pods at once more
+// efficiently than one at a time. It is used by the v2 PodsUsage call
+type BatchSidecarCalculator interface {
+	SidecarCalculator
+	// PodsUsageFunc returns a PodUsage for each of podsToEvaluate, in the same order
+	PodsUsageFunc(podsToEvaluate []*corev1.Pod, existingPods []*corev1.Pod) ([]PodUsage, error)
+}
+
+// PodUsage is the result of evaluating a single pod
+type PodUsage struct {
+	ResourceList corev1.ResourceList
+	Match        bool
+	Err          error
+}
+
 func RunServer(scc SidecarCalculator) {
 	socketPath, err := getSocketPath()
 	if err != nil {
@@ -38,7 +58,9 @@ func RunServer(scc SidecarCalculator) {
 	defer os.Remove(socketPath)
 	s := Server{scc}
 	grpcServer := grpc.NewServer()
+	// v1 is kept for controllers that don't speak v2 yet
 	aaqsidecarevaluate.RegisterPodUsageServer(grpcServer, &s)
+	aaqsidecarevaluatev2.RegisterPodUsageServer(grpcServer, &ServerV2{sidecarCalculator: scc})
 
 	if err := grpcServer.Serve(socket); err != nil {
 		klog.Fatalf("Failed to serve gRPC server over port 9000: %v", err)
@@ -50,6 +72,15 @@ func getSocketPath() (string, error) {
 		return "", fmt.Errorf("Failed dir %s due %s", SocketsSharedDirectory, err.Error())
 	}
 
+	if name := os.Getenv(SidecarNameEnvVar); name != "" {
+		socketPath := filepath.Join(SocketsSharedDirectory, SocketName(name))
+		// the socket of a previous run of this sidecar may have been left behind
+		if err := os.Remove(socketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("Failed removing stale socket %s due %s", socketPath, err.Error())
+		}
+		return socketPath, nil
+	}
+
 	for i := 0; i < 10; i++ {
 		socketName := fmt.Sprintf("sidecar-%s.sock", rand.String(4))
 		socketPath := filepath.Join(SocketsSharedDirectory, socketName)
@@ -63,6 +94,11 @@ func getSocketPath() (string, error) {
 	return "", fmt.Errorf("failed generate socket path")
 }
 
+// SocketName returns the name of the socket the sidecar named name serves on
+func SocketName(name string) string {
+	return fmt.Sprintf("sidecar-%s.sock", name)
+}
+
 type Server struct {
 	sidecarCalculator SidecarCalculator
 }
@@ -105,3 +141,60 @@ func (s *Server) PodUsageFunc(_ context.Context, request *aaqsidecarevaluate.Pod
 func (s *Server) HealthCheck(_ context.Context, _ *aaqsidecarevaluate.HealthCheckRequest) (*aaqsidecarevaluate.HealthCheckResponse, error) {
 	return &aaqsidecarevaluate.HealthCheckResponse{Healthy: true}, nil
 }
+
+// ServerV2 serves the v2 protocol, which carries typed pods and can evaluate many pods per call
+type ServerV2 struct {
+	aaqsidecarevaluatev2.UnimplementedPodUsageServer
+	sidecarCalculator SidecarCalculator
+}
+
+func (s *ServerV2) PodUsageFunc(_ context.Context, request *aaqsidecarevaluatev2.PodUsageRequest) (*aaqsidecarevaluatev2.PodUsageResponse, error) {
+	if request.GetPod() == nil {
+		return nil, fmt.Errorf("no pod to evaluate")
+	}
+	rl, match, err := s.sidecarCalculator.PodUsageFunc(request.GetPod(), request.GetPodsState())
+	return toPodUsageResponse(PodUsage{ResourceList: rl, Match: match, Err: err}), nil
+}
+
+func (s *ServerV2) PodsUsage(_ context.Context, request *aaqsidecarevaluatev2.PodsUsageRequest) (*aaqsidecarevaluatev2.PodsUsageResponse, error) {
+	var usages []PodUsage
+	if batchCalculator, ok := s.sidecarCalculator.(BatchSidecarCalculator); ok {
+		var err error
+		usages, err = batchCalculator.PodsUsageFunc(request.GetPods(), request.GetPodsState())
+		if err != nil {
+			return nil, err
+		}
+		if len(usages) != len(request.GetPods()) {
+			return nil, fmt.Errorf("calculator returned %d usages for %d pods", len(usages), len(request.GetPods()))
+		}
+	} else {
+		for _, pod := range request.GetPods() {
+			rl, match, err := s.sidecarCalculator.PodUsageFunc(pod, request.GetPodsState())
+			usages = append(usages, PodUsage{ResourceList: rl, Match: match, Err: err})
+		}
+	}
+	response := &aaqsidecarevaluatev2.PodsUsageResponse{}
+	for _, usage := range usages {
+		response.Usages = append(response.Usages, toPodUsageResponse(usage))
+	}
+	return response, nil
+}
+
+func (s *ServerV2) HealthCheck(_ context.Context, _ *aaqsidecarevaluatev2.HealthCheckRequest) (*aaqsidecarevaluatev2.HealthCheckResponse, error) {
+	return &aaqsidecarevaluatev2.HealthCheckResponse{Healthy: true}, nil
+}
+
+func toPodUsageResponse(usage PodUsage) *aaqsidecarevaluatev2.PodUsageResponse {
+	response := &aaqsidecarevaluatev2.PodUsageResponse{
+		ResourceList: make(map[string]*resource.Quantity, len(usage.ResourceList)),
+		Match:        usage.Match,
+	}
+	for name, quantity := range usage.ResourceList {
+		q := quantity.DeepCopy()
+		response.ResourceList[string(name)] = &q
+	}
+	if usage.Err != nil {
+		response.Error = usage.Err.Error()
+	}
+	return response
+}
@@ -0,0 +1,43 @@
+// Package abi is the interface between the AAQ pods and the WebAssembly calculators they run.
+//
+// A calculator module exports AllocateExport, which returns a pointer to size bytes of its memory, and PodUsageExport,
+// which is called with the pointer and size of a JSON PodUsageRequest written there and returns the pointer and size
+// of a JSON PodUsageResponse, packed with Pack. Modules built as WASI reactors are initialized with InitializeExport
+package abi
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// Version is the version of the ABI, modules report the one they implement with VersionExport
+	Version = 1
+
+	VersionExport    = "aaq_abi_version"
+	AllocateExport   = "aaq_allocate"
+	PodUsageExport   = "aaq_pod_usage"
+	InitializeExport = "_initialize"
+)
+
+// PodUsageRequest asks for the usage of Pod, given the pods counted against the same quotas
+type PodUsageRequest struct {
+	Pod       *corev1.Pod   `json:"pod"`
+	PodsState []*corev1.Pod `json:"podsState,omitempty"`
+}
+
+// PodUsageResponse is the result of a PodUsageRequest, the pod usage is only used when Match is true
+type PodUsageResponse struct {
+	ResourceList corev1.ResourceList `json:"resourceList,omitempty"`
+	Match        bool                `json:"match"`
+	Error        string              `json:"error,omitempty"`
+}
+
+// Pack packs a pointer and a size in the single value returned by PodUsageExport
+func Pack(ptr, size uint32) uint64 {
+	return uint64(ptr)<<32 | uint64(size)
+}
+
+// Unpack returns the pointer and size packed by Pack
+func Unpack(packed uint64) (uint32, uint32) {
+	return uint32(packed >> 32), uint32(packed)
+}
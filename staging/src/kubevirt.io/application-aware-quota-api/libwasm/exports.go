@@ -0,0 +1,35 @@
+//go:build wasip1
+
+package libwasm
+
+import (
+	"kubevirt.io/application-aware-quota-api/libwasm/abi"
+	"unsafe"
+)
+
+// buffers keeps the memory handed to the host referenced until the next request, so it isn't collected
+// while the host writes the request or reads the response
+var buffers [][]byte
+
+//go:wasmexport aaq_abi_version
+func abiVersion() uint32 {
+	return abi.Version
+}
+
+//go:wasmexport aaq_allocate
+func allocate(size uint32) uint32 {
+	buffer := make([]byte, size)
+	buffers = [][]byte{buffer}
+	if size == 0 {
+		return 0
+	}
+	return uint32(uintptr(unsafe.Pointer(&buffer[0])))
+}
+
+//go:wasmexport aaq_pod_usage
+func podUsage(ptr, size uint32) uint64 {
+	request := unsafe.Slice((*byte)(unsafe.Pointer(uintptr(ptr))), size)
+	response := evaluate(calculator, request)
+	buffers = append(buffers, response)
+	return abi.Pack(uint32(uintptr(unsafe.Pointer(&response[0]))), uint32(len(response)))
+}
@@ -0,0 +1,56 @@
+// Package libwasm builds AAQ usage calculators as WebAssembly modules, which the AAQ pods run in-process.
+//
+// A calculator registers itself in the init function of an empty main package:
+//
+//	func init() {
+//		libwasm.Register(&myCalculator{})
+//	}
+//
+//	func main() {}
+//
+// and is built as a WASI reactor with Go 1.24 or later:
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o calculator.wasm
+package libwasm
+
+import (
+	"encoding/json"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"kubevirt.io/application-aware-quota-api/libwasm/abi"
+)
+
+type Calculator interface {
+	PodUsageFunc(podToEvaluate *corev1.Pod, existingPods []*corev1.Pod) (corev1.ResourceList, bool, error)
+}
+
+var calculator Calculator
+
+// Register sets the calculator the module evaluates pods with
+func Register(c Calculator) {
+	calculator = c
+}
+
+// evaluate runs the calculator on a JSON PodUsageRequest and returns the JSON PodUsageResponse
+func evaluate(c Calculator, request []byte) []byte {
+	var response abi.PodUsageResponse
+	podUsageRequest := abi.PodUsageRequest{}
+	if c == nil {
+		response.Error = "no calculator is registered"
+	} else if err := json.Unmarshal(request, &podUsageRequest); err != nil {
+		response.Error = fmt.Sprintf("invalid request: %v", err)
+	} else if podUsageRequest.Pod == nil {
+		response.Error = "no pod to evaluate"
+	} else {
+		rl, match, err := c.PodUsageFunc(podUsageRequest.Pod, podUsageRequest.PodsState)
+		response.ResourceList, response.Match = rl, match
+		if err != nil {
+			response.Error = err.Error()
+		}
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		data, _ = json.Marshal(abi.PodUsageResponse{Error: err.Error()})
+	}
+	return data
+}
@@ -22,6 +22,7 @@ package v1alpha1
 import (
 	ocquotav1 "github.com/openshift/api/quota/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	sdkapi "kubevirt.io/controller-lifecycle-operator-sdk/api"
 )
@@ -45,13 +46,65 @@ type ApplicationAwareResourceQuota struct {
 // ApplicationAwareResourceQuotaSpec is an extension of corev1.ResourceQuotaSpec
 type ApplicationAwareResourceQuotaSpec struct {
 	corev1.ResourceQuotaSpec `json:",inline"`
+	// Cohort is the name of the cohort the quota belongs to.
+	// Quotas in the same cohort can borrow each other's unused resources
+	// +optional
+	Cohort string `json:"cohort,omitempty"`
+	// BorrowingLimit is the maximum amount of each resource the quota can borrow from its cohort above its hard limit.
+	// Resources that are not listed can be borrowed without a limit
+	// +optional
+	BorrowingLimit corev1.ResourceList `json:"borrowingLimit,omitempty"`
+	// LendingLimit is the maximum amount of each resource of the quota that other quotas in the cohort can borrow.
+	// Resources that are not listed can be lent without a limit
+	// +optional
+	LendingLimit corev1.ResourceList `json:"lendingLimit,omitempty"`
+	// Schedule holds time windows in which different hard limits are enforced
+	// +optional
+	Schedule *QuotaSchedule `json:"schedule,omitempty"`
+}
+
+// QuotaSchedule holds time windows in which different hard limits are enforced
+type QuotaSchedule struct {
+	// TimeZone is the IANA name of the time zone the windows start times are evaluated in. Defaults to UTC
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+	// Windows are evaluated in order, the hard limits of the first open window override the quota hard limits
+	// +listType=atomic
+	Windows []QuotaScheduleWindow `json:"windows"`
+}
+
+// QuotaScheduleWindow is a recurring time window with its own hard limits
+type QuotaScheduleWindow struct {
+	// Name of the window
+	Name string `json:"name"`
+	// Start is a cron expression in the standard five fields format, for the times the window opens
+	Start string `json:"start"`
+	// Duration is how long the window stays open
+	Duration metav1.Duration `json:"duration"`
+	// Hard is the set of hard limits enforced while the window is open.
+	// Resources that are not listed keep the quota hard limits
+	Hard corev1.ResourceList `json:"hard"`
 }
 
 // ApplicationAwareResourceQuotaStatus is an extension of corev1.ResourceQuotaStatus
 type ApplicationAwareResourceQuotaStatus struct {
 	corev1.ResourceQuotaStatus `json:",inline"`
+	// Borrowed is the usage above the hard limit that is borrowed from the quota cohort
+	// +optional
+	Borrowed corev1.ResourceList `json:"borrowed,omitempty"`
+	// Conditions of the quota, Degraded is true while the usage of some pods can't be calculated
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+const (
+	// ApplicationAwareResourceQuotaDegraded is true while the usage of some pods counted by the quota can't be calculated,
+	// the quota then keeps the usage it last calculated
+	ApplicationAwareResourceQuotaDegraded = "Degraded"
+)
+
 // ApplicationAwareResourceQuota List is a list of ApplicationAwareResourceQuota
 //
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -126,9 +179,40 @@ type AAQJobQueueConfigSpec struct {
 
 // AAQJobQueueConfigStatus defines the status with metadata for current jobs
 type AAQJobQueueConfigStatus struct {
-	// BuiltInCalculationConfigToApply
-	PodsInJobQueue []string        `json:"podsInJobQueue,omitempty"`
+	// PodsInJobQueue is deprecated, the released pods are tracked in memory by the controller
+	PodsInJobQueue []string `json:"podsInJobQueue,omitempty"`
+	// ControllerLock is deprecated, the quota controllers don't wait for the gate controller anymore
 	ControllerLock map[string]bool `json:"controllerLock,omitempty"`
+	// GatedPods lists the pods in the namespace that are waiting for quota, in the order they are evaluated.
+	// Only the first 100 pods are listed to keep the object small, TotalGatedPods counts all of them
+	GatedPods []GatedPodStatus `json:"gatedPods,omitempty"`
+	// TotalGatedPods is the number of pods in the namespace that are waiting for quota, GatedPods is truncated
+	// when it is larger than the number of listed pods
+	TotalGatedPods int32 `json:"totalGatedPods,omitempty"`
+}
+
+// GatedPodStatus describes a pod that is waiting for quota
+type GatedPodStatus struct {
+	// Name of the gated pod
+	Name string `json:"name"`
+	// Position of the pod in the namespace admission queue, starting from 1
+	Position int32 `json:"position"`
+	// GatedTime is the time the pod was gated
+	GatedTime metav1.Time `json:"gatedTime,omitempty"`
+	// Reason the pod is still gated
+	Reason string `json:"reason,omitempty"`
+	// BlockingQuotas lists the quotas the pod doesn't fit in
+	BlockingQuotas []BlockingQuota `json:"blockingQuotas,omitempty"`
+}
+
+// BlockingQuota describes a quota a gated pod doesn't fit in
+type BlockingQuota struct {
+	// Kind of the quota, ApplicationAwareResourceQuota or ApplicationAwareClusterResourceQuota
+	Kind string `json:"kind"`
+	// Name of the quota
+	Name string `json:"name"`
+	// Shortfall is the amount of each resource that is missing for the pod to fit in the quota
+	Shortfall corev1.ResourceList `json:"shortfall,omitempty"`
 }
 
 // AAQSpec defines our specification for the AAQ installation
@@ -155,13 +239,310 @@ type AAQSpec struct {
 type AAQConfiguration struct {
 	// VmiCalculatorConfiguration determine how resource allocation will be done with ApplicationAwareResourceQuota
 	VmiCalculatorConfiguration VmiCalculatorConfiguration `json:"vmiCalculatorConfiguration,omitempty"`
-	// SidecarEvaluators allow custom quota counting for external operator
+	// SidecarEvaluators allow custom quota counting for external operator.
+	// Each sidecar gets its container name in the AAQ_SIDECAR_NAME environment variable and serves on a socket named after it
 	SidecarEvaluators []corev1.Container `json:"sidecarEvaluators,omitempty"`
 	// AllowApplicationAwareClusterResourceQuota can be set to true to allow creation and management
 	// of ApplicationAwareClusterResourceQuota. Defaults to false
 	AllowApplicationAwareClusterResourceQuota bool `json:"allowApplicationAwareClusterResourceQuota,omitempty"`
+	// QueueingConfiguration determine the order in which gated pods are evaluated against quotas
+	QueueingConfiguration QueueingConfiguration `json:"queueingConfiguration,omitempty"`
+	// EnablePreemption can be set to true to allow evicting lower priority pods counted against the same quota
+	// in order to admit a higher priority gated pod. Pod groups preempt as a whole, for pods with a lower priority than
+	// all their members. Evictions go through the Eviction API and respect PodDisruptionBudgets.
+	// Best used together with the PriorityClass queueing policy. Defaults to false
+	EnablePreemption bool `json:"enablePreemption,omitempty"`
+	// GateTTLConfiguration determine how long pods can stay gated and what happens when they wait longer
+	GateTTLConfiguration GateTTLConfiguration `json:"gateTTLConfiguration,omitempty"`
+	// TracingConfiguration determine where the AAQ components export the traces of gated pods
+	TracingConfiguration TracingConfiguration `json:"tracingConfiguration,omitempty"`
+	// AuditLogConfiguration determine where the gate controller records why each pod was released or kept gated
+	AuditLogConfiguration AuditLogConfiguration `json:"auditLogConfiguration,omitempty"`
+	// CalculatorPolicies determine how each usage calculator is called and what happens to the pods it fails to evaluate.
+	// The first policy matching a calculator applies, calculators that no policy matches get the defaults
+	CalculatorPolicies []CalculatorPolicy `json:"calculatorPolicies,omitempty"`
+	// CalculatorComposition determines how the usages of the calculators matching the same pod are combined.
+	// allowed values are: Sum, FirstMatch or Max. Defaults to Sum
+	// +kubebuilder:validation:Enum=Sum;FirstMatch;Max
+	CalculatorComposition CalculatorCompositionStrategy `json:"calculatorComposition,omitempty"`
+	// UsageCacheConfiguration determine how long the usages calculators computed for a pod are reused
+	UsageCacheConfiguration UsageCacheConfiguration `json:"usageCacheConfiguration,omitempty"`
+	// RemoteEvaluators are evaluators the aaq-controller calls over the network with mutual TLS,
+	// unlike SidecarEvaluators they don't run in the aaq-controller pod
+	RemoteEvaluators []RemoteEvaluator `json:"remoteEvaluators,omitempty"`
+	// CELCalculators are usage calculators declared with CEL expressions, evaluated in the AAQ pods.
+	// Calculators that fail to compile are skipped
+	// +listType=map
+	// +listMapKey=name
+	CELCalculators []CELCalculator `json:"celCalculators,omitempty"`
+	// WasmCalculators are usage calculators compiled to WebAssembly, run in-process by the AAQ pods.
+	// Their modules are fetched when the pods start
+	WasmCalculators []WasmCalculator `json:"wasmCalculators,omitempty"`
+	// ShardingConfiguration lets all the aaq-controller replicas work, each on the namespaces of the shards it claims.
+	// Only the leader works when unset
+	ShardingConfiguration ShardingConfiguration `json:"shardingConfiguration,omitempty"`
+	// InformerConfiguration determine which objects the aaq-controller watches and what it keeps of them in memory
+	InformerConfiguration InformerConfiguration `json:"informerConfiguration,omitempty"`
+	// EventCoalescingConfiguration determine how the events of a namespace are coalesced before its gated pods and
+	// quotas are evaluated again, and how many gated pods are released at once
+	EventCoalescingConfiguration EventCoalescingConfiguration `json:"eventCoalescingConfiguration,omitempty"`
+}
+
+type WasmCalculator struct {
+	// Name of the calculator, it is named wasm/<name>
+	Name string `json:"name"`
+	// ConfigMap holds the module, exactly one of ConfigMap and Image must be set
+	ConfigMap *WasmConfigMapSource `json:"configMap,omitempty"`
+	// Image is a reference to a public OCI image or artifact holding the module, either as a
+	// application/vnd.wasm.content.layer.v1+wasm layer or as a .wasm file in its filesystem
+	Image string `json:"image,omitempty"`
+	// MemoryLimit bounds the memory of the module, defaults to 128Mi
+	MemoryLimit *resource.Quantity `json:"memoryLimit,omitempty"`
+	// Timeout bounds each evaluation of a pod, the module is stopped when it runs out. Defaults to 1s
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+type WasmConfigMapSource struct {
+	// Name of the ConfigMap, in the AAQ namespace
+	Name string `json:"name"`
+	// Key of the module in the binaryData of the ConfigMap
+	Key string `json:"key"`
+}
+
+type CELCalculator struct {
+	// Name of the calculator, it is named cel/<name>
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Match is a CEL expression returning whether the calculator evaluates the pod, which is available as pod
+	// +kubebuilder:validation:MinLength=1
+	Match string `json:"match"`
+	// Usage is a CEL expression returning the usage of the matched pod as a map of resource names to quantities.
+	// The usage the pod is counted with by default is available as defaultUsage, a map of resource names to quantities.
+	// Quantities can be written as strings or integers, or built with the Kubernetes quantity library,
+	// for example {"requests.memory": defaultUsage["requests.memory"].add(defaultUsage["requests.memory"])}
+	// +kubebuilder:validation:MinLength=1
+	Usage string `json:"usage"`
+}
+
+type RemoteEvaluator struct {
+	// Name of the evaluator, its calculator is named remote/<name>
+	Name string `json:"name"`
+	// Address is the host:port the evaluator serves on, usually the DNS name of its Service,
+	// for example my-evaluator.my-namespace.svc:9443. Defaults to the Service the operator deploys
+	// for the evaluator when Container is set
+	Address string `json:"address,omitempty"`
+	// CABundle is a PEM bundle trusted for the evaluator serving certificate, in addition to the AAQ evaluators CA.
+	// Evaluators that aren't deployed by the operator and serve their own certificate need it
+	CABundle []byte `json:"caBundle,omitempty"`
+	// Container is deployed by the operator as the evaluator Deployment, along with a Service and a serving certificate
+	// issued by the AAQ evaluators CA. When unset, the evaluator is deployed and owned by someone else
+	Container *corev1.Container `json:"container,omitempty"`
+	// Replicas of the evaluator Deployment. Defaults to 1
+	Replicas *int32 `json:"replicas,omitempty"`
 }
 
+type CalculatorFailurePolicy string
+
+type CalculatorCompositionStrategy string
+
+type CalculatorPolicy struct {
+	// Calculator is a glob matched against the calculator names, for example "sidecar/*" for all the
+	// sidecar evaluators or "built_in_usage_calculators.VirtLauncherCalculator" for the VM calculator.
+	// Sidecar evaluators are named sidecar/<container name>, remote evaluators remote/<name>
+	Calculator string `json:"calculator"`
+	// FailurePolicy is applied on pods the calculator failed to evaluate.
+	// allowed values are: FailClosed, FailOpen or Fallback. Defaults to Fallback
+	// +kubebuilder:validation:Enum=FailClosed;FailOpen;Fallback
+	FailurePolicy CalculatorFailurePolicy `json:"failurePolicy,omitempty"`
+	// Timeout of each call to a sidecar calculator. Defaults to 1m
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// Retries is the number of times a failed call is retried before the failure policy applies. Defaults to 9
+	// +kubebuilder:validation:Minimum=0
+	Retries *int32 `json:"retries,omitempty"`
+	// CircuitBreaker stops calling a calculator that keeps failing
+	CircuitBreaker CircuitBreaker `json:"circuitBreaker,omitempty"`
+	// Priority orders the calculators, the ones with a higher priority come first and win with the FirstMatch composition.
+	// Calculators with the same priority are ordered by name. Defaults to 0
+	Priority *int32 `json:"priority,omitempty"`
+	// CacheTTL overrides the TTL of the usage cache for the calculator, zero disables caching its usages.
+	// The usages of sidecar, remote, wasm and CEL calculators are only cached when it is set, since they may depend
+	// on the other pods
+	CacheTTL *metav1.Duration `json:"cacheTTL,omitempty"`
+}
+
+// UsageCacheConfiguration configures the cache of the usages calculators computed for each revision of a pod.
+// Calculators that depend on other objects, like the VM calculator on the VMI and its migrations, drop the usages
+// of the pods these objects affect as soon as they change
+type UsageCacheConfiguration struct {
+	// TTL bounds how long a usage is reused, calculators can depend on objects they don't report changes of.
+	// It doesn't apply to sidecar, remote, wasm and CEL calculators, which need a CalculatorPolicy CacheTTL to be cached.
+	// Zero disables the cache. Defaults to 10m
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+	// MaxEntries is the maximum number of usages the cache holds. Defaults to 100000
+	// +kubebuilder:validation:Minimum=1
+	MaxEntries *int32 `json:"maxEntries,omitempty"`
+}
+
+// ShardingConfiguration splits the namespaces in shards, each claimed by one aaq-controller replica through a Lease.
+// Namespaces selected by the same ApplicationAwareClusterResourceQuotas, or whose quotas share a cohort, are kept in
+// the same shard, so that a single replica accounts and gates the pods counted against a cluster quota or a cohort
+type ShardingConfiguration struct {
+	// Shards is the number of shards the namespaces are split into. Zero disables sharding
+	// +kubebuilder:validation:Minimum=0
+	Shards int32 `json:"shards,omitempty"`
+	// Replicas is the number of aaq-controller replicas, each replica claims an even part of the shards and takes over
+	// the shards of the replicas that are gone. Defaults to 2
+	// +kubebuilder:validation:Minimum=1
+	Replicas *int32 `json:"replicas,omitempty"`
+}
+
+// InformerConfiguration lets the aaq-controller keep less of the cluster in memory
+type InformerConfiguration struct {
+	// StripPodFields drops the pod fields no usage calculator requires from the pods the aaq-controller keeps in memory.
+	// The built-in calculators declare the fields they require, the fields the sidecar, remote, CEL and wasm calculators
+	// require must be listed in CalculatorPodFields. Defaults to false
+	StripPodFields bool `json:"stripPodFields,omitempty"`
+	// CalculatorPodFields lists the strippable pod fields the sidecar, remote, CEL and wasm calculators require.
+	// allowed values are: spec.volumes, spec.containers.env, spec.containers.command, spec.containers.probes
+	// and spec.containers.volumeMounts
+	CalculatorPodFields []string `json:"calculatorPodFields,omitempty"`
+	// ScopedWatches restricts the pods, ResourceQuotas and AAQJobQueueConfigs the aaq-controller keeps in memory to the
+	// namespaces that are gated or covered by an ApplicationAwareResourceQuota or an ApplicationAwareClusterResourceQuota.
+	// Each kind is still watched through a single watch, which lists them again as namespaces enter the scope.
+	// Pods left gated in a namespace that stops being gated and covered are released, no quota applies to them anymore.
+	// Defaults to false
+	ScopedWatches bool `json:"scopedWatches,omitempty"`
+}
+
+// EventCoalescingConfiguration debounces the evaluations of a namespace, so that a burst of pod or quota events
+// makes the aaq-controller evaluate the namespace once rather than once per event
+type EventCoalescingConfiguration struct {
+	// MinDelay is how long a namespace is evaluated after its last event, each event postpones the evaluation.
+	// Zero evaluates the namespace on every event. Defaults to 100ms
+	MinDelay *metav1.Duration `json:"minDelay,omitempty"`
+	// MaxDelay bounds how long the events of a namespace can postpone its evaluation since the first one of them.
+	// Defaults to 1s
+	MaxDelay *metav1.Duration `json:"maxDelay,omitempty"`
+	// ReleaseParallelism is the number of gated pods admitted by the same evaluation that are released at once.
+	// Defaults to 16
+	// +kubebuilder:validation:Minimum=1
+	ReleaseParallelism *int32 `json:"releaseParallelism,omitempty"`
+}
+
+type CircuitBreaker struct {
+	// FailureThreshold is the number of evaluations in a row the calculator can fail before it stops being called.
+	// Zero disables the circuit breaker. Defaults to 5
+	// +kubebuilder:validation:Minimum=0
+	FailureThreshold *int32 `json:"failureThreshold,omitempty"`
+	// OpenDuration is how long the calculator isn't called once the breaker opens. The calculator is then
+	// called again, and the breaker opens again on the first failure. Defaults to 30s
+	OpenDuration *metav1.Duration `json:"openDuration,omitempty"`
+}
+
+const (
+	// FailClosed keeps the pods the calculator failed to evaluate gated and marks the quotas counting them as degraded.
+	FailClosed CalculatorFailurePolicy = "FailClosed"
+	// FailOpen ignores the calculator for the pods it failed to evaluate, they are admitted without its usage.
+	FailOpen CalculatorFailurePolicy = "FailOpen"
+	// Fallback counts the pods the calculator failed to evaluate with the kubernetes pod evaluator,
+	// unless another calculator matched them.
+	Fallback CalculatorFailurePolicy = "Fallback"
+)
+
+const (
+	// SumComposition adds up the usages of all the calculators matching a pod
+	SumComposition CalculatorCompositionStrategy = "Sum"
+	// FirstMatchComposition counts a pod with the usage of the first calculator matching it, in order of priority
+	FirstMatchComposition CalculatorCompositionStrategy = "FirstMatch"
+	// MaxComposition counts each resource of a pod with the largest usage the calculators matching it report for it
+	MaxComposition CalculatorCompositionStrategy = "Max"
+)
+
+type AuditLogSink string
+
+type AuditLogConfiguration struct {
+	// Sink the audit records are written to as JSON lines.
+	// allowed values are: Stdout, File or HTTP. When unset, no audit records are written
+	// +kubebuilder:validation:Enum=Stdout;File;HTTP
+	Sink AuditLogSink `json:"sink,omitempty"`
+	// Path of the file the File sink appends the records to. Defaults to /var/log/aaq/audit.log.
+	// The directory of the file is an EmptyDir of the controller pod, the records are lost when the pod is deleted
+	// and each replica writes its own file. Use the Stdout or the HTTP sink to keep the records
+	Path string `json:"path,omitempty"`
+	// URL the HTTP sink posts the records to
+	URL string `json:"url,omitempty"`
+	// Retention is how long the File sink keeps records before rotating them out. Defaults to 24h
+	Retention *metav1.Duration `json:"retention,omitempty"`
+	// SamplingPercentage is the percentage of the decisions that are recorded. Defaults to 100
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	SamplingPercentage *int32 `json:"samplingPercentage,omitempty"`
+}
+
+const (
+	// AuditLogStdout writes the records to the standard output of the controller.
+	AuditLogStdout AuditLogSink = "Stdout"
+	// AuditLogFile appends the records to a file of the controller container, which doesn't outlive the pod.
+	AuditLogFile AuditLogSink = "File"
+	// AuditLogHTTP posts the records to an HTTP endpoint.
+	AuditLogHTTP AuditLogSink = "HTTP"
+)
+
+type TracingConfiguration struct {
+	// Endpoint is the host:port of the OTLP gRPC collector the traces are exported to.
+	// When unset, tracing is disabled
+	Endpoint string `json:"endpoint,omitempty"`
+	// Insecure disables TLS towards the collector
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+type GateExpiryAction string
+
+type GateTTLConfiguration struct {
+	// TTL is the maximum time a pod can stay gated. It can be overridden per pod with the
+	// aaq.kubevirt.io/gate-ttl annotation, which must be a positive duration. When unset, pods can stay gated forever
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+	// ExpiryAction is applied on pods that stayed gated longer than their TTL.
+	// allowed values are: Event, Delete or Fail. Defaults to Event
+	// +kubebuilder:validation:Enum=Event;Delete;Fail
+	ExpiryAction GateExpiryAction `json:"expiryAction,omitempty"`
+}
+
+const (
+	// GateExpiryEvent only emits a warning event on the expired pod, which keeps waiting for quota.
+	// The event is emitted once, the pod is marked with the GateTTLExpired condition.
+	GateExpiryEvent GateExpiryAction = "Event"
+	// GateExpiryDelete deletes the expired pod so its owner can react.
+	GateExpiryDelete GateExpiryAction = "Delete"
+	// GateExpiryFail marks the expired pod as Failed with the GateTTLExpired reason.
+	GateExpiryFail GateExpiryAction = "Fail"
+)
+
+type QueueingPolicyName string
+
+type QueueingConfiguration struct {
+	// Policy determine the order in which gated pods are evaluated against quotas.
+	// allowed values are: PriorityClass, FIFO or BestFitWithAging.
+	// When unset, gated pods are evaluated oldest first and each pod is released as soon as it fits.
+	// +kubebuilder:validation:Enum=PriorityClass;FIFO;BestFitWithAging
+	Policy QueueingPolicyName `json:"policy,omitempty"`
+	// AgingPeriod is the time a gated pod can wait before BestFitWithAging stops reordering it
+	// and evaluates it ahead of any younger pod. Defaults to 10m
+	AgingPeriod *metav1.Duration `json:"agingPeriod,omitempty"`
+}
+
+const (
+	// PriorityClass evaluates gated pods by descending priority, oldest first among pods with the same priority.
+	PriorityClass QueueingPolicyName = "PriorityClass"
+	// FIFO evaluates gated pods by creation time. A pod that doesn't fit blocks all younger pods
+	// until it is released, so large pods cannot be starved by smaller ones.
+	FIFO QueueingPolicyName = "FIFO"
+	// BestFitWithAging evaluates the largest gated pods first so quotas are packed tightly.
+	// Pods waiting longer than AgingPeriod are evaluated first in FIFO order and block all younger pods
+	// until they are released.
+	BestFitWithAging QueueingPolicyName = "BestFitWithAging"
+)
+
 type VmiCalcConfigName string
 
 type VmiCalculatorConfiguration struct {
@@ -203,6 +584,31 @@ type AAQPhase string
 // AAQStatus defines the status of the installation
 type AAQStatus struct {
 	sdkapi.Status `json:",inline"`
+	// SidecarEvaluators reports the state of the sidecar evaluators the aaq-controller is connected to
+	// +optional
+	// +listType=map
+	// +listMapKey=socket
+	SidecarEvaluators []SidecarEvaluatorStatus `json:"sidecarEvaluators,omitempty"`
+}
+
+// SidecarEvaluatorStatus is the state of a single sidecar evaluator
+type SidecarEvaluatorStatus struct {
+	// Socket is the name of the socket the sidecar serves on
+	Socket string `json:"socket"`
+	// Calculator is the name the calculator policies match the sidecar with, sidecar/<container name>
+	// +optional
+	Calculator string `json:"calculator,omitempty"`
+	// ProtocolVersion is the evaluator protocol version negotiated with the sidecar
+	// +optional
+	ProtocolVersion int32 `json:"protocolVersion,omitempty"`
+	// Healthy is false when the last health checks of the sidecar failed, its usage isn't calculated meanwhile
+	Healthy bool `json:"healthy"`
+	// LastTransitionTime is the last time the sidecar was registered or changed health
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// Message explains why the sidecar is unhealthy
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 // AAQList provides the needed parameters to do request a list of AAQ from the system
@@ -256,6 +662,9 @@ type ApplicationAwareClusterResourceQuota struct {
 // ApplicationAwareClusterResourceQuotaSpec defines the desired quota restrictions
 type ApplicationAwareClusterResourceQuotaSpec struct {
 	ocquotav1.ClusterResourceQuotaSpec `json:",inline"`
+	// Schedule holds time windows in which different hard limits are enforced
+	// +optional
+	Schedule *QuotaSchedule `json:"schedule,omitempty"`
 }
 
 // ApplicationAwareClusterResourceQuotaStatus defines the actual enforced quota and its current usage
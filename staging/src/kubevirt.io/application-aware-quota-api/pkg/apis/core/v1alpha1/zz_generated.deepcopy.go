@@ -92,6 +92,40 @@ func (in *AAQConfiguration) DeepCopyInto(out *AAQConfiguration) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	in.QueueingConfiguration.DeepCopyInto(&out.QueueingConfiguration)
+	in.GateTTLConfiguration.DeepCopyInto(&out.GateTTLConfiguration)
+	out.TracingConfiguration = in.TracingConfiguration
+	in.AuditLogConfiguration.DeepCopyInto(&out.AuditLogConfiguration)
+	if in.CalculatorPolicies != nil {
+		in, out := &in.CalculatorPolicies, &out.CalculatorPolicies
+		*out = make([]CalculatorPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.UsageCacheConfiguration.DeepCopyInto(&out.UsageCacheConfiguration)
+	if in.RemoteEvaluators != nil {
+		in, out := &in.RemoteEvaluators, &out.RemoteEvaluators
+		*out = make([]RemoteEvaluator, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CELCalculators != nil {
+		in, out := &in.CELCalculators, &out.CELCalculators
+		*out = make([]CELCalculator, len(*in))
+		copy(*out, *in)
+	}
+	if in.WasmCalculators != nil {
+		in, out := &in.WasmCalculators, &out.WasmCalculators
+		*out = make([]WasmCalculator, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.ShardingConfiguration.DeepCopyInto(&out.ShardingConfiguration)
+	in.InformerConfiguration.DeepCopyInto(&out.InformerConfiguration)
+	in.EventCoalescingConfiguration.DeepCopyInto(&out.EventCoalescingConfiguration)
 	return
 }
 
@@ -197,6 +231,13 @@ func (in *AAQJobQueueConfigStatus) DeepCopyInto(out *AAQJobQueueConfigStatus) {
 			(*out)[key] = val
 		}
 	}
+	if in.GatedPods != nil {
+		in, out := &in.GatedPods, &out.GatedPods
+		*out = make([]GatedPodStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -281,6 +322,13 @@ func (in *AAQSpec) DeepCopy() *AAQSpec {
 func (in *AAQStatus) DeepCopyInto(out *AAQStatus) {
 	*out = *in
 	in.Status.DeepCopyInto(&out.Status)
+	if in.SidecarEvaluators != nil {
+		in, out := &in.SidecarEvaluators, &out.SidecarEvaluators
+		*out = make([]SidecarEvaluatorStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -420,6 +468,11 @@ func (in *ApplicationAwareClusterResourceQuotaList) DeepCopyObject() runtime.Obj
 func (in *ApplicationAwareClusterResourceQuotaSpec) DeepCopyInto(out *ApplicationAwareClusterResourceQuotaSpec) {
 	*out = *in
 	in.ClusterResourceQuotaSpec.DeepCopyInto(&out.ClusterResourceQuotaSpec)
+	if in.Schedule != nil {
+		in, out := &in.Schedule, &out.Schedule
+		*out = new(QuotaSchedule)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -515,6 +568,25 @@ func (in *ApplicationAwareResourceQuotaList) DeepCopyObject() runtime.Object {
 func (in *ApplicationAwareResourceQuotaSpec) DeepCopyInto(out *ApplicationAwareResourceQuotaSpec) {
 	*out = *in
 	in.ResourceQuotaSpec.DeepCopyInto(&out.ResourceQuotaSpec)
+	if in.BorrowingLimit != nil {
+		in, out := &in.BorrowingLimit, &out.BorrowingLimit
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.LendingLimit != nil {
+		in, out := &in.LendingLimit, &out.LendingLimit
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.Schedule != nil {
+		in, out := &in.Schedule, &out.Schedule
+		*out = new(QuotaSchedule)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -532,6 +604,20 @@ func (in *ApplicationAwareResourceQuotaSpec) DeepCopy() *ApplicationAwareResourc
 func (in *ApplicationAwareResourceQuotaStatus) DeepCopyInto(out *ApplicationAwareResourceQuotaStatus) {
 	*out = *in
 	in.ResourceQuotaStatus.DeepCopyInto(&out.ResourceQuotaStatus)
+	if in.Borrowed != nil {
+		in, out := &in.Borrowed, &out.Borrowed
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -545,6 +631,108 @@ func (in *ApplicationAwareResourceQuotaStatus) DeepCopy() *ApplicationAwareResou
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuditLogConfiguration) DeepCopyInto(out *AuditLogConfiguration) {
+	*out = *in
+	if in.Retention != nil {
+		in, out := &in.Retention, &out.Retention
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.SamplingPercentage != nil {
+		in, out := &in.SamplingPercentage, &out.SamplingPercentage
+		*out = new(int32)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuditLogConfiguration.
+func (in *AuditLogConfiguration) DeepCopy() *AuditLogConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(AuditLogConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BlockingQuota) DeepCopyInto(out *BlockingQuota) {
+	*out = *in
+	if in.Shortfall != nil {
+		in, out := &in.Shortfall, &out.Shortfall
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BlockingQuota.
+func (in *BlockingQuota) DeepCopy() *BlockingQuota {
+	if in == nil {
+		return nil
+	}
+	out := new(BlockingQuota)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CELCalculator) DeepCopyInto(out *CELCalculator) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CELCalculator.
+func (in *CELCalculator) DeepCopy() *CELCalculator {
+	if in == nil {
+		return nil
+	}
+	out := new(CELCalculator)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CalculatorPolicy) DeepCopyInto(out *CalculatorPolicy) {
+	*out = *in
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Retries != nil {
+		in, out := &in.Retries, &out.Retries
+		*out = new(int32)
+		**out = **in
+	}
+	in.CircuitBreaker.DeepCopyInto(&out.CircuitBreaker)
+	if in.Priority != nil {
+		in, out := &in.Priority, &out.Priority
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CacheTTL != nil {
+		in, out := &in.CacheTTL, &out.CacheTTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CalculatorPolicy.
+func (in *CalculatorPolicy) DeepCopy() *CalculatorPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(CalculatorPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CertConfig) DeepCopyInto(out *CertConfig) {
 	*out = *in
@@ -571,6 +759,308 @@ func (in *CertConfig) DeepCopy() *CertConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CircuitBreaker) DeepCopyInto(out *CircuitBreaker) {
+	*out = *in
+	if in.FailureThreshold != nil {
+		in, out := &in.FailureThreshold, &out.FailureThreshold
+		*out = new(int32)
+		**out = **in
+	}
+	if in.OpenDuration != nil {
+		in, out := &in.OpenDuration, &out.OpenDuration
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CircuitBreaker.
+func (in *CircuitBreaker) DeepCopy() *CircuitBreaker {
+	if in == nil {
+		return nil
+	}
+	out := new(CircuitBreaker)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EventCoalescingConfiguration) DeepCopyInto(out *EventCoalescingConfiguration) {
+	*out = *in
+	if in.MinDelay != nil {
+		in, out := &in.MinDelay, &out.MinDelay
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MaxDelay != nil {
+		in, out := &in.MaxDelay, &out.MaxDelay
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.ReleaseParallelism != nil {
+		in, out := &in.ReleaseParallelism, &out.ReleaseParallelism
+		*out = new(int32)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EventCoalescingConfiguration.
+func (in *EventCoalescingConfiguration) DeepCopy() *EventCoalescingConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(EventCoalescingConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GateTTLConfiguration) DeepCopyInto(out *GateTTLConfiguration) {
+	*out = *in
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GateTTLConfiguration.
+func (in *GateTTLConfiguration) DeepCopy() *GateTTLConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(GateTTLConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GatedPodStatus) DeepCopyInto(out *GatedPodStatus) {
+	*out = *in
+	in.GatedTime.DeepCopyInto(&out.GatedTime)
+	if in.BlockingQuotas != nil {
+		in, out := &in.BlockingQuotas, &out.BlockingQuotas
+		*out = make([]BlockingQuota, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GatedPodStatus.
+func (in *GatedPodStatus) DeepCopy() *GatedPodStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(GatedPodStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InformerConfiguration) DeepCopyInto(out *InformerConfiguration) {
+	*out = *in
+	if in.CalculatorPodFields != nil {
+		in, out := &in.CalculatorPodFields, &out.CalculatorPodFields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InformerConfiguration.
+func (in *InformerConfiguration) DeepCopy() *InformerConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(InformerConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QueueingConfiguration) DeepCopyInto(out *QueueingConfiguration) {
+	*out = *in
+	if in.AgingPeriod != nil {
+		in, out := &in.AgingPeriod, &out.AgingPeriod
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QueueingConfiguration.
+func (in *QueueingConfiguration) DeepCopy() *QueueingConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(QueueingConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuotaSchedule) DeepCopyInto(out *QuotaSchedule) {
+	*out = *in
+	if in.Windows != nil {
+		in, out := &in.Windows, &out.Windows
+		*out = make([]QuotaScheduleWindow, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuotaSchedule.
+func (in *QuotaSchedule) DeepCopy() *QuotaSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(QuotaSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuotaScheduleWindow) DeepCopyInto(out *QuotaScheduleWindow) {
+	*out = *in
+	out.Duration = in.Duration
+	if in.Hard != nil {
+		in, out := &in.Hard, &out.Hard
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuotaScheduleWindow.
+func (in *QuotaScheduleWindow) DeepCopy() *QuotaScheduleWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(QuotaScheduleWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RemoteEvaluator) DeepCopyInto(out *RemoteEvaluator) {
+	*out = *in
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	if in.Container != nil {
+		in, out := &in.Container, &out.Container
+		*out = new(v1.Container)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RemoteEvaluator.
+func (in *RemoteEvaluator) DeepCopy() *RemoteEvaluator {
+	if in == nil {
+		return nil
+	}
+	out := new(RemoteEvaluator)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ShardingConfiguration) DeepCopyInto(out *ShardingConfiguration) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ShardingConfiguration.
+func (in *ShardingConfiguration) DeepCopy() *ShardingConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(ShardingConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SidecarEvaluatorStatus) DeepCopyInto(out *SidecarEvaluatorStatus) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SidecarEvaluatorStatus.
+func (in *SidecarEvaluatorStatus) DeepCopy() *SidecarEvaluatorStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SidecarEvaluatorStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TracingConfiguration) DeepCopyInto(out *TracingConfiguration) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TracingConfiguration.
+func (in *TracingConfiguration) DeepCopy() *TracingConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(TracingConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UsageCacheConfiguration) DeepCopyInto(out *UsageCacheConfiguration) {
+	*out = *in
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MaxEntries != nil {
+		in, out := &in.MaxEntries, &out.MaxEntries
+		*out = new(int32)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UsageCacheConfiguration.
+func (in *UsageCacheConfiguration) DeepCopy() *UsageCacheConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(UsageCacheConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VmiCalculatorConfiguration) DeepCopyInto(out *VmiCalculatorConfiguration) {
 	*out = *in
@@ -586,3 +1076,50 @@ func (in *VmiCalculatorConfiguration) DeepCopy() *VmiCalculatorConfiguration {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WasmCalculator) DeepCopyInto(out *WasmCalculator) {
+	*out = *in
+	if in.ConfigMap != nil {
+		in, out := &in.ConfigMap, &out.ConfigMap
+		*out = new(WasmConfigMapSource)
+		**out = **in
+	}
+	if in.MemoryLimit != nil {
+		in, out := &in.MemoryLimit, &out.MemoryLimit
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WasmCalculator.
+func (in *WasmCalculator) DeepCopy() *WasmCalculator {
+	if in == nil {
+		return nil
+	}
+	out := new(WasmCalculator)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WasmConfigMapSource) DeepCopyInto(out *WasmConfigMapSource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WasmConfigMapSource.
+func (in *WasmConfigMapSource) DeepCopy() *WasmConfigMapSource {
+	if in == nil {
+		return nil
+	}
+	out := new(WasmConfigMapSource)
+	in.DeepCopyInto(out)
+	return out
+}
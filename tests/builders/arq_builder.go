@@ -46,6 +46,39 @@ func (qb *ArqBuilder) WithScopes(scopes []v1.ResourceQuotaScope) *ArqBuilder {
 	return qb
 }
 
+// WithCohort sets the cohort for the ApplicationAwareResourceQuota.
+func (qb *ArqBuilder) WithCohort(cohort string) *ArqBuilder {
+	qb.arq.Spec.Cohort = cohort
+	return qb
+}
+
+// WithBorrowingLimit sets the borrowing limit of a resource for the ApplicationAwareResourceQuota.
+func (qb *ArqBuilder) WithBorrowingLimit(resourceName v1.ResourceName, val resource.Quantity) *ArqBuilder {
+	if qb.arq.Spec.BorrowingLimit == nil {
+		qb.arq.Spec.BorrowingLimit = make(v1.ResourceList)
+	}
+	qb.arq.Spec.BorrowingLimit[resourceName] = val
+	return qb
+}
+
+// WithLendingLimit sets the lending limit of a resource for the ApplicationAwareResourceQuota.
+func (qb *ArqBuilder) WithLendingLimit(resourceName v1.ResourceName, val resource.Quantity) *ArqBuilder {
+	if qb.arq.Spec.LendingLimit == nil {
+		qb.arq.Spec.LendingLimit = make(v1.ResourceList)
+	}
+	qb.arq.Spec.LendingLimit[resourceName] = val
+	return qb
+}
+
+// WithStatusUsed sets the used status of a resource for the ApplicationAwareResourceQuota.
+func (qb *ArqBuilder) WithStatusUsed(resourceName v1.ResourceName, val resource.Quantity) *ArqBuilder {
+	if qb.arq.Status.Used == nil {
+		qb.arq.Status.Used = make(v1.ResourceList)
+	}
+	qb.arq.Status.Used[resourceName] = val
+	return qb
+}
+
 // WithName sets the name for the ApplicationAwareResourceQuota.
 func (qb *ArqBuilder) WithSyncStatusHardEmptyStatusUsed() *ArqBuilder {
 	if qb.arq.Spec.Hard == nil {
@@ -1879,7 +1879,7 @@ func newTestApplicationAwareResourceQuotaWithScope(name string, scope v1.Resourc
 func newTestResourceQuotaWithScopeForPriorityClass(name string, hard v1.ResourceList, op v1.ScopeSelectorOperator, values []string) *v1alpha1.ApplicationAwareResourceQuota {
 	return &v1alpha1.ApplicationAwareResourceQuota{
 		ObjectMeta: metav1.ObjectMeta{Name: name},
-		Spec: v1alpha1.ApplicationAwareResourceQuotaSpec{v1.ResourceQuotaSpec{Hard: hard,
+		Spec: v1alpha1.ApplicationAwareResourceQuotaSpec{ResourceQuotaSpec: v1.ResourceQuotaSpec{Hard: hard,
 			ScopeSelector: &v1.ScopeSelector{
 				MatchExpressions: []v1.ScopedResourceSelectorRequirement{
 					{